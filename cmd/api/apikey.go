@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/viper"
+
+	"sonet/internal/adapters"
+	"sonet/internal/auth"
+)
+
+const apiKeyUsage = "usage: sonet apikey create --name NAME [--scopes SCOPE,...] [--rate-limit N] [--tenant ID]" +
+	" | list [--tenant ID] | revoke [--tenant ID] KEY_ID"
+
+// runAPIKey runs the apikey subcommand against the configured database
+func runAPIKey(args []string) error {
+	if len(args) == 0 {
+		return errors.New(apiKeyUsage)
+	}
+	if viper.GetString("DB_ADAPTER") == "memory" {
+		return errors.New("the memory adapter does not keep API keys between runs")
+	}
+
+	flags := flag.NewFlagSet("apikey "+args[0], flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	tenantID := flags.String("tenant", adapters.DefaultTenant, "tenant of the key")
+	name := flags.String("name", "", "name of the key")
+	scopes := flags.String("scopes", "", "comma-separated scopes")
+	rateLimit := flags.Int("rate-limit", 0, "requests per RATE_LIMIT_DURATION")
+	if err := flags.Parse(args[1:]); err != nil {
+		return fmt.Errorf("%v\n%s", err, apiKeyUsage)
+	}
+
+	db, err := adapters.NewDatabaseAdapter()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := adapters.WithTenant(context.Background(), *tenantID)
+
+	switch args[0] {
+	case "create":
+		if *name == "" {
+			return errors.New(apiKeyUsage)
+		}
+		var scopeList []string
+		if *scopes != "" {
+			for _, scope := range strings.Split(*scopes, ",") {
+				scopeList = append(scopeList, strings.TrimSpace(scope))
+			}
+		}
+
+		key, apiKey, err := auth.NewAPIKey(*name, scopeList, *rateLimit)
+		if err != nil {
+			return err
+		}
+		if err := db.CreateAPIKey(ctx, apiKey); err != nil {
+			return err
+		}
+
+		fmt.Printf("Created API key %s\n", apiKey.ID)
+		fmt.Printf("Key: %s\n", key)
+		fmt.Println("Store the key now, it cannot be shown again")
+		return nil
+
+	case "list":
+		keys, err := db.ListAPIKeys(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tRATE LIMIT\tCREATED AT\tREVOKED AT")
+		for _, key := range keys {
+			rateLimit := "default"
+			if key.RateLimit > 0 {
+				rateLimit = fmt.Sprint(key.RateLimit)
+			}
+			revokedAt := "-"
+			if key.RevokedAt != nil {
+				revokedAt = key.RevokedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, key.Prefix,
+				strings.Join(key.Scopes, ","), rateLimit, key.CreatedAt.Format("2006-01-02 15:04:05 MST"), revokedAt)
+		}
+		return w.Flush()
+
+	case "revoke":
+		if flags.NArg() != 1 {
+			return errors.New(apiKeyUsage)
+		}
+		if err := db.RevokeAPIKey(ctx, flags.Arg(0)); err != nil {
+			return err
+		}
+
+		fmt.Printf("Revoked API key %s\n", flags.Arg(0))
+		return nil
+
+	default:
+		return errors.New(apiKeyUsage)
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/viper"
+
+	"sonet/internal/adapters"
+)
+
+const countersUsage = "usage: sonet counters repair"
+
+// runCounters runs the counters subcommand against the configured database
+func runCounters(args []string) error {
+	if len(args) != 1 || args[0] != "repair" {
+		return errors.New(countersUsage)
+	}
+	if viper.GetString("DB_ADAPTER") == "memory" {
+		return errors.New("the memory adapter does not keep counters between runs")
+	}
+
+	db, err := adapters.NewDatabaseAdapter()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.RepairCounters(context.Background()); err != nil {
+		return err
+	}
+
+	fmt.Println("Recomputed the comment, reply and reaction counts of every tenant")
+	return nil
+}
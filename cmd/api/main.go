@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -15,7 +16,9 @@ import (
 
 	"sonet/internal/adapters"
 	"sonet/internal/api"
+	"sonet/internal/auth"
 	"sonet/internal/config"
+	"sonet/internal/hooks"
 )
 
 func main() {
@@ -24,6 +27,54 @@ func main() {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Subcommands run against the configured database and exit
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		if err := runAPIKey(os.Args[2:]); err != nil {
+			log.Fatalf("API key command failed: %v", err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "counters" {
+		if err := runCounters(os.Args[2:]); err != nil {
+			log.Fatalf("Counters command failed: %v", err)
+		}
+		return
+	}
+
+	// Initialize the database adapter
+	dbAdapter, err := adapters.NewDatabaseAdapter()
+	if err != nil {
+		log.Printf("Failed to initialize database adapter: %v", err)
+		log.Printf("Check your DB_ADAPTER and DB_CONNECTION_STRING configuration")
+		log.Fatalf("Exiting due to database initialization failure")
+	}
+
+	// Initialize authentication. API keys are accepted in every mode.
+	authenticator, err := auth.New()
+	if err != nil {
+		log.Fatalf("Failed to initialize authentication: %v", err)
+	}
+	authenticator = auth.Chain{auth.APIKeys{Store: dbAdapter}, authenticator}
+
+	// Check the reaction configuration before serving
+	rules, err := api.LoadReactionRules()
+	if err != nil {
+		log.Fatalf("Invalid reaction configuration: %v", err)
+	}
+
+	// Deliver hook events from the outbox until shutdown
+	dispatchCtx, stopDispatch := context.WithCancel(context.Background())
+	defer stopDispatch()
+	if viper.GetBool("HOOKS_ENABLED") {
+		go hooks.NewDispatcher(dbAdapter).Run(dispatchCtx)
+	}
+
 	// Initialize the app
 	app := fiber.New(fiber.Config{
 		AppName:      "Sonet API",
@@ -34,18 +85,13 @@ func main() {
 	app.Use(logger.New())
 	app.Use(recover.New())
 	app.Use(cors.New())
+	app.Use(auth.Middleware(authenticator))
+	app.Use(api.TenantMiddleware())
 	app.Use(api.RateLimiterMiddleware())
-
-	// Initialize the database adapter
-	dbAdapter, err := adapters.NewDatabaseAdapter()
-	if err != nil {
-		log.Printf("Failed to initialize database adapter: %v", err)
-		log.Printf("Check your DB_ADAPTER and DB_CONNECTION_STRING configuration")
-		log.Fatalf("Exiting due to database initialization failure")
-	}
+	app.Use(api.QueryTimeoutMiddleware())
 
 	// Initialize API routes
-	api.SetupRoutes(app, dbAdapter)
+	api.SetupRoutes(app, dbAdapter, rules)
 
 	// Start the server
 	port := viper.GetString("PORT")
@@ -60,6 +106,7 @@ func main() {
 	go func() {
 		<-c
 		fmt.Println("Gracefully shutting down...")
+		stopDispatch()
 		_ = app.Shutdown()
 	}()
 
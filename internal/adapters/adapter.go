@@ -1,45 +1,135 @@
 package adapters
 
 import (
+	"context"
 	"fmt"
+	"time"
 
 	"sonet/internal/models"
 
 	"github.com/spf13/viper"
 )
 
-// DatabaseAdapter is the interface that all database adapters must implement
+// DatabaseAdapter is the interface that all database adapters must implement.
+// Every method except Close takes the request context so that queries can be
+// cancelled and given deadlines.
 type DatabaseAdapter interface {
 	// Posts
-	CreatePost(post *models.Post) error
-	GetPostByID(id string) (*models.Post, error)
-	ListPosts(userID string, limit, offset int) ([]*models.Post, error)
-	SearchPosts(query string, limit, offset int) ([]*models.Post, error)
-	UpdatePost(post *models.Post) error
-	DeletePost(id string) error
+	CreatePost(ctx context.Context, post *models.Post) error
+	GetPostByID(ctx context.Context, id string) (*models.Post, error)
+	ListPosts(ctx context.Context, userID string, p Pagination) ([]*models.Post, error)
+	CountPosts(ctx context.Context, userID string) (int64, error)
+	SearchPosts(ctx context.Context, q SearchQuery, p Pagination) ([]*models.Post, error)
+	CountSearchPosts(ctx context.Context, q SearchQuery) (int64, error)
+	UpdatePost(ctx context.Context, post *models.Post) error
+	DeletePost(ctx context.Context, id string) error
 
 	// Location-based queries
-	ListPostsByCity(city string, limit, offset int) ([]*models.Post, error)
-	FindNearbyPosts(lat, lng float64, radiusKm float64, limit, offset int) ([]*models.Post, error)
+	ListPostsByCity(ctx context.Context, city string, p Pagination) ([]*models.Post, error)
+	CountPostsByCity(ctx context.Context, city string) (int64, error)
+	FindNearbyPosts(ctx context.Context, lat, lng float64, radiusKm float64, limit, offset int) ([]*models.Post, error)
+	CountNearbyPosts(ctx context.Context, lat, lng float64, radiusKm float64) (int64, error)
 
 	// Comments
-	CreateComment(comment *models.Comment) error
-	GetCommentByID(id string) (*models.Comment, error)
-	ListComments(postID string, limit, offset int) ([]*models.Comment, error)
-	UpdateComment(comment *models.Comment) error
-	DeleteComment(id string) error
-
-	// Reactions
-	CreateReaction(reaction *models.Reaction) error
-	GetReaction(userID, targetID, targetType, reactionType string) (*models.Reaction, error)
-	ListReactions(targetID, targetType string) ([]*models.Reaction, error)
-	DeleteReaction(id string) error
+	CreateComment(ctx context.Context, comment *models.Comment) error
+	GetCommentByID(ctx context.Context, id string) (*models.Comment, error)
+	ListComments(ctx context.Context, postID string, p Pagination) ([]*models.Comment, error)
+	CountComments(ctx context.Context, postID string) (int64, error)
+	UpdateComment(ctx context.Context, comment *models.Comment) error
+	DeleteComment(ctx context.Context, id string) error
+
+	// Reactions. AddReaction and RemoveReaction rely on idx_reactions_unique
+	// to add and remove a user's reaction idempotently: AddReaction reports
+	// whether the reaction was created, or loads the existing one into
+	// reaction, and RemoveReaction returns the removed reaction or
+	// gorm.ErrRecordNotFound. ReplaceReaction is AddReaction for exclusive
+	// reactions: in the same transaction, it removes the user's reactions of
+	// other types to the target, and returns them.
+	CreateReaction(ctx context.Context, reaction *models.Reaction) error
+	AddReaction(ctx context.Context, reaction *models.Reaction) (bool, error)
+	ReplaceReaction(ctx context.Context, reaction *models.Reaction) (bool, []*models.Reaction, error)
+	RemoveReaction(ctx context.Context, userID, targetID, targetType, reactionType string) (*models.Reaction, error)
+	GetReaction(ctx context.Context, userID, targetID, targetType, reactionType string) (*models.Reaction, error)
+	GetReactionByID(ctx context.Context, id string) (*models.Reaction, error)
+	ListReactions(ctx context.Context, targetID, targetType string) ([]*models.Reaction, error)
+	DeleteReaction(ctx context.Context, id string) error
+
+	// SummarizeReactions aggregates the reactions to each of the targets, with
+	// up to recent of the newest reactors of each type and the types userID
+	// reacted with. Every target has a summary, empty if it has no reactions.
+	SummarizeReactions(ctx context.Context, targetType string, targetIDs []string, userID string, recent int) (map[string]*models.ReactionSummary, error)
+
+	// RepairCounters recomputes the comment_count of posts, the reply_count
+	// of comments and the reaction_counts of both, in every tenant, from the
+	// comments and reactions. The counters are otherwise maintained in the
+	// transactions that create and delete comments and reactions.
+	RepairCounters(ctx context.Context) error
+
+	// Custom reaction types, by name
+	CreateReactionType(ctx context.Context, reactionType *models.ReactionType) error
+	GetReactionType(ctx context.Context, name string) (*models.ReactionType, error)
+	ListReactionTypes(ctx context.Context) ([]*models.ReactionType, error)
+	DeleteReactionType(ctx context.Context, name string) error
 
 	// Attachments
-	CreateAttachment(attachment *models.Attachment) error
-	GetAttachmentsForPost(postID string) ([]*models.Attachment, error)
-	GetAttachmentForComment(commentID string) (*models.Attachment, error)
-	DeleteAttachment(id string) error
+	CreateAttachment(ctx context.Context, attachment *models.Attachment) error
+	GetAttachmentsForPost(ctx context.Context, postID string) ([]*models.Attachment, error)
+	GetAttachmentForComment(ctx context.Context, commentID string) (*models.Attachment, error)
+	DeleteAttachment(ctx context.Context, id string) error
+
+	// Moderation log, newest first
+	CreateModerationAction(ctx context.Context, action *models.ModerationAction) error
+	ListModerationActions(ctx context.Context, p Pagination) ([]*models.ModerationAction, error)
+
+	// API keys. GetAPIKeyByPrefix finds keys of every tenant, since a key
+	// names its tenant; the other methods only see the context's tenant.
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]*models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) error
+
+	// Outbox of hook events, see hooks.Dispatcher. EnqueueEvent writes an
+	// event of the context's tenant, within the transaction of its adapter;
+	// ClaimEvents, CompleteEvent, ReleaseEvent, FailEvent, DeadLetterEvent,
+	// DeleteDeliveredEvents and DeleteDeadLetteredEvents see the events of every tenant. ClaimEvents
+	// leases the events that are due, counting an attempt, and the events
+	// are due again when their lease expires unless CompleteEvent marks
+	// them delivered first. ReleaseEvent makes a claimed event due now,
+	// giving back the attempt of its claim. FailEvent makes an event due at
+	// retryAt, and DeadLetterEvent stops claiming it until ReplayEvent makes
+	// it due again.
+	EnqueueEvent(ctx context.Context, event *models.OutboxEvent) error
+	ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error)
+	CompleteEvent(ctx context.Context, id string) error
+	ReleaseEvent(ctx context.Context, id string) error
+	FailEvent(ctx context.Context, id, lastError string, retryAt time.Time) error
+	DeadLetterEvent(ctx context.Context, id, lastError string) error
+	DeleteDeliveredEvents(ctx context.Context, before time.Time) (int64, error)
+	DeleteDeadLetteredEvents(ctx context.Context, before time.Time) (int64, error)
+	GetEvent(ctx context.Context, id string) (*models.OutboxEvent, error)
+	ListEvents(ctx context.Context, since, until time.Time, limit int) ([]*models.OutboxEvent, error) // Oldest first, without their copies for subscriptions
+	ListDeadLetteredEvents(ctx context.Context, p Pagination) ([]*models.OutboxEvent, error)          // Newest first
+	ReplayEvent(ctx context.Context, id string) (*models.OutboxEvent, error)
+
+	// Webhook subscriptions of the context's tenant, and the log of their
+	// deliveries. UpdateWebhookSubscription leaves the delivery stats alone,
+	// which RecordWebhookDelivery updates as it stores a delivery, counting a
+	// failure if it has an error. DeleteWebhookDeliveries deletes the
+	// deliveries of every tenant.
+	CreateWebhookSubscription(ctx context.Context, subscription *models.WebhookSubscription) error
+	GetWebhookSubscription(ctx context.Context, id string) (*models.WebhookSubscription, error)
+	ListWebhookSubscriptions(ctx context.Context) ([]*models.WebhookSubscription, error) // Oldest first
+	UpdateWebhookSubscription(ctx context.Context, subscription *models.WebhookSubscription) error
+	DeleteWebhookSubscription(ctx context.Context, id string) error
+	RecordWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	ListWebhookDeliveries(ctx context.Context, q DeliveryQuery, p Pagination) ([]*models.WebhookDelivery, error) // Newest first
+	DeleteWebhookDeliveries(ctx context.Context, before time.Time) (int64, error)
+
+	// Transaction runs fn with an adapter whose writes are made in a single
+	// transaction, committed if fn returns nil and rolled back otherwise.
+	// The memory adapter cannot roll back, and makes fn's writes as they
+	// come.
+	Transaction(ctx context.Context, fn func(tx DatabaseAdapter) error) error
 
 	// Utilities
 	Close() error
@@ -54,6 +144,8 @@ func NewDatabaseAdapter() (DatabaseAdapter, error) {
 		return newPostgresAdapter()
 	case "sqlite":
 		return newSQLiteAdapter()
+	case "memory":
+		return newMemoryAdapter()
 	case "firestore":
 		return nil, fmt.Errorf("firestore adapter not implemented yet")
 	case "supabase":
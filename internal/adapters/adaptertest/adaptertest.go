@@ -0,0 +1,1813 @@
+// Package adaptertest provides a conformance suite that every
+// adapters.DatabaseAdapter implementation is expected to pass.
+package adaptertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"sonet/internal/adapters"
+	"sonet/internal/models"
+)
+
+// Factory returns a new, empty adapter. It is called once per subtest and is
+// responsible for registering any cleanup with t.Cleanup.
+type Factory func(t *testing.T) adapters.DatabaseAdapter
+
+// baseTime is the creation time of the oldest fixture; later fixtures are
+// spaced one minute apart so that ordering is deterministic on every backend
+var baseTime = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// Run exercises every DatabaseAdapter method against adapters built by newAdapter
+func Run(t *testing.T, newAdapter Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, db adapters.DatabaseAdapter)
+	}{
+		{"PostCRUD", testPostCRUD},
+		{"ListPostsOrderingAndPagination", testListPostsOrderingAndPagination},
+		{"DeletePostCascades", testDeletePostCascades},
+		{"CommentCRUD", testCommentCRUD},
+		{"ListCommentsOrderingAndPagination", testListCommentsOrderingAndPagination},
+		{"DeleteCommentCascades", testDeleteCommentCascades},
+		{"Reactions", testReactions},
+		{"ReactionUniqueConstraint", testReactionUniqueConstraint},
+		{"AddRemoveReaction", testAddRemoveReaction},
+		{"SummarizeReactions", testSummarizeReactions},
+		{"ReplaceReaction", testReplaceReaction},
+		{"ReactionTypes", testReactionTypes},
+		{"EngagementCounters", testEngagementCounters},
+		{"Attachments", testAttachments},
+		{"SearchPosts", testSearchPosts},
+		{"SearchQuerySyntax", testSearchQuerySyntax},
+		{"SearchFilters", testSearchFilters},
+		{"ListPostsByCity", testListPostsByCity},
+		{"FindNearbyPosts", testFindNearbyPosts},
+		{"PostQueriesLoadAttachments", testPostQueriesLoadAttachments},
+		{"ListCommentsLoadsAttachments", testListCommentsLoadsAttachments},
+		{"PostCursorPagination", testPostCursorPagination},
+		{"CommentCursorPagination", testCommentCursorPagination},
+		{"Counts", testCounts},
+		{"TenantIsolation", testTenantIsolation},
+		{"HiddenContent", testHiddenContent},
+		{"ModerationActions", testModerationActions},
+		{"APIKeys", testAPIKeys},
+		{"Outbox", testOutbox},
+		{"DeadLetteredEvents", testDeadLetteredEvents},
+		{"WebhookSubscriptions", testWebhookSubscriptions},
+		{"WebhookDeliveries", testWebhookDeliveries},
+		{"ListEvents", testListEvents},
+		{"Transaction", testTransaction},
+		{"CanceledContext", testCanceledContext},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newAdapter(t))
+		})
+	}
+}
+
+// newPost creates a post created n minutes after baseTime
+func newPost(t *testing.T, db adapters.DatabaseAdapter, n int, post models.Post) *models.Post {
+	t.Helper()
+	if post.UserID == "" {
+		post.UserID = "user-1"
+	}
+	if post.Content == "" {
+		post.Content = "post content"
+	}
+	post.CreatedAt = baseTime.Add(time.Duration(n) * time.Minute)
+	require.NoError(t, db.CreatePost(context.Background(), &post))
+	require.NotEmpty(t, post.ID)
+	return &post
+}
+
+// newComment creates a comment on postID created n minutes after baseTime
+func newComment(t *testing.T, db adapters.DatabaseAdapter, n int, postID string, parentID *string) *models.Comment {
+	t.Helper()
+	comment := &models.Comment{
+		PostID:    postID,
+		UserID:    "user-2",
+		Content:   "comment content",
+		ParentID:  parentID,
+		CreatedAt: baseTime.Add(time.Duration(n) * time.Minute),
+	}
+	require.NoError(t, db.CreateComment(context.Background(), comment))
+	require.NotEmpty(t, comment.ID)
+	return comment
+}
+
+// newReaction creates a reaction by userID on a target
+func newReaction(t *testing.T, db adapters.DatabaseAdapter, userID, targetID, targetType, reactionType string) *models.Reaction {
+	t.Helper()
+	reaction := &models.Reaction{
+		UserID:     userID,
+		TargetID:   targetID,
+		TargetType: targetType,
+		Type:       reactionType,
+	}
+	require.NoError(t, db.CreateReaction(context.Background(), reaction))
+	require.NotEmpty(t, reaction.ID)
+	return reaction
+}
+
+// newPostAttachment creates an image attachment on a post
+func newPostAttachment(t *testing.T, db adapters.DatabaseAdapter, postID, url string) *models.Attachment {
+	t.Helper()
+	attachment := &models.Attachment{
+		URL:      url,
+		Type:     models.AttachmentTypeImage,
+		PostID:   &postID,
+		Metadata: models.JSON{},
+	}
+	require.NoError(t, db.CreateAttachment(context.Background(), attachment))
+	require.NotEmpty(t, attachment.ID)
+	return attachment
+}
+
+// newCommentAttachment creates a file attachment on a comment
+func newCommentAttachment(t *testing.T, db adapters.DatabaseAdapter, commentID, url string) *models.Attachment {
+	t.Helper()
+	attachment := &models.Attachment{
+		URL:       url,
+		Type:      models.AttachmentTypeFile,
+		CommentID: &commentID,
+		Metadata:  models.JSON{},
+	}
+	require.NoError(t, db.CreateAttachment(context.Background(), attachment))
+	require.NotEmpty(t, attachment.ID)
+	return attachment
+}
+
+// postIDs returns the IDs of posts in order
+func postIDs(posts []*models.Post) []string {
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	return ids
+}
+
+// commentIDs returns the IDs of comments in order
+func commentIDs(comments []*models.Comment) []string {
+	ids := make([]string, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+	return ids
+}
+
+// sortedPostIDs returns the IDs of posts sorted, for order-independent comparisons
+func sortedPostIDs(posts []*models.Post) []string {
+	ids := postIDs(posts)
+	sort.Strings(ids)
+	return ids
+}
+
+func sortedIDs(ids ...string) []string {
+	sort.Strings(ids)
+	return ids
+}
+
+func assertNotFound(t *testing.T, err error) {
+	t.Helper()
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound), "expected gorm.ErrRecordNotFound, got %v", err)
+}
+
+func testPostCRUD(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	created := newPost(t, db, 0, models.Post{
+		Content:   "hello world",
+		Language:  "en",
+		City:      "Oakland",
+		Latitude:  37.8044,
+		Longitude: -122.2712,
+		Metadata:  models.JSON{"tag": "greeting"},
+	})
+
+	found, err := db.GetPostByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, found.ID)
+	assert.Equal(t, "user-1", found.UserID)
+	assert.Equal(t, "hello world", found.Content)
+	assert.Equal(t, "en", found.Language)
+	assert.Equal(t, "Oakland", found.City)
+	assert.InDelta(t, 37.8044, found.Latitude, 1e-9)
+	assert.InDelta(t, -122.2712, found.Longitude, 1e-9)
+	assert.Equal(t, "greeting", found.Metadata["tag"])
+	assert.True(t, created.CreatedAt.Equal(found.CreatedAt))
+	assert.Empty(t, found.Attachments)
+
+	found.Content = "updated"
+	found.Language = "pt-BR"
+	found.City = "Berkeley"
+	require.NoError(t, db.UpdatePost(ctx, found))
+
+	updated, err := db.GetPostByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "updated", updated.Content)
+	assert.Equal(t, "pt-BR", updated.Language)
+	assert.Equal(t, "Berkeley", updated.City)
+	assert.True(t, created.CreatedAt.Equal(updated.CreatedAt))
+	assert.False(t, updated.UpdatedAt.Before(created.UpdatedAt))
+
+	require.NoError(t, db.DeletePost(ctx, created.ID))
+	_, err = db.GetPostByID(ctx, created.ID)
+	assertNotFound(t, err)
+
+	_, err = db.GetPostByID(ctx, "missing")
+	assertNotFound(t, err)
+}
+
+func testListPostsOrderingAndPagination(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	p1 := newPost(t, db, 1, models.Post{UserID: "alice"})
+	p2 := newPost(t, db, 2, models.Post{UserID: "bob"})
+	p3 := newPost(t, db, 3, models.Post{UserID: "alice"})
+	p4 := newPost(t, db, 4, models.Post{UserID: "bob"})
+	p5 := newPost(t, db, 5, models.Post{UserID: "alice"})
+
+	// Newest first
+	posts, err := db.ListPosts(ctx, "", adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{p5.ID, p4.ID, p3.ID, p2.ID, p1.ID}, postIDs(posts))
+
+	// Pages do not overlap
+	posts, err = db.ListPosts(ctx, "", adapters.Pagination{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{p5.ID, p4.ID}, postIDs(posts))
+
+	posts, err = db.ListPosts(ctx, "", adapters.Pagination{Limit: 2, Offset: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{p3.ID, p2.ID}, postIDs(posts))
+
+	posts, err = db.ListPosts(ctx, "", adapters.Pagination{Limit: 2, Offset: 4})
+	require.NoError(t, err)
+	assert.Equal(t, []string{p1.ID}, postIDs(posts))
+
+	posts, err = db.ListPosts(ctx, "", adapters.Pagination{Limit: 2, Offset: 10})
+	require.NoError(t, err)
+	assert.Empty(t, posts)
+
+	// Filter by user
+	posts, err = db.ListPosts(ctx, "alice", adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{p5.ID, p3.ID, p1.ID}, postIDs(posts))
+}
+
+func testDeletePostCascades(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	post := newPost(t, db, 0, models.Post{})
+	other := newPost(t, db, 1, models.Post{})
+
+	newPostAttachment(t, db, post.ID, "https://example.com/post.jpg")
+	comment := newComment(t, db, 2, post.ID, nil)
+	reply := newComment(t, db, 3, post.ID, &comment.ID)
+	newCommentAttachment(t, db, comment.ID, "https://example.com/comment.pdf")
+	newReaction(t, db, "user-3", post.ID, "post", "like")
+	newReaction(t, db, "user-3", comment.ID, "comment", "love")
+	newReaction(t, db, "user-3", reply.ID, "comment", "haha")
+
+	// Data on another post must survive
+	otherAttachment := newPostAttachment(t, db, other.ID, "https://example.com/other.jpg")
+	otherComment := newComment(t, db, 4, other.ID, nil)
+	newReaction(t, db, "user-3", other.ID, "post", "like")
+
+	require.NoError(t, db.DeletePost(ctx, post.ID))
+
+	_, err := db.GetPostByID(ctx, post.ID)
+	assertNotFound(t, err)
+	_, err = db.GetCommentByID(ctx, comment.ID)
+	assertNotFound(t, err)
+	_, err = db.GetCommentByID(ctx, reply.ID)
+	assertNotFound(t, err)
+
+	attachments, err := db.GetAttachmentsForPost(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Empty(t, attachments)
+	_, err = db.GetAttachmentForComment(ctx, comment.ID)
+	assertNotFound(t, err)
+
+	for _, target := range []struct{ id, typ string }{
+		{post.ID, "post"}, {comment.ID, "comment"}, {reply.ID, "comment"},
+	} {
+		reactions, err := db.ListReactions(ctx, target.id, target.typ)
+		require.NoError(t, err)
+		assert.Empty(t, reactions, "reactions on %s %s", target.typ, target.id)
+	}
+
+	found, err := db.GetPostByID(ctx, other.ID)
+	require.NoError(t, err)
+	require.Len(t, found.Attachments, 1)
+	assert.Equal(t, otherAttachment.ID, found.Attachments[0].ID)
+	_, err = db.GetCommentByID(ctx, otherComment.ID)
+	require.NoError(t, err)
+	reactions, err := db.ListReactions(ctx, other.ID, "post")
+	require.NoError(t, err)
+	assert.Len(t, reactions, 1)
+}
+
+func testCommentCRUD(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	post := newPost(t, db, 0, models.Post{})
+	comment := newComment(t, db, 1, post.ID, nil)
+	reply := newComment(t, db, 2, post.ID, &comment.ID)
+
+	found, err := db.GetCommentByID(ctx, comment.ID)
+	require.NoError(t, err)
+	assert.Equal(t, post.ID, found.PostID)
+	assert.Equal(t, "user-2", found.UserID)
+	assert.Equal(t, "comment content", found.Content)
+	assert.Nil(t, found.ParentID)
+	assert.Nil(t, found.Attachment)
+
+	foundReply, err := db.GetCommentByID(ctx, reply.ID)
+	require.NoError(t, err)
+	require.NotNil(t, foundReply.ParentID)
+	assert.Equal(t, comment.ID, *foundReply.ParentID)
+
+	found.Content = "edited"
+	found.Metadata = models.JSON{"edited": true}
+	require.NoError(t, db.UpdateComment(ctx, found))
+
+	updated, err := db.GetCommentByID(ctx, comment.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "edited", updated.Content)
+	assert.Equal(t, true, updated.Metadata["edited"])
+	assert.True(t, comment.CreatedAt.Equal(updated.CreatedAt))
+
+	_, err = db.GetCommentByID(ctx, "missing")
+	assertNotFound(t, err)
+}
+
+func testListCommentsOrderingAndPagination(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	post := newPost(t, db, 0, models.Post{})
+	other := newPost(t, db, 1, models.Post{})
+
+	c1 := newComment(t, db, 3, post.ID, nil)
+	c2 := newComment(t, db, 4, post.ID, nil)
+	c3 := newComment(t, db, 5, post.ID, &c1.ID)
+	newComment(t, db, 6, other.ID, nil)
+
+	// Oldest first, replies included
+	comments, err := db.ListComments(ctx, post.ID, adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{c1.ID, c2.ID, c3.ID}, commentIDs(comments))
+
+	comments, err = db.ListComments(ctx, post.ID, adapters.Pagination{Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{c1.ID, c2.ID}, commentIDs(comments))
+
+	comments, err = db.ListComments(ctx, post.ID, adapters.Pagination{Limit: 2, Offset: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{c3.ID}, commentIDs(comments))
+
+	comments, err = db.ListComments(ctx, "missing", adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, comments)
+}
+
+func testDeleteCommentCascades(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	post := newPost(t, db, 0, models.Post{})
+	comment := newComment(t, db, 1, post.ID, nil)
+	other := newComment(t, db, 2, post.ID, nil)
+
+	newCommentAttachment(t, db, comment.ID, "https://example.com/a.pdf")
+	newReaction(t, db, "user-3", comment.ID, "comment", "like")
+	otherAttachment := newCommentAttachment(t, db, other.ID, "https://example.com/b.pdf")
+	newReaction(t, db, "user-3", other.ID, "comment", "like")
+	newReaction(t, db, "user-3", post.ID, "post", "like")
+
+	require.NoError(t, db.DeleteComment(ctx, comment.ID))
+
+	_, err := db.GetCommentByID(ctx, comment.ID)
+	assertNotFound(t, err)
+	_, err = db.GetAttachmentForComment(ctx, comment.ID)
+	assertNotFound(t, err)
+	reactions, err := db.ListReactions(ctx, comment.ID, "comment")
+	require.NoError(t, err)
+	assert.Empty(t, reactions)
+
+	// The post and sibling comments are untouched
+	_, err = db.GetPostByID(ctx, post.ID)
+	require.NoError(t, err)
+	found, err := db.GetCommentByID(ctx, other.ID)
+	require.NoError(t, err)
+	require.NotNil(t, found.Attachment)
+	assert.Equal(t, otherAttachment.ID, found.Attachment.ID)
+	reactions, err = db.ListReactions(ctx, other.ID, "comment")
+	require.NoError(t, err)
+	assert.Len(t, reactions, 1)
+	reactions, err = db.ListReactions(ctx, post.ID, "post")
+	require.NoError(t, err)
+	assert.Len(t, reactions, 1)
+}
+
+func testReactions(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	post := newPost(t, db, 0, models.Post{})
+	like := newReaction(t, db, "user-3", post.ID, "post", "like")
+	love := newReaction(t, db, "user-3", post.ID, "post", "love")
+	newReaction(t, db, "user-4", post.ID, "post", "like")
+
+	// The same target ID with another target type is a different target
+	newReaction(t, db, "user-3", post.ID, "comment", "like")
+
+	found, err := db.GetReaction(ctx, "user-3", post.ID, "post", "like")
+	require.NoError(t, err)
+	assert.Equal(t, like.ID, found.ID)
+	assert.False(t, found.CreatedAt.IsZero())
+
+	_, err = db.GetReaction(ctx, "user-5", post.ID, "post", "like")
+	assertNotFound(t, err)
+
+	found, err = db.GetReactionByID(ctx, love.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "user-3", found.UserID)
+	assert.Equal(t, "love", found.Type)
+
+	_, err = db.GetReactionByID(ctx, "missing")
+	assertNotFound(t, err)
+
+	reactions, err := db.ListReactions(ctx, post.ID, "post")
+	require.NoError(t, err)
+	assert.Len(t, reactions, 3)
+
+	require.NoError(t, db.DeleteReaction(ctx, love.ID))
+	_, err = db.GetReaction(ctx, "user-3", post.ID, "post", "love")
+	assertNotFound(t, err)
+	_, err = db.GetReactionByID(ctx, love.ID)
+	assertNotFound(t, err)
+
+	reactions, err = db.ListReactions(ctx, post.ID, "post")
+	require.NoError(t, err)
+	assert.Len(t, reactions, 2)
+}
+
+func testReactionUniqueConstraint(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	post := newPost(t, db, 0, models.Post{})
+	newReaction(t, db, "user-3", post.ID, "post", "like")
+
+	err := db.CreateReaction(ctx, &models.Reaction{
+		UserID:     "user-3",
+		TargetID:   post.ID,
+		TargetType: "post",
+		Type:       "like",
+	})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, gorm.ErrDuplicatedKey), "expected gorm.ErrDuplicatedKey, got %v", err)
+
+	reactions, err := db.ListReactions(ctx, post.ID, "post")
+	require.NoError(t, err)
+	assert.Len(t, reactions, 1)
+}
+
+func testAddRemoveReaction(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+	other := adapters.WithTenant(ctx, "other")
+
+	post := newPost(t, db, 0, models.Post{})
+	added := &models.Reaction{UserID: "user-3", TargetID: post.ID, TargetType: "post", Type: "like"}
+	created, err := db.AddReaction(ctx, added)
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	// Adding it again loads the existing reaction
+	again := &models.Reaction{UserID: "user-3", TargetID: post.ID, TargetType: "post", Type: "like"}
+	created, err = db.AddReaction(ctx, again)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, added.ID, again.ID)
+	assert.False(t, again.CreatedAt.IsZero())
+
+	// The same reaction in another tenant is another reaction
+	created, err = db.AddReaction(other, &models.Reaction{UserID: "user-3", TargetID: post.ID, TargetType: "post", Type: "like"})
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	reactions, err := db.ListReactions(ctx, post.ID, "post")
+	require.NoError(t, err)
+	assert.Len(t, reactions, 1)
+
+	removed, err := db.RemoveReaction(ctx, "user-3", post.ID, "post", "like")
+	require.NoError(t, err)
+	assert.Equal(t, added.ID, removed.ID)
+	_, err = db.RemoveReaction(ctx, "user-3", post.ID, "post", "like")
+	assertNotFound(t, err)
+
+	reactions, err = db.ListReactions(ctx, post.ID, "post")
+	require.NoError(t, err)
+	assert.Empty(t, reactions)
+	reactions, err = db.ListReactions(other, post.ID, "post")
+	require.NoError(t, err)
+	assert.Len(t, reactions, 1)
+}
+
+func testSummarizeReactions(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	post := newPost(t, db, 0, models.Post{})
+	quiet := newPost(t, db, 1, models.Post{})
+	react := func(n int, userID, targetID, targetType, reactionType string) {
+		require.NoError(t, db.CreateReaction(ctx, &models.Reaction{
+			UserID:     userID,
+			TargetID:   targetID,
+			TargetType: targetType,
+			Type:       reactionType,
+			CreatedAt:  baseTime.Add(time.Duration(n) * time.Minute),
+		}))
+	}
+	react(1, "user-1", post.ID, "post", "like")
+	react(2, "user-2", post.ID, "post", "like")
+	react(3, "user-3", post.ID, "post", "like")
+	react(4, "user-3", post.ID, "post", "love")
+	react(5, "user-4", post.ID, "post", "haha")
+	react(6, "user-4", post.ID, "comment", "like")
+	require.NoError(t, db.CreateReaction(adapters.WithTenant(ctx, "other"),
+		&models.Reaction{UserID: "user-5", TargetID: post.ID, TargetType: "post", Type: "like"}))
+
+	summaries, err := db.SummarizeReactions(ctx, "post", []string{post.ID, quiet.ID}, "user-3", 2)
+	require.NoError(t, err)
+	require.Len(t, summaries, 2)
+
+	// Types are ordered by count, then by name
+	summary := summaries[post.ID]
+	assert.Equal(t, int64(5), summary.Total)
+	assert.Equal(t, []models.ReactionTypeSummary{
+		{Type: "like", Count: 3, RecentUsers: []string{"user-3", "user-2"}},
+		{Type: "haha", Count: 1, RecentUsers: []string{"user-4"}},
+		{Type: "love", Count: 1, RecentUsers: []string{"user-3"}},
+	}, summary.Types)
+	assert.Equal(t, []string{"like", "love"}, summary.Mine)
+
+	assert.Equal(t, &models.ReactionSummary{Types: []models.ReactionTypeSummary{}, Mine: []string{}}, summaries[quiet.ID])
+
+	// Counts are kept without recent reactors, or anyone to check for
+	summaries, err = db.SummarizeReactions(ctx, "post", []string{post.ID}, "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), summaries[post.ID].Total)
+	assert.Len(t, summaries[post.ID].Types, 3)
+	assert.Empty(t, summaries[post.ID].Types[0].RecentUsers)
+	assert.Empty(t, summaries[post.ID].Mine)
+
+	summaries, err = db.SummarizeReactions(ctx, "post", nil, "user-3", 2)
+	require.NoError(t, err)
+	assert.Empty(t, summaries)
+}
+
+func testReplaceReaction(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	post := newPost(t, db, 0, models.Post{})
+	like := newReaction(t, db, "user-3", post.ID, "post", "like")
+	love := newReaction(t, db, "user-3", post.ID, "post", "love")
+	newReaction(t, db, "user-4", post.ID, "post", "like")
+	newReaction(t, db, "user-3", post.ID, "comment", "like")
+
+	// Replacing removes the user's other reactions to the target only
+	haha := &models.Reaction{UserID: "user-3", TargetID: post.ID, TargetType: "post", Type: "haha"}
+	created, removed, err := db.ReplaceReaction(ctx, haha)
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.ElementsMatch(t, []string{like.ID, love.ID}, reactionIDs(removed))
+
+	reactions, err := db.ListReactions(ctx, post.ID, "post")
+	require.NoError(t, err)
+	assert.Len(t, reactions, 2)
+	_, err = db.GetReaction(ctx, "user-3", post.ID, "post", "haha")
+	require.NoError(t, err)
+	_, err = db.GetReaction(ctx, "user-3", post.ID, "comment", "like")
+	require.NoError(t, err)
+
+	// Replacing with the same type keeps the reaction
+	again := &models.Reaction{UserID: "user-3", TargetID: post.ID, TargetType: "post", Type: "haha"}
+	created, removed, err = db.ReplaceReaction(ctx, again)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Empty(t, removed)
+	assert.Equal(t, haha.ID, again.ID)
+}
+
+// Comment, reply and reaction counts follow the comments and reactions that
+// are created and deleted
+func testEngagementCounters(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	post := newPost(t, db, 0, models.Post{})
+	other := newPost(t, db, 1, models.Post{})
+	comment := newComment(t, db, 1, post.ID, nil)
+	reply := newComment(t, db, 2, post.ID, &comment.ID)
+	newComment(t, db, 3, post.ID, &comment.ID)
+	newComment(t, db, 4, other.ID, nil)
+
+	like := newReaction(t, db, "user-3", post.ID, "post", "like")
+	newReaction(t, db, "user-4", post.ID, "post", "like")
+	newReaction(t, db, "user-4", post.ID, "post", "love")
+	newReaction(t, db, "user-3", comment.ID, "comment", "haha")
+
+	_, err := db.AddReaction(ctx, &models.Reaction{UserID: "user-5", TargetID: post.ID, TargetType: "post", Type: "wow"})
+	require.NoError(t, err)
+	_, err = db.AddReaction(ctx, &models.Reaction{UserID: "user-5", TargetID: post.ID, TargetType: "post", Type: "wow"})
+	require.NoError(t, err)
+
+	assertPostCounters := func(id string, comments int64, reactions map[string]int64) {
+		t.Helper()
+		found, err := db.GetPostByID(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, comments, found.CommentCount)
+		assert.Equal(t, reactions, found.ReactionCounts)
+	}
+	assertCommentCounters := func(id string, replies int64, reactions map[string]int64) {
+		t.Helper()
+		found, err := db.GetCommentByID(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, replies, found.ReplyCount)
+		assert.Equal(t, reactions, found.ReactionCounts)
+	}
+
+	assertPostCounters(post.ID, 3, map[string]int64{"like": 2, "love": 1, "wow": 1})
+	assertPostCounters(other.ID, 1, map[string]int64{})
+	assertCommentCounters(comment.ID, 2, map[string]int64{"haha": 1})
+
+	// Lists load the counters too
+	posts, err := db.ListPosts(ctx, "", adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, posts, 2)
+	assert.Equal(t, int64(3), posts[1].CommentCount)
+	assert.Equal(t, map[string]int64{"like": 2, "love": 1, "wow": 1}, posts[1].ReactionCounts)
+	comments, err := db.ListComments(ctx, post.ID, adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, comments, 3)
+	assert.Equal(t, int64(2), comments[0].ReplyCount)
+	assert.Equal(t, map[string]int64{"haha": 1}, comments[0].ReactionCounts)
+
+	// Removing reactions and comments uncounts them, once
+	require.NoError(t, db.DeleteReaction(ctx, like.ID))
+	require.NoError(t, db.DeleteReaction(ctx, like.ID))
+	_, err = db.RemoveReaction(ctx, "user-4", post.ID, "post", "love")
+	require.NoError(t, err)
+	_, _, err = db.ReplaceReaction(ctx, &models.Reaction{UserID: "user-5", TargetID: post.ID, TargetType: "post", Type: "haha"})
+	require.NoError(t, err)
+	require.NoError(t, db.DeleteComment(ctx, reply.ID))
+	require.NoError(t, db.DeleteComment(ctx, reply.ID))
+
+	assertPostCounters(post.ID, 2, map[string]int64{"like": 1, "haha": 1})
+	assertCommentCounters(comment.ID, 1, map[string]int64{"haha": 1})
+
+	// Repairing accurate counters changes nothing
+	require.NoError(t, db.RepairCounters(ctx))
+	assertPostCounters(post.ID, 2, map[string]int64{"like": 1, "haha": 1})
+	assertCommentCounters(comment.ID, 1, map[string]int64{"haha": 1})
+
+	// Deleting the post deletes its counts along with its reactions, so they
+	// start over if its ID is ever reused
+	require.NoError(t, db.DeletePost(ctx, post.ID))
+	recreated := newPost(t, db, 5, models.Post{ID: post.ID})
+	assert.Equal(t, int64(0), recreated.CommentCount)
+	assertPostCounters(post.ID, 0, map[string]int64{})
+	assertPostCounters(other.ID, 1, map[string]int64{})
+}
+
+// reactionIDs returns the IDs of reactions
+func reactionIDs(reactions []*models.Reaction) []string {
+	ids := make([]string, len(reactions))
+	for i, reaction := range reactions {
+		ids[i] = reaction.ID
+	}
+	return ids
+}
+
+func testReactionTypes(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+	other := adapters.WithTenant(ctx, "other")
+
+	parrot := &models.ReactionType{Name: "parrot", ImageURL: "https://example.com/parrot.gif"}
+	require.NoError(t, db.CreateReactionType(ctx, parrot))
+	require.NotEmpty(t, parrot.ID)
+	require.NoError(t, db.CreateReactionType(ctx, &models.ReactionType{Name: "blob", ImageURL: "https://example.com/blob.png"}))
+
+	// Names are unique within a tenant only
+	err := db.CreateReactionType(ctx, &models.ReactionType{Name: "parrot", ImageURL: "https://example.com/other.gif"})
+	assert.True(t, errors.Is(err, gorm.ErrDuplicatedKey), "expected gorm.ErrDuplicatedKey, got %v", err)
+	require.NoError(t, db.CreateReactionType(other, &models.ReactionType{Name: "parrot", ImageURL: "https://example.com/other.gif"}))
+
+	found, err := db.GetReactionType(ctx, "parrot")
+	require.NoError(t, err)
+	assert.Equal(t, parrot.ID, found.ID)
+	assert.Equal(t, "https://example.com/parrot.gif", found.ImageURL)
+	_, err = db.GetReactionType(ctx, "missing")
+	assertNotFound(t, err)
+
+	reactionTypes, err := db.ListReactionTypes(ctx)
+	require.NoError(t, err)
+	require.Len(t, reactionTypes, 2)
+	assert.Equal(t, "blob", reactionTypes[0].Name)
+	assert.Equal(t, "parrot", reactionTypes[1].Name)
+
+	require.NoError(t, db.DeleteReactionType(ctx, "parrot"))
+	assertNotFound(t, db.DeleteReactionType(ctx, "parrot"))
+	_, err = db.GetReactionType(ctx, "parrot")
+	assertNotFound(t, err)
+	_, err = db.GetReactionType(other, "parrot")
+	require.NoError(t, err)
+}
+
+func testAttachments(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	post := newPost(t, db, 0, models.Post{})
+	comment := newComment(t, db, 1, post.ID, nil)
+
+	first := newPostAttachment(t, db, post.ID, "https://example.com/1.jpg")
+	second := newPostAttachment(t, db, post.ID, "https://example.com/2.jpg")
+	commentAttachment := newCommentAttachment(t, db, comment.ID, "https://example.com/c.pdf")
+
+	attachments, err := db.GetAttachmentsForPost(ctx, post.ID)
+	require.NoError(t, err)
+	require.Len(t, attachments, 2)
+	assert.ElementsMatch(t, []string{first.ID, second.ID}, []string{attachments[0].ID, attachments[1].ID})
+
+	found, err := db.GetAttachmentForComment(ctx, comment.ID)
+	require.NoError(t, err)
+	assert.Equal(t, commentAttachment.ID, found.ID)
+	assert.Equal(t, "https://example.com/c.pdf", found.URL)
+	assert.Equal(t, models.AttachmentTypeFile, found.Type)
+	require.NotNil(t, found.CommentID)
+	assert.Equal(t, comment.ID, *found.CommentID)
+	assert.Nil(t, found.PostID)
+
+	// Attachments are loaded with their owners
+	foundPost, err := db.GetPostByID(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Len(t, foundPost.Attachments, 2)
+	foundComment, err := db.GetCommentByID(ctx, comment.ID)
+	require.NoError(t, err)
+	require.NotNil(t, foundComment.Attachment)
+	assert.Equal(t, commentAttachment.ID, foundComment.Attachment.ID)
+
+	require.NoError(t, db.DeleteAttachment(ctx, first.ID))
+	attachments, err = db.GetAttachmentsForPost(ctx, post.ID)
+	require.NoError(t, err)
+	require.Len(t, attachments, 1)
+	assert.Equal(t, second.ID, attachments[0].ID)
+
+	_, err = db.GetAttachmentForComment(ctx, "missing")
+	assertNotFound(t, err)
+}
+
+func testSearchPosts(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	p1 := newPost(t, db, 1, models.Post{Content: "Learning Golang today"})
+	newPost(t, db, 2, models.Post{Content: "Rust is fun"})
+	p3 := newPost(t, db, 3, models.Post{Content: "golang generics are here"})
+	p4 := newPost(t, db, 4, models.Post{Content: "Why I like GOLANG"})
+
+	// Matching is case-insensitive and newest first
+	posts, err := db.SearchPosts(ctx, adapters.SearchQuery{Text: "golang"}, adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{p4.ID, p3.ID, p1.ID}, postIDs(posts))
+
+	// Results have a snippet with the matches highlighted; other queries do not
+	assert.Contains(t, posts[0].Snippet, "<mark>GOLANG</mark>")
+	assert.NotContains(t, posts[0].Snippet, "<mark>like</mark>")
+	found, err := db.GetPostByID(ctx, p4.ID)
+	require.NoError(t, err)
+	assert.Empty(t, found.Snippet)
+
+	posts, err = db.SearchPosts(ctx, adapters.SearchQuery{Text: "golang"}, adapters.Pagination{Limit: 2, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{p3.ID, p1.ID}, postIDs(posts))
+
+	posts, err = db.SearchPosts(ctx, adapters.SearchQuery{Text: "python"}, adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, posts)
+
+	// Snippets are HTML-escaped around the highlights
+	newPost(t, db, 5, models.Post{Content: `<img src=x onerror="alert(1)"> kiwi`})
+	posts, err = db.SearchPosts(ctx, adapters.SearchQuery{Text: "kiwi"}, adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Contains(t, posts[0].Snippet, "&lt;img src=x onerror=&#34;alert(1)&#34;&gt; <mark>kiwi</mark>")
+}
+
+func testSearchQuerySyntax(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	// Queries avoid words whose stems differ between backends
+	p1 := newPost(t, db, 1, models.Post{Content: "the quick brown fox"})
+	p2 := newPost(t, db, 2, models.Post{Content: "a quick red fox"})
+	p3 := newPost(t, db, 3, models.Post{Content: "slow brown dog"})
+	p4 := newPost(t, db, 4, models.Post{Content: "quickly now"})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"quick fox", []string{p2.ID, p1.ID}},
+		{"BROWN", []string{p3.ID, p1.ID}},
+		{`"brown fox"`, []string{p1.ID}},
+		{`"fox brown"`, []string{}},
+		{"quic*", []string{p4.ID, p2.ID, p1.ID}},
+		{"fox -red", []string{p1.ID}},
+		{"dog OR red", []string{p3.ID, p2.ID}},
+		{`"brown fox" OR dog`, []string{p3.ID, p1.ID}},
+		{"-fox", []string{}},
+		{"zebra", []string{}},
+		{"", []string{p4.ID, p3.ID, p2.ID, p1.ID}}, // No text criterion matches every post
+	}
+
+	for _, tt := range tests {
+		posts, err := db.SearchPosts(ctx, adapters.SearchQuery{Text: tt.query}, adapters.Pagination{Limit: 10})
+		require.NoError(t, err, tt.query)
+		assert.Equal(t, tt.want, postIDs(posts), tt.query)
+
+		count, err := db.CountSearchPosts(ctx, adapters.SearchQuery{Text: tt.query})
+		require.NoError(t, err, tt.query)
+		assert.Equal(t, int64(len(tt.want)), count, tt.query)
+
+		// Relevance ordering is adapter-defined, so compare sets
+		posts, err = db.SearchPosts(ctx, adapters.SearchQuery{Text: tt.query, Sort: adapters.SortRelevance}, adapters.Pagination{Limit: 10})
+		require.NoError(t, err, tt.query)
+		assert.Equal(t, sortedIDs(append([]string{}, tt.want...)...), sortedPostIDs(posts), tt.query)
+	}
+}
+
+func testSearchFilters(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	oakland := models.Post{City: "Oakland", Latitude: 37.8044, Longitude: -122.2712}
+	p1 := newPost(t, db, 1, models.Post{Content: "coffee downtown", City: oakland.City, Latitude: oakland.Latitude, Longitude: oakland.Longitude})
+	p2 := newPost(t, db, 2, models.Post{Content: "coffee uptown", UserID: "user-2", City: "Berkeley", Latitude: 37.8715, Longitude: -122.2730})
+	p3 := newPost(t, db, 3, models.Post{Content: "coffee in Paris", City: "Paris", Latitude: 48.8566, Longitude: 2.3522})
+	p4 := newPost(t, db, 4, models.Post{Content: "tea downtown", City: oakland.City, Latitude: oakland.Latitude, Longitude: oakland.Longitude})
+	p5 := newPost(t, db, 5, models.Post{Content: "kava in Suva", City: "Suva", Latitude: -18.1416, Longitude: 178.4419})
+	newPostAttachment(t, db, p1.ID, "https://example.com/coffee.jpg")
+	newReaction(t, db, "user-2", p1.ID, "post", "like")
+	newReaction(t, db, "user-1", p2.ID, "post", "love")
+
+	// Newer posts that match some criteria but not all must not shorten pages
+	for i := 0; i < 3; i++ {
+		newPost(t, db, 10+i, models.Post{Content: "coffee", City: "Paris", Latitude: 48.8566, Longitude: 2.3522})
+		newPost(t, db, 20+i, models.Post{Content: "tea", City: oakland.City, Latitude: oakland.Latitude, Longitude: oakland.Longitude, UserID: "user-3"})
+	}
+
+	hasAttachments, noAttachments := true, false
+	nearOakland := &adapters.GeoRadius{Lat: oakland.Latitude, Lng: oakland.Longitude, RadiusKm: 10}
+	tests := []struct {
+		name  string
+		query adapters.SearchQuery
+		want  []string
+	}{
+		{"text and city", adapters.SearchQuery{Text: "coffee", City: "Oakland"}, []string{p1.ID}},
+		{"text and radius", adapters.SearchQuery{Text: "coffee", Near: nearOakland}, []string{p2.ID, p1.ID}},
+		{"radius and user", adapters.SearchQuery{Near: nearOakland, UserID: "user-1"}, []string{p4.ID, p1.ID}},
+		{"bounding box", adapters.SearchQuery{Text: "coffee", Within: &adapters.BoundingBox{MinLat: 48, MinLng: 2, MaxLat: 49, MaxLng: 3}, Until: baseTime.Add(10 * time.Minute)}, []string{p3.ID}},
+		{"antimeridian box", adapters.SearchQuery{Within: &adapters.BoundingBox{MinLat: -20, MinLng: 170, MaxLat: -10, MaxLng: -170}}, []string{p5.ID}},
+		{"date range", adapters.SearchQuery{Since: baseTime.Add(2 * time.Minute), Until: baseTime.Add(4 * time.Minute)}, []string{p3.ID, p2.ID}},
+		{"with attachments", adapters.SearchQuery{HasAttachments: &hasAttachments}, []string{p1.ID}},
+		{"without attachments", adapters.SearchQuery{Text: "downtown OR uptown", HasAttachments: &noAttachments}, []string{p4.ID, p2.ID}},
+		{"reaction type", adapters.SearchQuery{ReactionType: "love"}, []string{p2.ID}},
+		{"nothing matches", adapters.SearchQuery{Text: "coffee", City: "Suva"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		posts, err := db.SearchPosts(ctx, tt.query, adapters.Pagination{Limit: 10})
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, tt.want, postIDs(posts), tt.name)
+
+		count, err := db.CountSearchPosts(ctx, tt.query)
+		require.NoError(t, err, tt.name)
+		assert.Equal(t, int64(len(tt.want)), count, tt.name)
+	}
+
+	// Pages hold the matching posts after skipping the ones that do not match
+	query := adapters.SearchQuery{Text: "coffee", Near: nearOakland}
+	posts, err := db.SearchPosts(ctx, query, adapters.Pagination{Limit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{p2.ID}, postIDs(posts))
+
+	after := &adapters.Cursor{CreatedAt: posts[0].CreatedAt, ID: posts[0].ID}
+	posts, err = db.SearchPosts(ctx, query, adapters.Pagination{Limit: 1, After: after})
+	require.NoError(t, err)
+	assert.Equal(t, []string{p1.ID}, postIDs(posts))
+
+	query.Sort = adapters.SortRelevance
+	posts, err = db.SearchPosts(ctx, query, adapters.Pagination{Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	assert.Len(t, posts, 1)
+}
+
+func testListPostsByCity(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	p1 := newPost(t, db, 1, models.Post{City: "Oakland"})
+	newPost(t, db, 2, models.Post{City: "Berkeley"})
+	p3 := newPost(t, db, 3, models.Post{City: "Oakland"})
+	newPost(t, db, 4, models.Post{City: "Oakland Hills"})
+
+	// Exact match, newest first
+	posts, err := db.ListPostsByCity(ctx, "Oakland", adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{p3.ID, p1.ID}, postIDs(posts))
+
+	posts, err = db.ListPostsByCity(ctx, "Oakland", adapters.Pagination{Limit: 1, Offset: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{p1.ID}, postIDs(posts))
+
+	posts, err = db.ListPostsByCity(ctx, "Paris", adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, posts)
+}
+
+func testFindNearbyPosts(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	// Distances from San Francisco City Hall (37.7793, -122.4193)
+	sf := newPost(t, db, 1, models.Post{Latitude: 37.7793, Longitude: -122.4193})      // 0 km
+	oakland := newPost(t, db, 2, models.Post{Latitude: 37.8044, Longitude: -122.2712}) // ~13.3 km
+	sanJose := newPost(t, db, 3, models.Post{Latitude: 37.3382, Longitude: -121.8863}) // ~67.6 km
+	newPost(t, db, 4, models.Post{Latitude: 34.0522, Longitude: -118.2437})            // ~559 km
+	edge := newPost(t, db, 5, models.Post{Latitude: 37.8693, Longitude: -122.4193})    // ~10.0 km north
+	outside := newPost(t, db, 6, models.Post{Latitude: 37.8713, Longitude: -122.4193}) // ~10.2 km north
+
+	// Nearest posts come first, and the newest first at the same distance
+	sfLater := newPost(t, db, 7, models.Post{Latitude: 37.7793, Longitude: -122.4193})
+	posts, err := db.FindNearbyPosts(ctx, 37.7793, -122.4193, 10.1, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{sfLater.ID, sf.ID, edge.ID}, postIDs(posts))
+
+	posts, err = db.FindNearbyPosts(ctx, 37.7793, -122.4193, 20, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{sfLater.ID, sf.ID, edge.ID, outside.ID, oakland.ID}, postIDs(posts))
+
+	posts, err = db.FindNearbyPosts(ctx, 37.7793, -122.4193, 100, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{sfLater.ID, sf.ID, edge.ID, outside.ID, oakland.ID, sanJose.ID}, postIDs(posts))
+
+	// Pages partition the result set
+	first, err := db.FindNearbyPosts(ctx, 37.7793, -122.4193, 100, 4, 0)
+	require.NoError(t, err)
+	second, err := db.FindNearbyPosts(ctx, 37.7793, -122.4193, 100, 4, 4)
+	require.NoError(t, err)
+	assert.Equal(t, []string{sfLater.ID, sf.ID, edge.ID, outside.ID}, postIDs(first))
+	assert.Equal(t, []string{oakland.ID, sanJose.ID}, postIDs(second))
+
+	// Posts without a location, at 0,0, are not near anywhere
+	newPost(t, db, 8, models.Post{Content: "nowhere"})
+	gulf := newPost(t, db, 9, models.Post{Latitude: 0.01}) // ~1.1 km north of 0,0
+	posts, err = db.FindNearbyPosts(ctx, 0, 0, 10, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{gulf.ID}, postIDs(posts))
+	count, err := db.CountNearbyPosts(ctx, 0, 0, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	posts, err = db.SearchPosts(ctx, adapters.SearchQuery{Near: &adapters.GeoRadius{Lat: 0, Lng: 0, RadiusKm: 10}}, adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{gulf.ID}, postIDs(posts))
+}
+
+func testPostQueriesLoadAttachments(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	post := newPost(t, db, 0, models.Post{
+		Content:   "attachments everywhere",
+		City:      "Oakland",
+		Latitude:  37.8044,
+		Longitude: -122.2712,
+	})
+	attachment := newPostAttachment(t, db, post.ID, "https://example.com/a.jpg")
+
+	queries := map[string]func() ([]*models.Post, error){
+		"ListPosts": func() ([]*models.Post, error) { return db.ListPosts(ctx, "", adapters.Pagination{Limit: 10}) },
+		"SearchPosts": func() ([]*models.Post, error) {
+			return db.SearchPosts(ctx, adapters.SearchQuery{Text: "attachments"}, adapters.Pagination{Limit: 10})
+		},
+		"ListPostsByCity": func() ([]*models.Post, error) {
+			return db.ListPostsByCity(ctx, "Oakland", adapters.Pagination{Limit: 10})
+		},
+		"FindNearbyPosts": func() ([]*models.Post, error) { return db.FindNearbyPosts(ctx, 37.8044, -122.2712, 1, 10, 0) },
+	}
+
+	for name, query := range queries {
+		posts, err := query()
+		require.NoError(t, err, name)
+		require.Len(t, posts, 1, name)
+		require.Len(t, posts[0].Attachments, 1, name)
+		assert.Equal(t, attachment.ID, posts[0].Attachments[0].ID, name)
+	}
+}
+
+func testListCommentsLoadsAttachments(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	post := newPost(t, db, 0, models.Post{})
+	c1 := newComment(t, db, 1, post.ID, nil)
+	c2 := newComment(t, db, 2, post.ID, nil)
+	c3 := newComment(t, db, 3, post.ID, nil)
+	a1 := newCommentAttachment(t, db, c1.ID, "https://example.com/1.pdf")
+	a3 := newCommentAttachment(t, db, c3.ID, "https://example.com/3.pdf")
+
+	comments, err := db.ListComments(ctx, post.ID, adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	require.Equal(t, []string{c1.ID, c2.ID, c3.ID}, commentIDs(comments))
+	require.NotNil(t, comments[0].Attachment)
+	assert.Equal(t, a1.ID, comments[0].Attachment.ID)
+	assert.Nil(t, comments[1].Attachment)
+	require.NotNil(t, comments[2].Attachment)
+	assert.Equal(t, a3.ID, comments[2].Attachment.ID)
+}
+
+// walkPosts follows cursors through a post query until a short page is returned
+func walkPosts(t *testing.T, limit int, query func(p adapters.Pagination) ([]*models.Post, error)) []string {
+	t.Helper()
+	var ids []string
+	p := adapters.Pagination{Limit: limit}
+	for i := 0; i < 100; i++ {
+		posts, err := query(p)
+		require.NoError(t, err)
+		ids = append(ids, postIDs(posts)...)
+		if len(posts) < limit {
+			return ids
+		}
+		last := posts[len(posts)-1]
+		p.After = &adapters.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+	t.Fatal("cursor pagination did not terminate")
+	return nil
+}
+
+func testPostCursorPagination(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	// Several posts share a creation time, so the ID must break ties
+	var posts []*models.Post
+	for i, n := range []int{1, 2, 2, 2, 3, 4, 4} {
+		posts = append(posts, newPost(t, db, n, models.Post{
+			Content: fmt.Sprintf("cursor post %d", i),
+			City:    "Oakland",
+		}))
+	}
+	sort.Slice(posts, func(i, j int) bool {
+		if !posts[i].CreatedAt.Equal(posts[j].CreatedAt) {
+			return posts[i].CreatedAt.After(posts[j].CreatedAt)
+		}
+		return posts[i].ID > posts[j].ID
+	})
+	expected := postIDs(posts)
+
+	queries := map[string]func(p adapters.Pagination) ([]*models.Post, error){
+		"ListPosts": func(p adapters.Pagination) ([]*models.Post, error) {
+			return db.ListPosts(ctx, "", p)
+		},
+		"SearchPosts": func(p adapters.Pagination) ([]*models.Post, error) {
+			return db.SearchPosts(ctx, adapters.SearchQuery{Text: "cursor"}, p)
+		},
+		"ListPostsByCity": func(p adapters.Pagination) ([]*models.Post, error) {
+			return db.ListPostsByCity(ctx, "Oakland", p)
+		},
+	}
+	for name, query := range queries {
+		for _, limit := range []int{1, 2, 3, 10} {
+			assert.Equal(t, expected, walkPosts(t, limit, query), "%s with limit %d", name, limit)
+		}
+	}
+
+	// Posts created while scrolling do not shift later pages
+	first, err := db.ListPosts(ctx, "", adapters.Pagination{Limit: 3})
+	require.NoError(t, err)
+	newPost(t, db, 10, models.Post{Content: "cursor newest"})
+	last := first[len(first)-1]
+	rest, err := db.ListPosts(ctx, "", adapters.Pagination{
+		Limit: 10,
+		After: &adapters.Cursor{CreatedAt: last.CreatedAt, ID: last.ID},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, expected, append(postIDs(first), postIDs(rest)...))
+}
+
+func testCommentCursorPagination(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	post := newPost(t, db, 0, models.Post{})
+	var comments []*models.Comment
+	for _, n := range []int{1, 1, 2, 3, 3, 3} {
+		comments = append(comments, newComment(t, db, n, post.ID, nil))
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		if !comments[i].CreatedAt.Equal(comments[j].CreatedAt) {
+			return comments[i].CreatedAt.Before(comments[j].CreatedAt)
+		}
+		return comments[i].ID < comments[j].ID
+	})
+
+	for _, limit := range []int{1, 2, 4} {
+		var ids []string
+		p := adapters.Pagination{Limit: limit}
+		for {
+			page, err := db.ListComments(ctx, post.ID, p)
+			require.NoError(t, err)
+			ids = append(ids, commentIDs(page)...)
+			if len(page) < limit {
+				break
+			}
+			last := page[len(page)-1]
+			p.After = &adapters.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+		}
+		assert.Equal(t, commentIDs(comments), ids, "limit %d", limit)
+	}
+}
+
+func testCounts(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	p1 := newPost(t, db, 1, models.Post{UserID: "alice", Content: "golang in Oakland", City: "Oakland", Latitude: 37.8044, Longitude: -122.2712})
+	newPost(t, db, 2, models.Post{UserID: "alice", Content: "rust in Oakland", City: "Oakland", Latitude: 37.8044, Longitude: -122.2712})
+	newPost(t, db, 3, models.Post{UserID: "bob", Content: "golang in LA", City: "Los Angeles", Latitude: 34.0522, Longitude: -118.2437})
+	newComment(t, db, 1, p1.ID, nil)
+	newComment(t, db, 2, p1.ID, nil)
+
+	count, err := db.CountPosts(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	count, err = db.CountPosts(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	count, err = db.CountSearchPosts(ctx, adapters.SearchQuery{Text: "golang"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	count, err = db.CountPostsByCity(ctx, "Oakland")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	count, err = db.CountNearbyPosts(ctx, 37.7793, -122.4193, 20)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	count, err = db.CountComments(ctx, p1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	count, err = db.CountComments(ctx, "missing")
+	require.NoError(t, err)
+	assert.Zero(t, count)
+}
+
+// Records of the default tenant, created by the fixtures, are invisible to
+// other tenants, which cannot change them either
+func testTenantIsolation(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+	other := adapters.WithTenant(ctx, "other")
+
+	post := newPost(t, db, 1, models.Post{Content: "golang in Oakland", City: "Oakland", Latitude: 37.8044, Longitude: -122.2712})
+	attachment := newPostAttachment(t, db, post.ID, "https://example.com/a.jpg")
+	comment := newComment(t, db, 1, post.ID, nil)
+	newCommentAttachment(t, db, comment.ID, "https://example.com/c.pdf")
+	reaction := newReaction(t, db, "user-3", post.ID, "post", "like")
+
+	// Another tenant's post, with the same user, reaction and content
+	otherPost := &models.Post{UserID: "user-1", Content: "golang in Oakland", City: "Oakland", Latitude: 37.8044, Longitude: -122.2712}
+	require.NoError(t, db.CreatePost(other, otherPost))
+	require.NoError(t, db.CreateReaction(other, &models.Reaction{UserID: "user-3", TargetID: otherPost.ID, TargetType: "post", Type: "like"}))
+
+	_, err := db.GetPostByID(other, post.ID)
+	assertNotFound(t, err)
+	_, err = db.GetPostByID(ctx, otherPost.ID)
+	assertNotFound(t, err)
+
+	page := adapters.Pagination{Limit: 10}
+	posts, err := db.ListPosts(other, "", page)
+	require.NoError(t, err)
+	assert.Equal(t, []string{otherPost.ID}, postIDs(posts))
+	posts, err = db.ListPosts(ctx, "user-1", page)
+	require.NoError(t, err)
+	assert.Equal(t, []string{post.ID}, postIDs(posts))
+	posts, err = db.SearchPosts(other, adapters.SearchQuery{Text: "golang", ReactionType: "like"}, page)
+	require.NoError(t, err)
+	assert.Equal(t, []string{otherPost.ID}, postIDs(posts))
+	posts, err = db.ListPostsByCity(other, "Oakland", page)
+	require.NoError(t, err)
+	assert.Equal(t, []string{otherPost.ID}, postIDs(posts))
+	posts, err = db.FindNearbyPosts(other, 37.7793, -122.4193, 20, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{otherPost.ID}, postIDs(posts))
+
+	count, err := db.CountPosts(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	count, err = db.CountSearchPosts(other, adapters.SearchQuery{Text: "golang"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	count, err = db.CountPostsByCity(other, "Oakland")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	count, err = db.CountNearbyPosts(other, 37.7793, -122.4193, 20)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+
+	_, err = db.GetCommentByID(other, comment.ID)
+	assertNotFound(t, err)
+	comments, err := db.ListComments(other, post.ID, page)
+	require.NoError(t, err)
+	assert.Empty(t, comments)
+	count, err = db.CountComments(other, post.ID)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	_, err = db.GetReaction(other, "user-3", post.ID, "post", "like")
+	assertNotFound(t, err)
+	_, err = db.GetReactionByID(other, reaction.ID)
+	assertNotFound(t, err)
+	reactions, err := db.ListReactions(other, post.ID, "post")
+	require.NoError(t, err)
+	assert.Empty(t, reactions)
+
+	attachments, err := db.GetAttachmentsForPost(other, post.ID)
+	require.NoError(t, err)
+	assert.Empty(t, attachments)
+	_, err = db.GetAttachmentForComment(other, comment.ID)
+	assertNotFound(t, err)
+
+	// Writes through another tenant leave the records alone
+	changed := *post
+	changed.Content = "taken over"
+	assertNotFound(t, db.UpdatePost(other, &changed))
+	changedComment := *comment
+	changedComment.Content = "taken over"
+	assertNotFound(t, db.UpdateComment(other, &changedComment))
+	require.NoError(t, db.DeleteReaction(other, reaction.ID))
+	require.NoError(t, db.DeleteAttachment(other, attachment.ID))
+	require.NoError(t, db.DeleteComment(other, comment.ID))
+	require.NoError(t, db.DeletePost(other, post.ID))
+
+	found, err := db.GetPostByID(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "golang in Oakland", found.Content)
+	assert.Len(t, found.Attachments, 1)
+	foundComment, err := db.GetCommentByID(ctx, comment.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "comment content", foundComment.Content)
+	assert.NotNil(t, foundComment.Attachment)
+	reactions, err = db.ListReactions(ctx, post.ID, "post")
+	require.NoError(t, err)
+	assert.Len(t, reactions, 1)
+
+	// Records of a tenant naming another tenant's post are not the post's
+	require.NoError(t, db.CreateReaction(ctx, &models.Reaction{UserID: "user-4", TargetID: otherPost.ID, TargetType: "post", Type: "love"}))
+	newPostAttachment(t, db, otherPost.ID, "https://example.com/b.jpg")
+	hasAttachments := true
+	posts, err = db.SearchPosts(other, adapters.SearchQuery{HasAttachments: &hasAttachments}, page)
+	require.NoError(t, err)
+	assert.Empty(t, posts)
+	posts, err = db.SearchPosts(other, adapters.SearchQuery{ReactionType: "love"}, page)
+	require.NoError(t, err)
+	assert.Empty(t, posts)
+	found, err = db.GetPostByID(other, otherPost.ID)
+	require.NoError(t, err)
+	assert.Empty(t, found.Attachments)
+
+	require.NoError(t, db.DeletePost(other, otherPost.ID))
+	reactions, err = db.ListReactions(ctx, otherPost.ID, "post")
+	require.NoError(t, err)
+	assert.Len(t, reactions, 1)
+	attachments, err = db.GetAttachmentsForPost(ctx, otherPost.ID)
+	require.NoError(t, err)
+	assert.Len(t, attachments, 1)
+}
+
+func testHiddenContent(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+	visible := newPost(t, db, 1, models.Post{Content: "golang in Oakland", City: "Oakland", Latitude: 37.8044, Longitude: -122.2712})
+	hidden := newPost(t, db, 2, models.Post{Content: "golang in Oakland", City: "Oakland", Latitude: 37.8044, Longitude: -122.2712})
+	visibleComment := newComment(t, db, 3, visible.ID, nil)
+	hiddenComment := newComment(t, db, 4, visible.ID, nil)
+
+	hiddenAt := baseTime.Add(time.Hour)
+	hidden.HiddenAt = &hiddenAt
+	require.NoError(t, db.UpdatePost(ctx, hidden))
+	hiddenComment.HiddenAt = &hiddenAt
+	require.NoError(t, db.UpdateComment(ctx, hiddenComment))
+
+	// Hidden content is fetched by ID, with the time it was hidden
+	post, err := db.GetPostByID(ctx, hidden.ID)
+	require.NoError(t, err)
+	require.NotNil(t, post.HiddenAt)
+	assert.True(t, hiddenAt.Equal(*post.HiddenAt))
+	comment, err := db.GetCommentByID(ctx, hiddenComment.ID)
+	require.NoError(t, err)
+	require.NotNil(t, comment.HiddenAt)
+
+	// but left out of lists, counts and searches
+	page := adapters.Pagination{Limit: 10}
+	posts, err := db.ListPosts(ctx, "", page)
+	require.NoError(t, err)
+	assert.Equal(t, []string{visible.ID}, postIDs(posts))
+	assert.Nil(t, posts[0].HiddenAt)
+	posts, err = db.SearchPosts(ctx, adapters.SearchQuery{Text: "golang"}, page)
+	require.NoError(t, err)
+	assert.Equal(t, []string{visible.ID}, postIDs(posts))
+	posts, err = db.ListPostsByCity(ctx, "Oakland", page)
+	require.NoError(t, err)
+	assert.Equal(t, []string{visible.ID}, postIDs(posts))
+	posts, err = db.FindNearbyPosts(ctx, 37.7793, -122.4193, 20, 10, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{visible.ID}, postIDs(posts))
+	comments, err := db.ListComments(ctx, visible.ID, page)
+	require.NoError(t, err)
+	assert.Equal(t, []string{visibleComment.ID}, commentIDs(comments))
+
+	for name, count := range map[string]func() (int64, error){
+		"posts":    func() (int64, error) { return db.CountPosts(ctx, "") },
+		"search":   func() (int64, error) { return db.CountSearchPosts(ctx, adapters.SearchQuery{Text: "golang"}) },
+		"city":     func() (int64, error) { return db.CountPostsByCity(ctx, "Oakland") },
+		"nearby":   func() (int64, error) { return db.CountNearbyPosts(ctx, 37.7793, -122.4193, 20) },
+		"comments": func() (int64, error) { return db.CountComments(ctx, visible.ID) },
+	} {
+		n, err := count()
+		require.NoError(t, err, name)
+		assert.Equal(t, int64(1), n, name)
+	}
+
+	// Unhidden content is listed again
+	post.HiddenAt = nil
+	require.NoError(t, db.UpdatePost(ctx, post))
+	count, err := db.CountPosts(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+}
+
+func testModerationActions(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+	other := adapters.WithTenant(ctx, "other")
+
+	var ids []string
+	for i, action := range []string{models.ModerationHide, models.ModerationUnhide, models.ModerationDelete} {
+		moderation := &models.ModerationAction{
+			Action:      action,
+			TargetType:  "post",
+			TargetID:    "post-1",
+			AuthorID:    "user-1",
+			ModeratorID: "moderator-1",
+			Reason:      "spam",
+			CreatedAt:   baseTime.Add(time.Duration(i) * time.Minute),
+		}
+		require.NoError(t, db.CreateModerationAction(ctx, moderation))
+		require.NotEmpty(t, moderation.ID)
+		ids = append(ids, moderation.ID)
+	}
+	require.NoError(t, db.CreateModerationAction(other, &models.ModerationAction{Action: models.ModerationDelete, TargetType: "comment", TargetID: "comment-1"}))
+
+	// Newest first, within the tenant
+	actions, err := db.ListModerationActions(ctx, adapters.Pagination{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, actions, 2)
+	assert.Equal(t, ids[2], actions[0].ID)
+	assert.Equal(t, ids[1], actions[1].ID)
+	assert.Equal(t, models.ModerationDelete, actions[0].Action)
+	assert.Equal(t, "post-1", actions[0].TargetID)
+	assert.Equal(t, "user-1", actions[0].AuthorID)
+	assert.Equal(t, "moderator-1", actions[0].ModeratorID)
+	assert.Equal(t, "spam", actions[0].Reason)
+
+	last := actions[1]
+	actions, err = db.ListModerationActions(ctx, adapters.Pagination{Limit: 2, After: &adapters.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}})
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	assert.Equal(t, ids[0], actions[0].ID)
+
+	actions, err = db.ListModerationActions(other, adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, actions, 1)
+	assert.Equal(t, "comment-1", actions[0].TargetID)
+}
+
+func testAPIKeys(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+	other := adapters.WithTenant(ctx, "other")
+
+	key := &models.APIKey{Name: "moderation bot", Prefix: "prefix-1", Hash: "hash-1", Scopes: models.StringList{"moderation", "posts:write"}, RateLimit: 10, CreatedAt: baseTime}
+	require.NoError(t, db.CreateAPIKey(ctx, key))
+	require.NotEmpty(t, key.ID)
+	otherKey := &models.APIKey{Name: "importer", Prefix: "prefix-2", Hash: "hash-2", CreatedAt: baseTime.Add(time.Minute)}
+	require.NoError(t, db.CreateAPIKey(other, otherKey))
+
+	// Prefixes are unique across tenants
+	err := db.CreateAPIKey(other, &models.APIKey{Name: "copy", Prefix: "prefix-1", Hash: "hash-3"})
+	assert.Error(t, err)
+
+	// Keys are found by prefix whatever the tenant
+	found, err := db.GetAPIKeyByPrefix(ctx, "prefix-2")
+	require.NoError(t, err)
+	assert.Equal(t, otherKey.ID, found.ID)
+	assert.Equal(t, "other", found.TenantID)
+	assert.Equal(t, "hash-2", found.Hash)
+	assert.Empty(t, found.Scopes)
+	assert.False(t, found.Revoked())
+	_, err = db.GetAPIKeyByPrefix(ctx, "unknown")
+	assertNotFound(t, err)
+
+	keys, err := db.ListAPIKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, key.ID, keys[0].ID)
+	assert.Equal(t, models.StringList{"moderation", "posts:write"}, keys[0].Scopes)
+	assert.Equal(t, 10, keys[0].RateLimit)
+
+	// Keys are only revoked within their tenant
+	assertNotFound(t, db.RevokeAPIKey(other, key.ID))
+	assertNotFound(t, db.RevokeAPIKey(ctx, "missing"))
+	require.NoError(t, db.RevokeAPIKey(ctx, key.ID))
+	found, err = db.GetAPIKeyByPrefix(ctx, "prefix-1")
+	require.NoError(t, err)
+	require.True(t, found.Revoked())
+	revokedAt := *found.RevokedAt
+
+	// Revoking again keeps the original time
+	require.NoError(t, db.RevokeAPIKey(ctx, key.ID))
+	found, err = db.GetAPIKeyByPrefix(ctx, "prefix-1")
+	require.NoError(t, err)
+	assert.True(t, revokedAt.Equal(*found.RevokedAt))
+
+	found, err = db.GetAPIKeyByPrefix(ctx, "prefix-2")
+	require.NoError(t, err)
+	assert.False(t, found.Revoked())
+}
+
+func testOutbox(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+	other := adapters.WithTenant(ctx, "other")
+
+	first := &models.OutboxEvent{Type: "post_created", Payload: `{"type":"post_created"}`}
+	require.NoError(t, db.EnqueueEvent(ctx, first))
+	require.NotEmpty(t, first.ID)
+	second := &models.OutboxEvent{Type: "post_deleted", Payload: `{"type":"post_deleted"}`}
+	require.NoError(t, db.EnqueueEvent(other, second))
+	assert.Equal(t, "other", second.TenantID)
+
+	// Events of every tenant are claimed, oldest first, up to the limit
+	claimed, err := db.ClaimEvents(ctx, 1, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, first.ID, claimed[0].ID)
+	assert.Equal(t, 1, claimed[0].Attempts)
+	assert.Equal(t, `{"type":"post_created"}`, claimed[0].Payload)
+
+	// Leased events are not claimed again until the lease expires
+	claimed, err = db.ClaimEvents(ctx, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, second.ID, claimed[0].ID)
+	assert.Equal(t, "other", claimed[0].TenantID)
+
+	// Failed events are due again at the time of their retry
+	require.NoError(t, db.FailEvent(ctx, second.ID, "webhook returned status: 500", time.Now().Add(time.Hour)))
+	claimed, err = db.ClaimEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+	require.NoError(t, db.FailEvent(ctx, second.ID, "webhook returned status: 500", time.Now()))
+	claimed, err = db.ClaimEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, 2, claimed[0].Attempts)
+	assert.Equal(t, "webhook returned status: 500", claimed[0].LastError)
+
+	// Delivered events are never claimed, and are deleted once old enough
+	require.NoError(t, db.CompleteEvent(ctx, first.ID))
+	require.NoError(t, db.CompleteEvent(ctx, second.ID))
+	deleted, err := db.DeleteDeliveredEvents(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), deleted)
+	deleted, err = db.DeleteDeliveredEvents(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+
+	third := &models.OutboxEvent{Type: "post_updated", Payload: `{}`}
+	require.NoError(t, db.EnqueueEvent(ctx, third))
+	require.NoError(t, db.CompleteEvent(ctx, third.ID))
+	claimed, err = db.ClaimEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+
+	// Released events are due at once, with the attempt of their claim back,
+	// while delivered events stay delivered
+	fourth := &models.OutboxEvent{Type: "post_updated", Payload: `{}`}
+	require.NoError(t, db.EnqueueEvent(ctx, fourth))
+	claimed, err = db.ClaimEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.NoError(t, db.ReleaseEvent(ctx, fourth.ID))
+	require.NoError(t, db.ReleaseEvent(ctx, third.ID))
+	claimed, err = db.ClaimEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, fourth.ID, claimed[0].ID)
+	assert.Equal(t, 1, claimed[0].Attempts)
+}
+
+func testDeadLetteredEvents(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+	other := adapters.WithTenant(ctx, "other")
+
+	dead := &models.OutboxEvent{Type: "post_created", Payload: `{}`}
+	require.NoError(t, db.EnqueueEvent(ctx, dead))
+	pending := &models.OutboxEvent{Type: "post_updated", Payload: `{}`}
+	require.NoError(t, db.EnqueueEvent(ctx, pending))
+	otherDead := &models.OutboxEvent{Type: "post_created", Payload: `{}`}
+	require.NoError(t, db.EnqueueEvent(other, otherDead))
+
+	claimed, err := db.ClaimEvents(ctx, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, claimed, 3)
+	require.NoError(t, db.DeadLetterEvent(ctx, dead.ID, "webhook returned status: 500"))
+	require.NoError(t, db.DeadLetterEvent(ctx, otherDead.ID, "webhook returned status: 500"))
+
+	// Dead-lettered events are no longer claimed
+	claimed, err = db.ClaimEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, pending.ID, claimed[0].ID)
+
+	// Dead-lettered events are listed and fetched within their tenant
+	events, err := db.ListDeadLetteredEvents(ctx, adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, dead.ID, events[0].ID)
+	assert.Equal(t, "webhook returned status: 500", events[0].LastError)
+	assert.NotNil(t, events[0].DeadLetteredAt)
+	found, err := db.GetEvent(ctx, pending.ID)
+	require.NoError(t, err)
+	assert.Nil(t, found.DeadLetteredAt)
+	_, err = db.GetEvent(ctx, otherDead.ID)
+	assertNotFound(t, err)
+
+	// Replaying makes them due again with a fresh set of attempts
+	_, err = db.ReplayEvent(ctx, otherDead.ID)
+	assertNotFound(t, err)
+	_, err = db.ReplayEvent(ctx, pending.ID)
+	assertNotFound(t, err)
+	replayed, err := db.ReplayEvent(ctx, dead.ID)
+	require.NoError(t, err)
+	assert.Equal(t, dead.ID, replayed.ID)
+	assert.Nil(t, replayed.DeadLetteredAt)
+	assert.Equal(t, 0, replayed.Attempts)
+
+	claimed, err = db.ClaimEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	assert.Equal(t, dead.ID, claimed[0].ID)
+	assert.Equal(t, 1, claimed[0].Attempts)
+	events, err = db.ListDeadLetteredEvents(ctx, adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	// Dead-lettered events of every tenant are deleted once old enough,
+	// and other events are left alone
+	deleted, err := db.DeleteDeadLetteredEvents(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), deleted)
+	deleted, err = db.DeleteDeadLetteredEvents(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+	_, err = db.GetEvent(other, otherDead.ID)
+	assertNotFound(t, err)
+	_, err = db.GetEvent(ctx, dead.ID)
+	require.NoError(t, err)
+	_, err = db.GetEvent(ctx, pending.ID)
+	require.NoError(t, err)
+}
+
+func testWebhookSubscriptions(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+	other := adapters.WithTenant(ctx, "other")
+
+	first := &models.WebhookSubscription{URL: "https://example.com/hooks", EventTypes: models.StringList{"comment_created"}, Enabled: true, Secret: "secret-1", CreatedAt: baseTime}
+	require.NoError(t, db.CreateWebhookSubscription(ctx, first))
+	require.NotEmpty(t, first.ID)
+	second := &models.WebhookSubscription{URL: "https://example.com/disabled", PostIDs: models.StringList{"post-1", "post-2"}, Secret: "secret-2", CreatedAt: baseTime.Add(time.Minute)}
+	require.NoError(t, db.CreateWebhookSubscription(ctx, second))
+	require.NoError(t, db.CreateWebhookSubscription(other, &models.WebhookSubscription{URL: "https://example.com/other", Enabled: true}))
+
+	// Subscriptions are listed oldest first within their tenant
+	subscriptions, err := db.ListWebhookSubscriptions(ctx)
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 2)
+	assert.Equal(t, first.ID, subscriptions[0].ID)
+	assert.Equal(t, models.StringList{"comment_created"}, subscriptions[0].EventTypes)
+	assert.True(t, subscriptions[0].Enabled)
+	assert.Equal(t, "secret-1", subscriptions[0].Secret)
+	assert.Equal(t, second.ID, subscriptions[1].ID)
+	assert.Equal(t, models.StringList{"post-1", "post-2"}, subscriptions[1].PostIDs)
+	assert.False(t, subscriptions[1].Enabled)
+
+	_, err = db.GetWebhookSubscription(other, first.ID)
+	assertNotFound(t, err)
+	_, err = db.GetWebhookSubscription(ctx, "missing")
+	assertNotFound(t, err)
+
+	// Deliveries are counted, and only within their tenant
+	record := func(ctx context.Context, at time.Time, lastError string) {
+		delivery := &models.WebhookDelivery{EventID: "event-1", SubscriptionID: first.ID, Error: lastError, CreatedAt: at}
+		require.NoError(t, db.RecordWebhookDelivery(ctx, delivery))
+	}
+	record(ctx, baseTime, "")
+	record(ctx, baseTime.Add(time.Minute), "")
+	record(ctx, baseTime.Add(2*time.Minute), "webhook returned status: 500")
+	record(other, baseTime, "elsewhere")
+	found, err := db.GetWebhookSubscription(ctx, first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), found.Stats.DeliveredCount)
+	assert.Equal(t, int64(1), found.Stats.FailedCount)
+	require.NotNil(t, found.Stats.LastDeliveredAt)
+	assert.True(t, baseTime.Add(time.Minute).Equal(*found.Stats.LastDeliveredAt))
+	require.NotNil(t, found.Stats.LastFailedAt)
+	assert.True(t, baseTime.Add(2*time.Minute).Equal(*found.Stats.LastFailedAt))
+	assert.Equal(t, "webhook returned status: 500", found.Stats.LastError)
+
+	// Updates leave the stats alone
+	found.Enabled = false
+	found.EventTypes = models.StringList{}
+	found.PreviousSecret = "secret-1"
+	found.Secret = "secret-3"
+	found.Stats = models.WebhookStats{}
+	require.NoError(t, db.UpdateWebhookSubscription(ctx, found))
+	found, err = db.GetWebhookSubscription(ctx, first.ID)
+	require.NoError(t, err)
+	assert.False(t, found.Enabled)
+	assert.Empty(t, found.EventTypes)
+	assert.Equal(t, "secret-3", found.Secret)
+	assert.Equal(t, "secret-1", found.PreviousSecret)
+	assert.Equal(t, int64(2), found.Stats.DeliveredCount)
+	assert.Equal(t, int64(1), found.Stats.FailedCount)
+	assertNotFound(t, db.UpdateWebhookSubscription(other, found))
+
+	// Subscriptions are only deleted within their tenant
+	assertNotFound(t, db.DeleteWebhookSubscription(other, first.ID))
+	require.NoError(t, db.DeleteWebhookSubscription(ctx, first.ID))
+	assertNotFound(t, db.DeleteWebhookSubscription(ctx, first.ID))
+	subscriptions, err = db.ListWebhookSubscriptions(ctx)
+	require.NoError(t, err)
+	require.Len(t, subscriptions, 1)
+	assert.Equal(t, second.ID, subscriptions[0].ID)
+}
+
+func testWebhookDeliveries(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+	other := adapters.WithTenant(ctx, "other")
+
+	deliveries := []*models.WebhookDelivery{
+		{EventID: "event-1", EventType: "post_created", URL: "https://example.com/global", Attempt: 1, StatusCode: 200, LatencyMS: 12, Response: "ok", CreatedAt: baseTime},
+		{EventID: "event-1", EventType: "post_created", SubscriptionID: "subscription-1", URL: "https://example.com/hooks", Attempt: 1, StatusCode: 503, Error: "webhook returned status: 503", CreatedAt: baseTime.Add(time.Minute)},
+		{EventID: "event-1", EventType: "post_created", SubscriptionID: "subscription-1", URL: "https://example.com/hooks", Attempt: 2, StatusCode: 204, CreatedAt: baseTime.Add(2 * time.Minute)},
+		{EventID: "event-2", EventType: "comment_created", SubscriptionID: "subscription-1", URL: "https://example.com/hooks", Attempt: 1, Error: "webhook request failed: timeout", CreatedAt: baseTime.Add(3 * time.Minute)},
+	}
+	for _, delivery := range deliveries {
+		require.NoError(t, db.RecordWebhookDelivery(ctx, delivery))
+		require.NotEmpty(t, delivery.ID)
+	}
+	require.NoError(t, db.RecordWebhookDelivery(other, &models.WebhookDelivery{EventID: "event-1", SubscriptionID: "subscription-1", CreatedAt: baseTime}))
+
+	ids := func(q adapters.DeliveryQuery, p adapters.Pagination) []string {
+		found, err := db.ListWebhookDeliveries(ctx, q, p)
+		require.NoError(t, err)
+		ids := make([]string, len(found))
+		for i, delivery := range found {
+			ids[i] = delivery.ID
+		}
+		return ids
+	}
+	page := adapters.Pagination{Limit: 10}
+	failed, succeeded := true, false
+
+	// Deliveries of the tenant are listed newest first, and filtered
+	assert.Equal(t, []string{deliveries[3].ID, deliveries[2].ID, deliveries[1].ID, deliveries[0].ID}, ids(adapters.DeliveryQuery{}, page))
+	assert.Equal(t, []string{deliveries[3].ID, deliveries[2].ID, deliveries[1].ID}, ids(adapters.DeliveryQuery{SubscriptionID: "subscription-1"}, page))
+	assert.Equal(t, []string{deliveries[2].ID, deliveries[1].ID, deliveries[0].ID}, ids(adapters.DeliveryQuery{EventID: "event-1"}, page))
+	assert.Equal(t, []string{deliveries[3].ID, deliveries[1].ID}, ids(adapters.DeliveryQuery{Failed: &failed}, page))
+	assert.Equal(t, []string{deliveries[2].ID}, ids(adapters.DeliveryQuery{SubscriptionID: "subscription-1", Failed: &succeeded}, page))
+	assert.Equal(t, []string{deliveries[1].ID, deliveries[0].ID}, ids(adapters.DeliveryQuery{}, adapters.Pagination{Limit: 2, After: &adapters.Cursor{CreatedAt: deliveries[2].CreatedAt, ID: deliveries[2].ID}}))
+	assert.Equal(t, []string{deliveries[2].ID}, ids(adapters.DeliveryQuery{}, adapters.Pagination{Limit: 1, Offset: 1}))
+
+	found, err := db.ListWebhookDeliveries(ctx, adapters.DeliveryQuery{}, adapters.Pagination{Limit: 1, Offset: 3})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, "event-1", found[0].EventID)
+	assert.Equal(t, "post_created", found[0].EventType)
+	assert.Empty(t, found[0].SubscriptionID)
+	assert.Equal(t, "https://example.com/global", found[0].URL)
+	assert.Equal(t, 1, found[0].Attempt)
+	assert.Equal(t, 200, found[0].StatusCode)
+	assert.Equal(t, int64(12), found[0].LatencyMS)
+	assert.Equal(t, "ok", found[0].Response)
+	assert.Empty(t, found[0].Error)
+	assert.True(t, baseTime.Equal(found[0].CreatedAt))
+
+	// Deliveries are deleted in every tenant
+	deleted, err := db.DeleteWebhookDeliveries(ctx, baseTime.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), deleted)
+	assert.Equal(t, []string{deliveries[3].ID, deliveries[2].ID, deliveries[1].ID}, ids(adapters.DeliveryQuery{}, page))
+	found, err = db.ListWebhookDeliveries(other, adapters.DeliveryQuery{}, page)
+	require.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+func testListEvents(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+	other := adapters.WithTenant(ctx, "other")
+
+	events := make([]*models.OutboxEvent, 4)
+	for i := range events {
+		events[i] = &models.OutboxEvent{Type: "post_created", Payload: "{}", CreatedAt: baseTime.Add(time.Duration(i) * time.Minute)}
+		require.NoError(t, db.EnqueueEvent(ctx, events[i]))
+	}
+	require.NoError(t, db.EnqueueEvent(ctx, &models.OutboxEvent{Type: "post_created", Payload: "{}", SubscriptionID: "subscription-1", CreatedAt: baseTime.Add(time.Minute)}))
+	require.NoError(t, db.EnqueueEvent(other, &models.OutboxEvent{Type: "post_created", Payload: "{}", CreatedAt: baseTime.Add(time.Minute)}))
+
+	// Events of the tenant created in the range are listed oldest first,
+	// without their copies for subscriptions
+	found, err := db.ListEvents(ctx, baseTime.Add(time.Minute), baseTime.Add(3*time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	assert.Equal(t, events[1].ID, found[0].ID)
+	assert.Equal(t, events[2].ID, found[1].ID)
+
+	found, err = db.ListEvents(ctx, baseTime, baseTime.Add(time.Hour), 3)
+	require.NoError(t, err)
+	require.Len(t, found, 3)
+	assert.Equal(t, events[0].ID, found[0].ID)
+}
+
+func testTransaction(t *testing.T, db adapters.DatabaseAdapter) {
+	ctx := context.Background()
+
+	var post *models.Post
+	err := db.Transaction(ctx, func(tx adapters.DatabaseAdapter) error {
+		post = newPost(t, tx, 0, models.Post{})
+		return tx.EnqueueEvent(ctx, &models.OutboxEvent{Type: "post_created", Payload: `{}`})
+	})
+	require.NoError(t, err)
+	_, err = db.GetPostByID(ctx, post.ID)
+	require.NoError(t, err)
+	claimed, err := db.ClaimEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, claimed, 1)
+
+	// fn's error is returned as is, and nothing it wrote is kept
+	failed := errors.New("failed")
+	var rolledBack *models.Post
+	err = db.Transaction(ctx, func(tx adapters.DatabaseAdapter) error {
+		rolledBack = newPost(t, tx, 1, models.Post{})
+		require.NoError(t, tx.EnqueueEvent(ctx, &models.OutboxEvent{Type: "post_created", Payload: `{}`}))
+		return failed
+	})
+	assert.Equal(t, failed, err)
+	_, err = db.GetPostByID(ctx, rolledBack.ID)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound), "expected gorm.ErrRecordNotFound, got %v", err)
+	count, err := db.CountPosts(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	claimed, err = db.ClaimEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+}
+
+func testCanceledContext(t *testing.T, db adapters.DatabaseAdapter) {
+	post := newPost(t, db, 0, models.Post{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := db.GetPostByID(ctx, post.ID)
+	assert.True(t, errors.Is(err, context.Canceled), "expected context.Canceled, got %v", err)
+	_, err = db.ListPosts(ctx, "", adapters.Pagination{Limit: 10})
+	assert.True(t, errors.Is(err, context.Canceled), "expected context.Canceled, got %v", err)
+	err = db.CreatePost(ctx, &models.Post{UserID: "user-1", Content: "never stored"})
+	assert.True(t, errors.Is(err, context.Canceled), "expected context.Canceled, got %v", err)
+
+	posts, err := db.ListPosts(context.Background(), "", adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, posts, 1)
+}
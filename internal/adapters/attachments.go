@@ -0,0 +1,73 @@
+package adapters
+
+import (
+	"gorm.io/gorm"
+
+	"sonet/internal/models"
+)
+
+// loadPostAttachments loads the attachments of all posts with a single query
+func loadPostAttachments(db *gorm.DB, posts []*models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+
+	var attachments []*models.Attachment
+	err := db.Where("post_id IN ?", ids).
+		Order("created_at ASC, id ASC").
+		Find(&attachments).Error
+	if err != nil {
+		return err
+	}
+
+	byPost := make(map[string][]models.Attachment, len(posts))
+	for _, attachment := range attachments {
+		byPost[*attachment.PostID] = append(byPost[*attachment.PostID], *attachment)
+	}
+
+	for _, post := range posts {
+		post.Attachments = byPost[post.ID]
+		if post.Attachments == nil {
+			post.Attachments = []models.Attachment{}
+		}
+	}
+	return nil
+}
+
+// loadCommentAttachments loads the attachment of all comments with a single query
+func loadCommentAttachments(db *gorm.DB, comments []*models.Comment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+
+	var attachments []*models.Attachment
+	err := db.Where("comment_id IN ?", ids).
+		Order("id ASC").
+		Find(&attachments).Error
+	if err != nil {
+		return err
+	}
+
+	// A comment has at most one attachment; like GetAttachmentForComment, keep the first
+	byComment := make(map[string]*models.Attachment, len(comments))
+	for _, attachment := range attachments {
+		if _, ok := byComment[*attachment.CommentID]; !ok {
+			byComment[*attachment.CommentID] = attachment
+		}
+	}
+
+	for _, comment := range comments {
+		comment.Attachment = byComment[comment.ID]
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"sonet/internal/models"
+)
+
+// Test that post and comment pages load attachments and reaction counts with
+// one query each per page
+func TestAttachmentsAreBatchLoaded(t *testing.T) {
+	viper.Set("DB_CONNECTION_STRING", filepath.Join(t.TempDir(), "sonet.db"))
+	a, err := newSQLiteAdapter()
+	require.NoError(t, err)
+	defer a.Close()
+
+	ctx := context.Background()
+	var post *models.Post
+	for i := 0; i < 10; i++ {
+		p := &models.Post{UserID: "user-1", Content: fmt.Sprintf("post %d", i), City: "Oakland", Latitude: 37.8044, Longitude: -122.2712}
+		require.NoError(t, a.CreatePost(ctx, p))
+		postID := p.ID
+		require.NoError(t, a.CreateAttachment(ctx, &models.Attachment{URL: "https://example.com/a.jpg", Type: models.AttachmentTypeImage, PostID: &postID}))
+		post = p
+	}
+	for i := 0; i < 10; i++ {
+		c := &models.Comment{PostID: post.ID, UserID: "user-2", Content: "comment"}
+		require.NoError(t, a.CreateComment(ctx, c))
+		commentID := c.ID
+		require.NoError(t, a.CreateAttachment(ctx, &models.Attachment{URL: "https://example.com/c.pdf", Type: models.AttachmentTypeFile, CommentID: &commentID}))
+	}
+
+	// Count queries issued by each call
+	queries := 0
+	require.NoError(t, a.db.Callback().Query().After("gorm:query").Register("test:count", func(*gorm.DB) {
+		queries++
+	}))
+
+	calls := map[string]func() error{
+		"ListPosts": func() error {
+			_, err := a.ListPosts(ctx, "", Pagination{Limit: 100})
+			return err
+		},
+		"SearchPosts": func() error {
+			_, err := a.SearchPosts(ctx, SearchQuery{Text: "post"}, Pagination{Limit: 100})
+			return err
+		},
+		"ListPostsByCity": func() error {
+			_, err := a.ListPostsByCity(ctx, "Oakland", Pagination{Limit: 100})
+			return err
+		},
+		"FindNearbyPosts": func() error {
+			_, err := a.FindNearbyPosts(ctx, 37.8044, -122.2712, 1, 100, 0)
+			return err
+		},
+		"ListComments": func() error {
+			_, err := a.ListComments(ctx, post.ID, Pagination{Limit: 100})
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		queries = 0
+		require.NoError(t, call(), name)
+		assert.Equal(t, 3, queries, name)
+	}
+}
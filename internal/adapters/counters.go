@@ -0,0 +1,144 @@
+package adapters
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"sonet/internal/models"
+)
+
+// countComment adds delta to the comment count of the post of a comment, and
+// to the reply count of its parent. Counts never drop below zero.
+func countComment(ctx context.Context, tx *gorm.DB, comment *models.Comment, delta int) error {
+	err := inTenant(ctx, tx, "posts").Table("posts").
+		Where("id = ? AND comment_count + ? >= 0", comment.PostID, delta).
+		UpdateColumn("comment_count", gorm.Expr("comment_count + ?", delta)).Error
+	if err != nil || comment.ParentID == nil {
+		return err
+	}
+
+	return inTenant(ctx, tx, "comments").Table("comments").
+		Where("id = ? AND reply_count + ? >= 0", *comment.ParentID, delta).
+		UpdateColumn("reply_count", gorm.Expr("reply_count + ?", delta)).Error
+}
+
+// countReaction adds delta to the number of reactions of the type of a
+// reaction to its target. Counts that drop to zero are deleted.
+func countReaction(ctx context.Context, tx *gorm.DB, reaction *models.Reaction, delta int) error {
+	if delta > 0 {
+		return tx.WithContext(ctx).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "tenant_id"}, {Name: "target_id"}, {Name: "target_type"}, {Name: "type"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{"count": gorm.Expr("reaction_counts.count + excluded.count")}),
+		}).Create(&models.ReactionCount{
+			TenantID:   TenantFromContext(ctx),
+			TargetID:   reaction.TargetID,
+			TargetType: reaction.TargetType,
+			Type:       reaction.Type,
+			Count:      int64(delta),
+		}).Error
+	}
+
+	counted := inTenant(ctx, tx, "reaction_counts").Table("reaction_counts").
+		Where("target_id = ? AND target_type = ? AND type = ?", reaction.TargetID, reaction.TargetType, reaction.Type)
+	if err := counted.UpdateColumn("count", gorm.Expr("count + ?", delta)).Error; err != nil {
+		return err
+	}
+	return inTenant(ctx, tx, "reaction_counts").
+		Where("target_id = ? AND target_type = ? AND type = ? AND count <= 0", reaction.TargetID, reaction.TargetType, reaction.Type).
+		Delete(&models.ReactionCount{}).Error
+}
+
+// deleteReactionCounts deletes the reaction counts of targets whose reactions
+// are deleted along with them
+func deleteReactionCounts(ctx context.Context, tx *gorm.DB, targetType string, targetIDs []string) error {
+	if len(targetIDs) == 0 {
+		return nil
+	}
+	return inTenant(ctx, tx, "reaction_counts").
+		Delete(&models.ReactionCount{}, "target_type = ? AND target_id IN ?", targetType, targetIDs).Error
+}
+
+// loadReactionCounts loads the reaction counts of targets with a single query
+func loadReactionCounts(db *gorm.DB, targetType string, targetIDs []string) (map[string]map[string]int64, error) {
+	byTarget := make(map[string]map[string]int64, len(targetIDs))
+	for _, id := range targetIDs {
+		byTarget[id] = map[string]int64{}
+	}
+	if len(targetIDs) == 0 {
+		return byTarget, nil
+	}
+
+	var counts []*models.ReactionCount
+	err := db.Where("target_type = ? AND target_id IN ?", targetType, targetIDs).Find(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, count := range counts {
+		if types, ok := byTarget[count.TargetID]; ok {
+			types[count.Type] = count.Count
+		}
+	}
+	return byTarget, nil
+}
+
+// loadPostReactionCounts loads the reaction counts of all posts with a single query
+func loadPostReactionCounts(db *gorm.DB, posts []*models.Post) error {
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+
+	byPost, err := loadReactionCounts(db, "post", ids)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		post.ReactionCounts = byPost[post.ID]
+	}
+	return nil
+}
+
+// loadCommentReactionCounts loads the reaction counts of all comments with a single query
+func loadCommentReactionCounts(db *gorm.DB, comments []*models.Comment) error {
+	ids := make([]string, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+
+	byComment, err := loadReactionCounts(db, "comment", ids)
+	if err != nil {
+		return err
+	}
+	for _, comment := range comments {
+		comment.ReactionCounts = byComment[comment.ID]
+	}
+	return nil
+}
+
+// repairCounters recomputes the comment, reply and reaction counts of every
+// tenant from the comments and reactions, in a single transaction
+func repairCounters(ctx context.Context, db *gorm.DB) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			`UPDATE posts SET comment_count = (
+				SELECT COUNT(*) FROM comments WHERE comments.tenant_id = posts.tenant_id AND comments.post_id = posts.id
+			)`,
+			`UPDATE comments SET reply_count = (
+				SELECT COUNT(*) FROM comments AS replies WHERE replies.tenant_id = comments.tenant_id AND replies.parent_id = comments.id
+			)`,
+			`DELETE FROM reaction_counts`,
+			`INSERT INTO reaction_counts (tenant_id, target_id, target_type, type, count)
+				SELECT tenant_id, target_id, target_type, type, COUNT(*) FROM reactions
+				GROUP BY tenant_id, target_id, target_type, type`,
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
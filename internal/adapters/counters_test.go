@@ -0,0 +1,46 @@
+package adapters
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sonet/internal/models"
+)
+
+// Test that repairing counters recomputes them in every tenant
+func TestRepairCounters(t *testing.T) {
+	viper.Set("DB_CONNECTION_STRING", filepath.Join(t.TempDir(), "sonet.db"))
+	a, err := newSQLiteAdapter()
+	require.NoError(t, err)
+	defer a.Close()
+
+	ctx := WithTenant(context.Background(), "acme")
+	post := &models.Post{UserID: "user-1", Content: "post"}
+	require.NoError(t, a.CreatePost(ctx, post))
+	comment := &models.Comment{PostID: post.ID, UserID: "user-2", Content: "comment"}
+	require.NoError(t, a.CreateComment(ctx, comment))
+	require.NoError(t, a.CreateComment(ctx, &models.Comment{PostID: post.ID, UserID: "user-3", Content: "reply", ParentID: &comment.ID}))
+	require.NoError(t, a.CreateReaction(ctx, &models.Reaction{UserID: "user-2", TargetID: post.ID, TargetType: "post", Type: "like"}))
+
+	// Counters drift when records change behind the adapter's back
+	require.NoError(t, a.db.Exec("UPDATE posts SET comment_count = 7").Error)
+	require.NoError(t, a.db.Exec("UPDATE comments SET reply_count = 0").Error)
+	require.NoError(t, a.db.Exec("UPDATE reaction_counts SET count = 3").Error)
+	require.NoError(t, a.db.Exec("INSERT INTO reaction_counts (tenant_id, target_id, target_type, type, count) VALUES ('acme', ?, 'post', 'sad', 1)", post.ID).Error)
+
+	require.NoError(t, a.RepairCounters(context.Background()))
+
+	found, err := a.GetPostByID(ctx, post.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), found.CommentCount)
+	assert.Equal(t, map[string]int64{"like": 1}, found.ReactionCounts)
+
+	foundComment, err := a.GetCommentByID(ctx, comment.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), foundComment.ReplyCount)
+}
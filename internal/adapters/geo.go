@@ -0,0 +1,30 @@
+package adapters
+
+import "math"
+
+// earthRadiusKm is the mean Earth radius used for distance calculations
+const earthRadiusKm = 6371.0
+
+// haversineKm returns the great-circle distance in kilometers between two points
+func haversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	radLat1 := lat1 * math.Pi / 180
+	radLat2 := lat2 * math.Pi / 180
+	deltaLng := (lng2 - lng1) * math.Pi / 180
+	deltaLat := (lat2 - lat1) * math.Pi / 180
+
+	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
+		math.Cos(radLat1)*math.Cos(radLat2)*
+			math.Sin(deltaLng/2)*math.Sin(deltaLng/2)
+	c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return earthRadiusKm * c
+}
+
+// boundingBox returns the latitude and longitude deltas of a box that fully
+// contains a circle of radiusKm around lat. A 20% margin is added for safety.
+// A rough approximation: 1 degree of latitude ≈ 111 km and
+// 1 degree of longitude ≈ 111 * cos(latitude) km
+func boundingBox(lat, radiusKm float64) (latDelta, lngDelta float64) {
+	latDelta = (radiusKm * 1.2) / 111.0
+	lngDelta = (radiusKm * 1.2) / (111.0 * math.Cos(lat*math.Pi/180.0))
+	return latDelta, lngDelta
+}
@@ -0,0 +1,1842 @@
+package adapters
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"sonet/internal/models"
+)
+
+// MemoryAdapter implements the DatabaseAdapter interface with an in-process store.
+// It is intended for tests and ephemeral deployments; all data is lost on restart.
+type MemoryAdapter struct {
+	mu sync.RWMutex
+	memoryTables
+}
+
+// memoryTables holds the stored records of a MemoryAdapter, by ID
+type memoryTables struct {
+	posts       map[string]*models.Post
+	comments    map[string]*models.Comment
+	reactions   map[string]*models.Reaction
+	attachments map[string]*models.Attachment
+	moderation  map[string]*models.ModerationAction
+	apiKeys     map[string]*models.APIKey
+	types       map[string]*models.ReactionType
+	events      map[string]*models.OutboxEvent
+	webhooks    map[string]*models.WebhookSubscription
+	deliveries  map[string]*models.WebhookDelivery
+}
+
+// newMemoryAdapter creates a new in-memory database adapter
+func newMemoryAdapter() (*MemoryAdapter, error) {
+	return &MemoryAdapter{memoryTables: newMemoryTables()}, nil
+}
+
+func newMemoryTables() memoryTables {
+	return memoryTables{
+		posts:       make(map[string]*models.Post),
+		comments:    make(map[string]*models.Comment),
+		reactions:   make(map[string]*models.Reaction),
+		attachments: make(map[string]*models.Attachment),
+		moderation:  make(map[string]*models.ModerationAction),
+		apiKeys:     make(map[string]*models.APIKey),
+		types:       make(map[string]*models.ReactionType),
+		events:      make(map[string]*models.OutboxEvent),
+		webhooks:    make(map[string]*models.WebhookSubscription),
+		deliveries:  make(map[string]*models.WebhookDelivery),
+	}
+}
+
+// clone copies every stored record, so that writes to the copy leave t as it is
+func (t memoryTables) clone() memoryTables {
+	return memoryTables{
+		posts:       cloneTable(t.posts, clonePost),
+		comments:    cloneTable(t.comments, cloneComment),
+		reactions:   cloneTable(t.reactions, copyRecord[models.Reaction]),
+		attachments: cloneTable(t.attachments, cloneAttachment),
+		moderation:  cloneTable(t.moderation, copyRecord[models.ModerationAction]),
+		apiKeys:     cloneTable(t.apiKeys, cloneAPIKey),
+		types:       cloneTable(t.types, copyRecord[models.ReactionType]),
+		events:      cloneTable(t.events, cloneOutboxEvent),
+		webhooks:    cloneTable(t.webhooks, cloneWebhookSubscription),
+		deliveries:  cloneTable(t.deliveries, copyRecord[models.WebhookDelivery]),
+	}
+}
+
+// CreatePost creates a new post
+func (a *MemoryAdapter) CreatePost(ctx context.Context, post *models.Post) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	post.TenantID = TenantFromContext(ctx)
+	if err := post.BeforeCreate(nil); err != nil {
+		return err
+	}
+	if _, exists := a.posts[post.ID]; exists {
+		return gorm.ErrDuplicatedKey
+	}
+
+	a.posts[post.ID] = clonePost(post)
+	return nil
+}
+
+// GetPostByID retrieves a post by its ID with attachments
+func (a *MemoryAdapter) GetPostByID(ctx context.Context, id string) (*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	post, ok := a.posts[id]
+	if !ok || post.TenantID != TenantFromContext(ctx) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return a.postWithAttachments(post), nil
+}
+
+// ListPosts retrieves posts with pagination and attachments
+func (a *MemoryAdapter) ListPosts(ctx context.Context, userID string, p Pagination) ([]*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return a.findPosts(visiblePostsInTenant(ctx, postsByUser(userID)), p), nil
+}
+
+// CountPosts returns the number of posts, optionally filtered by user
+func (a *MemoryAdapter) CountPosts(ctx context.Context, userID string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return a.countPosts(visiblePostsInTenant(ctx, postsByUser(userID))), nil
+}
+
+// UpdatePost updates an existing post
+func (a *MemoryAdapter) UpdatePost(ctx context.Context, post *models.Post) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	post.TenantID = TenantFromContext(ctx)
+	if stored, ok := a.posts[post.ID]; !ok || stored.TenantID != post.TenantID {
+		return gorm.ErrRecordNotFound
+	}
+
+	post.UpdatedAt = time.Now()
+	a.posts[post.ID] = clonePost(post)
+	return nil
+}
+
+// DeletePost deletes a post and all its comments, attachments and reactions
+func (a *MemoryAdapter) DeletePost(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if post, ok := a.posts[id]; !ok || post.TenantID != TenantFromContext(ctx) {
+		return nil
+	}
+
+	tenantID := TenantFromContext(ctx)
+
+	// Delete all reactions to this post
+	a.deleteReactionsFor(tenantID, id, "post")
+
+	// Delete all comments with their reactions and attachments
+	for commentID, comment := range a.comments {
+		if comment.TenantID == tenantID && comment.PostID == id {
+			a.deleteCommentLocked(tenantID, commentID)
+		}
+	}
+
+	// Delete all attachments for this post
+	for attachmentID, attachment := range a.attachments {
+		if attachment.TenantID == tenantID && attachment.PostID != nil && *attachment.PostID == id {
+			delete(a.attachments, attachmentID)
+		}
+	}
+
+	// Finally delete the post
+	delete(a.posts, id)
+	return nil
+}
+
+// CreateComment creates a new comment
+func (a *MemoryAdapter) CreateComment(ctx context.Context, comment *models.Comment) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	comment.TenantID = TenantFromContext(ctx)
+	if err := comment.BeforeCreate(nil); err != nil {
+		return err
+	}
+	if _, exists := a.comments[comment.ID]; exists {
+		return gorm.ErrDuplicatedKey
+	}
+
+	a.comments[comment.ID] = cloneComment(comment)
+	return nil
+}
+
+// GetCommentByID retrieves a comment by its ID with attachment
+func (a *MemoryAdapter) GetCommentByID(ctx context.Context, id string) (*models.Comment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	comment, ok := a.comments[id]
+	if !ok || comment.TenantID != TenantFromContext(ctx) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return a.commentWithAttachment(comment), nil
+}
+
+// ListComments retrieves comments with pagination and attachments
+func (a *MemoryAdapter) ListComments(ctx context.Context, postID string, p Pagination) ([]*models.Comment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	tenantID := TenantFromContext(ctx)
+	comments := make([]*models.Comment, 0)
+	for _, comment := range a.comments {
+		if comment.TenantID != tenantID || comment.PostID != postID || comment.HiddenAt != nil {
+			continue
+		}
+		if p.After != nil && !p.After.isAfterOldestFirst(comment.CreatedAt, comment.ID) {
+			continue
+		}
+		comments = append(comments, comment)
+	}
+
+	// Oldest comments first, like the SQL adapters
+	sort.Slice(comments, func(i, j int) bool {
+		if !comments[i].CreatedAt.Equal(comments[j].CreatedAt) {
+			return comments[i].CreatedAt.Before(comments[j].CreatedAt)
+		}
+		return comments[i].ID < comments[j].ID
+	})
+
+	comments = paginatePage(comments, p)
+	for i, comment := range comments {
+		comments[i] = a.commentWithAttachment(comment)
+	}
+	return comments, nil
+}
+
+// CountComments returns the number of comments on a post
+func (a *MemoryAdapter) CountComments(ctx context.Context, postID string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	tenantID := TenantFromContext(ctx)
+	var count int64
+	for _, comment := range a.comments {
+		if comment.TenantID == tenantID && comment.PostID == postID && comment.HiddenAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// UpdateComment updates an existing comment
+func (a *MemoryAdapter) UpdateComment(ctx context.Context, comment *models.Comment) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	comment.TenantID = TenantFromContext(ctx)
+	if stored, ok := a.comments[comment.ID]; !ok || stored.TenantID != comment.TenantID {
+		return gorm.ErrRecordNotFound
+	}
+
+	comment.UpdatedAt = time.Now()
+	a.comments[comment.ID] = cloneComment(comment)
+	return nil
+}
+
+// DeleteComment deletes a comment, its attachment and all its reactions
+func (a *MemoryAdapter) DeleteComment(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if comment, ok := a.comments[id]; ok && comment.TenantID == TenantFromContext(ctx) {
+		a.deleteCommentLocked(comment.TenantID, id)
+	}
+	return nil
+}
+
+// CreateReaction creates a new reaction
+func (a *MemoryAdapter) CreateReaction(ctx context.Context, reaction *models.Reaction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	reaction.TenantID = TenantFromContext(ctx)
+	if err := reaction.BeforeCreate(nil); err != nil {
+		return err
+	}
+	if _, exists := a.reactions[reaction.ID]; exists {
+		return gorm.ErrDuplicatedKey
+	}
+
+	// Enforce the same uniqueness as idx_reactions_unique
+	if a.findReaction(reaction.TenantID, reaction.UserID, reaction.TargetID, reaction.TargetType, reaction.Type) != nil {
+		return gorm.ErrDuplicatedKey
+	}
+
+	stored := *reaction
+	a.reactions[reaction.ID] = &stored
+	return nil
+}
+
+// AddReaction creates a reaction unless the user already reacted to the
+// target with its type, in which case reaction is set to the existing one
+func (a *MemoryAdapter) AddReaction(ctx context.Context, reaction *models.Reaction) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	reaction.TenantID = TenantFromContext(ctx)
+	if existing := a.findReaction(reaction.TenantID, reaction.UserID, reaction.TargetID, reaction.TargetType, reaction.Type); existing != nil {
+		*reaction = *existing
+		return false, nil
+	}
+
+	if err := reaction.BeforeCreate(nil); err != nil {
+		return false, err
+	}
+	if _, exists := a.reactions[reaction.ID]; exists {
+		return false, gorm.ErrDuplicatedKey
+	}
+
+	stored := *reaction
+	a.reactions[reaction.ID] = &stored
+	return true, nil
+}
+
+// ReplaceReaction adds a reaction and removes the user's reactions of other
+// types to its target
+func (a *MemoryAdapter) ReplaceReaction(ctx context.Context, reaction *models.Reaction) (bool, []*models.Reaction, error) {
+	if err := ctx.Err(); err != nil {
+		return false, nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	reaction.TenantID = TenantFromContext(ctx)
+	removed := make([]*models.Reaction, 0)
+	for id, existing := range a.reactions {
+		if existing.TenantID == reaction.TenantID && existing.UserID == reaction.UserID &&
+			existing.TargetID == reaction.TargetID && existing.TargetType == reaction.TargetType && existing.Type != reaction.Type {
+			removed = append(removed, existing)
+			delete(a.reactions, id)
+		}
+	}
+
+	if existing := a.findReaction(reaction.TenantID, reaction.UserID, reaction.TargetID, reaction.TargetType, reaction.Type); existing != nil {
+		*reaction = *existing
+		return false, removed, nil
+	}
+
+	if err := reaction.BeforeCreate(nil); err != nil {
+		return false, nil, err
+	}
+	stored := *reaction
+	a.reactions[reaction.ID] = &stored
+	return true, removed, nil
+}
+
+// RemoveReaction deletes a user's reaction to a target and returns it
+func (a *MemoryAdapter) RemoveReaction(ctx context.Context, userID, targetID, targetType, reactionType string) (*models.Reaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	reaction := a.findReaction(TenantFromContext(ctx), userID, targetID, targetType, reactionType)
+	if reaction == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	delete(a.reactions, reaction.ID)
+	return reaction, nil
+}
+
+// GetReaction retrieves a specific reaction
+func (a *MemoryAdapter) GetReaction(ctx context.Context, userID, targetID, targetType, reactionType string) (*models.Reaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	reaction := a.findReaction(TenantFromContext(ctx), userID, targetID, targetType, reactionType)
+	if reaction == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	found := *reaction
+	return &found, nil
+}
+
+// GetReactionByID retrieves a reaction by ID
+func (a *MemoryAdapter) GetReactionByID(ctx context.Context, id string) (*models.Reaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	reaction, ok := a.reactions[id]
+	if !ok || reaction.TenantID != TenantFromContext(ctx) {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	found := *reaction
+	return &found, nil
+}
+
+// ListReactions retrieves all reactions for a target
+func (a *MemoryAdapter) ListReactions(ctx context.Context, targetID, targetType string) ([]*models.Reaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	tenantID := TenantFromContext(ctx)
+	reactions := make([]*models.Reaction, 0)
+	for _, reaction := range a.reactions {
+		if reaction.TenantID == tenantID && reaction.TargetID == targetID && reaction.TargetType == targetType {
+			found := *reaction
+			reactions = append(reactions, &found)
+		}
+	}
+
+	sort.Slice(reactions, func(i, j int) bool {
+		if !reactions[i].CreatedAt.Equal(reactions[j].CreatedAt) {
+			return reactions[i].CreatedAt.Before(reactions[j].CreatedAt)
+		}
+		return reactions[i].ID < reactions[j].ID
+	})
+	return reactions, nil
+}
+
+// DeleteReaction deletes a reaction
+func (a *MemoryAdapter) DeleteReaction(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if reaction, ok := a.reactions[id]; ok && reaction.TenantID == TenantFromContext(ctx) {
+		delete(a.reactions, id)
+	}
+	return nil
+}
+
+// SummarizeReactions aggregates the reactions to targets
+func (a *MemoryAdapter) SummarizeReactions(ctx context.Context, targetType string, targetIDs []string, userID string, recent int) (map[string]*models.ReactionSummary, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	summaries := newReactionSummaries(targetIDs)
+	tenantID := TenantFromContext(ctx)
+
+	// Group the reactions like the ranking query of the SQL adapters
+	type group struct{ targetID, reactionType string }
+	groups := make(map[group][]*models.Reaction)
+	for _, reaction := range a.reactions {
+		if _, ok := summaries[reaction.TargetID]; ok && reaction.TenantID == tenantID && reaction.TargetType == targetType {
+			key := group{reaction.TargetID, reaction.Type}
+			groups[key] = append(groups[key], reaction)
+		}
+	}
+
+	rows := make([]reactionSummaryRow, 0, len(a.reactions))
+	for key, reactions := range groups {
+		sort.Slice(reactions, func(i, j int) bool {
+			if !reactions[i].CreatedAt.Equal(reactions[j].CreatedAt) {
+				return reactions[i].CreatedAt.After(reactions[j].CreatedAt)
+			}
+			return reactions[i].ID > reactions[j].ID
+		})
+
+		mine := false
+		for _, reaction := range reactions {
+			mine = mine || reaction.UserID == userID
+		}
+		for i, reaction := range reactions {
+			if i >= max(recent, 1) {
+				break
+			}
+			rows = append(rows, reactionSummaryRow{
+				TargetID:      key.targetID,
+				Type:          key.reactionType,
+				UserID:        reaction.UserID,
+				ReactionRank:  i + 1,
+				ReactionCount: int64(len(reactions)),
+				IsMine:        mine,
+			})
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		switch {
+		case rows[i].TargetID != rows[j].TargetID:
+			return rows[i].TargetID < rows[j].TargetID
+		case rows[i].ReactionCount != rows[j].ReactionCount:
+			return rows[i].ReactionCount > rows[j].ReactionCount
+		case rows[i].Type != rows[j].Type:
+			return rows[i].Type < rows[j].Type
+		}
+		return rows[i].ReactionRank < rows[j].ReactionRank
+	})
+
+	addReactionSummaryRows(summaries, rows, recent)
+	return summaries, nil
+}
+
+// RepairCounters does nothing, since the memory adapter counts when reading
+func (a *MemoryAdapter) RepairCounters(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Transaction runs fn with a copy of the stored data, which replaces the data
+// only once fn succeeds, so nothing is kept of a failed fn. Other calls wait
+// until fn returns, so fn must only use tx.
+func (a *MemoryAdapter) Transaction(ctx context.Context, fn func(tx DatabaseAdapter) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	tx := &MemoryAdapter{memoryTables: a.memoryTables.clone()}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	a.memoryTables = tx.memoryTables
+	return nil
+}
+
+// Close releases the stored data
+func (a *MemoryAdapter) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.memoryTables = newMemoryTables()
+	return nil
+}
+
+// SearchPosts returns the posts matching a search query, see parseSearchQuery
+// for the text query syntax
+func (a *MemoryAdapter) SearchPosts(ctx context.Context, q SearchQuery, p Pagination) ([]*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	clauses := parseSearchQuery(q.Text)
+	var posts []*models.Post
+	if q.Sort == SortRelevance {
+		posts = a.rankPosts(visiblePostsInTenant(ctx, a.postsMatchingQuery(q, clauses)), clauses, p)
+	} else {
+		posts = a.findPosts(visiblePostsInTenant(ctx, a.postsMatchingQuery(q, clauses)), p)
+	}
+
+	// Posts are copies, so the snippet is never stored
+	if q.hasText() {
+		for _, post := range posts {
+			post.Snippet = highlightMatches(clauses, post.Content)
+		}
+	}
+	return posts, nil
+}
+
+// CountSearchPosts returns the number of posts matching a search query
+func (a *MemoryAdapter) CountSearchPosts(ctx context.Context, q SearchQuery) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return a.countPosts(visiblePostsInTenant(ctx, a.postsMatchingQuery(q, parseSearchQuery(q.Text)))), nil
+}
+
+// ListPostsByCity returns posts from a specific city
+func (a *MemoryAdapter) ListPostsByCity(ctx context.Context, city string, p Pagination) ([]*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return a.findPosts(visiblePostsInTenant(ctx, postsInCity(city)), p), nil
+}
+
+// CountPostsByCity returns the number of posts from a specific city
+func (a *MemoryAdapter) CountPostsByCity(ctx context.Context, city string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return a.countPosts(visiblePostsInTenant(ctx, postsInCity(city))), nil
+}
+
+// FindNearbyPosts finds posts within a certain radius of a location, nearest first
+func (a *MemoryAdapter) FindNearbyPosts(ctx context.Context, lat, lng float64, radiusKm float64, limit, offset int) ([]*models.Post, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return a.nearestPosts(visiblePostsInTenant(ctx, postsNear(lat, lng, radiusKm)), lat, lng, limit, offset), nil
+}
+
+// CountNearbyPosts returns the number of posts within a certain radius of a location
+func (a *MemoryAdapter) CountNearbyPosts(ctx context.Context, lat, lng float64, radiusKm float64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return a.countPosts(visiblePostsInTenant(ctx, postsNear(lat, lng, radiusKm))), nil
+}
+
+// Attachment methods
+
+// CreateAttachment creates a new attachment
+func (a *MemoryAdapter) CreateAttachment(ctx context.Context, attachment *models.Attachment) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	attachment.TenantID = TenantFromContext(ctx)
+	if err := attachment.BeforeCreate(nil); err != nil {
+		return err
+	}
+	if _, exists := a.attachments[attachment.ID]; exists {
+		return gorm.ErrDuplicatedKey
+	}
+
+	a.attachments[attachment.ID] = cloneAttachment(attachment)
+	return nil
+}
+
+// GetAttachmentsForPost retrieves all attachments for a post
+func (a *MemoryAdapter) GetAttachmentsForPost(ctx context.Context, postID string) ([]*models.Attachment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.attachmentsForPost(TenantFromContext(ctx), postID), nil
+}
+
+// GetAttachmentForComment retrieves an attachment for a comment
+func (a *MemoryAdapter) GetAttachmentForComment(ctx context.Context, commentID string) (*models.Attachment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	attachment := a.attachmentForComment(TenantFromContext(ctx), commentID)
+	if attachment == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return attachment, nil
+}
+
+// DeleteAttachment deletes an attachment
+func (a *MemoryAdapter) DeleteAttachment(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if attachment, ok := a.attachments[id]; ok && attachment.TenantID == TenantFromContext(ctx) {
+		delete(a.attachments, id)
+	}
+	return nil
+}
+
+// CreateModerationAction records a moderation action
+func (a *MemoryAdapter) CreateModerationAction(ctx context.Context, action *models.ModerationAction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	action.TenantID = TenantFromContext(ctx)
+	if err := action.BeforeCreate(nil); err != nil {
+		return err
+	}
+	if _, exists := a.moderation[action.ID]; exists {
+		return gorm.ErrDuplicatedKey
+	}
+
+	stored := *action
+	a.moderation[action.ID] = &stored
+	return nil
+}
+
+// ListModerationActions retrieves moderation actions, newest first
+func (a *MemoryAdapter) ListModerationActions(ctx context.Context, p Pagination) ([]*models.ModerationAction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	tenantID := TenantFromContext(ctx)
+	actions := make([]*models.ModerationAction, 0)
+	for _, action := range a.moderation {
+		if action.TenantID != tenantID {
+			continue
+		}
+		if p.After != nil && !p.After.isAfterNewestFirst(action.CreatedAt, action.ID) {
+			continue
+		}
+		stored := *action
+		actions = append(actions, &stored)
+	}
+
+	sort.Slice(actions, func(i, j int) bool {
+		if !actions[i].CreatedAt.Equal(actions[j].CreatedAt) {
+			return actions[i].CreatedAt.After(actions[j].CreatedAt)
+		}
+		return actions[i].ID > actions[j].ID
+	})
+	return paginatePage(actions, p), nil
+}
+
+// CreateReactionType creates a custom reaction type
+func (a *MemoryAdapter) CreateReactionType(ctx context.Context, reactionType *models.ReactionType) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	reactionType.TenantID = TenantFromContext(ctx)
+	if err := reactionType.BeforeCreate(nil); err != nil {
+		return err
+	}
+	if _, exists := a.types[reactionType.ID]; exists {
+		return gorm.ErrDuplicatedKey
+	}
+	// Enforce the same uniqueness as idx_reaction_types_tenant_name
+	if a.findReactionType(reactionType.TenantID, reactionType.Name) != nil {
+		return gorm.ErrDuplicatedKey
+	}
+
+	stored := *reactionType
+	a.types[reactionType.ID] = &stored
+	return nil
+}
+
+// GetReactionType retrieves a custom reaction type by name
+func (a *MemoryAdapter) GetReactionType(ctx context.Context, name string) (*models.ReactionType, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	reactionType := a.findReactionType(TenantFromContext(ctx), name)
+	if reactionType == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	found := *reactionType
+	return &found, nil
+}
+
+// ListReactionTypes retrieves all custom reaction types, by name
+func (a *MemoryAdapter) ListReactionTypes(ctx context.Context) ([]*models.ReactionType, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	tenantID := TenantFromContext(ctx)
+	reactionTypes := make([]*models.ReactionType, 0)
+	for _, reactionType := range a.types {
+		if reactionType.TenantID == tenantID {
+			found := *reactionType
+			reactionTypes = append(reactionTypes, &found)
+		}
+	}
+	sort.Slice(reactionTypes, func(i, j int) bool {
+		return reactionTypes[i].Name < reactionTypes[j].Name
+	})
+	return reactionTypes, nil
+}
+
+// DeleteReactionType deletes a custom reaction type. Reactions of the type
+// are kept.
+func (a *MemoryAdapter) DeleteReactionType(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	reactionType := a.findReactionType(TenantFromContext(ctx), name)
+	if reactionType == nil {
+		return gorm.ErrRecordNotFound
+	}
+	delete(a.types, reactionType.ID)
+	return nil
+}
+
+// findReactionType returns the stored reaction type of a tenant with a name,
+// or nil. The caller must hold the lock.
+func (a *MemoryAdapter) findReactionType(tenantID, name string) *models.ReactionType {
+	for _, reactionType := range a.types {
+		if reactionType.TenantID == tenantID && reactionType.Name == name {
+			return reactionType
+		}
+	}
+	return nil
+}
+
+// CreateAPIKey creates a new API key
+func (a *MemoryAdapter) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key.TenantID = TenantFromContext(ctx)
+	if err := key.BeforeCreate(nil); err != nil {
+		return err
+	}
+	if _, exists := a.apiKeys[key.ID]; exists {
+		return gorm.ErrDuplicatedKey
+	}
+	// Enforce the same uniqueness as idx_api_keys_prefix
+	for _, existing := range a.apiKeys {
+		if existing.Prefix == key.Prefix {
+			return gorm.ErrDuplicatedKey
+		}
+	}
+
+	a.apiKeys[key.ID] = cloneAPIKey(key)
+	return nil
+}
+
+// GetAPIKeyByPrefix retrieves the API key with a prefix, of any tenant
+func (a *MemoryAdapter) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, key := range a.apiKeys {
+		if key.Prefix == prefix {
+			return cloneAPIKey(key), nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// ListAPIKeys retrieves all API keys, oldest first
+func (a *MemoryAdapter) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	tenantID := TenantFromContext(ctx)
+	keys := make([]*models.APIKey, 0)
+	for _, key := range a.apiKeys {
+		if key.TenantID == tenantID {
+			keys = append(keys, cloneAPIKey(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an API key
+func (a *MemoryAdapter) RevokeAPIKey(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key, ok := a.apiKeys[id]
+	if !ok || key.TenantID != TenantFromContext(ctx) {
+		return gorm.ErrRecordNotFound
+	}
+	if key.RevokedAt == nil {
+		now := time.Now()
+		key.RevokedAt = &now
+	}
+	return nil
+}
+
+// findPosts returns the posts matching the filter, newest first, with pagination and attachments
+func (a *MemoryAdapter) findPosts(match func(post *models.Post) bool, p Pagination) []*models.Post {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	posts := make([]*models.Post, 0)
+	for _, post := range a.posts {
+		if !match(post) {
+			continue
+		}
+		if p.After != nil && !p.After.isAfterNewestFirst(post.CreatedAt, post.ID) {
+			continue
+		}
+		posts = append(posts, post)
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		if !posts[i].CreatedAt.Equal(posts[j].CreatedAt) {
+			return posts[i].CreatedAt.After(posts[j].CreatedAt)
+		}
+		return posts[i].ID > posts[j].ID
+	})
+
+	posts = paginatePage(posts, p)
+	for i, post := range posts {
+		posts[i] = a.postWithAttachments(post)
+	}
+	return posts
+}
+
+// rankPosts returns the posts matching the search clauses, best matches first,
+// with offset pagination and attachments
+func (a *MemoryAdapter) rankPosts(match func(post *models.Post) bool, clauses []searchClause, p Pagination) []*models.Post {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	posts := make([]*models.Post, 0)
+	scores := make(map[string]int)
+	for _, post := range a.posts {
+		if match(post) {
+			posts = append(posts, post)
+			scores[post.ID] = searchScore(clauses, post.Content)
+		}
+	}
+
+	// Ties are broken newest first, like the SQL adapters
+	sort.Slice(posts, func(i, j int) bool {
+		if scores[posts[i].ID] != scores[posts[j].ID] {
+			return scores[posts[i].ID] > scores[posts[j].ID]
+		}
+		if !posts[i].CreatedAt.Equal(posts[j].CreatedAt) {
+			return posts[i].CreatedAt.After(posts[j].CreatedAt)
+		}
+		return posts[i].ID > posts[j].ID
+	})
+
+	posts = paginate(posts, p.Limit, p.Offset)
+	for i, post := range posts {
+		posts[i] = a.postWithAttachments(post)
+	}
+	return posts
+}
+
+// nearestPosts returns the posts matching the filter, nearest to a location
+// first, with offset pagination and attachments
+func (a *MemoryAdapter) nearestPosts(match func(post *models.Post) bool, lat, lng float64, limit, offset int) []*models.Post {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	posts := make([]*models.Post, 0)
+	distances := make(map[string]float64)
+	for _, post := range a.posts {
+		if match(post) {
+			posts = append(posts, post)
+			distances[post.ID] = haversineKm(lat, lng, post.Latitude, post.Longitude)
+		}
+	}
+
+	// Ties are broken newest first, like the SQL adapters
+	sort.Slice(posts, func(i, j int) bool {
+		if distances[posts[i].ID] != distances[posts[j].ID] {
+			return distances[posts[i].ID] < distances[posts[j].ID]
+		}
+		if !posts[i].CreatedAt.Equal(posts[j].CreatedAt) {
+			return posts[i].CreatedAt.After(posts[j].CreatedAt)
+		}
+		return posts[i].ID > posts[j].ID
+	})
+
+	posts = paginate(posts, limit, offset)
+	for i, post := range posts {
+		posts[i] = a.postWithAttachments(post)
+	}
+	return posts
+}
+
+// countPosts returns the number of posts matching the filter
+func (a *MemoryAdapter) countPosts(match func(post *models.Post) bool) int64 {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var count int64
+	for _, post := range a.posts {
+		if match(post) {
+			count++
+		}
+	}
+	return count
+}
+
+// visiblePostsInTenant restricts a matcher to the posts of the tenant of a
+// context that are not hidden, like visibleInTenant
+func visiblePostsInTenant(ctx context.Context, match func(post *models.Post) bool) func(post *models.Post) bool {
+	tenantID := TenantFromContext(ctx)
+	return func(post *models.Post) bool {
+		return post.TenantID == tenantID && post.HiddenAt == nil && match(post)
+	}
+}
+
+// postsByUser matches the posts of a user, or all posts if userID is empty
+func postsByUser(userID string) func(post *models.Post) bool {
+	return func(post *models.Post) bool {
+		return userID == "" || post.UserID == userID
+	}
+}
+
+// postsMatchingQuery matches posts matching all criteria of a search query,
+// whose text parses to clauses. The matcher must be called with the lock held.
+func (a *MemoryAdapter) postsMatchingQuery(q SearchQuery, clauses []searchClause) func(post *models.Post) bool {
+	return func(post *models.Post) bool {
+		switch {
+		case q.hasText() && searchScore(clauses, post.Content) == 0:
+			return false
+		case q.City != "" && post.City != q.City:
+			return false
+		case q.Near != nil && !postsNear(q.Near.Lat, q.Near.Lng, q.Near.RadiusKm)(post):
+			return false
+		case q.Within != nil && !q.Within.contains(post.Latitude, post.Longitude):
+			return false
+		case q.UserID != "" && post.UserID != q.UserID:
+			return false
+		case !q.Since.IsZero() && post.CreatedAt.Before(q.Since):
+			return false
+		case !q.Until.IsZero() && !post.CreatedAt.Before(q.Until):
+			return false
+		case q.HasAttachments != nil && *q.HasAttachments != a.hasAttachments(post.TenantID, post.ID):
+			return false
+		case q.ReactionType != "" && !a.hasReaction(post.TenantID, post.ID, "post", q.ReactionType):
+			return false
+		}
+		return true
+	}
+}
+
+// hasAttachments reports whether a post has attachments.
+// The caller must hold the lock.
+func (a *MemoryAdapter) hasAttachments(tenantID, postID string) bool {
+	for _, attachment := range a.attachments {
+		if attachment.TenantID == tenantID && attachment.PostID != nil && *attachment.PostID == postID {
+			return true
+		}
+	}
+	return false
+}
+
+// hasReaction reports whether a target has a reaction of a type.
+// The caller must hold the lock.
+func (a *MemoryAdapter) hasReaction(tenantID, targetID, targetType, reactionType string) bool {
+	for _, reaction := range a.reactions {
+		if reaction.TenantID == tenantID && reaction.TargetID == targetID && reaction.TargetType == targetType &&
+			reaction.Type == reactionType {
+			return true
+		}
+	}
+	return false
+}
+
+// postsInCity matches posts from a specific city
+func postsInCity(city string) func(post *models.Post) bool {
+	return func(post *models.Post) bool {
+		return post.City == city
+	}
+}
+
+// postsNear matches posts within a certain radius of a location. Posts
+// without a location, at 0,0, are never near it.
+func postsNear(lat, lng, radiusKm float64) func(post *models.Post) bool {
+	return func(post *models.Post) bool {
+		if post.Latitude == 0 && post.Longitude == 0 {
+			return false
+		}
+		return haversineKm(lat, lng, post.Latitude, post.Longitude) <= radiusKm
+	}
+}
+
+// postWithAttachments returns a copy of the post with its attachments and
+// counters loaded. The caller must hold the lock.
+func (a *MemoryAdapter) postWithAttachments(post *models.Post) *models.Post {
+	found := clonePost(post)
+	attachments := a.attachmentsForPost(post.TenantID, post.ID)
+	found.Attachments = make([]models.Attachment, len(attachments))
+	for i, attachment := range attachments {
+		found.Attachments[i] = *attachment
+	}
+
+	// Counters are counted when read, so they are always accurate
+	for _, comment := range a.comments {
+		if comment.PostID == post.ID && comment.TenantID == post.TenantID {
+			found.CommentCount++
+		}
+	}
+	found.ReactionCounts = a.reactionCountsFor(post.TenantID, post.ID, "post")
+	return found
+}
+
+// commentWithAttachment returns a copy of the comment with its attachment and
+// counters loaded. The caller must hold the lock.
+func (a *MemoryAdapter) commentWithAttachment(comment *models.Comment) *models.Comment {
+	found := cloneComment(comment)
+	found.Attachment = a.attachmentForComment(comment.TenantID, comment.ID)
+
+	for _, reply := range a.comments {
+		if reply.ParentID != nil && *reply.ParentID == comment.ID && reply.TenantID == comment.TenantID {
+			found.ReplyCount++
+		}
+	}
+	found.ReactionCounts = a.reactionCountsFor(comment.TenantID, comment.ID, "comment")
+	return found
+}
+
+// reactionCountsFor counts the reactions of each type to a target.
+// The caller must hold the lock.
+func (a *MemoryAdapter) reactionCountsFor(tenantID, targetID, targetType string) map[string]int64 {
+	counts := map[string]int64{}
+	for _, reaction := range a.reactions {
+		if reaction.TenantID == tenantID && reaction.TargetID == targetID && reaction.TargetType == targetType {
+			counts[reaction.Type]++
+		}
+	}
+	return counts
+}
+
+// attachmentsForPost returns copies of the attachments of a post in creation order.
+// The caller must hold the lock.
+func (a *MemoryAdapter) attachmentsForPost(tenantID, postID string) []*models.Attachment {
+	attachments := make([]*models.Attachment, 0)
+	for _, attachment := range a.attachments {
+		if attachment.TenantID == tenantID && attachment.PostID != nil && *attachment.PostID == postID {
+			attachments = append(attachments, cloneAttachment(attachment))
+		}
+	}
+
+	sort.Slice(attachments, func(i, j int) bool {
+		if !attachments[i].CreatedAt.Equal(attachments[j].CreatedAt) {
+			return attachments[i].CreatedAt.Before(attachments[j].CreatedAt)
+		}
+		return attachments[i].ID < attachments[j].ID
+	})
+	return attachments
+}
+
+// attachmentForComment returns a copy of the attachment of a comment, or nil.
+// Like the SQL adapters, the attachment with the lowest ID wins if there are several.
+// The caller must hold the lock.
+func (a *MemoryAdapter) attachmentForComment(tenantID, commentID string) *models.Attachment {
+	var found *models.Attachment
+	for _, attachment := range a.attachments {
+		if attachment.TenantID != tenantID || attachment.CommentID == nil || *attachment.CommentID != commentID {
+			continue
+		}
+		if found == nil || attachment.ID < found.ID {
+			found = attachment
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	return cloneAttachment(found)
+}
+
+// findReaction returns the stored reaction matching the unique key, or nil.
+// The caller must hold the lock.
+func (a *MemoryAdapter) findReaction(tenantID, userID, targetID, targetType, reactionType string) *models.Reaction {
+	for _, reaction := range a.reactions {
+		if reaction.TenantID == tenantID && reaction.UserID == userID && reaction.TargetID == targetID &&
+			reaction.TargetType == targetType && reaction.Type == reactionType {
+			return reaction
+		}
+	}
+	return nil
+}
+
+// deleteReactionsFor deletes all reactions to a target. The caller must hold the write lock.
+func (a *MemoryAdapter) deleteReactionsFor(tenantID, targetID, targetType string) {
+	for id, reaction := range a.reactions {
+		if reaction.TenantID == tenantID && reaction.TargetID == targetID && reaction.TargetType == targetType {
+			delete(a.reactions, id)
+		}
+	}
+}
+
+// deleteCommentLocked deletes a comment, its attachment and all its reactions.
+// The caller must hold the write lock.
+func (a *MemoryAdapter) deleteCommentLocked(tenantID, id string) {
+	a.deleteReactionsFor(tenantID, id, "comment")
+
+	for attachmentID, attachment := range a.attachments {
+		if attachment.TenantID == tenantID && attachment.CommentID != nil && *attachment.CommentID == id {
+			delete(a.attachments, attachmentID)
+		}
+	}
+
+	delete(a.comments, id)
+}
+
+// clonePost copies a post so stored records never alias caller-owned values
+func clonePost(post *models.Post) *models.Post {
+	copied := *post
+	copied.Metadata = cloneJSON(post.Metadata)
+	copied.HiddenAt = cloneTime(post.HiddenAt)
+	copied.Attachments = nil
+	copied.Snippet = ""
+	copied.CommentCount = 0
+	copied.ReactionCounts = nil
+	return &copied
+}
+
+// cloneComment copies a comment so stored records never alias caller-owned values
+func cloneComment(comment *models.Comment) *models.Comment {
+	copied := *comment
+	copied.Metadata = cloneJSON(comment.Metadata)
+	copied.ParentID = cloneString(comment.ParentID)
+	copied.HiddenAt = cloneTime(comment.HiddenAt)
+	copied.Attachment = nil
+	copied.ReplyCount = 0
+	copied.ReactionCounts = nil
+	return &copied
+}
+
+// cloneAttachment copies an attachment so stored records never alias caller-owned values
+func cloneAttachment(attachment *models.Attachment) *models.Attachment {
+	copied := *attachment
+	copied.Metadata = cloneJSON(attachment.Metadata)
+	copied.PostID = cloneString(attachment.PostID)
+	copied.CommentID = cloneString(attachment.CommentID)
+	return &copied
+}
+
+// cloneTable copies a table of records with their clone function
+func cloneTable[T any](table map[string]*T, clone func(*T) *T) map[string]*T {
+	copied := make(map[string]*T, len(table))
+	for id, record := range table {
+		copied[id] = clone(record)
+	}
+	return copied
+}
+
+// copyRecord copies records whose fields are only ever replaced, never changed in place
+func copyRecord[T any](record *T) *T {
+	copied := *record
+	return &copied
+}
+
+func cloneAPIKey(key *models.APIKey) *models.APIKey {
+	copied := *key
+	copied.Scopes = append(models.StringList{}, key.Scopes...)
+	copied.RevokedAt = cloneTime(key.RevokedAt)
+	return &copied
+}
+
+func cloneJSON(data models.JSON) models.JSON {
+	if data == nil {
+		return nil
+	}
+	copied := make(models.JSON, len(data))
+	for key, value := range data {
+		copied[key] = value
+	}
+	return copied
+}
+
+func cloneString(value *string) *string {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
+
+func cloneTime(value *time.Time) *time.Time {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
+
+// EnqueueEvent writes a hook event to the outbox
+func (a *MemoryAdapter) EnqueueEvent(ctx context.Context, event *models.OutboxEvent) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	event.TenantID = TenantFromContext(ctx)
+	if err := event.BeforeCreate(nil); err != nil {
+		return err
+	}
+	if _, exists := a.events[event.ID]; exists {
+		return gorm.ErrDuplicatedKey
+	}
+
+	a.events[event.ID] = cloneOutboxEvent(event)
+	return nil
+}
+
+// ClaimEvents leases the hook events of every tenant that are due for
+// delivery, oldest first
+func (a *MemoryAdapter) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	due := make([]*models.OutboxEvent, 0)
+	for _, event := range a.events {
+		if event.DeliveredAt == nil && event.DeadLetteredAt == nil && !event.AvailableAt.After(now) {
+			due = append(due, event)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].AvailableAt.Equal(due[j].AvailableAt) {
+			return due[i].AvailableAt.Before(due[j].AvailableAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]*models.OutboxEvent, len(due))
+	for i, event := range due {
+		event.AvailableAt = now.Add(lease)
+		event.Attempts++
+		claimed[i] = cloneOutboxEvent(event)
+	}
+	sort.Slice(claimed, func(i, j int) bool {
+		if !claimed[i].CreatedAt.Equal(claimed[j].CreatedAt) {
+			return claimed[i].CreatedAt.Before(claimed[j].CreatedAt)
+		}
+		return claimed[i].ID < claimed[j].ID
+	})
+	return claimed, nil
+}
+
+// CompleteEvent marks a hook event delivered
+func (a *MemoryAdapter) CompleteEvent(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if event, ok := a.events[id]; ok {
+		now := time.Now()
+		event.DeliveredAt = &now
+	}
+	return nil
+}
+
+// ReleaseEvent makes a claimed hook event due now, giving back the attempt
+// its claim took
+func (a *MemoryAdapter) ReleaseEvent(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if event, ok := a.events[id]; ok && event.DeliveredAt == nil && event.DeadLetteredAt == nil && event.Attempts > 0 {
+		event.AvailableAt = time.Now()
+		event.Attempts--
+	}
+	return nil
+}
+
+// FailEvent records why delivering a hook event failed, and when to retry it
+func (a *MemoryAdapter) FailEvent(ctx context.Context, id, lastError string, retryAt time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if event, ok := a.events[id]; ok {
+		event.LastError = lastError
+		event.AvailableAt = retryAt
+	}
+	return nil
+}
+
+// DeadLetterEvent records why delivering a hook event failed for the last time
+func (a *MemoryAdapter) DeadLetterEvent(ctx context.Context, id, lastError string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if event, ok := a.events[id]; ok {
+		now := time.Now()
+		event.LastError = lastError
+		event.DeadLetteredAt = &now
+	}
+	return nil
+}
+
+// DeleteDeliveredEvents deletes the hook events of every tenant delivered
+// before a time
+func (a *MemoryAdapter) DeleteDeliveredEvents(ctx context.Context, before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var deleted int64
+	for id, event := range a.events {
+		if event.DeliveredAt != nil && event.DeliveredAt.Before(before) {
+			delete(a.events, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// DeleteDeadLetteredEvents deletes the hook events of every tenant
+// dead-lettered before a time
+func (a *MemoryAdapter) DeleteDeadLetteredEvents(ctx context.Context, before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var deleted int64
+	for id, event := range a.events {
+		if event.DeadLetteredAt != nil && event.DeadLetteredAt.Before(before) {
+			delete(a.events, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// GetEvent retrieves a hook event by ID
+func (a *MemoryAdapter) GetEvent(ctx context.Context, id string) (*models.OutboxEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	event, ok := a.events[id]
+	if !ok || event.TenantID != TenantFromContext(ctx) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return cloneOutboxEvent(event), nil
+}
+
+// ListEvents retrieves the hook events created in a time range, oldest first
+func (a *MemoryAdapter) ListEvents(ctx context.Context, since, until time.Time, limit int) ([]*models.OutboxEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	tenantID := TenantFromContext(ctx)
+	events := make([]*models.OutboxEvent, 0)
+	for _, event := range a.events {
+		if event.TenantID != tenantID || event.SubscriptionID != "" {
+			continue
+		}
+		if event.CreatedAt.Before(since) || !event.CreatedAt.Before(until) {
+			continue
+		}
+		events = append(events, cloneOutboxEvent(event))
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].CreatedAt.Equal(events[j].CreatedAt) {
+			return events[i].CreatedAt.Before(events[j].CreatedAt)
+		}
+		return events[i].ID < events[j].ID
+	})
+	return paginate(events, limit, 0), nil
+}
+
+// ListDeadLetteredEvents retrieves the dead-lettered hook events, newest first
+func (a *MemoryAdapter) ListDeadLetteredEvents(ctx context.Context, p Pagination) ([]*models.OutboxEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	tenantID := TenantFromContext(ctx)
+	events := make([]*models.OutboxEvent, 0)
+	for _, event := range a.events {
+		if event.TenantID != tenantID || event.DeadLetteredAt == nil {
+			continue
+		}
+		if p.After != nil && !p.After.isAfterNewestFirst(event.CreatedAt, event.ID) {
+			continue
+		}
+		events = append(events, cloneOutboxEvent(event))
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].CreatedAt.Equal(events[j].CreatedAt) {
+			return events[i].CreatedAt.After(events[j].CreatedAt)
+		}
+		return events[i].ID > events[j].ID
+	})
+	return paginatePage(events, p), nil
+}
+
+// ReplayEvent makes a dead-lettered hook event due for delivery again
+func (a *MemoryAdapter) ReplayEvent(ctx context.Context, id string) (*models.OutboxEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	event, ok := a.events[id]
+	if !ok || event.TenantID != TenantFromContext(ctx) || event.DeadLetteredAt == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	event.DeadLetteredAt = nil
+	event.Attempts = 0
+	event.AvailableAt = time.Now()
+	return cloneOutboxEvent(event), nil
+}
+
+// cloneOutboxEvent copies an outbox event so stored records never alias caller-owned values
+func cloneOutboxEvent(event *models.OutboxEvent) *models.OutboxEvent {
+	copied := *event
+	copied.DeliveredAt = cloneTime(event.DeliveredAt)
+	copied.DeadLetteredAt = cloneTime(event.DeadLetteredAt)
+	return &copied
+}
+
+// CreateWebhookSubscription creates a webhook subscription
+func (a *MemoryAdapter) CreateWebhookSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	subscription.TenantID = TenantFromContext(ctx)
+	if err := subscription.BeforeCreate(nil); err != nil {
+		return err
+	}
+	if _, exists := a.webhooks[subscription.ID]; exists {
+		return gorm.ErrDuplicatedKey
+	}
+
+	// Stats are only written by recording deliveries
+	subscription.Stats = models.WebhookStats{}
+	a.webhooks[subscription.ID] = cloneWebhookSubscription(subscription)
+	return nil
+}
+
+// GetWebhookSubscription retrieves a webhook subscription by ID
+func (a *MemoryAdapter) GetWebhookSubscription(ctx context.Context, id string) (*models.WebhookSubscription, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	subscription, ok := a.webhooks[id]
+	if !ok || subscription.TenantID != TenantFromContext(ctx) {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return cloneWebhookSubscription(subscription), nil
+}
+
+// ListWebhookSubscriptions retrieves all webhook subscriptions, oldest first
+func (a *MemoryAdapter) ListWebhookSubscriptions(ctx context.Context) ([]*models.WebhookSubscription, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	tenantID := TenantFromContext(ctx)
+	subscriptions := make([]*models.WebhookSubscription, 0)
+	for _, subscription := range a.webhooks {
+		if subscription.TenantID == tenantID {
+			subscriptions = append(subscriptions, cloneWebhookSubscription(subscription))
+		}
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if !subscriptions[i].CreatedAt.Equal(subscriptions[j].CreatedAt) {
+			return subscriptions[i].CreatedAt.Before(subscriptions[j].CreatedAt)
+		}
+		return subscriptions[i].ID < subscriptions[j].ID
+	})
+	return subscriptions, nil
+}
+
+// UpdateWebhookSubscription updates a webhook subscription, except its delivery stats
+func (a *MemoryAdapter) UpdateWebhookSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	existing, ok := a.webhooks[subscription.ID]
+	if !ok || existing.TenantID != TenantFromContext(ctx) {
+		return gorm.ErrRecordNotFound
+	}
+
+	subscription.TenantID = existing.TenantID
+	subscription.UpdatedAt = time.Now()
+	updated := cloneWebhookSubscription(subscription)
+	updated.Stats = existing.Stats
+	a.webhooks[subscription.ID] = updated
+	return nil
+}
+
+// DeleteWebhookSubscription deletes a webhook subscription
+func (a *MemoryAdapter) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	subscription, ok := a.webhooks[id]
+	if !ok || subscription.TenantID != TenantFromContext(ctx) {
+		return gorm.ErrRecordNotFound
+	}
+	delete(a.webhooks, id)
+	return nil
+}
+
+// RecordWebhookDelivery stores a delivery to a webhook, counting it in the
+// stats of its subscription
+func (a *MemoryAdapter) RecordWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delivery.TenantID = TenantFromContext(ctx)
+	if err := delivery.BeforeCreate(nil); err != nil {
+		return err
+	}
+	if _, exists := a.deliveries[delivery.ID]; exists {
+		return gorm.ErrDuplicatedKey
+	}
+	stored := *delivery
+	a.deliveries[delivery.ID] = &stored
+
+	subscription, ok := a.webhooks[delivery.SubscriptionID]
+	if !ok || subscription.TenantID != delivery.TenantID {
+		return nil
+	}
+	at := delivery.CreatedAt
+	if delivery.Error == "" {
+		subscription.Stats.DeliveredCount++
+		subscription.Stats.LastDeliveredAt = &at
+	} else {
+		subscription.Stats.FailedCount++
+		subscription.Stats.LastFailedAt = &at
+		subscription.Stats.LastError = delivery.Error
+	}
+	return nil
+}
+
+// ListWebhookDeliveries retrieves the webhook deliveries matching a query, newest first
+func (a *MemoryAdapter) ListWebhookDeliveries(ctx context.Context, q DeliveryQuery, p Pagination) ([]*models.WebhookDelivery, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	tenantID := TenantFromContext(ctx)
+	deliveries := make([]*models.WebhookDelivery, 0)
+	for _, delivery := range a.deliveries {
+		if delivery.TenantID != tenantID {
+			continue
+		}
+		if q.SubscriptionID != "" && delivery.SubscriptionID != q.SubscriptionID {
+			continue
+		}
+		if q.EventID != "" && delivery.EventID != q.EventID {
+			continue
+		}
+		if q.Failed != nil && *q.Failed != (delivery.Error != "") {
+			continue
+		}
+		if p.After != nil && !p.After.isAfterNewestFirst(delivery.CreatedAt, delivery.ID) {
+			continue
+		}
+		copied := *delivery
+		deliveries = append(deliveries, &copied)
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID > deliveries[j].ID
+	})
+	return paginatePage(deliveries, p), nil
+}
+
+// DeleteWebhookDeliveries deletes the webhook deliveries of every tenant
+// made before a time
+func (a *MemoryAdapter) DeleteWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var deleted int64
+	for id, delivery := range a.deliveries {
+		if delivery.CreatedAt.Before(before) {
+			delete(a.deliveries, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// cloneWebhookSubscription copies a webhook subscription so stored records
+// never alias caller-owned values
+func cloneWebhookSubscription(subscription *models.WebhookSubscription) *models.WebhookSubscription {
+	copied := *subscription
+	copied.EventTypes = append(models.StringList{}, subscription.EventTypes...)
+	copied.PostIDs = append(models.StringList{}, subscription.PostIDs...)
+	copied.UserIDs = append(models.StringList{}, subscription.UserIDs...)
+	copied.Stats.LastDeliveredAt = cloneTime(subscription.Stats.LastDeliveredAt)
+	copied.Stats.LastFailedAt = cloneTime(subscription.Stats.LastFailedAt)
+	return &copied
+}
@@ -0,0 +1,22 @@
+package adapters_test
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+
+	"sonet/internal/adapters"
+	"sonet/internal/adapters/adaptertest"
+)
+
+func TestMemoryAdapterConformance(t *testing.T) {
+	adaptertest.Run(t, func(t *testing.T) adapters.DatabaseAdapter {
+		viper.Set("DB_ADAPTER", "memory")
+
+		db, err := adapters.NewDatabaseAdapter()
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+		return db
+	})
+}
@@ -0,0 +1,76 @@
+package adapters
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+
+	"sonet/internal/migrations"
+)
+
+// Schema migration modes, selected with DB_MIGRATE_MODE
+const (
+	// MigrateUp applies pending versioned migrations on startup (the default)
+	MigrateUp = "up"
+	// MigrateAuto uses GORM's AutoMigrate instead of versioned migrations, for development
+	MigrateAuto = "auto"
+	// MigrateNone leaves the schema alone; run `sonet migrate up` separately
+	MigrateNone = "none"
+)
+
+// migrateSchema brings the schema up to date according to DB_MIGRATE_MODE.
+// autoMigrate is the adapter's AutoMigrate based setup, used in auto mode.
+func migrateSchema(db *gorm.DB, dialect string, autoMigrate func(db *gorm.DB) error) error {
+	switch mode := viper.GetString("DB_MIGRATE_MODE"); mode {
+	case MigrateUp, "":
+		migrator, err := migrations.New(db, dialect)
+		if err != nil {
+			return err
+		}
+		_, err = migrator.Up(context.Background())
+		return err
+	case MigrateAuto:
+		return autoMigrate(db)
+	case MigrateNone:
+		return nil
+	default:
+		return fmt.Errorf("unknown DB_MIGRATE_MODE %q", mode)
+	}
+}
+
+// NewMigrator opens the configured database for running schema migrations.
+// The returned function closes the database connection.
+func NewMigrator() (*migrations.Migrator, func() error, error) {
+	var db *gorm.DB
+	var dialect string
+	var err error
+
+	switch adapterType := viper.GetString("DB_ADAPTER"); adapterType {
+	case "postgres":
+		db, err = openPostgres()
+		dialect = migrations.Postgres
+	case "memory", "firestore", "supabase":
+		return nil, nil, fmt.Errorf("the %s adapter does not use schema migrations", adapterType)
+	default:
+		db, err = openSQLite()
+		dialect = migrations.SQLite
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	migrator, err := migrations.New(db, dialect)
+	if err != nil {
+		_ = sqlDB.Close()
+		return nil, nil, err
+	}
+
+	return migrator, sqlDB.Close, nil
+}
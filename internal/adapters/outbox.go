@@ -0,0 +1,137 @@
+package adapters
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"sonet/internal/models"
+)
+
+// enqueueEvent writes an event of the tenant of the context to the outbox
+func enqueueEvent(ctx context.Context, db *gorm.DB, event *models.OutboxEvent) error {
+	event.TenantID = TenantFromContext(ctx)
+	return db.WithContext(ctx).Create(event).Error
+}
+
+// claimEvents leases up to limit events that are due for delivery and not
+// dead-lettered, of every tenant, oldest first. Claiming takes an attempt and makes the events due
+// again once the lease expires, unless they are marked delivered before.
+// PostgreSQL skips the events other dispatchers are claiming; SQLite
+// serializes writers, so it needs no row locks.
+func claimEvents(ctx context.Context, db *gorm.DB, limit int, lease time.Duration) ([]*models.OutboxEvent, error) {
+	now := time.Now()
+	var events []*models.OutboxEvent
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		due := tx.Model(&models.OutboxEvent{}).Select("id").
+			Where("delivered_at IS NULL AND dead_lettered_at IS NULL AND available_at <= ?", now).
+			Order("available_at ASC, id ASC").
+			Limit(limit).
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+
+		return tx.Model(&events).Clauses(clause.Returning{}).
+			Where("id IN (?)", due).
+			Updates(map[string]interface{}{
+				"available_at": now.Add(lease),
+				"attempts":     gorm.Expr("attempts + 1"),
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows come back in no particular order
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].CreatedAt.Equal(events[j].CreatedAt) {
+			return events[i].CreatedAt.Before(events[j].CreatedAt)
+		}
+		return events[i].ID < events[j].ID
+	})
+	return events, nil
+}
+
+// completeEvent marks an event delivered
+func completeEvent(ctx context.Context, db *gorm.DB, id string) error {
+	return db.WithContext(ctx).Model(&models.OutboxEvent{}).Where("id = ?", id).
+		Update("delivered_at", time.Now()).Error
+}
+
+// releaseEvent makes a claimed event due now, giving back the attempt its
+// claim took
+func releaseEvent(ctx context.Context, db *gorm.DB, id string) error {
+	return db.WithContext(ctx).Model(&models.OutboxEvent{}).
+		Where("id = ? AND delivered_at IS NULL AND dead_lettered_at IS NULL AND attempts > 0", id).
+		Updates(map[string]interface{}{"available_at": time.Now(), "attempts": gorm.Expr("attempts - 1")}).Error
+}
+
+// failEvent records why delivering an event failed, and when it is due again
+func failEvent(ctx context.Context, db *gorm.DB, id, lastError string, retryAt time.Time) error {
+	return db.WithContext(ctx).Model(&models.OutboxEvent{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"last_error": lastError, "available_at": retryAt}).Error
+}
+
+// deadLetterEvent records why delivering an event failed for the last time,
+// and stops claiming it
+func deadLetterEvent(ctx context.Context, db *gorm.DB, id, lastError string) error {
+	return db.WithContext(ctx).Model(&models.OutboxEvent{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"last_error": lastError, "dead_lettered_at": time.Now()}).Error
+}
+
+// listDeadLetteredEvents lists the dead-lettered events of the tenant of the
+// context, newest first
+func listDeadLetteredEvents(ctx context.Context, db *gorm.DB, p Pagination) ([]*models.OutboxEvent, error) {
+	var events []*models.OutboxEvent
+	err := newestFirst(inTenant(ctx, db, "outbox_events").Where("dead_lettered_at IS NOT NULL"), p).Find(&events).Error
+	return events, err
+}
+
+// getEvent retrieves an event of the tenant of the context
+func getEvent(ctx context.Context, db *gorm.DB, id string) (*models.OutboxEvent, error) {
+	var event models.OutboxEvent
+	if err := inTenant(ctx, db, "outbox_events").First(&event, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// listEvents lists up to limit events of the tenant of the context created
+// in [since, until), oldest first, once each: without their copies for
+// webhook subscriptions
+func listEvents(ctx context.Context, db *gorm.DB, since, until time.Time, limit int) ([]*models.OutboxEvent, error) {
+	var events []*models.OutboxEvent
+	err := inTenant(ctx, db, "outbox_events").
+		Where("subscription_id = '' AND created_at >= ? AND created_at < ?", since, until).
+		Order("created_at ASC, id ASC").Limit(limit).Find(&events).Error
+	return events, err
+}
+
+// replayEvent makes a dead-lettered event of the tenant of the context due
+// now, with a fresh set of attempts
+func replayEvent(ctx context.Context, db *gorm.DB, id string) (*models.OutboxEvent, error) {
+	var events []*models.OutboxEvent
+	result := inTenant(ctx, db, "outbox_events").Model(&events).Clauses(clause.Returning{}).
+		Where("id = ? AND dead_lettered_at IS NOT NULL", id).
+		Updates(map[string]interface{}{"dead_lettered_at": nil, "attempts": 0, "available_at": time.Now()})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(events) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return events[0], nil
+}
+
+// deleteDeliveredEvents deletes the events of every tenant delivered before a time
+func deleteDeliveredEvents(ctx context.Context, db *gorm.DB, before time.Time) (int64, error) {
+	result := db.WithContext(ctx).Delete(&models.OutboxEvent{}, "delivered_at < ?", before)
+	return result.RowsAffected, result.Error
+}
+
+// deleteDeadLetteredEvents deletes the events of every tenant dead-lettered before a time
+func deleteDeadLetteredEvents(ctx context.Context, db *gorm.DB, before time.Time) (int64, error) {
+	result := db.WithContext(ctx).Delete(&models.OutboxEvent{}, "dead_lettered_at < ?", before)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,44 @@
+package adapters
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"sonet/internal/models"
+)
+
+// Test that events are rolled back along with the change they describe
+func TestTransactionRollsBackEvents(t *testing.T) {
+	viper.Set("DB_CONNECTION_STRING", filepath.Join(t.TempDir(), "sonet.db"))
+	a, err := newSQLiteAdapter()
+	require.NoError(t, err)
+	defer a.Close()
+
+	ctx := context.Background()
+	failed := errors.New("failed")
+	post := &models.Post{UserID: "user-1", Content: "post"}
+	err = a.Transaction(ctx, func(tx DatabaseAdapter) error {
+		if err := tx.CreatePost(ctx, post); err != nil {
+			return err
+		}
+		if err := tx.EnqueueEvent(ctx, &models.OutboxEvent{Type: "post_created", Payload: `{}`}); err != nil {
+			return err
+		}
+		return failed
+	})
+	assert.Equal(t, failed, err)
+
+	_, err = a.GetPostByID(ctx, post.ID)
+	assert.True(t, errors.Is(err, gorm.ErrRecordNotFound), "expected gorm.ErrRecordNotFound, got %v", err)
+	events, err := a.ClaimEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+}
@@ -0,0 +1,106 @@
+package adapters
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Pagination selects a window of an ordered result set. When After is set,
+// keyset pagination is used: results start right after the cursor and
+// Offset is ignored.
+type Pagination struct {
+	Limit  int
+	Offset int
+	After  *Cursor
+}
+
+// Cursor identifies a row in a result set ordered by (created_at, id)
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Encode returns the opaque string form of the cursor
+func (c Cursor) Encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor produced by Cursor.Encode
+func DecodeCursor(encoded string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok || id == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &Cursor{CreatedAt: time.Unix(0, unixNano), ID: id}, nil
+}
+
+// newestFirst orders a query by (created_at, id) descending and applies the pagination
+func newestFirst(query *gorm.DB, p Pagination) *gorm.DB {
+	query = query.Order("created_at DESC, id DESC").Limit(p.Limit)
+	if p.After != nil {
+		return query.Where("(created_at < ? OR (created_at = ? AND id < ?))",
+			p.After.CreatedAt, p.After.CreatedAt, p.After.ID)
+	}
+	return query.Offset(p.Offset)
+}
+
+// oldestFirst orders a query by (created_at, id) ascending and applies the pagination
+func oldestFirst(query *gorm.DB, p Pagination) *gorm.DB {
+	query = query.Order("created_at ASC, id ASC").Limit(p.Limit)
+	if p.After != nil {
+		return query.Where("(created_at > ? OR (created_at = ? AND id > ?))",
+			p.After.CreatedAt, p.After.CreatedAt, p.After.ID)
+	}
+	return query.Offset(p.Offset)
+}
+
+// isAfterNewestFirst reports whether a row comes after the cursor in newest-first order
+func (c *Cursor) isAfterNewestFirst(createdAt time.Time, id string) bool {
+	return createdAt.Before(c.CreatedAt) || (createdAt.Equal(c.CreatedAt) && id < c.ID)
+}
+
+// isAfterOldestFirst reports whether a row comes after the cursor in oldest-first order
+func (c *Cursor) isAfterOldestFirst(createdAt time.Time, id string) bool {
+	return createdAt.After(c.CreatedAt) || (createdAt.Equal(c.CreatedAt) && id > c.ID)
+}
+
+// paginate applies limit and offset to an already ordered slice
+func paginate[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return []T{}
+	}
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[offset:end]
+}
+
+// paginatePage applies a Pagination to an already ordered slice that has been
+// filtered by the cursor, if any
+func paginatePage[T any](items []T, p Pagination) []T {
+	if p.After != nil {
+		return paginate(items, p.Limit, 0)
+	}
+	return paginate(items, p.Limit, p.Offset)
+}
@@ -1,23 +1,54 @@
 package adapters
 
 import (
+	"context"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 
+	"sonet/internal/migrations"
 	"sonet/internal/models"
 )
 
 // PostgresAdapter implements the DatabaseAdapter interface for PostgreSQL
 type PostgresAdapter struct {
-	db *gorm.DB
+	db     *gorm.DB
+	search searchConfigs
 }
 
 // newPostgresAdapter creates a new PostgreSQL database adapter
 func newPostgresAdapter() (*PostgresAdapter, error) {
+	search, err := loadSearchConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := openPostgres()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrateSchema(db, migrations.Postgres, autoMigratePostgres); err != nil {
+		return nil, fmt.Errorf("failed to migrate database schema: %v", err)
+	}
+
+	if err := search.validate(db); err != nil {
+		return nil, err
+	}
+
+	return &PostgresAdapter{db: db, search: search}, nil
+}
+
+// openPostgres opens the PostgreSQL database configured in DB_CONNECTION_STRING
+func openPostgres() (*gorm.DB, error) {
 	dsn := viper.GetString("DB_CONNECTION_STRING")
 
 	// Configure the logger
@@ -28,71 +59,98 @@ func newPostgresAdapter() (*PostgresAdapter, error) {
 
 	// Open the database connection
 	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logLevel),
+		Logger:         logger.Default.LogMode(logLevel),
+		TranslateError: true,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %v", err)
 	}
 
+	return db, nil
+}
+
+// autoMigratePostgres creates the schema with GORM's AutoMigrate, for development
+func autoMigratePostgres(db *gorm.DB) error {
 	// Enable PostGIS extension for geospatial features
 	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS postgis").Error; err != nil {
-		return nil, fmt.Errorf("failed to enable PostGIS extension: %v", err)
+		return fmt.Errorf("failed to enable PostGIS extension: %v", err)
+	}
+
+	if err := db.AutoMigrate(&models.Post{}, &models.Comment{}, &models.Reaction{}, &models.Attachment{}, &models.ModerationAction{}, &models.APIKey{}, &models.ReactionType{}, &models.ReactionCount{}, &models.OutboxEvent{}, &models.WebhookSubscription{}, &models.WebhookDelivery{}); err != nil {
+		return err
 	}
 
 	// Create a spatial index for geolocation queries if it doesn't exist
 	if err := db.Exec(`
-		DO $$
-		BEGIN
-			IF NOT EXISTS (
-				SELECT 1 FROM pg_indexes WHERE indexname = 'idx_posts_location'
-			) THEN
-				CREATE INDEX idx_posts_location ON posts USING GIST (
-					ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)
-				);
-			END IF;
-		END $$;
+		CREATE INDEX IF NOT EXISTS idx_posts_location ON posts USING GIST (
+			ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)
+		)
 	`).Error; err != nil {
-		return nil, fmt.Errorf("failed to create spatial index: %v", err)
+		return fmt.Errorf("failed to create spatial index: %v", err)
 	}
 
-	// Auto migrate the schema
-	if err := db.AutoMigrate(&models.Post{}, &models.Comment{}, &models.Reaction{}, &models.Attachment{}); err != nil {
-		return nil, fmt.Errorf("failed to migrate database schema: %v", err)
+	// Index post content for full-text search, as migration 0002_post_search does
+	for _, statement := range []string{
+		"ALTER TABLE posts ADD COLUMN IF NOT EXISTS search_config regconfig NOT NULL DEFAULT 'english'",
+		`ALTER TABLE posts ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (to_tsvector(search_config, coalesce(content, ''))) STORED`,
+		"CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING GIN (search_vector)",
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("failed to create search index: %v", err)
+		}
 	}
 
-	return &PostgresAdapter{db: db}, nil
+	return nil
+}
+
+// postgresPost is a post with the text search configuration its content is
+// indexed with, a column only the PostgreSQL schema has
+type postgresPost struct {
+	models.Post
+	SearchConfig string
+}
+
+// TableName stores postgresPost in the posts table
+func (postgresPost) TableName() string {
+	return "posts"
 }
 
 // CreatePost creates a new post
-func (a *PostgresAdapter) CreatePost(post *models.Post) error {
-	return a.db.Create(post).Error
+func (a *PostgresAdapter) CreatePost(ctx context.Context, post *models.Post) error {
+	post.TenantID = TenantFromContext(ctx)
+	row := postgresPost{Post: *post, SearchConfig: a.search.forLanguage(post.Language)}
+	if err := a.db.WithContext(ctx).Create(&row).Error; err != nil {
+		return err
+	}
+
+	*post = row.Post
+	return nil
 }
 
 // GetPostByID retrieves a post by its ID with attachments
-func (a *PostgresAdapter) GetPostByID(id string) (*models.Post, error) {
+func (a *PostgresAdapter) GetPostByID(ctx context.Context, id string) (*models.Post, error) {
 	var post models.Post
-	err := a.db.First(&post, "id = ?", id).Error
+	err := inTenant(ctx, a.db, "posts").First(&post, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
 
-	// Load attachments
-	attachments, err := a.GetAttachmentsForPost(id)
-	if err != nil {
+	// Load attachments and reaction counts
+	if err := loadPostAttachments(inTenant(ctx, a.db, "attachments"), []*models.Post{&post}); err != nil {
 		return nil, err
 	}
-	post.Attachments = make([]models.Attachment, len(attachments))
-	for i, attachment := range attachments {
-		post.Attachments[i] = *attachment
+	if err := loadPostReactionCounts(inTenant(ctx, a.db, "reaction_counts"), []*models.Post{&post}); err != nil {
+		return nil, err
 	}
 
 	return &post, nil
 }
 
 // ListPosts retrieves posts with pagination and attachments
-func (a *PostgresAdapter) ListPosts(userID string, limit, offset int) ([]*models.Post, error) {
+func (a *PostgresAdapter) ListPosts(ctx context.Context, userID string, p Pagination) ([]*models.Post, error) {
 	var posts []*models.Post
-	query := a.db.Order("created_at DESC").Limit(limit).Offset(offset)
+	query := newestFirst(visibleInTenant(ctx, a.db, "posts"), p)
 	if userID != "" {
 		query = query.Where("user_id = ?", userID)
 	}
@@ -102,147 +160,281 @@ func (a *PostgresAdapter) ListPosts(userID string, limit, offset int) ([]*models
 		return nil, err
 	}
 
-	// Load attachments for each post
-	for _, post := range posts {
-		attachments, err := a.GetAttachmentsForPost(post.ID)
-		if err != nil {
-			return nil, err
-		}
-		post.Attachments = make([]models.Attachment, len(attachments))
-		for i, attachment := range attachments {
-			post.Attachments[i] = *attachment
-		}
+	// Load attachments and reaction counts for all posts in one query each
+	if err := loadPostAttachments(inTenant(ctx, a.db, "attachments"), posts); err != nil {
+		return nil, err
+	}
+	if err := loadPostReactionCounts(inTenant(ctx, a.db, "reaction_counts"), posts); err != nil {
+		return nil, err
 	}
 
 	return posts, nil
 }
 
-// UpdatePost updates an existing post
-func (a *PostgresAdapter) UpdatePost(post *models.Post) error {
-	return a.db.Save(post).Error
+// CountPosts returns the number of posts, optionally filtered by user
+func (a *PostgresAdapter) CountPosts(ctx context.Context, userID string) (int64, error) {
+	var count int64
+	query := visibleInTenant(ctx, a.db, "posts").Model(&models.Post{})
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	err := query.Count(&count).Error
+	return count, err
+}
+
+// UpdatePost updates an existing post, reindexing it if its language changed
+func (a *PostgresAdapter) UpdatePost(ctx context.Context, post *models.Post) error {
+	post.TenantID = TenantFromContext(ctx)
+	row := postgresPost{Post: *post, SearchConfig: a.search.forLanguage(post.Language)}
+	if err := updateInTenant(ctx, a.db, "posts", &row); err != nil {
+		return err
+	}
+
+	*post = row.Post
+	return nil
 }
 
 // DeletePost deletes a post and all its comments, attachments and reactions
-func (a *PostgresAdapter) DeletePost(id string) error {
-	return a.db.Transaction(func(tx *gorm.DB) error {
+func (a *PostgresAdapter) DeletePost(ctx context.Context, id string) error {
+	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Delete all reactions to this post
-		if err := tx.Delete(&models.Reaction{}, "target_id = ? AND target_type = ?", id, "post").Error; err != nil {
+		if err := inTenant(ctx, tx, "reactions").Delete(&models.Reaction{}, "target_id = ? AND target_type = ?", id, "post").Error; err != nil {
 			return err
 		}
 
 		// Get all comments for this post
 		var comments []*models.Comment
-		if err := tx.Where("post_id = ?", id).Find(&comments).Error; err != nil {
+		if err := inTenant(ctx, tx, "comments").Where("post_id = ?", id).Find(&comments).Error; err != nil {
 			return err
 		}
 
 		// Delete all reactions and attachments to these comments
-		for _, comment := range comments {
-			if err := tx.Delete(&models.Reaction{}, "target_id = ? AND target_type = ?", comment.ID, "comment").Error; err != nil {
+		commentIDs := make([]string, len(comments))
+		for i, comment := range comments {
+			commentIDs[i] = comment.ID
+			if err := inTenant(ctx, tx, "reactions").Delete(&models.Reaction{}, "target_id = ? AND target_type = ?", comment.ID, "comment").Error; err != nil {
 				return err
 			}
 
 			// Delete comment attachments
-			if err := tx.Delete(&models.Attachment{}, "comment_id = ?", comment.ID).Error; err != nil {
+			if err := inTenant(ctx, tx, "attachments").Delete(&models.Attachment{}, "comment_id = ?", comment.ID).Error; err != nil {
 				return err
 			}
 		}
 
+		// Delete the reaction counts of the post and its comments
+		if err := deleteReactionCounts(ctx, tx, "post", []string{id}); err != nil {
+			return err
+		}
+		if err := deleteReactionCounts(ctx, tx, "comment", commentIDs); err != nil {
+			return err
+		}
+
 		// Delete all comments
-		if err := tx.Delete(&models.Comment{}, "post_id = ?", id).Error; err != nil {
+		if err := inTenant(ctx, tx, "comments").Delete(&models.Comment{}, "post_id = ?", id).Error; err != nil {
 			return err
 		}
 
 		// Delete all attachments for this post
-		if err := tx.Delete(&models.Attachment{}, "post_id = ?", id).Error; err != nil {
+		if err := inTenant(ctx, tx, "attachments").Delete(&models.Attachment{}, "post_id = ?", id).Error; err != nil {
 			return err
 		}
 
 		// Finally delete the post
-		return tx.Delete(&models.Post{}, "id = ?", id).Error
+		return inTenant(ctx, tx, "posts").Delete(&models.Post{}, "id = ?", id).Error
 	})
 }
 
-// CreateComment creates a new comment
-func (a *PostgresAdapter) CreateComment(comment *models.Comment) error {
-	return a.db.Create(comment).Error
+// CreateComment creates a new comment and counts it on its post and parent
+func (a *PostgresAdapter) CreateComment(ctx context.Context, comment *models.Comment) error {
+	comment.TenantID = TenantFromContext(ctx)
+	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(comment).Error; err != nil {
+			return err
+		}
+		return countComment(ctx, tx, comment, 1)
+	})
 }
 
 // GetCommentByID retrieves a comment by its ID with attachment
-func (a *PostgresAdapter) GetCommentByID(id string) (*models.Comment, error) {
+func (a *PostgresAdapter) GetCommentByID(ctx context.Context, id string) (*models.Comment, error) {
 	var comment models.Comment
-	err := a.db.First(&comment, "id = ?", id).Error
+	err := inTenant(ctx, a.db, "comments").First(&comment, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
 
 	// Load attachment if exists
-	attachment, err := a.GetAttachmentForComment(id)
+	attachment, err := a.GetAttachmentForComment(ctx, id)
 	if err == nil {
 		comment.Attachment = attachment
 	}
 	// If error is record not found, that's fine - comment may not have an attachment
 
+	if err := loadCommentReactionCounts(inTenant(ctx, a.db, "reaction_counts"), []*models.Comment{&comment}); err != nil {
+		return nil, err
+	}
+
 	return &comment, nil
 }
 
 // ListComments retrieves comments with pagination and attachments
-func (a *PostgresAdapter) ListComments(postID string, limit, offset int) ([]*models.Comment, error) {
+func (a *PostgresAdapter) ListComments(ctx context.Context, postID string, p Pagination) ([]*models.Comment, error) {
 	var comments []*models.Comment
-	err := a.db.Where("post_id = ?", postID).
-		Order("created_at ASC").
-		Limit(limit).
-		Offset(offset).
+	err := oldestFirst(visibleInTenant(ctx, a.db, "comments").Where("post_id = ?", postID), p).
 		Find(&comments).Error
 
 	if err != nil {
 		return nil, err
 	}
 
-	// Load attachment for each comment
-	for _, comment := range comments {
-		attachment, err := a.GetAttachmentForComment(comment.ID)
-		if err == nil {
-			comment.Attachment = attachment
-		}
-		// If error is record not found, that's fine - comment may not have an attachment
+	// Load attachments and reaction counts for all comments in one query each
+	if err := loadCommentAttachments(inTenant(ctx, a.db, "attachments"), comments); err != nil {
+		return nil, err
+	}
+	if err := loadCommentReactionCounts(inTenant(ctx, a.db, "reaction_counts"), comments); err != nil {
+		return nil, err
 	}
 
 	return comments, nil
 }
 
+// CountComments returns the number of comments on a post
+func (a *PostgresAdapter) CountComments(ctx context.Context, postID string) (int64, error) {
+	var count int64
+	err := visibleInTenant(ctx, a.db, "comments").Model(&models.Comment{}).
+		Where("post_id = ?", postID).
+		Count(&count).Error
+	return count, err
+}
+
 // UpdateComment updates an existing comment
-func (a *PostgresAdapter) UpdateComment(comment *models.Comment) error {
-	return a.db.Save(comment).Error
+func (a *PostgresAdapter) UpdateComment(ctx context.Context, comment *models.Comment) error {
+	comment.TenantID = TenantFromContext(ctx)
+	return updateInTenant(ctx, a.db, "comments", comment)
 }
 
-// DeleteComment deletes a comment, its attachment and all its reactions
-func (a *PostgresAdapter) DeleteComment(id string) error {
-	return a.db.Transaction(func(tx *gorm.DB) error {
+// DeleteComment deletes a comment, its attachment and all its reactions, and
+// uncounts it on its post and parent
+func (a *PostgresAdapter) DeleteComment(ctx context.Context, id string) error {
+	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Delete the comment first, so that only the request that deleted it uncounts it
+		var deleted []*models.Comment
+		if err := inTenant(ctx, tx, "comments").Clauses(clause.Returning{}).Where("id = ?", id).Delete(&deleted).Error; err != nil {
+			return err
+		}
+		for _, comment := range deleted {
+			if err := countComment(ctx, tx, comment, -1); err != nil {
+				return err
+			}
+		}
+
 		// Delete all reactions to this comment
-		if err := tx.Delete(&models.Reaction{}, "target_id = ? AND target_type = ?", id, "comment").Error; err != nil {
+		if err := inTenant(ctx, tx, "reactions").Delete(&models.Reaction{}, "target_id = ? AND target_type = ?", id, "comment").Error; err != nil {
+			return err
+		}
+		if err := deleteReactionCounts(ctx, tx, "comment", []string{id}); err != nil {
 			return err
 		}
 
 		// Delete attachment if exists
-		if err := tx.Delete(&models.Attachment{}, "comment_id = ?", id).Error; err != nil {
+		return inTenant(ctx, tx, "attachments").Delete(&models.Attachment{}, "comment_id = ?", id).Error
+	})
+}
+
+// CreateReaction creates a new reaction and counts it
+func (a *PostgresAdapter) CreateReaction(ctx context.Context, reaction *models.Reaction) error {
+	reaction.TenantID = TenantFromContext(ctx)
+	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(reaction).Error; err != nil {
+			return err
+		}
+		return countReaction(ctx, tx, reaction, 1)
+	})
+}
+
+// AddReaction creates a reaction unless the user already reacted to the
+// target with its type, in which case reaction is set to the existing one
+func (a *PostgresAdapter) AddReaction(ctx context.Context, reaction *models.Reaction) (bool, error) {
+	reaction.TenantID = TenantFromContext(ctx)
+	var created bool
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(reaction)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		created = true
+		return countReaction(ctx, tx, reaction, 1)
+	})
+	if err != nil {
+		return false, err
+	}
+	if created {
+		return true, nil
+	}
+
+	existing, err := a.GetReaction(ctx, reaction.UserID, reaction.TargetID, reaction.TargetType, reaction.Type)
+	if err != nil {
+		return false, err
+	}
+	*reaction = *existing
+	return false, nil
+}
+
+// ReplaceReaction adds a reaction and removes the user's reactions of other
+// types to its target
+func (a *PostgresAdapter) ReplaceReaction(ctx context.Context, reaction *models.Reaction) (bool, []*models.Reaction, error) {
+	var created bool
+	var removed []*models.Reaction
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Row locks cannot serialize replacements while the user has no
+		// reaction to the target yet, so lock the user and target instead
+		key := strings.Join([]string{TenantFromContext(ctx), reaction.UserID, reaction.TargetType, reaction.TargetID}, "/")
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key).Error; err != nil {
 			return err
 		}
 
-		// Delete the comment
-		return tx.Delete(&models.Comment{}, "id = ?", id).Error
+		var err error
+		created, removed, err = replaceReaction(ctx, tx, reaction)
+		return err
 	})
+	if err != nil {
+		return false, nil, err
+	}
+	return created, removed, nil
 }
 
-// CreateReaction creates a new reaction
-func (a *PostgresAdapter) CreateReaction(reaction *models.Reaction) error {
-	return a.db.Create(reaction).Error
+// RemoveReaction deletes a user's reaction to a target and returns it
+func (a *PostgresAdapter) RemoveReaction(ctx context.Context, userID, targetID, targetType, reactionType string) (*models.Reaction, error) {
+	var reaction models.Reaction
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := inTenant(ctx, tx, "reactions").Where("user_id = ? AND target_id = ? AND target_type = ? AND type = ?",
+			userID, targetID, targetType, reactionType).First(&reaction).Error
+		if err != nil {
+			return err
+		}
+
+		// Another request may have removed it since
+		result := inTenant(ctx, tx, "reactions").Delete(&models.Reaction{}, "id = ?", reaction.ID)
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		return countReaction(ctx, tx, &reaction, -1)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &reaction, nil
 }
 
 // GetReaction retrieves a specific reaction
-func (a *PostgresAdapter) GetReaction(userID, targetID, targetType, reactionType string) (*models.Reaction, error) {
+func (a *PostgresAdapter) GetReaction(ctx context.Context, userID, targetID, targetType, reactionType string) (*models.Reaction, error) {
 	var reaction models.Reaction
-	err := a.db.Where("user_id = ? AND target_id = ? AND target_type = ? AND type = ?",
+	err := inTenant(ctx, a.db, "reactions").Where("user_id = ? AND target_id = ? AND target_type = ? AND type = ?",
 		userID, targetID, targetType, reactionType).First(&reaction).Error
 	if err != nil {
 		return nil, err
@@ -250,16 +442,54 @@ func (a *PostgresAdapter) GetReaction(userID, targetID, targetType, reactionType
 	return &reaction, nil
 }
 
+// GetReactionByID retrieves a reaction by ID
+func (a *PostgresAdapter) GetReactionByID(ctx context.Context, id string) (*models.Reaction, error) {
+	var reaction models.Reaction
+	if err := inTenant(ctx, a.db, "reactions").First(&reaction, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &reaction, nil
+}
+
 // ListReactions retrieves all reactions for a target
-func (a *PostgresAdapter) ListReactions(targetID, targetType string) ([]*models.Reaction, error) {
+func (a *PostgresAdapter) ListReactions(ctx context.Context, targetID, targetType string) ([]*models.Reaction, error) {
 	var reactions []*models.Reaction
-	err := a.db.Where("target_id = ? AND target_type = ?", targetID, targetType).Find(&reactions).Error
+	err := inTenant(ctx, a.db, "reactions").Where("target_id = ? AND target_type = ?", targetID, targetType).Find(&reactions).Error
 	return reactions, err
 }
 
-// DeleteReaction deletes a reaction
-func (a *PostgresAdapter) DeleteReaction(id string) error {
-	return a.db.Delete(&models.Reaction{}, "id = ?", id).Error
+// DeleteReaction deletes a reaction and uncounts it
+func (a *PostgresAdapter) DeleteReaction(ctx context.Context, id string) error {
+	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var deleted []*models.Reaction
+		if err := inTenant(ctx, tx, "reactions").Clauses(clause.Returning{}).Where("id = ?", id).Delete(&deleted).Error; err != nil {
+			return err
+		}
+		for _, reaction := range deleted {
+			if err := countReaction(ctx, tx, reaction, -1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SummarizeReactions aggregates the reactions to targets
+func (a *PostgresAdapter) SummarizeReactions(ctx context.Context, targetType string, targetIDs []string, userID string, recent int) (map[string]*models.ReactionSummary, error) {
+	return summarizeReactions(ctx, a.db, targetType, targetIDs, userID, recent)
+}
+
+// RepairCounters recomputes the engagement counters of every tenant
+func (a *PostgresAdapter) RepairCounters(ctx context.Context) error {
+	return repairCounters(ctx, a.db)
+}
+
+// Transaction runs fn in a database transaction, with an adapter whose
+// methods take part in it
+func (a *PostgresAdapter) Transaction(ctx context.Context, fn func(tx DatabaseAdapter) error) error {
+	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&PostgresAdapter{db: tx, search: a.search})
+	})
 }
 
 // Close closes the database connection
@@ -271,84 +501,311 @@ func (a *PostgresAdapter) Close() error {
 	return sqlDB.Close()
 }
 
-// SearchPosts searches for posts by content using full text search
-func (a *PostgresAdapter) SearchPosts(query string, limit, offset int) ([]*models.Post, error) {
-	var posts []*models.Post
+// SearchPosts returns the posts matching a search query with PostgreSQL's
+// full-text search, see parseSearchQuery for the text query syntax. Relevance
+// is ranked with ts_rank and snippets are highlighted with ts_headline.
+func (a *PostgresAdapter) SearchPosts(ctx context.Context, q SearchQuery, p Pagination) ([]*models.Post, error) {
+	posts := []*models.Post{}
+	clauses := parseSearchQuery(q.Text)
+	if q.hasText() && len(clauses) == 0 {
+		return posts, nil
+	}
 
-	// Using PostgreSQL's full-text search capabilities
-	// Using plainto_tsquery for simpler, space-separated search
-	err := a.db.Where("to_tsvector('english', content) @@ plainto_tsquery('english', ?)", query).
-		Order("created_at DESC").
-		Limit(limit).
-		Offset(offset).
-		Find(&posts).Error
+	search := a.matchingPosts(visibleInTenant(ctx, a.db, "posts"), q, clauses)
+	tsQuery := tsQueryExpression(clauses)
+	if len(clauses) > 0 {
+		search = search.Select("posts.*, ts_headline(search_config, content, to_tsquery(search_config, ?), ?) AS snippet", tsQuery, headlineOptions)
+	}
+
+	switch {
+	case q.Sort == SortRelevance && len(clauses) > 0:
+		search = search.Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:                "ts_rank(search_vector, to_tsquery(search_config, ?)) DESC, created_at DESC, id DESC",
+			Vars:               []interface{}{tsQuery},
+			WithoutParentheses: true,
+		}}).Limit(p.Limit).Offset(p.Offset)
+	case q.Sort == SortRelevance:
+		search = newestFirst(search, Pagination{Limit: p.Limit, Offset: p.Offset})
+	default:
+		search = newestFirst(search, p)
+	}
+
+	if err := search.Find(&posts).Error; err != nil {
+		return nil, err
+	}
+
+	if len(clauses) > 0 {
+		for _, post := range posts {
+			post.Snippet = escapeSnippet(post.Snippet)
+		}
+	}
+
+	if err := loadPostAttachments(inTenant(ctx, a.db, "attachments"), posts); err != nil {
+		return nil, err
+	}
+	if err := loadPostReactionCounts(inTenant(ctx, a.db, "reaction_counts"), posts); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// CountSearchPosts returns the number of posts matching a search query
+func (a *PostgresAdapter) CountSearchPosts(ctx context.Context, q SearchQuery) (int64, error) {
+	var count int64
+	clauses := parseSearchQuery(q.Text)
+	if q.hasText() && len(clauses) == 0 {
+		return count, nil
+	}
+
+	err := a.matchingPosts(visibleInTenant(ctx, a.db, "posts").Model(&models.Post{}), q, clauses).
+		Count(&count).Error
+	return count, err
+}
+
+// matchingPosts restricts a posts query to the posts matching a search query,
+// whose text parses to clauses
+func (a *PostgresAdapter) matchingPosts(query *gorm.DB, q SearchQuery, clauses []searchClause) *gorm.DB {
+	query = whereSearchFilters(query, q)
+	if q.Near != nil {
+		query = query.Where(nearbyCondition, nearbyArgs(q.Near.Lat, q.Near.Lng, q.Near.RadiusKm)...)
+	}
+
+	if len(clauses) > 0 {
+		condition, args := a.search.matchCondition(tsQueryExpression(clauses))
+		query = query.Where(condition, args...)
+	}
+	return query
+}
+
+// headlineOptions configures the snippets ts_headline returns: up to two
+// fragments around the matches, with the matching words marked for
+// escapeSnippet
+var headlineOptions = fmt.Sprintf(`StartSel="%s", StopSel="%s", MaxFragments=2, MaxWords=32, MinWords=12`,
+	matchStart, matchStop)
+
+// searchConfigs maps post languages to the PostgreSQL text search
+// configurations their content is indexed with
+type searchConfigs struct {
+	byLanguage map[string]string // Lowercase language tag to configuration
+	fallback   string            // Configuration of posts in other languages
+}
+
+// loadSearchConfigs reads the text search configurations from
+// SEARCH_LANGUAGES, a comma-separated list of language:configuration pairs,
+// and SEARCH_DEFAULT_CONFIG
+func loadSearchConfigs() (searchConfigs, error) {
+	configs := searchConfigs{
+		byLanguage: make(map[string]string),
+		fallback:   strings.TrimSpace(viper.GetString("SEARCH_DEFAULT_CONFIG")),
+	}
+	if configs.fallback == "" {
+		configs.fallback = "english"
+	}
+
+	for _, pair := range strings.Split(viper.GetString("SEARCH_LANGUAGES"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		language, config, ok := strings.Cut(pair, ":")
+		language, config = strings.ToLower(strings.TrimSpace(language)), strings.TrimSpace(config)
+		if !ok || language == "" || config == "" {
+			return searchConfigs{}, fmt.Errorf("invalid SEARCH_LANGUAGES entry %q, expected language:configuration", pair)
+		}
+		configs.byLanguage[language] = config
+	}
+
+	return configs, nil
+}
+
+// forLanguage returns the configuration for a language tag. Regional tags
+// such as pt-BR fall back to their language.
+func (s searchConfigs) forLanguage(language string) string {
+	language = strings.ToLower(language)
+	if config, ok := s.byLanguage[language]; ok {
+		return config
+	}
+	if base, _, ok := strings.Cut(language, "-"); ok {
+		if config, ok := s.byLanguage[base]; ok {
+			return config
+		}
+	}
+	return s.fallback
+}
 
-	return posts, err
+// all returns every configuration posts are indexed with, sorted
+func (s searchConfigs) all() []string {
+	seen := map[string]bool{s.fallback: true}
+	configs := []string{s.fallback}
+	for _, config := range s.byLanguage {
+		if !seen[config] {
+			seen[config] = true
+			configs = append(configs, config)
+		}
+	}
+	sort.Strings(configs)
+	return configs
+}
+
+// validate checks that the configurations exist in the database
+func (s searchConfigs) validate(db *gorm.DB) error {
+	for _, config := range s.all() {
+		var name string
+		if err := db.Raw("SELECT ?::regconfig::text", config).Scan(&name).Error; err != nil {
+			return fmt.Errorf("invalid text search configuration %q: %v", config, err)
+		}
+	}
+	return nil
+}
+
+// matchCondition returns a condition matching posts against to_tsquery input.
+// Each post matches the query as parsed by the configuration it is indexed
+// with, so stemming and stop words are those of its language. There is one
+// branch per configuration, so each can use the GIN index on search_vector.
+//
+// Posts indexed with a configuration that was since removed from
+// SEARCH_LANGUAGES no longer match; updating them reindexes them.
+func (s searchConfigs) matchCondition(tsQuery string) (string, []interface{}) {
+	configs := s.all()
+	conditions := make([]string, len(configs))
+	args := make([]interface{}, 0, 3*len(configs))
+	for i, config := range configs {
+		conditions[i] = "(search_config = ?::regconfig AND search_vector @@ to_tsquery(?::regconfig, ?))"
+		args = append(args, config, config, tsQuery)
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
 }
 
 // ListPostsByCity returns posts from a specific city
-func (a *PostgresAdapter) ListPostsByCity(city string, limit, offset int) ([]*models.Post, error) {
+func (a *PostgresAdapter) ListPostsByCity(ctx context.Context, city string, p Pagination) ([]*models.Post, error) {
 	var posts []*models.Post
-	err := a.db.Where("city = ?", city).
-		Order("created_at DESC").
-		Limit(limit).
-		Offset(offset).
+	err := newestFirst(visibleInTenant(ctx, a.db, "posts").Where("city = ?", city), p).
 		Find(&posts).Error
-	return posts, err
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadPostAttachments(inTenant(ctx, a.db, "attachments"), posts); err != nil {
+		return nil, err
+	}
+	if err := loadPostReactionCounts(inTenant(ctx, a.db, "reaction_counts"), posts); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
 }
 
-// FindNearbyPosts finds posts within a certain radius of a location
-func (a *PostgresAdapter) FindNearbyPosts(lat, lng float64, radiusKm float64, limit, offset int) ([]*models.Post, error) {
-	var posts []*models.Post
+// CountPostsByCity returns the number of posts from a specific city
+func (a *PostgresAdapter) CountPostsByCity(ctx context.Context, city string) (int64, error) {
+	var count int64
+	err := visibleInTenant(ctx, a.db, "posts").Model(&models.Post{}).
+		Where("city = ?", city).
+		Count(&count).Error
+	return count, err
+}
+
+// nearbyCondition matches posts within a radius of a location, leaving out
+// posts without a location, at 0,0. It takes the location's longitude and
+// latitude, a bounding distance in degrees, the location again and the
+// radius in meters; see nearbyArgs.
+//
+// PostGIS ST_DWithin uses the spatial index for efficient geospatial queries.
+// The index is on SRID 4326 geometry, so ST_DWithin works in degrees: it is
+// given a bounding distance that covers the radius, and ST_DistanceSphere
+// then filters by the exact distance in meters.
+const nearbyCondition = `
+	latitude IS NOT NULL AND longitude IS NOT NULL
+	AND NOT (latitude = 0 AND longitude = 0)
+	AND ST_DWithin(
+		ST_SetSRID(ST_MakePoint(longitude, latitude), 4326),
+		ST_SetSRID(ST_MakePoint(?, ?), 4326),
+		?
+	)
+	AND ST_DistanceSphere(
+		ST_MakePoint(longitude, latitude),
+		ST_MakePoint(?, ?)
+	) <= ?`
+
+// nearbyArgs returns the arguments of nearbyCondition
+func nearbyArgs(lat, lng, radiusKm float64) []interface{} {
+	latDelta, lngDelta := boundingBox(lat, radiusKm)
+	radiusDegrees := math.Max(latDelta, lngDelta)
 
-	// Use PostGIS ST_DWithin function with the spatial index for efficient geospatial queries
 	// Convert radius from km to meters for ST_DistanceSphere
+	radiusMeters := radiusKm * 1000.0
+
+	return []interface{}{
+		lng, lat, // First point coordinates (note: longitude first in ST_MakePoint)
+		radiusDegrees,
+		lng, lat, // Second point coordinates for the exact distance filter
+		radiusMeters,
+	}
+}
+
+// FindNearbyPosts finds posts within a certain radius of a location, nearest first
+func (a *PostgresAdapter) FindNearbyPosts(ctx context.Context, lat, lng float64, radiusKm float64, limit, offset int) ([]*models.Post, error) {
+	var posts []*models.Post
+
 	query := `
 		SELECT * FROM posts
-		WHERE latitude IS NOT NULL AND longitude IS NOT NULL
-		AND ST_DWithin(
-			ST_SetSRID(ST_MakePoint(longitude, latitude), 4326),
-			ST_SetSRID(ST_MakePoint(?, ?), 4326),
-			?
-		)
+		WHERE tenant_id = ? AND hidden_at IS NULL AND ` + nearbyCondition + `
 		ORDER BY ST_DistanceSphere(
 			ST_MakePoint(longitude, latitude),
 			ST_MakePoint(?, ?)
-		) ASC
+		) ASC, created_at DESC, id DESC
 		LIMIT ? OFFSET ?
 	`
 
-	// Convert radius from km to meters for ST_DistanceSphere
-	radiusMeters := radiusKm * 1000.0
-
-	err := a.db.Raw(query,
-		lng, lat, // First point coordinates (note: longitude first in ST_MakePoint)
-		radiusMeters,
-		lng, lat, // Second point coordinates for the ORDER BY
+	args := append([]interface{}{TenantFromContext(ctx)}, nearbyArgs(lat, lng, radiusKm)...)
+	args = append(args,
+		lng, lat, // Point coordinates for the ORDER BY
 		limit, offset,
-	).Scan(&posts).Error
+	)
+	err := a.db.WithContext(ctx).Raw(query, args...).Scan(&posts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadPostAttachments(inTenant(ctx, a.db, "attachments"), posts); err != nil {
+		return nil, err
+	}
+	if err := loadPostReactionCounts(inTenant(ctx, a.db, "reaction_counts"), posts); err != nil {
+		return nil, err
+	}
 
-	return posts, err
+	return posts, nil
+}
+
+// CountNearbyPosts returns the number of posts within a certain radius of a location
+func (a *PostgresAdapter) CountNearbyPosts(ctx context.Context, lat, lng float64, radiusKm float64) (int64, error) {
+	var count int64
+	err := visibleInTenant(ctx, a.db, "posts").Model(&models.Post{}).
+		Where(nearbyCondition, nearbyArgs(lat, lng, radiusKm)...).
+		Count(&count).Error
+	return count, err
 }
 
 // Attachment methods
 
 // CreateAttachment creates a new attachment
-func (a *PostgresAdapter) CreateAttachment(attachment *models.Attachment) error {
-	return a.db.Create(attachment).Error
+func (a *PostgresAdapter) CreateAttachment(ctx context.Context, attachment *models.Attachment) error {
+	attachment.TenantID = TenantFromContext(ctx)
+	return a.db.WithContext(ctx).Create(attachment).Error
 }
 
 // GetAttachmentsForPost retrieves all attachments for a post
-func (a *PostgresAdapter) GetAttachmentsForPost(postID string) ([]*models.Attachment, error) {
+func (a *PostgresAdapter) GetAttachmentsForPost(ctx context.Context, postID string) ([]*models.Attachment, error) {
 	var attachments []*models.Attachment
-	err := a.db.Where("post_id = ?", postID).Find(&attachments).Error
+	err := inTenant(ctx, a.db, "attachments").Where("post_id = ?", postID).
+		Order("created_at ASC, id ASC").
+		Find(&attachments).Error
 	return attachments, err
 }
 
 // GetAttachmentForComment retrieves an attachment for a comment
-func (a *PostgresAdapter) GetAttachmentForComment(commentID string) (*models.Attachment, error) {
+func (a *PostgresAdapter) GetAttachmentForComment(ctx context.Context, commentID string) (*models.Attachment, error) {
 	var attachment models.Attachment
-	err := a.db.Where("comment_id = ?", commentID).First(&attachment).Error
+	err := inTenant(ctx, a.db, "attachments").Where("comment_id = ?", commentID).First(&attachment).Error
 	if err != nil {
 		return nil, err
 	}
@@ -356,6 +813,186 @@ func (a *PostgresAdapter) GetAttachmentForComment(commentID string) (*models.Att
 }
 
 // DeleteAttachment deletes an attachment
-func (a *PostgresAdapter) DeleteAttachment(id string) error {
-	return a.db.Delete(&models.Attachment{}, "id = ?", id).Error
+func (a *PostgresAdapter) DeleteAttachment(ctx context.Context, id string) error {
+	return inTenant(ctx, a.db, "attachments").Delete(&models.Attachment{}, "id = ?", id).Error
+}
+
+// CreateModerationAction records a moderation action
+func (a *PostgresAdapter) CreateModerationAction(ctx context.Context, action *models.ModerationAction) error {
+	action.TenantID = TenantFromContext(ctx)
+	return a.db.WithContext(ctx).Create(action).Error
+}
+
+// ListModerationActions retrieves moderation actions, newest first
+func (a *PostgresAdapter) ListModerationActions(ctx context.Context, p Pagination) ([]*models.ModerationAction, error) {
+	var actions []*models.ModerationAction
+	err := newestFirst(inTenant(ctx, a.db, "moderation_actions"), p).Find(&actions).Error
+	return actions, err
+}
+
+// CreateReactionType creates a custom reaction type
+func (a *PostgresAdapter) CreateReactionType(ctx context.Context, reactionType *models.ReactionType) error {
+	reactionType.TenantID = TenantFromContext(ctx)
+	return a.db.WithContext(ctx).Create(reactionType).Error
+}
+
+// GetReactionType retrieves a custom reaction type by name
+func (a *PostgresAdapter) GetReactionType(ctx context.Context, name string) (*models.ReactionType, error) {
+	var reactionType models.ReactionType
+	if err := inTenant(ctx, a.db, "reaction_types").First(&reactionType, "name = ?", name).Error; err != nil {
+		return nil, err
+	}
+	return &reactionType, nil
+}
+
+// ListReactionTypes retrieves all custom reaction types, by name
+func (a *PostgresAdapter) ListReactionTypes(ctx context.Context) ([]*models.ReactionType, error) {
+	var reactionTypes []*models.ReactionType
+	err := inTenant(ctx, a.db, "reaction_types").Order("name ASC").Find(&reactionTypes).Error
+	return reactionTypes, err
+}
+
+// DeleteReactionType deletes a custom reaction type. Reactions of the type
+// are kept.
+func (a *PostgresAdapter) DeleteReactionType(ctx context.Context, name string) error {
+	result := inTenant(ctx, a.db, "reaction_types").Delete(&models.ReactionType{}, "name = ?", name)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// CreateAPIKey creates a new API key
+func (a *PostgresAdapter) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	key.TenantID = TenantFromContext(ctx)
+	return a.db.WithContext(ctx).Create(key).Error
+}
+
+// GetAPIKeyByPrefix retrieves the API key with a prefix, of any tenant
+func (a *PostgresAdapter) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := a.db.WithContext(ctx).First(&key, "prefix = ?", prefix).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListAPIKeys retrieves all API keys, oldest first
+func (a *PostgresAdapter) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	err := inTenant(ctx, a.db, "api_keys").Order("created_at ASC, id ASC").Find(&keys).Error
+	return keys, err
+}
+
+// RevokeAPIKey revokes an API key
+func (a *PostgresAdapter) RevokeAPIKey(ctx context.Context, id string) error {
+	var key models.APIKey
+	if err := inTenant(ctx, a.db, "api_keys").First(&key, "id = ?", id).Error; err != nil {
+		return err
+	}
+	if key.Revoked() {
+		return nil
+	}
+	return inTenant(ctx, a.db, "api_keys").Model(&models.APIKey{}).Where("id = ?", id).Update("revoked_at", time.Now()).Error
+}
+
+// EnqueueEvent writes a hook event to the outbox
+func (a *PostgresAdapter) EnqueueEvent(ctx context.Context, event *models.OutboxEvent) error {
+	return enqueueEvent(ctx, a.db, event)
+}
+
+// ClaimEvents leases the hook events that are due for delivery
+func (a *PostgresAdapter) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error) {
+	return claimEvents(ctx, a.db, limit, lease)
+}
+
+// CompleteEvent marks a hook event delivered
+func (a *PostgresAdapter) CompleteEvent(ctx context.Context, id string) error {
+	return completeEvent(ctx, a.db, id)
+}
+
+// ReleaseEvent makes a claimed hook event due now
+func (a *PostgresAdapter) ReleaseEvent(ctx context.Context, id string) error {
+	return releaseEvent(ctx, a.db, id)
+}
+
+// FailEvent records why delivering a hook event failed, and when to retry it
+func (a *PostgresAdapter) FailEvent(ctx context.Context, id, lastError string, retryAt time.Time) error {
+	return failEvent(ctx, a.db, id, lastError, retryAt)
+}
+
+// DeadLetterEvent records why delivering a hook event failed for the last time
+func (a *PostgresAdapter) DeadLetterEvent(ctx context.Context, id, lastError string) error {
+	return deadLetterEvent(ctx, a.db, id, lastError)
+}
+
+// DeleteDeliveredEvents deletes the hook events delivered before a time
+func (a *PostgresAdapter) DeleteDeliveredEvents(ctx context.Context, before time.Time) (int64, error) {
+	return deleteDeliveredEvents(ctx, a.db, before)
+}
+
+// DeleteDeadLetteredEvents deletes the hook events dead-lettered before a time
+func (a *PostgresAdapter) DeleteDeadLetteredEvents(ctx context.Context, before time.Time) (int64, error) {
+	return deleteDeadLetteredEvents(ctx, a.db, before)
+}
+
+// GetEvent retrieves a hook event by ID
+func (a *PostgresAdapter) GetEvent(ctx context.Context, id string) (*models.OutboxEvent, error) {
+	return getEvent(ctx, a.db, id)
+}
+
+// ListEvents retrieves the hook events created in a time range, oldest first
+func (a *PostgresAdapter) ListEvents(ctx context.Context, since, until time.Time, limit int) ([]*models.OutboxEvent, error) {
+	return listEvents(ctx, a.db, since, until, limit)
+}
+
+// ListDeadLetteredEvents retrieves the dead-lettered hook events, newest first
+func (a *PostgresAdapter) ListDeadLetteredEvents(ctx context.Context, p Pagination) ([]*models.OutboxEvent, error) {
+	return listDeadLetteredEvents(ctx, a.db, p)
+}
+
+// ReplayEvent makes a dead-lettered hook event due for delivery again
+func (a *PostgresAdapter) ReplayEvent(ctx context.Context, id string) (*models.OutboxEvent, error) {
+	return replayEvent(ctx, a.db, id)
+}
+
+// CreateWebhookSubscription creates a webhook subscription
+func (a *PostgresAdapter) CreateWebhookSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	return createWebhookSubscription(ctx, a.db, subscription)
+}
+
+// GetWebhookSubscription retrieves a webhook subscription by ID
+func (a *PostgresAdapter) GetWebhookSubscription(ctx context.Context, id string) (*models.WebhookSubscription, error) {
+	return getWebhookSubscription(ctx, a.db, id)
+}
+
+// ListWebhookSubscriptions retrieves all webhook subscriptions, oldest first
+func (a *PostgresAdapter) ListWebhookSubscriptions(ctx context.Context) ([]*models.WebhookSubscription, error) {
+	return listWebhookSubscriptions(ctx, a.db)
+}
+
+// UpdateWebhookSubscription updates a webhook subscription, except its delivery stats
+func (a *PostgresAdapter) UpdateWebhookSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	return updateInTenant(ctx, a.db, "webhook_subscriptions", subscription)
+}
+
+// DeleteWebhookSubscription deletes a webhook subscription
+func (a *PostgresAdapter) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	return deleteWebhookSubscription(ctx, a.db, id)
+}
+
+// RecordWebhookDelivery stores a delivery to a webhook, counting it in the
+// stats of its subscription
+func (a *PostgresAdapter) RecordWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return recordWebhookDelivery(ctx, a.db, delivery)
+}
+
+// ListWebhookDeliveries retrieves the webhook deliveries matching a query, newest first
+func (a *PostgresAdapter) ListWebhookDeliveries(ctx context.Context, q DeliveryQuery, p Pagination) ([]*models.WebhookDelivery, error) {
+	return listWebhookDeliveries(ctx, a.db, q, p)
+}
+
+// DeleteWebhookDeliveries deletes the webhook deliveries made before a time
+func (a *PostgresAdapter) DeleteWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	return deleteWebhookDeliveries(ctx, a.db, before)
 }
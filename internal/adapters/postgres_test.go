@@ -0,0 +1,40 @@
+package adapters_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+
+	"sonet/internal/adapters"
+	"sonet/internal/adapters/adaptertest"
+)
+
+// TestPostgresAdapterConformance runs against the database in
+// SONET_TEST_POSTGRES_DSN. All Sonet tables in that database are truncated.
+func TestPostgresAdapterConformance(t *testing.T) {
+	dsn := os.Getenv("SONET_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("SONET_TEST_POSTGRES_DSN is not set")
+	}
+
+	adaptertest.Run(t, func(t *testing.T) adapters.DatabaseAdapter {
+		viper.Set("DB_ADAPTER", "postgres")
+		viper.Set("DB_CONNECTION_STRING", dsn)
+
+		db, err := adapters.NewDatabaseAdapter()
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+
+		conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		require.NoError(t, err)
+		require.NoError(t, conn.Exec("TRUNCATE posts, comments, reactions, attachments").Error)
+		sqlDB, err := conn.DB()
+		require.NoError(t, err)
+		require.NoError(t, sqlDB.Close())
+		return db
+	})
+}
@@ -0,0 +1,126 @@
+package adapters
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"sonet/internal/models"
+)
+
+// replaceReaction adds a reaction within a transaction after removing the
+// user's reactions of other types to its target, see
+// DatabaseAdapter.ReplaceReaction, and updates their counts. Removing first
+// takes SQLite's write lock before anything is read.
+func replaceReaction(ctx context.Context, tx *gorm.DB, reaction *models.Reaction) (bool, []*models.Reaction, error) {
+	var removed []*models.Reaction
+	err := inTenant(ctx, tx, "reactions").Clauses(clause.Returning{}).
+		Where("user_id = ? AND target_id = ? AND target_type = ? AND type <> ?",
+			reaction.UserID, reaction.TargetID, reaction.TargetType, reaction.Type).
+		Delete(&removed).Error
+	if err != nil {
+		return false, nil, err
+	}
+	for _, previous := range removed {
+		if err := countReaction(ctx, tx, previous, -1); err != nil {
+			return false, nil, err
+		}
+	}
+
+	reaction.TenantID = TenantFromContext(ctx)
+	result := tx.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(reaction)
+	if result.Error != nil {
+		return false, nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, removed, countReaction(ctx, tx, reaction, 1)
+	}
+
+	var existing models.Reaction
+	err = inTenant(ctx, tx, "reactions").Where("user_id = ? AND target_id = ? AND target_type = ? AND type = ?",
+		reaction.UserID, reaction.TargetID, reaction.TargetType, reaction.Type).First(&existing).Error
+	if err != nil {
+		return false, nil, err
+	}
+	*reaction = existing
+	return false, removed, nil
+}
+
+// reactionSummaryRow is a reaction ranked among the reactions of its type to
+// its target, newest first, along with how many there are and whether the
+// requesting user is among them
+type reactionSummaryRow struct {
+	TargetID      string
+	Type          string
+	UserID        string
+	ReactionRank  int
+	ReactionCount int64
+	IsMine        bool
+}
+
+// summarizeReactions summarizes the reactions to targets with a single query,
+// which ranks the reactions of each type to each target and keeps the newest
+func summarizeReactions(ctx context.Context, db *gorm.DB, targetType string, targetIDs []string, userID string, recent int) (map[string]*models.ReactionSummary, error) {
+	summaries := newReactionSummaries(targetIDs)
+	if len(targetIDs) == 0 {
+		return summaries, nil
+	}
+
+	ranked := inTenant(ctx, db, "reactions").Model(&models.Reaction{}).
+		Select(`target_id, type, user_id,
+			ROW_NUMBER() OVER (PARTITION BY target_id, type ORDER BY created_at DESC, id DESC) AS reaction_rank,
+			COUNT(*) OVER (PARTITION BY target_id, type) AS reaction_count,
+			MAX(CASE WHEN user_id = ? THEN 1 ELSE 0 END) OVER (PARTITION BY target_id, type) AS is_mine`, userID).
+		Where("target_type = ? AND target_id IN ?", targetType, targetIDs)
+
+	// Every type keeps at least its newest reaction, which carries its count
+	var rows []reactionSummaryRow
+	err := db.WithContext(ctx).Table("(?) AS ranked", ranked).
+		Where("reaction_rank <= ?", max(recent, 1)).
+		Order("target_id, reaction_count DESC, type, reaction_rank").
+		Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	addReactionSummaryRows(summaries, rows, recent)
+	return summaries, nil
+}
+
+// newReactionSummaries returns empty summaries of targets
+func newReactionSummaries(targetIDs []string) map[string]*models.ReactionSummary {
+	summaries := make(map[string]*models.ReactionSummary, len(targetIDs))
+	for _, id := range targetIDs {
+		summaries[id] = &models.ReactionSummary{Types: []models.ReactionTypeSummary{}, Mine: []string{}}
+	}
+	return summaries
+}
+
+// addReactionSummaryRows adds ranked reactions to the summaries of their
+// targets. Rows are ordered by target, by count within a target, and by rank
+// within a type.
+func addReactionSummaryRows(summaries map[string]*models.ReactionSummary, rows []reactionSummaryRow, recent int) {
+	for _, row := range rows {
+		summary, ok := summaries[row.TargetID]
+		if !ok {
+			continue
+		}
+
+		if row.ReactionRank == 1 {
+			summary.Total += row.ReactionCount
+			summary.Types = append(summary.Types, models.ReactionTypeSummary{
+				Type:        row.Type,
+				Count:       row.ReactionCount,
+				RecentUsers: []string{},
+			})
+			if row.IsMine {
+				summary.Mine = append(summary.Mine, row.Type)
+			}
+		}
+		if row.ReactionRank <= recent {
+			typeSummary := &summary.Types[len(summary.Types)-1]
+			typeSummary.RecentUsers = append(typeSummary.RecentUsers, row.UserID)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package adapters
+
+import (
+	"html"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// SearchSort selects the order of search results
+type SearchSort string
+
+const (
+	// SortRecent orders results newest first and supports cursor pagination
+	SortRecent SearchSort = "recent"
+	// SortRelevance orders results by how well they match the query. Results
+	// are paged by offset; the pagination cursor is ignored.
+	SortRelevance SearchSort = "relevance"
+)
+
+// SearchQuery selects the posts matching all of its criteria. Criteria left
+// at their zero value match every post.
+type SearchQuery struct {
+	Text           string       // Content query, see parseSearchQuery for the syntax
+	City           string       // Exact city name
+	Near           *GeoRadius   // Within a distance of a location
+	Within         *BoundingBox // Within a latitude and longitude range
+	UserID         string       // Author
+	Since          time.Time    // Created at or after
+	Until          time.Time    // Created before
+	HasAttachments *bool        // With or without attachments
+	ReactionType   string       // With at least one reaction of this type
+	Sort           SearchSort   // Defaults to SortRecent
+}
+
+// GeoRadius is a circle around a location
+type GeoRadius struct {
+	Lat      float64
+	Lng      float64
+	RadiusKm float64
+}
+
+// BoundingBox is a latitude and longitude range. A box whose MinLng is greater
+// than its MaxLng crosses the antimeridian.
+type BoundingBox struct {
+	MinLat float64
+	MinLng float64
+	MaxLat float64
+	MaxLng float64
+}
+
+// contains reports whether a location is inside the box
+func (b BoundingBox) contains(lat, lng float64) bool {
+	if lat < b.MinLat || lat > b.MaxLat {
+		return false
+	}
+	if b.MinLng > b.MaxLng {
+		return lng >= b.MinLng || lng <= b.MaxLng
+	}
+	return lng >= b.MinLng && lng <= b.MaxLng
+}
+
+// hasText reports whether the query filters by content. Text without a term
+// that must match, such as only exclusions, matches no posts.
+func (q SearchQuery) hasText() bool {
+	return strings.TrimSpace(q.Text) != ""
+}
+
+// whereSearchFilters restricts a posts query to the criteria every SQL
+// database expresses alike, which is all but text and distance
+func whereSearchFilters(query *gorm.DB, q SearchQuery) *gorm.DB {
+	if q.City != "" {
+		query = query.Where("posts.city = ?", q.City)
+	}
+	if q.UserID != "" {
+		query = query.Where("posts.user_id = ?", q.UserID)
+	}
+	if !q.Since.IsZero() {
+		query = query.Where("posts.created_at >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		query = query.Where("posts.created_at < ?", q.Until)
+	}
+
+	if b := q.Within; b != nil {
+		query = query.Where("posts.latitude BETWEEN ? AND ?", b.MinLat, b.MaxLat)
+		if b.MinLng > b.MaxLng {
+			query = query.Where("(posts.longitude >= ? OR posts.longitude <= ?)", b.MinLng, b.MaxLng)
+		} else {
+			query = query.Where("posts.longitude BETWEEN ? AND ?", b.MinLng, b.MaxLng)
+		}
+	}
+
+	if q.HasAttachments != nil {
+		exists := `EXISTS (SELECT 1 FROM attachments WHERE attachments.post_id = posts.id
+			AND attachments.tenant_id = posts.tenant_id)`
+		if !*q.HasAttachments {
+			exists = "NOT " + exists
+		}
+		query = query.Where(exists)
+	}
+
+	if q.ReactionType != "" {
+		query = query.Where(`EXISTS (SELECT 1 FROM reactions WHERE reactions.target_id = posts.id
+			AND reactions.tenant_id = posts.tenant_id AND reactions.target_type = ? AND reactions.type = ?)`, "post", q.ReactionType)
+	}
+
+	return query
+}
+
+// searchTerm is a word or quoted phrase of a search query
+type searchTerm struct {
+	words   []string // Lowercase words, more than one for a phrase
+	prefix  bool     // The last word matches as a prefix
+	negated bool
+}
+
+// searchClause matches content that matches all of its terms
+type searchClause []searchTerm
+
+// parseSearchQuery parses web search style query syntax, shared by all
+// adapters: all words must match, "quoted phrases" match consecutive words,
+// word* matches words starting with word, -word excludes content with word
+// and OR separates alternatives. Clauses without a term that must match are
+// dropped, since they cannot be searched for on their own. No clauses means
+// nothing matches.
+func parseSearchQuery(query string) []searchClause {
+	var clauses []searchClause
+	var clause searchClause
+
+	flush := func() {
+		for _, term := range clause {
+			if !term.negated {
+				clauses = append(clauses, clause)
+				break
+			}
+		}
+		clause = nil
+	}
+
+	rest := strings.TrimSpace(query)
+	for rest != "" {
+		var raw string
+		var term searchTerm
+
+		if rest[0] == '-' && len(rest) > 1 {
+			term.negated = true
+			rest = rest[1:]
+		}
+
+		if rest[0] == '"' {
+			// A phrase runs to the closing quote, or the end of the query
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				raw, rest = rest[1:], ""
+			} else {
+				raw, rest = rest[1:end+1], rest[end+2:]
+			}
+			if strings.HasPrefix(rest, "*") {
+				term.prefix = true
+			}
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			raw, rest = rest[:end], rest[end:]
+
+			if raw == "OR" && !term.negated {
+				flush()
+				rest = strings.TrimSpace(rest)
+				continue
+			}
+			term.prefix = strings.HasSuffix(raw, "*")
+		}
+		rest = strings.TrimLeftFunc(strings.TrimPrefix(rest, "*"), unicode.IsSpace)
+
+		term.words = searchWords(raw)
+		if len(term.words) > 0 {
+			clause = append(clause, term)
+		}
+	}
+	flush()
+
+	return clauses
+}
+
+// searchWords splits text into lowercase words of letters and digits
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ftsMatchExpression renders clauses as an SQLite FTS5 MATCH expression
+func ftsMatchExpression(clauses []searchClause) string {
+	alternatives := make([]string, len(clauses))
+	for i, clause := range clauses {
+		var required, excluded []string
+		for _, term := range clause {
+			// Words only hold letters and digits, so they need no escaping
+			phrase := `"` + strings.Join(term.words, " ") + `"`
+			if term.prefix {
+				phrase += "*"
+			}
+			if term.negated {
+				excluded = append(excluded, phrase)
+			} else {
+				required = append(required, phrase)
+			}
+		}
+
+		expression := "(" + strings.Join(required, " AND ") + ")"
+		for _, phrase := range excluded {
+			expression += " NOT " + phrase
+		}
+		alternatives[i] = "(" + expression + ")"
+	}
+	return strings.Join(alternatives, " OR ")
+}
+
+// tsQueryExpression renders clauses as PostgreSQL to_tsquery input
+func tsQueryExpression(clauses []searchClause) string {
+	alternatives := make([]string, len(clauses))
+	for i, clause := range clauses {
+		terms := make([]string, len(clause))
+		for j, term := range clause {
+			// Words only hold letters and digits, so they need no escaping
+			words := make([]string, len(term.words))
+			for k, word := range term.words {
+				words[k] = "'" + word + "'"
+			}
+			if term.prefix {
+				words[len(words)-1] += ":*"
+			}
+
+			terms[j] = strings.Join(words, " <-> ")
+			if len(words) > 1 {
+				terms[j] = "(" + terms[j] + ")"
+			}
+			if term.negated {
+				terms[j] = "!" + terms[j]
+			}
+		}
+		alternatives[i] = "(" + strings.Join(terms, " & ") + ")"
+	}
+	return strings.Join(alternatives, " | ")
+}
+
+// likeEscaper escapes LIKE wildcards
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// likeCondition renders clauses as a condition on content with LIKE
+// patterns, for SQLite builds without FTS5. Prefix terms match anywhere in
+// a word and only ASCII letters match regardless of case.
+func likeCondition(clauses []searchClause) (string, []interface{}) {
+	var args []interface{}
+	alternatives := make([]string, len(clauses))
+	for i, clause := range clauses {
+		conditions := make([]string, len(clause))
+		for j, term := range clause {
+			words := make([]string, len(term.words))
+			for k, word := range term.words {
+				words[k] = likeEscaper.Replace(word)
+			}
+			args = append(args, "%"+strings.Join(words, "%")+"%")
+
+			if term.negated {
+				conditions[j] = `content NOT LIKE ? ESCAPE '\'`
+			} else {
+				conditions[j] = `content LIKE ? ESCAPE '\'`
+			}
+		}
+		alternatives[i] = "(" + strings.Join(conditions, " AND ") + ")"
+	}
+	return "(" + strings.Join(alternatives, " OR ") + ")", args
+}
+
+// searchScore returns how well content matches the clauses: the number of
+// times required terms occur in it, or 0 if it does not match
+func searchScore(clauses []searchClause, content string) int {
+	words := searchWords(content)
+
+	best := 0
+	for _, clause := range clauses {
+		score := 0
+		for _, term := range clause {
+			occurrences := len(termMatches(term, words))
+			if term.negated && occurrences > 0 || !term.negated && occurrences == 0 {
+				score = 0
+				break
+			}
+			score += occurrences
+		}
+		if score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+// termMatches returns the indexes of the words where a term occurs
+func termMatches(term searchTerm, words []string) []int {
+	var matches []int
+	for i := 0; i+len(term.words) <= len(words); i++ {
+		matched := true
+		for j, word := range term.words {
+			last := j == len(term.words)-1
+			if words[i+j] != word && !(last && term.prefix && strings.HasPrefix(words[i+j], word)) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+// Snippets wrap the words matching a search in these tags, and are otherwise
+// HTML-escaped
+const (
+	highlightStart = "<mark>"
+	highlightStop  = "</mark>"
+)
+
+// Database functions wrap matches in these markers instead of the highlight
+// tags, so that escapeSnippet can escape the rest of the snippet
+const (
+	matchStart = "\x02"
+	matchStop  = "\x03"
+)
+
+// matchReplacer replaces match markers with highlight tags
+var matchReplacer = strings.NewReplacer(matchStart, highlightStart, matchStop, highlightStop)
+
+// escapeSnippet HTML-escapes a snippet made by a database function, wrapping
+// the matches it marked in highlight tags
+func escapeSnippet(snippet string) string {
+	return matchReplacer.Replace(html.EscapeString(snippet))
+}
+
+// highlightMatches returns content HTML-escaped, with the words matching
+// required terms of the clauses wrapped in highlight tags, for adapters
+// without a database function to do so
+func highlightMatches(clauses []searchClause, content string) string {
+	// Find the words of content as searchWords splits them, with their offsets
+	var words []string
+	var spans [][2]int
+	start := -1
+	for i, r := range content + " " {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		} else if !isWord && start >= 0 {
+			words = append(words, strings.ToLower(content[start:i]))
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+
+	marked := make([]bool, len(words))
+	for _, clause := range clauses {
+		for _, term := range clause {
+			if term.negated {
+				continue
+			}
+			for _, i := range termMatches(term, words) {
+				for j := range term.words {
+					marked[i+j] = true
+				}
+			}
+		}
+	}
+
+	var b strings.Builder
+	last := 0
+	for i, span := range spans {
+		if marked[i] {
+			b.WriteString(html.EscapeString(content[last:span[0]]))
+			b.WriteString(highlightStart)
+			b.WriteString(html.EscapeString(content[span[0]:span[1]]))
+			b.WriteString(highlightStop)
+			last = span[1]
+		}
+	}
+	b.WriteString(html.EscapeString(content[last:]))
+	return b.String()
+}
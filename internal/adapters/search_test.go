@@ -0,0 +1,95 @@
+package adapters
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		query   string
+		fts     string
+		tsQuery string
+	}{
+		{"Quick fox", `(("quick" AND "fox"))`, `('quick' & 'fox')`},
+		{`"brown fox" jump*`, `(("brown fox" AND "jump"*))`, `(('brown' <-> 'fox') & 'jump':*)`},
+		{`"brown fo"*`, `(("brown fo"*))`, `(('brown' <-> 'fo':*))`},
+		{"fox -red -\"red fox\"", `(("fox") NOT "red" NOT "red fox")`, `('fox' & !'red' & !('red' <-> 'fox'))`},
+		{"dog OR red fox", `(("dog")) OR (("red" AND "fox"))`, `('dog') | ('red' & 'fox')`},
+		{"e-mail's", `(("e mail s"))`, `(('e' <-> 'mail' <-> 's'))`},
+		{`"unterminated phrase`, `(("unterminated phrase"))`, `(('unterminated' <-> 'phrase'))`},
+		{"OR dog OR", `(("dog"))`, `('dog')`},
+		{"-fox OR dog", `(("dog"))`, `('dog')`},
+	}
+
+	for _, tt := range tests {
+		clauses := parseSearchQuery(tt.query)
+		assert.Equal(t, tt.fts, ftsMatchExpression(clauses), tt.query)
+		assert.Equal(t, tt.tsQuery, tsQueryExpression(clauses), tt.query)
+	}
+
+	// Queries without anything to match have no clauses
+	for _, query := range []string{"", "   ", "-fox", "*", `""`, "- -"} {
+		assert.Empty(t, parseSearchQuery(query), query)
+	}
+}
+
+func TestSearchScore(t *testing.T) {
+	clauses := parseSearchQuery(`"brown fox" OR dog -cat`)
+	assert.Equal(t, 1, searchScore(clauses, "The quick brown fox"))
+	assert.Equal(t, 2, searchScore(clauses, "Dog eat dog"))
+	assert.Equal(t, 0, searchScore(clauses, "dog and cat"))
+	assert.Equal(t, 0, searchScore(clauses, "fox brown"))
+	assert.Equal(t, 1, searchScore(parseSearchQuery("quic*"), "Quickly!"))
+}
+
+func TestHighlightMatches(t *testing.T) {
+	tests := []struct {
+		query, content, want string
+	}{
+		{"fox", "The Fox, the fox!", "The <mark>Fox</mark>, the <mark>fox</mark>!"},
+		{`"brown fox" OR dog`, "brown fox, brown dog", "<mark>brown</mark> <mark>fox</mark>, brown <mark>dog</mark>"},
+		{"quic* -slow", "quickly, not slow", "<mark>quickly</mark>, not slow"},
+		{"café", "Café <b>", "<mark>Café</mark> &lt;b&gt;"},
+		{"script", "<script>alert(1)</script>", "&lt;<mark>script</mark>&gt;alert(1)&lt;/<mark>script</mark>&gt;"},
+		{"zebra", "no match", "no match"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, highlightMatches(parseSearchQuery(tt.query), tt.content), tt.query)
+	}
+}
+
+func TestEscapeSnippet(t *testing.T) {
+	snippet := "<b>" + matchStart + "kiwi" + matchStop + "</b> & " + matchStart + "lime" + matchStop
+	assert.Equal(t, "&lt;b&gt;<mark>kiwi</mark>&lt;/b&gt; &amp; <mark>lime</mark>", escapeSnippet(snippet))
+}
+
+func TestSearchConfigs(t *testing.T) {
+	viper.Set("SEARCH_LANGUAGES", "en:english, pt:portuguese,pt-br:portuguese,ES:spanish")
+	viper.Set("SEARCH_DEFAULT_CONFIG", "simple")
+	defer viper.Set("SEARCH_LANGUAGES", nil)
+	defer viper.Set("SEARCH_DEFAULT_CONFIG", nil)
+
+	configs, err := loadSearchConfigs()
+	require.NoError(t, err)
+	assert.Equal(t, "english", configs.forLanguage("en"))
+	assert.Equal(t, "english", configs.forLanguage("en-GB"))
+	assert.Equal(t, "portuguese", configs.forLanguage("pt-BR"))
+	assert.Equal(t, "spanish", configs.forLanguage("es"))
+	assert.Equal(t, "simple", configs.forLanguage("ja"))
+	assert.Equal(t, "simple", configs.forLanguage(""))
+	assert.Equal(t, []string{"english", "portuguese", "simple", "spanish"}, configs.all())
+
+	condition, args := configs.matchCondition("'fox'")
+	assert.Equal(t, 4, strings.Count(condition, "search_vector @@"))
+	assert.Len(t, args, 12)
+
+	viper.Set("SEARCH_LANGUAGES", "en=english")
+	_, err = loadSearchConfigs()
+	assert.Error(t, err)
+}
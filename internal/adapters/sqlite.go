@@ -1,24 +1,64 @@
 package adapters
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
-	"math"
+	"log"
+	"time"
 
+	"github.com/mattn/go-sqlite3"
 	"github.com/spf13/viper"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 
+	"sonet/internal/migrations"
 	"sonet/internal/models"
 )
 
 // SQLiteAdapter implements the DatabaseAdapter interface for SQLite
 type SQLiteAdapter struct {
-	db *gorm.DB
+	db  *gorm.DB
+	fts bool // Whether the posts_fts full-text index exists
 }
 
 // newSQLiteAdapter creates a new SQLite database adapter
 func newSQLiteAdapter() (*SQLiteAdapter, error) {
+	db, err := openSQLite()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrateSchema(db, migrations.SQLite, autoMigrateSQLite); err != nil {
+		return nil, fmt.Errorf("failed to migrate database schema: %v", err)
+	}
+
+	// The full-text index needs FTS5, which only some builds have
+	fts := db.Migrator().HasTable("posts_fts")
+	if !fts {
+		log.Printf("Full-text search is unavailable, searching posts by substring instead: " +
+			"build with -tags sqlite_fts5 and use versioned migrations, as DB_MIGRATE_MODE=up does")
+	}
+
+	return &SQLiteAdapter{db: db, fts: fts}, nil
+}
+
+// sqliteDriver is the SQLite driver with the SQL functions Sonet's queries use
+const sqliteDriver = "sqlite3_sonet"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			// haversine_km(lat1, lng1, lat2, lng2) is the distance between two locations
+			return conn.RegisterFunc("haversine_km", haversineKm, true)
+		},
+	})
+}
+
+// openSQLite opens the SQLite database configured in DB_CONNECTION_STRING
+func openSQLite() (*gorm.DB, error) {
 	dbPath := viper.GetString("DB_CONNECTION_STRING")
 
 	// Configure the logger
@@ -28,51 +68,51 @@ func newSQLiteAdapter() (*SQLiteAdapter, error) {
 	}
 
 	// Open the database connection
-	db, err := gorm.Open(sqlite.Open(dbPath), &gorm.Config{
-		Logger: logger.Default.LogMode(logLevel),
+	db, err := gorm.Open(sqlite.New(sqlite.Config{DriverName: sqliteDriver, DSN: dbPath}), &gorm.Config{
+		Logger:         logger.Default.LogMode(logLevel),
+		TranslateError: true,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %v", err)
 	}
 
-	// Auto migrate the schema
-	if err := db.AutoMigrate(&models.Post{}, &models.Comment{}, &models.Reaction{}, &models.Attachment{}); err != nil {
-		return nil, fmt.Errorf("failed to migrate database schema: %v", err)
-	}
+	return db, nil
+}
 
-	return &SQLiteAdapter{db: db}, nil
+// autoMigrateSQLite creates the schema with GORM's AutoMigrate, for development
+func autoMigrateSQLite(db *gorm.DB) error {
+	return db.AutoMigrate(&models.Post{}, &models.Comment{}, &models.Reaction{}, &models.Attachment{}, &models.ModerationAction{}, &models.APIKey{}, &models.ReactionType{}, &models.ReactionCount{}, &models.OutboxEvent{}, &models.WebhookSubscription{}, &models.WebhookDelivery{})
 }
 
 // CreatePost creates a new post
-func (a *SQLiteAdapter) CreatePost(post *models.Post) error {
-	return a.db.Create(post).Error
+func (a *SQLiteAdapter) CreatePost(ctx context.Context, post *models.Post) error {
+	post.TenantID = TenantFromContext(ctx)
+	return a.db.WithContext(ctx).Create(post).Error
 }
 
 // GetPostByID retrieves a post by its ID with attachments
-func (a *SQLiteAdapter) GetPostByID(id string) (*models.Post, error) {
+func (a *SQLiteAdapter) GetPostByID(ctx context.Context, id string) (*models.Post, error) {
 	var post models.Post
-	err := a.db.First(&post, "id = ?", id).Error
+	err := inTenant(ctx, a.db, "posts").First(&post, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
 
-	// Load attachments
-	attachments, err := a.GetAttachmentsForPost(id)
-	if err != nil {
+	// Load attachments and reaction counts
+	if err := loadPostAttachments(inTenant(ctx, a.db, "attachments"), []*models.Post{&post}); err != nil {
 		return nil, err
 	}
-	post.Attachments = make([]models.Attachment, len(attachments))
-	for i, attachment := range attachments {
-		post.Attachments[i] = *attachment
+	if err := loadPostReactionCounts(inTenant(ctx, a.db, "reaction_counts"), []*models.Post{&post}); err != nil {
+		return nil, err
 	}
 
 	return &post, nil
 }
 
 // ListPosts retrieves posts with pagination and attachments
-func (a *SQLiteAdapter) ListPosts(userID string, limit, offset int) ([]*models.Post, error) {
+func (a *SQLiteAdapter) ListPosts(ctx context.Context, userID string, p Pagination) ([]*models.Post, error) {
 	var posts []*models.Post
-	query := a.db.Order("created_at DESC").Limit(limit).Offset(offset)
+	query := newestFirst(visibleInTenant(ctx, a.db, "posts"), p)
 	if userID != "" {
 		query = query.Where("user_id = ?", userID)
 	}
@@ -82,147 +122,268 @@ func (a *SQLiteAdapter) ListPosts(userID string, limit, offset int) ([]*models.P
 		return nil, err
 	}
 
-	// Load attachments for each post
-	for _, post := range posts {
-		attachments, err := a.GetAttachmentsForPost(post.ID)
-		if err != nil {
-			return nil, err
-		}
-		post.Attachments = make([]models.Attachment, len(attachments))
-		for i, attachment := range attachments {
-			post.Attachments[i] = *attachment
-		}
+	// Load attachments and reaction counts for all posts in one query each
+	if err := loadPostAttachments(inTenant(ctx, a.db, "attachments"), posts); err != nil {
+		return nil, err
+	}
+	if err := loadPostReactionCounts(inTenant(ctx, a.db, "reaction_counts"), posts); err != nil {
+		return nil, err
 	}
 
 	return posts, nil
 }
 
+// CountPosts returns the number of posts, optionally filtered by user
+func (a *SQLiteAdapter) CountPosts(ctx context.Context, userID string) (int64, error) {
+	var count int64
+	query := visibleInTenant(ctx, a.db, "posts").Model(&models.Post{})
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	err := query.Count(&count).Error
+	return count, err
+}
+
 // UpdatePost updates an existing post
-func (a *SQLiteAdapter) UpdatePost(post *models.Post) error {
-	return a.db.Save(post).Error
+func (a *SQLiteAdapter) UpdatePost(ctx context.Context, post *models.Post) error {
+	post.TenantID = TenantFromContext(ctx)
+	return updateInTenant(ctx, a.db, "posts", post)
 }
 
 // DeletePost deletes a post and all its comments, attachments and reactions
-func (a *SQLiteAdapter) DeletePost(id string) error {
-	return a.db.Transaction(func(tx *gorm.DB) error {
+func (a *SQLiteAdapter) DeletePost(ctx context.Context, id string) error {
+	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 		// Delete all reactions to this post
-		if err := tx.Delete(&models.Reaction{}, "target_id = ? AND target_type = ?", id, "post").Error; err != nil {
+		if err := inTenant(ctx, tx, "reactions").Delete(&models.Reaction{}, "target_id = ? AND target_type = ?", id, "post").Error; err != nil {
 			return err
 		}
 
 		// Get all comments for this post
 		var comments []*models.Comment
-		if err := tx.Where("post_id = ?", id).Find(&comments).Error; err != nil {
+		if err := inTenant(ctx, tx, "comments").Where("post_id = ?", id).Find(&comments).Error; err != nil {
 			return err
 		}
 
 		// Delete all reactions and attachments to these comments
-		for _, comment := range comments {
-			if err := tx.Delete(&models.Reaction{}, "target_id = ? AND target_type = ?", comment.ID, "comment").Error; err != nil {
+		commentIDs := make([]string, len(comments))
+		for i, comment := range comments {
+			commentIDs[i] = comment.ID
+			if err := inTenant(ctx, tx, "reactions").Delete(&models.Reaction{}, "target_id = ? AND target_type = ?", comment.ID, "comment").Error; err != nil {
 				return err
 			}
 
 			// Delete comment attachments
-			if err := tx.Delete(&models.Attachment{}, "comment_id = ?", comment.ID).Error; err != nil {
+			if err := inTenant(ctx, tx, "attachments").Delete(&models.Attachment{}, "comment_id = ?", comment.ID).Error; err != nil {
 				return err
 			}
 		}
 
+		// Delete the reaction counts of the post and its comments
+		if err := deleteReactionCounts(ctx, tx, "post", []string{id}); err != nil {
+			return err
+		}
+		if err := deleteReactionCounts(ctx, tx, "comment", commentIDs); err != nil {
+			return err
+		}
+
 		// Delete all comments
-		if err := tx.Delete(&models.Comment{}, "post_id = ?", id).Error; err != nil {
+		if err := inTenant(ctx, tx, "comments").Delete(&models.Comment{}, "post_id = ?", id).Error; err != nil {
 			return err
 		}
 
 		// Delete all attachments for this post
-		if err := tx.Delete(&models.Attachment{}, "post_id = ?", id).Error; err != nil {
+		if err := inTenant(ctx, tx, "attachments").Delete(&models.Attachment{}, "post_id = ?", id).Error; err != nil {
 			return err
 		}
 
 		// Finally delete the post
-		return tx.Delete(&models.Post{}, "id = ?", id).Error
+		return inTenant(ctx, tx, "posts").Delete(&models.Post{}, "id = ?", id).Error
 	})
 }
 
-// CreateComment creates a new comment
-func (a *SQLiteAdapter) CreateComment(comment *models.Comment) error {
-	return a.db.Create(comment).Error
+// CreateComment creates a new comment and counts it on its post and parent
+func (a *SQLiteAdapter) CreateComment(ctx context.Context, comment *models.Comment) error {
+	comment.TenantID = TenantFromContext(ctx)
+	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(comment).Error; err != nil {
+			return err
+		}
+		return countComment(ctx, tx, comment, 1)
+	})
 }
 
 // GetCommentByID retrieves a comment by its ID with attachment
-func (a *SQLiteAdapter) GetCommentByID(id string) (*models.Comment, error) {
+func (a *SQLiteAdapter) GetCommentByID(ctx context.Context, id string) (*models.Comment, error) {
 	var comment models.Comment
-	err := a.db.First(&comment, "id = ?", id).Error
+	err := inTenant(ctx, a.db, "comments").First(&comment, "id = ?", id).Error
 	if err != nil {
 		return nil, err
 	}
 
 	// Load attachment if exists
-	attachment, err := a.GetAttachmentForComment(id)
+	attachment, err := a.GetAttachmentForComment(ctx, id)
 	if err == nil {
 		comment.Attachment = attachment
 	}
 	// If error is record not found, that's fine - comment may not have an attachment
 
+	if err := loadCommentReactionCounts(inTenant(ctx, a.db, "reaction_counts"), []*models.Comment{&comment}); err != nil {
+		return nil, err
+	}
+
 	return &comment, nil
 }
 
 // ListComments retrieves comments with pagination and attachments
-func (a *SQLiteAdapter) ListComments(postID string, limit, offset int) ([]*models.Comment, error) {
+func (a *SQLiteAdapter) ListComments(ctx context.Context, postID string, p Pagination) ([]*models.Comment, error) {
 	var comments []*models.Comment
-	err := a.db.Where("post_id = ?", postID).
-		Order("created_at ASC").
-		Limit(limit).
-		Offset(offset).
+	err := oldestFirst(visibleInTenant(ctx, a.db, "comments").Where("post_id = ?", postID), p).
 		Find(&comments).Error
 
 	if err != nil {
 		return nil, err
 	}
 
-	// Load attachment for each comment
-	for _, comment := range comments {
-		attachment, err := a.GetAttachmentForComment(comment.ID)
-		if err == nil {
-			comment.Attachment = attachment
-		}
-		// If error is record not found, that's fine - comment may not have an attachment
+	// Load attachments and reaction counts for all comments in one query each
+	if err := loadCommentAttachments(inTenant(ctx, a.db, "attachments"), comments); err != nil {
+		return nil, err
+	}
+	if err := loadCommentReactionCounts(inTenant(ctx, a.db, "reaction_counts"), comments); err != nil {
+		return nil, err
 	}
 
 	return comments, nil
 }
 
+// CountComments returns the number of comments on a post
+func (a *SQLiteAdapter) CountComments(ctx context.Context, postID string) (int64, error) {
+	var count int64
+	err := visibleInTenant(ctx, a.db, "comments").Model(&models.Comment{}).
+		Where("post_id = ?", postID).
+		Count(&count).Error
+	return count, err
+}
+
 // UpdateComment updates an existing comment
-func (a *SQLiteAdapter) UpdateComment(comment *models.Comment) error {
-	return a.db.Save(comment).Error
+func (a *SQLiteAdapter) UpdateComment(ctx context.Context, comment *models.Comment) error {
+	comment.TenantID = TenantFromContext(ctx)
+	return updateInTenant(ctx, a.db, "comments", comment)
 }
 
-// DeleteComment deletes a comment, its attachment and all its reactions
-func (a *SQLiteAdapter) DeleteComment(id string) error {
-	return a.db.Transaction(func(tx *gorm.DB) error {
+// DeleteComment deletes a comment, its attachment and all its reactions, and
+// uncounts it on its post and parent
+func (a *SQLiteAdapter) DeleteComment(ctx context.Context, id string) error {
+	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Delete the comment first, so that only the request that deleted it uncounts it
+		var deleted []*models.Comment
+		if err := inTenant(ctx, tx, "comments").Clauses(clause.Returning{}).Where("id = ?", id).Delete(&deleted).Error; err != nil {
+			return err
+		}
+		for _, comment := range deleted {
+			if err := countComment(ctx, tx, comment, -1); err != nil {
+				return err
+			}
+		}
+
 		// Delete all reactions to this comment
-		if err := tx.Delete(&models.Reaction{}, "target_id = ? AND target_type = ?", id, "comment").Error; err != nil {
+		if err := inTenant(ctx, tx, "reactions").Delete(&models.Reaction{}, "target_id = ? AND target_type = ?", id, "comment").Error; err != nil {
+			return err
+		}
+		if err := deleteReactionCounts(ctx, tx, "comment", []string{id}); err != nil {
 			return err
 		}
 
 		// Delete attachment if exists
-		if err := tx.Delete(&models.Attachment{}, "comment_id = ?", id).Error; err != nil {
+		return inTenant(ctx, tx, "attachments").Delete(&models.Attachment{}, "comment_id = ?", id).Error
+	})
+}
+
+// CreateReaction creates a new reaction and counts it
+func (a *SQLiteAdapter) CreateReaction(ctx context.Context, reaction *models.Reaction) error {
+	reaction.TenantID = TenantFromContext(ctx)
+	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(reaction).Error; err != nil {
 			return err
 		}
+		return countReaction(ctx, tx, reaction, 1)
+	})
+}
+
+// AddReaction creates a reaction unless the user already reacted to the
+// target with its type, in which case reaction is set to the existing one
+func (a *SQLiteAdapter) AddReaction(ctx context.Context, reaction *models.Reaction) (bool, error) {
+	reaction.TenantID = TenantFromContext(ctx)
+	var created bool
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(reaction)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		created = true
+		return countReaction(ctx, tx, reaction, 1)
+	})
+	if err != nil {
+		return false, err
+	}
+	if created {
+		return true, nil
+	}
+
+	existing, err := a.GetReaction(ctx, reaction.UserID, reaction.TargetID, reaction.TargetType, reaction.Type)
+	if err != nil {
+		return false, err
+	}
+	*reaction = *existing
+	return false, nil
+}
 
-		// Delete the comment
-		return tx.Delete(&models.Comment{}, "id = ?", id).Error
+// ReplaceReaction adds a reaction and removes the user's reactions of other
+// types to its target
+func (a *SQLiteAdapter) ReplaceReaction(ctx context.Context, reaction *models.Reaction) (bool, []*models.Reaction, error) {
+	var created bool
+	var removed []*models.Reaction
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		created, removed, err = replaceReaction(ctx, tx, reaction)
+		return err
 	})
+	if err != nil {
+		return false, nil, err
+	}
+	return created, removed, nil
 }
 
-// CreateReaction creates a new reaction
-func (a *SQLiteAdapter) CreateReaction(reaction *models.Reaction) error {
-	return a.db.Create(reaction).Error
+// RemoveReaction deletes a user's reaction to a target and returns it
+func (a *SQLiteAdapter) RemoveReaction(ctx context.Context, userID, targetID, targetType, reactionType string) (*models.Reaction, error) {
+	var reaction models.Reaction
+	err := a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := inTenant(ctx, tx, "reactions").Where("user_id = ? AND target_id = ? AND target_type = ? AND type = ?",
+			userID, targetID, targetType, reactionType).First(&reaction).Error
+		if err != nil {
+			return err
+		}
+
+		// Another request may have removed it since
+		result := inTenant(ctx, tx, "reactions").Delete(&models.Reaction{}, "id = ?", reaction.ID)
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		return countReaction(ctx, tx, &reaction, -1)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &reaction, nil
 }
 
 // GetReaction retrieves a specific reaction
-func (a *SQLiteAdapter) GetReaction(userID, targetID, targetType, reactionType string) (*models.Reaction, error) {
+func (a *SQLiteAdapter) GetReaction(ctx context.Context, userID, targetID, targetType, reactionType string) (*models.Reaction, error) {
 	var reaction models.Reaction
-	err := a.db.Where("user_id = ? AND target_id = ? AND target_type = ? AND type = ?",
+	err := inTenant(ctx, a.db, "reactions").Where("user_id = ? AND target_id = ? AND target_type = ? AND type = ?",
 		userID, targetID, targetType, reactionType).First(&reaction).Error
 	if err != nil {
 		return nil, err
@@ -230,16 +391,54 @@ func (a *SQLiteAdapter) GetReaction(userID, targetID, targetType, reactionType s
 	return &reaction, nil
 }
 
+// GetReactionByID retrieves a reaction by ID
+func (a *SQLiteAdapter) GetReactionByID(ctx context.Context, id string) (*models.Reaction, error) {
+	var reaction models.Reaction
+	if err := inTenant(ctx, a.db, "reactions").First(&reaction, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &reaction, nil
+}
+
 // ListReactions retrieves all reactions for a target
-func (a *SQLiteAdapter) ListReactions(targetID, targetType string) ([]*models.Reaction, error) {
+func (a *SQLiteAdapter) ListReactions(ctx context.Context, targetID, targetType string) ([]*models.Reaction, error) {
 	var reactions []*models.Reaction
-	err := a.db.Where("target_id = ? AND target_type = ?", targetID, targetType).Find(&reactions).Error
+	err := inTenant(ctx, a.db, "reactions").Where("target_id = ? AND target_type = ?", targetID, targetType).Find(&reactions).Error
 	return reactions, err
 }
 
-// DeleteReaction deletes a reaction
-func (a *SQLiteAdapter) DeleteReaction(id string) error {
-	return a.db.Delete(&models.Reaction{}, "id = ?", id).Error
+// DeleteReaction deletes a reaction and uncounts it
+func (a *SQLiteAdapter) DeleteReaction(ctx context.Context, id string) error {
+	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var deleted []*models.Reaction
+		if err := inTenant(ctx, tx, "reactions").Clauses(clause.Returning{}).Where("id = ?", id).Delete(&deleted).Error; err != nil {
+			return err
+		}
+		for _, reaction := range deleted {
+			if err := countReaction(ctx, tx, reaction, -1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SummarizeReactions aggregates the reactions to targets
+func (a *SQLiteAdapter) SummarizeReactions(ctx context.Context, targetType string, targetIDs []string, userID string, recent int) (map[string]*models.ReactionSummary, error) {
+	return summarizeReactions(ctx, a.db, targetType, targetIDs, userID, recent)
+}
+
+// RepairCounters recomputes the engagement counters of every tenant
+func (a *SQLiteAdapter) RepairCounters(ctx context.Context) error {
+	return repairCounters(ctx, a.db)
+}
+
+// Transaction runs fn in a database transaction, with an adapter whose
+// methods take part in it
+func (a *SQLiteAdapter) Transaction(ctx context.Context, fn func(tx DatabaseAdapter) error) error {
+	return a.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&SQLiteAdapter{db: tx, fts: a.fts})
+	})
 }
 
 // Close closes the database connection
@@ -251,108 +450,190 @@ func (a *SQLiteAdapter) Close() error {
 	return sqlDB.Close()
 }
 
-// SearchPosts searches for posts by content
-func (a *SQLiteAdapter) SearchPosts(query string, limit, offset int) ([]*models.Post, error) {
-	var posts []*models.Post
+// SearchPosts returns the posts matching a search query, see parseSearchQuery
+// for the text query syntax. With the FTS5 index, relevance is ranked by bm25
+// and snippets are excerpts around the matches; without it, text search falls
+// back to LIKE, relevance ordering to newest first and snippets to the whole
+// content.
+func (a *SQLiteAdapter) SearchPosts(ctx context.Context, q SearchQuery, p Pagination) ([]*models.Post, error) {
+	posts := []*models.Post{}
+	clauses := parseSearchQuery(q.Text)
+	if q.hasText() && len(clauses) == 0 {
+		return posts, nil
+	}
+
+	search := a.matchingPosts(visibleInTenant(ctx, a.db, "posts"), q, clauses)
+	ranked := a.fts && len(clauses) > 0
+	if ranked {
+		search = search.Select("posts.*, snippet(posts_fts, 0, ?, ?, '…', 32) AS snippet", matchStart, matchStop)
+	} else {
+		search = search.Select("posts.*")
+	}
 
-	// Using LIKE for basic search functionality
-	searchQuery := "%" + query + "%"
+	switch {
+	case q.Sort == SortRelevance && ranked:
+		search = search.Order("bm25(posts_fts), created_at DESC, id DESC").
+			Limit(p.Limit).
+			Offset(p.Offset)
+	case q.Sort == SortRelevance:
+		search = newestFirst(search, Pagination{Limit: p.Limit, Offset: p.Offset})
+	default:
+		search = newestFirst(search, p)
+	}
 
-	err := a.db.Where("content LIKE ?", searchQuery).
-		Order("created_at DESC").
-		Limit(limit).
-		Offset(offset).
-		Find(&posts).Error
+	if err := search.Find(&posts).Error; err != nil {
+		return nil, err
+	}
 
-	return posts, err
+	for _, post := range posts {
+		switch {
+		case ranked:
+			post.Snippet = escapeSnippet(post.Snippet)
+		case q.hasText():
+			post.Snippet = highlightMatches(clauses, post.Content)
+		}
+	}
+
+	if err := loadPostAttachments(inTenant(ctx, a.db, "attachments"), posts); err != nil {
+		return nil, err
+	}
+	if err := loadPostReactionCounts(inTenant(ctx, a.db, "reaction_counts"), posts); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// CountSearchPosts returns the number of posts matching a search query
+func (a *SQLiteAdapter) CountSearchPosts(ctx context.Context, q SearchQuery) (int64, error) {
+	var count int64
+	clauses := parseSearchQuery(q.Text)
+	if q.hasText() && len(clauses) == 0 {
+		return count, nil
+	}
+
+	err := a.matchingPosts(visibleInTenant(ctx, a.db, "posts").Model(&models.Post{}), q, clauses).
+		Count(&count).Error
+	return count, err
+}
+
+// matchingPosts restricts a posts query to the posts matching a search query,
+// whose text parses to clauses
+func (a *SQLiteAdapter) matchingPosts(query *gorm.DB, q SearchQuery, clauses []searchClause) *gorm.DB {
+	query = whereSearchFilters(query, q)
+	if q.Near != nil {
+		query = withinRadius(query, q.Near.Lat, q.Near.Lng, q.Near.RadiusKm)
+	}
+
+	if len(clauses) == 0 {
+		return query
+	}
+	if a.fts {
+		return query.Joins("JOIN posts_fts ON posts_fts.rowid = posts.rowid").
+			Where("posts_fts MATCH ?", ftsMatchExpression(clauses))
+	}
+
+	condition, args := likeCondition(clauses)
+	return query.Where(condition, args...)
 }
 
 // ListPostsByCity returns posts from a specific city
-func (a *SQLiteAdapter) ListPostsByCity(city string, limit, offset int) ([]*models.Post, error) {
+func (a *SQLiteAdapter) ListPostsByCity(ctx context.Context, city string, p Pagination) ([]*models.Post, error) {
 	var posts []*models.Post
 	// Use exact match rather than LIKE for city
-	err := a.db.Where("city = ?", city).
-		Order("created_at DESC").
-		Limit(limit).
-		Offset(offset).
+	err := newestFirst(visibleInTenant(ctx, a.db, "posts").Where("city = ?", city), p).
 		Find(&posts).Error
-	return posts, err
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadPostAttachments(inTenant(ctx, a.db, "attachments"), posts); err != nil {
+		return nil, err
+	}
+	if err := loadPostReactionCounts(inTenant(ctx, a.db, "reaction_counts"), posts); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
 }
 
-// FindNearbyPosts finds posts within a certain radius of a location
-func (a *SQLiteAdapter) FindNearbyPosts(lat, lng float64, radiusKm float64, limit, offset int) ([]*models.Post, error) {
-	var posts []*models.Post
+// CountPostsByCity returns the number of posts from a specific city
+func (a *SQLiteAdapter) CountPostsByCity(ctx context.Context, city string) (int64, error) {
+	var count int64
+	err := visibleInTenant(ctx, a.db, "posts").Model(&models.Post{}).
+		Where("city = ?", city).
+		Count(&count).Error
+	return count, err
+}
 
-	// For better performance, use a bounding box first to limit the number of records
-	// A rough approximation: 1 degree of latitude ≈ 111 km
-	// 1 degree of longitude ≈ 111 * cos(latitude) km
-	latDelta := (radiusKm * 1.2) / 111.0 // Add 20% margin for safety
-	lngDelta := (radiusKm * 1.2) / (111.0 * math.Cos(lat*math.Pi/180.0))
-
-	// Use the bounding box to reduce the number of candidates
-	err := a.db.Where("latitude IS NOT NULL AND longitude IS NOT NULL").
-		Where("latitude BETWEEN ? AND ?", lat-latDelta, lat+latDelta).
-		Where("longitude BETWEEN ? AND ?", lng-lngDelta, lng+lngDelta).
-		Order("created_at DESC").
+// FindNearbyPosts finds posts within a certain radius of a location, nearest first
+func (a *SQLiteAdapter) FindNearbyPosts(ctx context.Context, lat, lng float64, radiusKm float64, limit, offset int) ([]*models.Post, error) {
+	var posts []*models.Post
+	err := withinRadius(visibleInTenant(ctx, a.db, "posts"), lat, lng, radiusKm).
+		Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:                "haversine_km(posts.latitude, posts.longitude, ?, ?) ASC, created_at DESC, id DESC",
+			Vars:               []interface{}{lat, lng},
+			WithoutParentheses: true,
+		}}).
+		Limit(limit).
+		Offset(offset).
 		Find(&posts).Error
-
 	if err != nil {
 		return nil, err
 	}
 
-	// Filter the candidates by accurate distance and apply pagination in memory
-	const earthRadius = 6371.0 // Earth radius in kilometers
-	filteredPosts := make([]*models.Post, 0)
-
-	for _, post := range posts {
-		// Calculate distance using Haversine formula
-		radLat1 := lat * math.Pi / 180
-		radLat2 := post.Latitude * math.Pi / 180
-		deltaLng := (post.Longitude - lng) * math.Pi / 180
-		deltaLat := (post.Latitude - lat) * math.Pi / 180
-
-		a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
-			math.Cos(radLat1)*math.Cos(radLat2)*
-				math.Sin(deltaLng/2)*math.Sin(deltaLng/2)
-		c := 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
-		distance := earthRadius * c
-
-		if distance <= radiusKm {
-			filteredPosts = append(filteredPosts, post)
-		}
-	}
-
-	// Apply pagination to the filtered results
-	start := offset
-	end := offset + limit
-	if start >= len(filteredPosts) {
-		return []*models.Post{}, nil
+	if err := loadPostAttachments(inTenant(ctx, a.db, "attachments"), posts); err != nil {
+		return nil, err
 	}
-	if end > len(filteredPosts) {
-		end = len(filteredPosts)
+	if err := loadPostReactionCounts(inTenant(ctx, a.db, "reaction_counts"), posts); err != nil {
+		return nil, err
 	}
 
-	return filteredPosts[start:end], nil
+	return posts, nil
+}
+
+// CountNearbyPosts returns the number of posts within a certain radius of a location
+func (a *SQLiteAdapter) CountNearbyPosts(ctx context.Context, lat, lng float64, radiusKm float64) (int64, error) {
+	var count int64
+	err := withinRadius(visibleInTenant(ctx, a.db, "posts").Model(&models.Post{}), lat, lng, radiusKm).
+		Count(&count).Error
+	return count, err
+}
+
+// withinRadius restricts a posts query to the posts within a certain radius
+// of a location, leaving out posts without a location, at 0,0. The bounding
+// box around the location limits the number of records before the exact
+// distance is checked with haversine_km.
+func withinRadius(query *gorm.DB, lat, lng, radiusKm float64) *gorm.DB {
+	latDelta, lngDelta := boundingBox(lat, radiusKm)
+	return query.Where("posts.latitude IS NOT NULL AND posts.longitude IS NOT NULL").
+		Where("NOT (posts.latitude = 0 AND posts.longitude = 0)").
+		Where("posts.latitude BETWEEN ? AND ?", lat-latDelta, lat+latDelta).
+		Where("posts.longitude BETWEEN ? AND ?", lng-lngDelta, lng+lngDelta).
+		Where("haversine_km(posts.latitude, posts.longitude, ?, ?) <= ?", lat, lng, radiusKm)
 }
 
 // Attachment methods
 
 // CreateAttachment creates a new attachment
-func (a *SQLiteAdapter) CreateAttachment(attachment *models.Attachment) error {
-	return a.db.Create(attachment).Error
+func (a *SQLiteAdapter) CreateAttachment(ctx context.Context, attachment *models.Attachment) error {
+	attachment.TenantID = TenantFromContext(ctx)
+	return a.db.WithContext(ctx).Create(attachment).Error
 }
 
 // GetAttachmentsForPost retrieves all attachments for a post
-func (a *SQLiteAdapter) GetAttachmentsForPost(postID string) ([]*models.Attachment, error) {
+func (a *SQLiteAdapter) GetAttachmentsForPost(ctx context.Context, postID string) ([]*models.Attachment, error) {
 	var attachments []*models.Attachment
-	err := a.db.Where("post_id = ?", postID).Find(&attachments).Error
+	err := inTenant(ctx, a.db, "attachments").Where("post_id = ?", postID).
+		Order("created_at ASC, id ASC").
+		Find(&attachments).Error
 	return attachments, err
 }
 
 // GetAttachmentForComment retrieves an attachment for a comment
-func (a *SQLiteAdapter) GetAttachmentForComment(commentID string) (*models.Attachment, error) {
+func (a *SQLiteAdapter) GetAttachmentForComment(ctx context.Context, commentID string) (*models.Attachment, error) {
 	var attachment models.Attachment
-	err := a.db.Where("comment_id = ?", commentID).First(&attachment).Error
+	err := inTenant(ctx, a.db, "attachments").Where("comment_id = ?", commentID).First(&attachment).Error
 	if err != nil {
 		return nil, err
 	}
@@ -360,6 +641,186 @@ func (a *SQLiteAdapter) GetAttachmentForComment(commentID string) (*models.Attac
 }
 
 // DeleteAttachment deletes an attachment
-func (a *SQLiteAdapter) DeleteAttachment(id string) error {
-	return a.db.Delete(&models.Attachment{}, "id = ?", id).Error
+func (a *SQLiteAdapter) DeleteAttachment(ctx context.Context, id string) error {
+	return inTenant(ctx, a.db, "attachments").Delete(&models.Attachment{}, "id = ?", id).Error
+}
+
+// CreateModerationAction records a moderation action
+func (a *SQLiteAdapter) CreateModerationAction(ctx context.Context, action *models.ModerationAction) error {
+	action.TenantID = TenantFromContext(ctx)
+	return a.db.WithContext(ctx).Create(action).Error
+}
+
+// ListModerationActions retrieves moderation actions, newest first
+func (a *SQLiteAdapter) ListModerationActions(ctx context.Context, p Pagination) ([]*models.ModerationAction, error) {
+	var actions []*models.ModerationAction
+	err := newestFirst(inTenant(ctx, a.db, "moderation_actions"), p).Find(&actions).Error
+	return actions, err
+}
+
+// CreateReactionType creates a custom reaction type
+func (a *SQLiteAdapter) CreateReactionType(ctx context.Context, reactionType *models.ReactionType) error {
+	reactionType.TenantID = TenantFromContext(ctx)
+	return a.db.WithContext(ctx).Create(reactionType).Error
+}
+
+// GetReactionType retrieves a custom reaction type by name
+func (a *SQLiteAdapter) GetReactionType(ctx context.Context, name string) (*models.ReactionType, error) {
+	var reactionType models.ReactionType
+	if err := inTenant(ctx, a.db, "reaction_types").First(&reactionType, "name = ?", name).Error; err != nil {
+		return nil, err
+	}
+	return &reactionType, nil
+}
+
+// ListReactionTypes retrieves all custom reaction types, by name
+func (a *SQLiteAdapter) ListReactionTypes(ctx context.Context) ([]*models.ReactionType, error) {
+	var reactionTypes []*models.ReactionType
+	err := inTenant(ctx, a.db, "reaction_types").Order("name ASC").Find(&reactionTypes).Error
+	return reactionTypes, err
+}
+
+// DeleteReactionType deletes a custom reaction type. Reactions of the type
+// are kept.
+func (a *SQLiteAdapter) DeleteReactionType(ctx context.Context, name string) error {
+	result := inTenant(ctx, a.db, "reaction_types").Delete(&models.ReactionType{}, "name = ?", name)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// CreateAPIKey creates a new API key
+func (a *SQLiteAdapter) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	key.TenantID = TenantFromContext(ctx)
+	return a.db.WithContext(ctx).Create(key).Error
+}
+
+// GetAPIKeyByPrefix retrieves the API key with a prefix, of any tenant
+func (a *SQLiteAdapter) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := a.db.WithContext(ctx).First(&key, "prefix = ?", prefix).Error; err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// ListAPIKeys retrieves all API keys, oldest first
+func (a *SQLiteAdapter) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	err := inTenant(ctx, a.db, "api_keys").Order("created_at ASC, id ASC").Find(&keys).Error
+	return keys, err
+}
+
+// RevokeAPIKey revokes an API key
+func (a *SQLiteAdapter) RevokeAPIKey(ctx context.Context, id string) error {
+	var key models.APIKey
+	if err := inTenant(ctx, a.db, "api_keys").First(&key, "id = ?", id).Error; err != nil {
+		return err
+	}
+	if key.Revoked() {
+		return nil
+	}
+	return inTenant(ctx, a.db, "api_keys").Model(&models.APIKey{}).Where("id = ?", id).Update("revoked_at", time.Now()).Error
+}
+
+// EnqueueEvent writes a hook event to the outbox
+func (a *SQLiteAdapter) EnqueueEvent(ctx context.Context, event *models.OutboxEvent) error {
+	return enqueueEvent(ctx, a.db, event)
+}
+
+// ClaimEvents leases the hook events that are due for delivery
+func (a *SQLiteAdapter) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error) {
+	return claimEvents(ctx, a.db, limit, lease)
+}
+
+// CompleteEvent marks a hook event delivered
+func (a *SQLiteAdapter) CompleteEvent(ctx context.Context, id string) error {
+	return completeEvent(ctx, a.db, id)
+}
+
+// ReleaseEvent makes a claimed hook event due now
+func (a *SQLiteAdapter) ReleaseEvent(ctx context.Context, id string) error {
+	return releaseEvent(ctx, a.db, id)
+}
+
+// FailEvent records why delivering a hook event failed, and when to retry it
+func (a *SQLiteAdapter) FailEvent(ctx context.Context, id, lastError string, retryAt time.Time) error {
+	return failEvent(ctx, a.db, id, lastError, retryAt)
+}
+
+// DeadLetterEvent records why delivering a hook event failed for the last time
+func (a *SQLiteAdapter) DeadLetterEvent(ctx context.Context, id, lastError string) error {
+	return deadLetterEvent(ctx, a.db, id, lastError)
+}
+
+// DeleteDeliveredEvents deletes the hook events delivered before a time
+func (a *SQLiteAdapter) DeleteDeliveredEvents(ctx context.Context, before time.Time) (int64, error) {
+	return deleteDeliveredEvents(ctx, a.db, before)
+}
+
+// DeleteDeadLetteredEvents deletes the hook events dead-lettered before a time
+func (a *SQLiteAdapter) DeleteDeadLetteredEvents(ctx context.Context, before time.Time) (int64, error) {
+	return deleteDeadLetteredEvents(ctx, a.db, before)
+}
+
+// GetEvent retrieves a hook event by ID
+func (a *SQLiteAdapter) GetEvent(ctx context.Context, id string) (*models.OutboxEvent, error) {
+	return getEvent(ctx, a.db, id)
+}
+
+// ListEvents retrieves the hook events created in a time range, oldest first
+func (a *SQLiteAdapter) ListEvents(ctx context.Context, since, until time.Time, limit int) ([]*models.OutboxEvent, error) {
+	return listEvents(ctx, a.db, since, until, limit)
+}
+
+// ListDeadLetteredEvents retrieves the dead-lettered hook events, newest first
+func (a *SQLiteAdapter) ListDeadLetteredEvents(ctx context.Context, p Pagination) ([]*models.OutboxEvent, error) {
+	return listDeadLetteredEvents(ctx, a.db, p)
+}
+
+// ReplayEvent makes a dead-lettered hook event due for delivery again
+func (a *SQLiteAdapter) ReplayEvent(ctx context.Context, id string) (*models.OutboxEvent, error) {
+	return replayEvent(ctx, a.db, id)
+}
+
+// CreateWebhookSubscription creates a webhook subscription
+func (a *SQLiteAdapter) CreateWebhookSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	return createWebhookSubscription(ctx, a.db, subscription)
+}
+
+// GetWebhookSubscription retrieves a webhook subscription by ID
+func (a *SQLiteAdapter) GetWebhookSubscription(ctx context.Context, id string) (*models.WebhookSubscription, error) {
+	return getWebhookSubscription(ctx, a.db, id)
+}
+
+// ListWebhookSubscriptions retrieves all webhook subscriptions, oldest first
+func (a *SQLiteAdapter) ListWebhookSubscriptions(ctx context.Context) ([]*models.WebhookSubscription, error) {
+	return listWebhookSubscriptions(ctx, a.db)
+}
+
+// UpdateWebhookSubscription updates a webhook subscription, except its delivery stats
+func (a *SQLiteAdapter) UpdateWebhookSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	return updateInTenant(ctx, a.db, "webhook_subscriptions", subscription)
+}
+
+// DeleteWebhookSubscription deletes a webhook subscription
+func (a *SQLiteAdapter) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	return deleteWebhookSubscription(ctx, a.db, id)
+}
+
+// RecordWebhookDelivery stores a delivery to a webhook, counting it in the
+// stats of its subscription
+func (a *SQLiteAdapter) RecordWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return recordWebhookDelivery(ctx, a.db, delivery)
+}
+
+// ListWebhookDeliveries retrieves the webhook deliveries matching a query, newest first
+func (a *SQLiteAdapter) ListWebhookDeliveries(ctx context.Context, q DeliveryQuery, p Pagination) ([]*models.WebhookDelivery, error) {
+	return listWebhookDeliveries(ctx, a.db, q, p)
+}
+
+// DeleteWebhookDeliveries deletes the webhook deliveries made before a time
+func (a *SQLiteAdapter) DeleteWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	return deleteWebhookDeliveries(ctx, a.db, before)
 }
@@ -0,0 +1,71 @@
+//go:build sqlite_fts5
+
+package adapters
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sonet/internal/models"
+)
+
+// Test that builds with FTS5 search the full-text index
+func TestSQLiteFullTextSearch(t *testing.T) {
+	viper.Set("DB_CONNECTION_STRING", filepath.Join(t.TempDir(), "sonet.db"))
+	a, err := newSQLiteAdapter()
+	require.NoError(t, err)
+	defer a.Close()
+	require.True(t, a.fts)
+
+	ctx := context.Background()
+	newPost := func(content string) *models.Post {
+		post := &models.Post{UserID: "user-1", Content: content}
+		require.NoError(t, a.CreatePost(ctx, post))
+		return post
+	}
+
+	sparse := newPost("golang is one of many languages we use at work every day")
+	dense := newPost("golang golang golang")
+	cafe := newPost("Meet me at the Café ÜBER")
+
+	// Best matches come first
+	posts, err := a.SearchPosts(ctx, SearchQuery{Text: "golang", Sort: SortRelevance}, Pagination{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, posts, 2)
+	assert.Equal(t, dense.ID, posts[0].ID)
+	assert.Equal(t, sparse.ID, posts[1].ID)
+
+	// Case and diacritics are folded beyond ASCII
+	posts, err = a.SearchPosts(ctx, SearchQuery{Text: "cafe über"}, Pagination{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, cafe.ID, posts[0].ID)
+
+	// Snippets highlight the words as the index matched them
+	assert.Equal(t, "Meet me at the <mark>Café</mark> <mark>ÜBER</mark>", posts[0].Snippet)
+
+	// and HTML-escape the rest
+	newPost("<b>kiwi</b> & lime")
+	posts, err = a.SearchPosts(ctx, SearchQuery{Text: "kiwi"}, Pagination{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, "&lt;b&gt;<mark>kiwi</mark>&lt;/b&gt; &amp; lime", posts[0].Snippet)
+
+	// Updates and deletes keep the index in sync
+	dense.Content = "rust rust rust"
+	require.NoError(t, a.UpdatePost(ctx, dense))
+	require.NoError(t, a.DeletePost(ctx, sparse.ID))
+
+	count, err := a.CountSearchPosts(ctx, SearchQuery{Text: "golang"})
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	count, err = a.CountSearchPosts(ctx, SearchQuery{Text: "rust"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
@@ -0,0 +1,24 @@
+package adapters_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+
+	"sonet/internal/adapters"
+	"sonet/internal/adapters/adaptertest"
+)
+
+func TestSQLiteAdapterConformance(t *testing.T) {
+	adaptertest.Run(t, func(t *testing.T) adapters.DatabaseAdapter {
+		viper.Set("DB_ADAPTER", "sqlite")
+		viper.Set("DB_CONNECTION_STRING", filepath.Join(t.TempDir(), "sonet.db"))
+
+		db, err := adapters.NewDatabaseAdapter()
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+		return db
+	})
+}
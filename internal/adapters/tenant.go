@@ -0,0 +1,51 @@
+package adapters
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// DefaultTenant is the tenant of requests that name none, and of the records
+// created before tenants were introduced
+const DefaultTenant = ""
+
+// tenantKey is the context key of the tenant ID
+type tenantKey struct{}
+
+// WithTenant returns a context in which adapters only read and write the
+// records of a tenant. Every adapter method scopes its queries to the tenant
+// of its context, and stamps the records it creates with it.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant ID of a context, or DefaultTenant
+func TenantFromContext(ctx context.Context) string {
+	tenantID, _ := ctx.Value(tenantKey{}).(string)
+	return tenantID
+}
+
+// inTenant starts a query restricted to the records of a table that belong to
+// the tenant of the context
+func inTenant(ctx context.Context, db *gorm.DB, table string) *gorm.DB {
+	return db.WithContext(ctx).Where(table+".tenant_id = ?", TenantFromContext(ctx))
+}
+
+// visibleInTenant starts a query restricted to the posts or comments of the
+// tenant of the context that moderators have not hidden. Hidden records are
+// left out of lists, counts and searches, but can still be fetched by ID.
+func visibleInTenant(ctx context.Context, db *gorm.DB, table string) *gorm.DB {
+	return inTenant(ctx, db, table).Where(table + ".hidden_at IS NULL")
+}
+
+// updateInTenant saves all fields of a record of a table that belongs to the
+// tenant of the context. Unlike Save, it never creates the record: it fails
+// with gorm.ErrRecordNotFound if the tenant has no record with its ID.
+func updateInTenant(ctx context.Context, db *gorm.DB, table string, record interface{}) error {
+	result := inTenant(ctx, db, table).Select("*").Updates(record)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
@@ -0,0 +1,111 @@
+package adapters
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"sonet/internal/models"
+)
+
+// createWebhookSubscription creates a webhook subscription in the tenant of the context
+func createWebhookSubscription(ctx context.Context, db *gorm.DB, subscription *models.WebhookSubscription) error {
+	subscription.TenantID = TenantFromContext(ctx)
+	return db.WithContext(ctx).Create(subscription).Error
+}
+
+// getWebhookSubscription retrieves a webhook subscription of the tenant of the context
+func getWebhookSubscription(ctx context.Context, db *gorm.DB, id string) (*models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+	if err := inTenant(ctx, db, "webhook_subscriptions").First(&subscription, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+// listWebhookSubscriptions lists the webhook subscriptions of the tenant of
+// the context, oldest first
+func listWebhookSubscriptions(ctx context.Context, db *gorm.DB) ([]*models.WebhookSubscription, error) {
+	var subscriptions []*models.WebhookSubscription
+	err := inTenant(ctx, db, "webhook_subscriptions").Order("created_at ASC, id ASC").Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+// deleteWebhookSubscription deletes a webhook subscription of the tenant of the context
+func deleteWebhookSubscription(ctx context.Context, db *gorm.DB, id string) error {
+	result := inTenant(ctx, db, "webhook_subscriptions").Delete(&models.WebhookSubscription{}, "id = ?", id)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// DeliveryQuery selects the webhook deliveries matching all of its criteria.
+// Criteria left at their zero value match every delivery.
+type DeliveryQuery struct {
+	SubscriptionID string
+	EventID        string
+	Failed         *bool // Failed or successful attempts
+}
+
+// recordWebhookDelivery stores an attempt to deliver an event in the tenant
+// of the context and, for a webhook subscription, counts it in the
+// subscription's stats
+func recordWebhookDelivery(ctx context.Context, db *gorm.DB, delivery *models.WebhookDelivery) error {
+	delivery.TenantID = TenantFromContext(ctx)
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(delivery).Error; err != nil {
+			return err
+		}
+		if delivery.SubscriptionID == "" {
+			return nil
+		}
+
+		stats := map[string]interface{}{
+			"delivered_count":   gorm.Expr("delivered_count + 1"),
+			"last_delivered_at": delivery.CreatedAt,
+		}
+		if delivery.Error != "" {
+			stats = map[string]interface{}{
+				"failed_count":   gorm.Expr("failed_count + 1"),
+				"last_failed_at": delivery.CreatedAt,
+				"last_error":     delivery.Error,
+			}
+		}
+
+		// The stats are read-only in the model, so update the table directly
+		return inTenant(ctx, tx, "webhook_subscriptions").Table("webhook_subscriptions").
+			Where("id = ?", delivery.SubscriptionID).UpdateColumns(stats).Error
+	})
+}
+
+// listWebhookDeliveries lists the webhook deliveries of the tenant of the
+// context matching a query, newest first
+func listWebhookDeliveries(ctx context.Context, db *gorm.DB, q DeliveryQuery, p Pagination) ([]*models.WebhookDelivery, error) {
+	query := inTenant(ctx, db, "webhook_deliveries")
+	if q.SubscriptionID != "" {
+		query = query.Where("subscription_id = ?", q.SubscriptionID)
+	}
+	if q.EventID != "" {
+		query = query.Where("event_id = ?", q.EventID)
+	}
+	if q.Failed != nil {
+		if *q.Failed {
+			query = query.Where("error <> ''")
+		} else {
+			query = query.Where("error = ''")
+		}
+	}
+
+	var deliveries []*models.WebhookDelivery
+	err := newestFirst(query, p).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// deleteWebhookDeliveries deletes the webhook deliveries of every tenant made
+// before a time
+func deleteWebhookDeliveries(ctx context.Context, db *gorm.DB, before time.Time) (int64, error) {
+	result := db.WithContext(ctx).Delete(&models.WebhookDelivery{}, "created_at < ?", before)
+	return result.RowsAffected, result.Error
+}
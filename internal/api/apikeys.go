@@ -0,0 +1,78 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"sonet/internal/adapters"
+	"sonet/internal/auth"
+	"sonet/internal/models"
+)
+
+// APIKeyInput is the request body for creating an API key
+type APIKeyInput struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	RateLimit int      `json:"rate_limit"`
+}
+
+// CreatedAPIKey is an API key along with the key itself, which is only
+// returned when it is created
+type CreatedAPIKey struct {
+	*models.APIKey
+	Key string `json:"key"`
+}
+
+// API key handlers. Keys are managed within the tenant of the admin key.
+func createAPIKey(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		input := new(APIKeyInput)
+		if err := c.BodyParser(input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+
+		input.Name = strings.TrimSpace(input.Name)
+		if input.Name == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Name is required")
+		}
+
+		key, apiKey, err := auth.NewAPIKey(input.Name, input.Scopes, input.RateLimit)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		if err := db.CreateAPIKey(c.UserContext(), apiKey); err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusCreated).JSON(CreatedAPIKey{APIKey: apiKey, Key: key})
+	}
+}
+
+func listAPIKeys(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		keys, err := db.ListAPIKeys(c.UserContext())
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(keys)
+	}
+}
+
+func revokeAPIKey(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		if id == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid API key ID")
+		}
+
+		if err := db.RevokeAPIKey(c.UserContext(), id); err != nil {
+			return err
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
@@ -1,9 +1,11 @@
 package api
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"net/url"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
@@ -14,6 +16,7 @@ import (
 	"gorm.io/gorm"
 
 	"sonet/internal/adapters"
+	"sonet/internal/auth"
 	"sonet/internal/hooks"
 	"sonet/internal/models"
 )
@@ -28,14 +31,15 @@ func ErrorHandler(c *fiber.Ctx, err error) error {
 	code := fiber.StatusInternalServerError
 
 	// Check for known error types
-	if errors.Is(err, gorm.ErrRecordNotFound) {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		code = fiberErr.Code
+	} else if errors.Is(err, gorm.ErrRecordNotFound) {
 		code = fiber.StatusNotFound
-	} else if errors.Is(err, fiber.ErrBadRequest) {
-		code = fiber.StatusBadRequest
-	} else if errors.Is(err, fiber.ErrUnauthorized) {
-		code = fiber.StatusUnauthorized
-	} else if errors.Is(err, fiber.ErrForbidden) {
-		code = fiber.StatusForbidden
+	} else if errors.Is(err, gorm.ErrDuplicatedKey) {
+		code = fiber.StatusConflict
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		code = fiber.StatusGatewayTimeout
 	}
 
 	return c.Status(code).JSON(ErrorResponse{
@@ -43,8 +47,9 @@ func ErrorHandler(c *fiber.Ctx, err error) error {
 	})
 }
 
-// SetupRoutes configures all API routes
-func SetupRoutes(app *fiber.App, db adapters.DatabaseAdapter) {
+// SetupRoutes configures all API routes, with the reaction rules loaded by
+// LoadReactionRules
+func SetupRoutes(app *fiber.App, db adapters.DatabaseAdapter, rules *ReactionRules) {
 	api := app.Group("/api")
 
 	// Health check
@@ -63,6 +68,8 @@ func SetupRoutes(app *fiber.App, db adapters.DatabaseAdapter) {
 	posts.Get("/:id", getPost(db))
 	posts.Put("/:id", updatePost(db))
 	posts.Delete("/:id", deletePost(db))
+	posts.Post("/:id/hide", setPostHidden(db, true))
+	posts.Post("/:id/unhide", setPostHidden(db, false))
 
 	// Comment routes
 	comments := api.Group("/comments")
@@ -71,26 +78,99 @@ func SetupRoutes(app *fiber.App, db adapters.DatabaseAdapter) {
 	comments.Get("/:id", getComment(db))
 	comments.Put("/:id", updateComment(db))
 	comments.Delete("/:id", deleteComment(db))
+	comments.Post("/:id/hide", setCommentHidden(db, true))
+	comments.Post("/:id/unhide", setCommentHidden(db, false))
 
 	// Reaction routes
 	reactions := api.Group("/reactions")
-	reactions.Post("/", createReaction(db))
+	reactions.Post("/", createReaction(db, rules))
+	reactions.Get("/types", listReactionTypes(db, rules))
 	reactions.Get("/:targetType/:targetId", listReactions(db))
+	reactions.Get("/:targetType/:targetId/summary", summarizeReactions(db))
 	reactions.Delete("/:id", deleteReaction(db))
+	reactions.Delete("/:targetType/:targetId/:type", removeReaction(db))
+	reactions.Put("/:targetType/:targetId/:type/toggle", toggleReaction(db, rules))
 
 	// Search routes
 	search := api.Group("/search")
 	search.Get("/posts", searchPosts(db))
+
+	// Moderation routes
+	moderation := api.Group("/moderation", withScope(auth.ScopeModeration))
+	moderation.Get("/actions", listModerationActions(db))
+
+	// Admin routes
+	admin := api.Group("/admin", withScope(auth.ScopeAdmin))
+	admin.Post("/api-keys", createAPIKey(db))
+	admin.Get("/api-keys", listAPIKeys(db))
+	admin.Delete("/api-keys/:id", revokeAPIKey(db))
+	admin.Post("/reaction-types", createReactionType(db, rules))
+	admin.Delete("/reaction-types/:name", deleteReactionType(db))
+	admin.Get("/hook-events/dead-lettered", listDeadLetteredEvents(db))
+	admin.Get("/hook-events/:id", getHookEvent(db))
+	admin.Post("/hook-events/:id/replay", replayHookEvent(db))
+	admin.Post("/webhooks", createWebhookSubscription(db))
+	admin.Get("/webhooks", listWebhookSubscriptions(db))
+	admin.Get("/webhooks/:id", getWebhookSubscription(db))
+	admin.Put("/webhooks/:id", updateWebhookSubscription(db))
+	admin.Delete("/webhooks/:id", deleteWebhookSubscription(db))
+	admin.Post("/webhooks/:id/rotate-secret", rotateWebhookSecret(db))
+	admin.Delete("/webhooks/:id/previous-secret", removePreviousWebhookSecret(db))
+	admin.Post("/webhooks/:id/resend", resendWebhookEvents(db))
+	admin.Get("/webhook-deliveries", listWebhookDeliveries(db))
 }
 
-// getUserID extracts the user ID from the request header
+// getUserID returns the ID of the authenticated user, or "" for anonymous requests
 func getUserID(c *fiber.Ctx) string {
-	return c.Get("X-User-ID")
+	return auth.UserID(c)
+}
+
+// requireScope returns the ID of the user or API key making the request. It
+// rejects anonymous requests, and API keys without a scope.
+func requireScope(c *fiber.Ctx, scope string) (string, error) {
+	userID := getUserID(c)
+	if userID == "" {
+		return "", fiber.ErrUnauthorized
+	}
+	if !auth.HasScope(c, scope) {
+		return "", fiber.NewError(fiber.StatusForbidden, "The "+scope+" scope is required")
+	}
+	return userID, nil
+}
+
+// withScope returns a middleware that rejects requests without a scope, see
+// requireScope
+func withScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, err := requireScope(c, scope); err != nil {
+			return err
+		}
+		return c.Next()
+	}
+}
+
+// isAuthor reports whether the request is made by the author of content, who
+// may change and delete it
+func isAuthor(c *fiber.Ctx, authorID string) bool {
+	return authorID == getUserID(c) && auth.HasScope(c, auth.ScopePostsWrite)
+}
+
+// canSee reports whether the request may see content: hidden content is only
+// shown to its author and to moderators
+func canSee(c *fiber.Ctx, hiddenAt *time.Time, authorID string) bool {
+	return hiddenAt == nil || authorID == getUserID(c) || auth.HasScope(c, auth.ScopeModeration)
 }
 
-// Common pagination logic
-func getPaginationParams(c *fiber.Ctx) (limit, offset int) {
-	limit, _ = strconv.Atoi(c.Query("limit", "20"))
+// getTenantID returns the ID of the tenant the request is made for
+func getTenantID(c *fiber.Ctx) string {
+	return adapters.TenantFromContext(c.UserContext())
+}
+
+// Common pagination logic. Clients page either with page/limit, which is
+// translated into an offset, or with the opaque cursor returned as next_cursor
+// in a previous response.
+func getPagination(c *fiber.Ctx) (adapters.Pagination, error) {
+	limit, _ := strconv.Atoi(c.Query("limit", "20"))
 	page, _ := strconv.Atoi(c.Query("page", "1"))
 
 	if limit <= 0 {
@@ -103,8 +183,104 @@ func getPaginationParams(c *fiber.Ctx) (limit, offset int) {
 		page = 1
 	}
 
-	offset = (page - 1) * limit
-	return
+	p := adapters.Pagination{Limit: limit, Offset: (page - 1) * limit}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		after, err := adapters.DecodeCursor(cursor)
+		if err != nil {
+			return p, fiber.NewError(fiber.StatusBadRequest, "Invalid cursor")
+		}
+		p.After = after
+		p.Offset = 0
+	}
+
+	return p, nil
+}
+
+// withLookahead asks for one item more than the page holds, so that the
+// handler can tell whether more results follow the page
+func withLookahead(p adapters.Pagination) adapters.Pagination {
+	p.Limit++
+	return p
+}
+
+// trimPage drops the lookahead item fetched with withLookahead and reports
+// whether there was one
+func trimPage[T any](items []T, limit int) ([]T, bool) {
+	if len(items) > limit {
+		return items[:limit], true
+	}
+	return items, false
+}
+
+// paginationMeta builds the pagination fields of a list response's meta block.
+// last is the cursor of the last item returned, if any.
+func paginationMeta(c *fiber.Ctx, p adapters.Pagination, count int, hasMore bool, last *adapters.Cursor) fiber.Map {
+	page, _ := strconv.Atoi(c.Query("page", "1"))
+
+	meta := fiber.Map{
+		"page":        page,
+		"limit":       p.Limit,
+		"offset":      p.Offset,
+		"count":       count,
+		"has_more":    hasMore,
+		"next_cursor": nil,
+	}
+
+	if hasMore && last != nil {
+		meta["next_cursor"] = last.Encode()
+	}
+
+	return meta
+}
+
+// addTotal adds the total number of results to meta when the client asks for
+// it with with_total=true. Counting costs an extra query, so it is opt-in.
+func addTotal(c *fiber.Ctx, meta fiber.Map, count func() (int64, error)) error {
+	if !c.QueryBool("with_total") {
+		return nil
+	}
+
+	total, err := count()
+	if err != nil {
+		return err
+	}
+	meta["total"] = total
+	return nil
+}
+
+// getSearchSort reads the order of text search results from the sort query
+// parameter. Relevance ordering is paged by offset only.
+func getSearchSort(c *fiber.Ctx, p adapters.Pagination) (adapters.SearchSort, error) {
+	switch order := adapters.SearchSort(c.Query("sort", string(adapters.SortRecent))); order {
+	case adapters.SortRecent:
+		return order, nil
+	case adapters.SortRelevance:
+		if p.After != nil {
+			return "", fiber.NewError(fiber.StatusBadRequest, "Cursor pagination is not supported for relevance-sorted search")
+		}
+		return order, nil
+	default:
+		return "", fiber.NewError(fiber.StatusBadRequest, "Invalid sort, expected recent or relevance")
+	}
+}
+
+// lastPostCursor returns the cursor of the last post in a page
+func lastPostCursor(posts []*models.Post) *adapters.Cursor {
+	if len(posts) == 0 {
+		return nil
+	}
+	last := posts[len(posts)-1]
+	return &adapters.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+}
+
+// lastCommentCursor returns the cursor of the last comment in a page
+func lastCommentCursor(comments []*models.Comment) *adapters.Cursor {
+	if len(comments) == 0 {
+		return nil
+	}
+	last := comments[len(comments)-1]
+	return &adapters.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
 }
 
 // Health check handler
@@ -117,7 +293,7 @@ func healthCheck(db adapters.DatabaseAdapter) fiber.Handler {
 
 		// Check database connectivity
 		checkStart := time.Now()
-		if _, err := db.ListPosts("", 1, 0); err != nil {
+		if _, err := db.ListPosts(c.UserContext(), "", adapters.Pagination{Limit: 1}); err != nil {
 			dbStatus = "error: " + err.Error()
 		} else {
 			dbStatus = "ok"
@@ -155,9 +331,9 @@ type PostWithAttachments struct {
 // Post handlers
 func createPost(db adapters.DatabaseAdapter) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		userID := getUserID(c)
-		if userID == "" {
-			return fiber.ErrUnauthorized
+		userID, err := requireScope(c, auth.ScopePostsWrite)
+		if err != nil {
+			return err
 		}
 
 		postInput := new(PostWithAttachments)
@@ -167,6 +343,13 @@ func createPost(db adapters.DatabaseAdapter) fiber.Handler {
 
 		post := &postInput.Post
 		post.UserID = userID
+		post.Snippet = ""
+		post.CommentCount = 0
+		post.ReactionCounts = map[string]int64{}
+
+		if !validLanguage(post.Language) {
+			return fiber.NewError(fiber.StatusBadRequest, "Language must be a language tag such as en or pt-BR")
+		}
 
 		// Validate location fields if provided
 		if post.Latitude != 0 || post.Longitude != 0 {
@@ -178,36 +361,50 @@ func createPost(db adapters.DatabaseAdapter) fiber.Handler {
 			}
 		}
 
-		if err := db.CreatePost(post); err != nil {
-			return err
-		}
-
-		// Create attachments if any
-		for _, attachmentData := range postInput.AttachmentsData {
-			postID := post.ID
-			attachment := &models.Attachment{
-				URL:      attachmentData.URL,
-				Type:     attachmentData.Type,
-				PostID:   &postID,
-				Metadata: models.JSON{},
+		err = db.Transaction(c.UserContext(), func(tx adapters.DatabaseAdapter) error {
+			if err := tx.CreatePost(c.UserContext(), post); err != nil {
+				return err
 			}
 
-			// Validate attachment
-			if err := attachment.Validate(); err != nil {
-				return fiber.NewError(fiber.StatusBadRequest, err.Error())
-			}
+			// Create attachments if any
+			for _, attachmentData := range postInput.AttachmentsData {
+				postID := post.ID
+				attachment := &models.Attachment{
+					URL:      attachmentData.URL,
+					Type:     attachmentData.Type,
+					PostID:   &postID,
+					Metadata: models.JSON{},
+				}
 
-			if err := db.CreateAttachment(attachment); err != nil {
-				return err
+				// Validate attachment
+				if err := attachment.Validate(); err != nil {
+					return fiber.NewError(fiber.StatusBadRequest, err.Error())
+				}
+
+				if err := tx.CreateAttachment(c.UserContext(), attachment); err != nil {
+					return err
+				}
+				post.Attachments = append(post.Attachments, *attachment)
 			}
-			post.Attachments = append(post.Attachments, *attachment)
+
+			return hooks.TriggerPostCreated(c.UserContext(), tx, getTenantID(c), userID, post)
+		})
+		if err != nil {
+			return err
 		}
 
-		hooks.TriggerPostCreated(userID, post)
 		return c.Status(http.StatusCreated).JSON(post)
 	}
 }
 
+// languageTag matches BCP 47 style language tags such as en, pt-BR or zh-Hant-TW
+var languageTag = regexp.MustCompile(`^[A-Za-z]{2,8}(-[A-Za-z0-9]{1,8})*$`)
+
+// validLanguage reports whether a post language is empty or a language tag
+func validLanguage(language string) bool {
+	return language == "" || len(language) <= 35 && languageTag.MatchString(language)
+}
+
 func getPost(db adapters.DatabaseAdapter) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id := c.Params("id")
@@ -215,10 +412,16 @@ func getPost(db adapters.DatabaseAdapter) fiber.Handler {
 			return fiber.NewError(fiber.StatusBadRequest, "Invalid post ID")
 		}
 
-		post, err := db.GetPostByID(id)
+		post, err := db.GetPostByID(c.UserContext(), id)
 		if err != nil {
 			return err
 		}
+		if !canSee(c, post.HiddenAt, post.UserID) {
+			return gorm.ErrRecordNotFound
+		}
+		if err := addPostReactions(c, db, []*models.Post{post}); err != nil {
+			return err
+		}
 
 		return c.JSON(post)
 	}
@@ -226,24 +429,33 @@ func getPost(db adapters.DatabaseAdapter) fiber.Handler {
 
 func listPosts(db adapters.DatabaseAdapter) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		limit, offset := getPaginationParams(c)
+		p, err := getPagination(c)
+		if err != nil {
+			return err
+		}
 		userID := c.Query("user_id", "") // Filter by user ID if provided
-		page, _ := strconv.Atoi(c.Query("page", "1"))
 
-		posts, err := db.ListPosts(userID, limit, offset)
+		posts, err := db.ListPosts(c.UserContext(), userID, withLookahead(p))
 		if err != nil {
 			return err
 		}
+		posts, hasMore := trimPage(posts, p.Limit)
+		if err := addPostReactions(c, db, posts); err != nil {
+			return err
+		}
 
 		// Return with pagination metadata
+		meta := paginationMeta(c, p, len(posts), hasMore, lastPostCursor(posts))
+		err = addTotal(c, meta, func() (int64, error) {
+			return db.CountPosts(c.UserContext(), userID)
+		})
+		if err != nil {
+			return err
+		}
+
 		return c.JSON(fiber.Map{
 			"data": posts,
-			"meta": fiber.Map{
-				"page":   page,
-				"limit":  limit,
-				"offset": offset,
-				"count":  len(posts),
-			},
+			"meta": meta,
 		})
 	}
 }
@@ -255,12 +467,12 @@ func updatePost(db adapters.DatabaseAdapter) fiber.Handler {
 			return fiber.NewError(fiber.StatusBadRequest, "Invalid post ID")
 		}
 
-		userID := getUserID(c)
-		if userID == "" {
-			return fiber.ErrUnauthorized
+		userID, err := requireScope(c, auth.ScopePostsWrite)
+		if err != nil {
+			return err
 		}
 
-		post, err := db.GetPostByID(id)
+		post, err := db.GetPostByID(c.UserContext(), id)
 		if err != nil {
 			return err
 		}
@@ -277,8 +489,13 @@ func updatePost(db adapters.DatabaseAdapter) fiber.Handler {
 		updatedPost := &postInput.Post
 
 		post.Content = updatedPost.Content
+		post.Language = updatedPost.Language
 		post.Metadata = updatedPost.Metadata
 
+		if !validLanguage(post.Language) {
+			return fiber.NewError(fiber.StatusBadRequest, "Language must be a language tag such as en or pt-BR")
+		}
+
 		// Update location fields
 		post.City = updatedPost.City
 		post.Latitude = updatedPost.Latitude
@@ -294,43 +511,49 @@ func updatePost(db adapters.DatabaseAdapter) fiber.Handler {
 			}
 		}
 
-		if err := db.UpdatePost(post); err != nil {
-			return err
-		}
-
-		// If new attachments are provided, replace existing ones
-		if len(postInput.AttachmentsData) > 0 {
-			// Delete existing attachments
-			for _, attachment := range post.Attachments {
-				if err := db.DeleteAttachment(attachment.ID); err != nil {
-					return err
-				}
+		err = db.Transaction(c.UserContext(), func(tx adapters.DatabaseAdapter) error {
+			if err := tx.UpdatePost(c.UserContext(), post); err != nil {
+				return err
 			}
 
-			// Add new attachments
-			post.Attachments = nil
-			for _, attachmentData := range postInput.AttachmentsData {
-				postID := post.ID
-				attachment := &models.Attachment{
-					URL:      attachmentData.URL,
-					Type:     attachmentData.Type,
-					PostID:   &postID,
-					Metadata: models.JSON{},
+			// If new attachments are provided, replace existing ones
+			if len(postInput.AttachmentsData) > 0 {
+				// Delete existing attachments
+				for _, attachment := range post.Attachments {
+					if err := tx.DeleteAttachment(c.UserContext(), attachment.ID); err != nil {
+						return err
+					}
 				}
 
-				// Validate attachment
-				if err := attachment.Validate(); err != nil {
-					return fiber.NewError(fiber.StatusBadRequest, err.Error())
-				}
+				// Add new attachments
+				post.Attachments = nil
+				for _, attachmentData := range postInput.AttachmentsData {
+					postID := post.ID
+					attachment := &models.Attachment{
+						URL:      attachmentData.URL,
+						Type:     attachmentData.Type,
+						PostID:   &postID,
+						Metadata: models.JSON{},
+					}
 
-				if err := db.CreateAttachment(attachment); err != nil {
-					return err
+					// Validate attachment
+					if err := attachment.Validate(); err != nil {
+						return fiber.NewError(fiber.StatusBadRequest, err.Error())
+					}
+
+					if err := tx.CreateAttachment(c.UserContext(), attachment); err != nil {
+						return err
+					}
+					post.Attachments = append(post.Attachments, *attachment)
 				}
-				post.Attachments = append(post.Attachments, *attachment)
 			}
+
+			return hooks.TriggerPostUpdated(c.UserContext(), tx, getTenantID(c), userID, post)
+		})
+		if err != nil {
+			return err
 		}
 
-		hooks.TriggerPostUpdated(userID, post)
 		return c.JSON(post)
 	}
 }
@@ -347,20 +570,34 @@ func deletePost(db adapters.DatabaseAdapter) fiber.Handler {
 			return fiber.ErrUnauthorized
 		}
 
-		post, err := db.GetPostByID(id)
+		post, err := db.GetPostByID(c.UserContext(), id)
 		if err != nil {
 			return err
 		}
 
-		if post.UserID != userID {
-			return fiber.ErrForbidden
+		// Moderators may delete other users' posts, giving a reason
+		var moderation *models.ModerationAction
+		if !isAuthor(c, post.UserID) {
+			moderation, err = newModeration(c, models.ModerationDelete, "post", post.ID, post.UserID)
+			if err != nil {
+				return err
+			}
 		}
 
-		if err := db.DeletePost(id); err != nil {
+		err = db.Transaction(c.UserContext(), func(tx adapters.DatabaseAdapter) error {
+			if err := tx.DeletePost(c.UserContext(), id); err != nil {
+				return err
+			}
+
+			if moderation != nil {
+				return recordModeration(c, tx, moderation)
+			}
+			return hooks.TriggerPostDeleted(c.UserContext(), tx, getTenantID(c), userID, id)
+		})
+		if err != nil {
 			return err
 		}
 
-		hooks.TriggerPostDeleted(userID, id)
 		return c.SendStatus(http.StatusNoContent)
 	}
 }
@@ -378,9 +615,9 @@ type CommentWithAttachment struct {
 // Comment handlers
 func createComment(db adapters.DatabaseAdapter) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		userID := getUserID(c)
-		if userID == "" {
-			return fiber.ErrUnauthorized
+		userID, err := requireScope(c, auth.ScopePostsWrite)
+		if err != nil {
+			return err
 		}
 
 		commentInput := new(CommentWithAttachment)
@@ -395,46 +632,53 @@ func createComment(db adapters.DatabaseAdapter) fiber.Handler {
 		}
 
 		// Verify the post exists
-		_, err := db.GetPostByID(comment.PostID)
-		if err != nil {
+		if _, err := db.GetPostByID(c.UserContext(), comment.PostID); err != nil {
 			return fiber.NewError(fiber.StatusBadRequest, "Invalid post ID")
 		}
 
 		// If this is a reply, verify parent comment exists
 		if comment.ParentID != nil {
-			_, err := db.GetCommentByID(*comment.ParentID)
+			_, err := db.GetCommentByID(c.UserContext(), *comment.ParentID)
 			if err != nil {
 				return fiber.NewError(fiber.StatusBadRequest, "Invalid parent comment ID")
 			}
 		}
 
 		comment.UserID = userID
-		if err := db.CreateComment(comment); err != nil {
-			return err
-		}
-
-		// Create attachment if provided
-		if commentInput.HasAttachment {
-			commentID := comment.ID
-			attachment := &models.Attachment{
-				URL:       commentInput.AttachmentData.URL,
-				Type:      commentInput.AttachmentData.Type,
-				CommentID: &commentID,
-				Metadata:  models.JSON{},
+		comment.ReplyCount = 0
+		comment.ReactionCounts = map[string]int64{}
+		err = db.Transaction(c.UserContext(), func(tx adapters.DatabaseAdapter) error {
+			if err := tx.CreateComment(c.UserContext(), comment); err != nil {
+				return err
 			}
 
-			// Validate attachment
-			if err := attachment.Validate(); err != nil {
-				return fiber.NewError(fiber.StatusBadRequest, err.Error())
-			}
+			// Create attachment if provided
+			if commentInput.HasAttachment {
+				commentID := comment.ID
+				attachment := &models.Attachment{
+					URL:       commentInput.AttachmentData.URL,
+					Type:      commentInput.AttachmentData.Type,
+					CommentID: &commentID,
+					Metadata:  models.JSON{},
+				}
 
-			if err := db.CreateAttachment(attachment); err != nil {
-				return err
+				// Validate attachment
+				if err := attachment.Validate(); err != nil {
+					return fiber.NewError(fiber.StatusBadRequest, err.Error())
+				}
+
+				if err := tx.CreateAttachment(c.UserContext(), attachment); err != nil {
+					return err
+				}
+				comment.Attachment = attachment
 			}
-			comment.Attachment = attachment
+
+			return hooks.TriggerCommentCreated(c.UserContext(), tx, getTenantID(c), userID, comment)
+		})
+		if err != nil {
+			return err
 		}
 
-		hooks.TriggerCommentCreated(userID, comment)
 		return c.Status(http.StatusCreated).JSON(comment)
 	}
 }
@@ -446,10 +690,16 @@ func getComment(db adapters.DatabaseAdapter) fiber.Handler {
 			return fiber.NewError(fiber.StatusBadRequest, "Invalid comment ID")
 		}
 
-		comment, err := db.GetCommentByID(id)
+		comment, err := db.GetCommentByID(c.UserContext(), id)
 		if err != nil {
 			return err
 		}
+		if !canSee(c, comment.HiddenAt, comment.UserID) {
+			return gorm.ErrRecordNotFound
+		}
+		if err := addCommentReactions(c, db, []*models.Comment{comment}); err != nil {
+			return err
+		}
 
 		return c.JSON(comment)
 	}
@@ -462,24 +712,33 @@ func listComments(db adapters.DatabaseAdapter) fiber.Handler {
 			return fiber.NewError(fiber.StatusBadRequest, "Invalid post ID")
 		}
 
-		limit, offset := getPaginationParams(c)
-		page, _ := strconv.Atoi(c.Query("page", "1"))
+		p, err := getPagination(c)
+		if err != nil {
+			return err
+		}
 
-		comments, err := db.ListComments(postID, limit, offset)
+		comments, err := db.ListComments(c.UserContext(), postID, withLookahead(p))
 		if err != nil {
 			return err
 		}
+		comments, hasMore := trimPage(comments, p.Limit)
+		if err := addCommentReactions(c, db, comments); err != nil {
+			return err
+		}
 
 		// Return with pagination metadata
+		meta := paginationMeta(c, p, len(comments), hasMore, lastCommentCursor(comments))
+		meta["post_id"] = postID
+		err = addTotal(c, meta, func() (int64, error) {
+			return db.CountComments(c.UserContext(), postID)
+		})
+		if err != nil {
+			return err
+		}
+
 		return c.JSON(fiber.Map{
 			"data": comments,
-			"meta": fiber.Map{
-				"page":    page,
-				"limit":   limit,
-				"offset":  offset,
-				"count":   len(comments),
-				"post_id": postID,
-			},
+			"meta": meta,
 		})
 	}
 }
@@ -491,12 +750,12 @@ func updateComment(db adapters.DatabaseAdapter) fiber.Handler {
 			return fiber.NewError(fiber.StatusBadRequest, "Invalid comment ID")
 		}
 
-		userID := getUserID(c)
-		if userID == "" {
-			return fiber.ErrUnauthorized
+		userID, err := requireScope(c, auth.ScopePostsWrite)
+		if err != nil {
+			return err
 		}
 
-		comment, err := db.GetCommentByID(id)
+		comment, err := db.GetCommentByID(c.UserContext(), id)
 		if err != nil {
 			return err
 		}
@@ -515,46 +774,52 @@ func updateComment(db adapters.DatabaseAdapter) fiber.Handler {
 		comment.Content = updatedComment.Content
 		comment.Metadata = updatedComment.Metadata
 
-		if err := db.UpdateComment(comment); err != nil {
-			return err
-		}
+		err = db.Transaction(c.UserContext(), func(tx adapters.DatabaseAdapter) error {
+			if err := tx.UpdateComment(c.UserContext(), comment); err != nil {
+				return err
+			}
 
-		// Handle attachment update
-		if commentInput.HasAttachment {
-			// Delete existing attachment if any
-			if comment.Attachment != nil {
-				if err := db.DeleteAttachment(comment.Attachment.ID); err != nil {
-					return err
+			// Handle attachment update
+			if commentInput.HasAttachment {
+				// Delete existing attachment if any
+				if comment.Attachment != nil {
+					if err := tx.DeleteAttachment(c.UserContext(), comment.Attachment.ID); err != nil {
+						return err
+					}
 				}
-			}
 
-			// Add new attachment
-			commentID := comment.ID
-			attachment := &models.Attachment{
-				URL:       commentInput.AttachmentData.URL,
-				Type:      commentInput.AttachmentData.Type,
-				CommentID: &commentID,
-				Metadata:  models.JSON{},
-			}
+				// Add new attachment
+				commentID := comment.ID
+				attachment := &models.Attachment{
+					URL:       commentInput.AttachmentData.URL,
+					Type:      commentInput.AttachmentData.Type,
+					CommentID: &commentID,
+					Metadata:  models.JSON{},
+				}
 
-			// Validate attachment
-			if err := attachment.Validate(); err != nil {
-				return fiber.NewError(fiber.StatusBadRequest, err.Error())
-			}
+				// Validate attachment
+				if err := attachment.Validate(); err != nil {
+					return fiber.NewError(fiber.StatusBadRequest, err.Error())
+				}
 
-			if err := db.CreateAttachment(attachment); err != nil {
-				return err
-			}
-			comment.Attachment = attachment
-		} else if comment.Attachment != nil {
-			// Remove attachment if HasAttachment is false but there was an attachment
-			if err := db.DeleteAttachment(comment.Attachment.ID); err != nil {
-				return err
+				if err := tx.CreateAttachment(c.UserContext(), attachment); err != nil {
+					return err
+				}
+				comment.Attachment = attachment
+			} else if comment.Attachment != nil {
+				// Remove attachment if HasAttachment is false but there was an attachment
+				if err := tx.DeleteAttachment(c.UserContext(), comment.Attachment.ID); err != nil {
+					return err
+				}
+				comment.Attachment = nil
 			}
-			comment.Attachment = nil
+
+			return hooks.TriggerCommentUpdated(c.UserContext(), tx, getTenantID(c), userID, comment)
+		})
+		if err != nil {
+			return err
 		}
 
-		hooks.TriggerCommentUpdated(userID, comment)
 		return c.JSON(comment)
 	}
 }
@@ -571,30 +836,44 @@ func deleteComment(db adapters.DatabaseAdapter) fiber.Handler {
 			return fiber.ErrUnauthorized
 		}
 
-		comment, err := db.GetCommentByID(id)
+		comment, err := db.GetCommentByID(c.UserContext(), id)
 		if err != nil {
 			return err
 		}
 
-		if comment.UserID != userID {
-			return fiber.ErrForbidden
+		// Moderators may delete other users' comments, giving a reason
+		var moderation *models.ModerationAction
+		if !isAuthor(c, comment.UserID) {
+			moderation, err = newModeration(c, models.ModerationDelete, "comment", comment.ID, comment.UserID)
+			if err != nil {
+				return err
+			}
 		}
 
-		if err := db.DeleteComment(id); err != nil {
+		err = db.Transaction(c.UserContext(), func(tx adapters.DatabaseAdapter) error {
+			if err := tx.DeleteComment(c.UserContext(), id); err != nil {
+				return err
+			}
+
+			if moderation != nil {
+				return recordModeration(c, tx, moderation)
+			}
+			return hooks.TriggerCommentDeleted(c.UserContext(), tx, getTenantID(c), userID, comment)
+		})
+		if err != nil {
 			return err
 		}
 
-		hooks.TriggerCommentDeleted(userID, id)
 		return c.SendStatus(http.StatusNoContent)
 	}
 }
 
 // Reaction handlers
-func createReaction(db adapters.DatabaseAdapter) fiber.Handler {
+func createReaction(db adapters.DatabaseAdapter, rules *ReactionRules) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		userID := getUserID(c)
-		if userID == "" {
-			return fiber.ErrUnauthorized
+		userID, err := requireScope(c, auth.ScopePostsWrite)
+		if err != nil {
+			return err
 		}
 
 		reaction := new(models.Reaction)
@@ -606,35 +885,130 @@ func createReaction(db adapters.DatabaseAdapter) fiber.Handler {
 			return fiber.NewError(fiber.StatusBadRequest, "Target ID, target type, and reaction type are required")
 		}
 
-		// Verify target exists
-		if reaction.TargetType == "post" {
-			_, err := db.GetPostByID(reaction.TargetID)
-			if err != nil {
-				return fiber.NewError(fiber.StatusBadRequest, "Invalid post ID")
+		if err := checkReactionTarget(c, db, reaction.TargetType, reaction.TargetID); err != nil {
+			return err
+		}
+		if err := rules.checkType(c, db, reaction.Type); err != nil {
+			return err
+		}
+
+		// An existing reaction is returned as is
+		reaction.UserID = userID
+		var created bool
+		err = db.Transaction(c.UserContext(), func(tx adapters.DatabaseAdapter) error {
+			created, err = rules.addReaction(c, tx, reaction)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if !created {
+			return c.Status(http.StatusOK).JSON(reaction)
+		}
+
+		return c.Status(http.StatusCreated).JSON(reaction)
+	}
+}
+
+// checkReactionTarget verifies that the target of a reaction exists
+func checkReactionTarget(c *fiber.Ctx, db adapters.DatabaseAdapter, targetType, targetID string) error {
+	switch targetType {
+	case "post":
+		if _, err := db.GetPostByID(c.UserContext(), targetID); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid post ID")
+		}
+	case "comment":
+		if _, err := db.GetCommentByID(c.UserContext(), targetID); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid comment ID")
+		}
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "Target type must be 'post' or 'comment'")
+	}
+	return nil
+}
+
+// reactionFromPath returns the caller's reaction named by the targetType,
+// targetId and type parameters
+func reactionFromPath(c *fiber.Ctx, userID string) *models.Reaction {
+	// Parameters are only valid until the request completes, so keep copies
+	return &models.Reaction{
+		UserID:     userID,
+		TargetID:   strings.Clone(c.Params("targetId")),
+		TargetType: strings.Clone(c.Params("targetType")),
+		Type:       strings.Clone(c.Params("type")),
+	}
+}
+
+// toggleReaction adds the caller's reaction to a target, or removes it if it
+// exists
+func toggleReaction(db adapters.DatabaseAdapter, rules *ReactionRules) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := requireScope(c, auth.ScopePostsWrite)
+		if err != nil {
+			return err
+		}
+
+		reaction := reactionFromPath(c, userID)
+		if err := checkReactionTarget(c, db, reaction.TargetType, reaction.TargetID); err != nil {
+			return err
+		}
+		if err := rules.checkType(c, db, reaction.Type); err != nil {
+			return err
+		}
+
+		var created bool
+		err = db.Transaction(c.UserContext(), func(tx adapters.DatabaseAdapter) error {
+			created, err = rules.addReaction(c, tx, reaction)
+			if err != nil || created {
+				return err
+			}
+
+			// A concurrent toggle may have removed it already, which leaves
+			// the same result
+			removed, err := tx.RemoveReaction(c.UserContext(), userID, reaction.TargetID, reaction.TargetType, reaction.Type)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
 			}
-		} else if reaction.TargetType == "comment" {
-			_, err := db.GetCommentByID(reaction.TargetID)
 			if err != nil {
-				return fiber.NewError(fiber.StatusBadRequest, "Invalid comment ID")
+				return err
 			}
-		} else {
-			return fiber.NewError(fiber.StatusBadRequest, "Target type must be 'post' or 'comment'")
+			return hooks.TriggerReactionRemoved(c.UserContext(), tx, getTenantID(c), userID, removed)
+		})
+		if err != nil {
+			return err
 		}
+		if created {
+			return c.Status(http.StatusCreated).JSON(reaction)
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
 
-		// Check if reaction already exists
-		existingReaction, err := db.GetReaction(userID, reaction.TargetID, reaction.TargetType, reaction.Type)
-		if err == nil && existingReaction != nil {
-			// Reaction already exists, return it
-			return c.Status(http.StatusOK).JSON(existingReaction)
+// removeReaction removes the caller's reaction to a target, if any
+func removeReaction(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := requireScope(c, auth.ScopePostsWrite)
+		if err != nil {
+			return err
 		}
 
-		reaction.UserID = userID
-		if err := db.CreateReaction(reaction); err != nil {
+		reaction := reactionFromPath(c, userID)
+		err = db.Transaction(c.UserContext(), func(tx adapters.DatabaseAdapter) error {
+			removed, err := tx.RemoveReaction(c.UserContext(), userID, reaction.TargetID, reaction.TargetType, reaction.Type)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return hooks.TriggerReactionRemoved(c.UserContext(), tx, getTenantID(c), userID, removed)
+		})
+		if err != nil {
 			return err
 		}
 
-		hooks.TriggerReactionAdded(userID, reaction)
-		return c.Status(http.StatusCreated).JSON(reaction)
+		return c.SendStatus(http.StatusNoContent)
 	}
 }
 
@@ -647,7 +1021,7 @@ func listReactions(db adapters.DatabaseAdapter) fiber.Handler {
 			return fiber.NewError(fiber.StatusBadRequest, "Target ID and type are required")
 		}
 
-		reactions, err := db.ListReactions(targetID, targetType)
+		reactions, err := db.ListReactions(c.UserContext(), targetID, targetType)
 		if err != nil {
 			return err
 		}
@@ -656,6 +1030,107 @@ func listReactions(db adapters.DatabaseAdapter) fiber.Handler {
 	}
 }
 
+// Limits of the number of recent reactors of each type in reaction summaries
+const (
+	defaultRecentReactors = 3
+	maxRecentReactors     = 20
+)
+
+// getReactionSummaries summarizes the reactions to targets for the request,
+// with as many recent reactors of each type as the reactors query parameter
+// asks for
+func getReactionSummaries(c *fiber.Ctx, db adapters.DatabaseAdapter, targetType string, targetIDs []string) (map[string]*models.ReactionSummary, error) {
+	recent, err := strconv.Atoi(c.Query("reactors", strconv.Itoa(defaultRecentReactors)))
+	if err != nil || recent < 0 || recent > maxRecentReactors {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Reactors must be between 0 and "+strconv.Itoa(maxRecentReactors))
+	}
+
+	return db.SummarizeReactions(c.UserContext(), targetType, targetIDs, getUserID(c), recent)
+}
+
+// includesReactions reports whether the include query parameter, a
+// comma-separated list, asks for reaction summaries
+func includesReactions(c *fiber.Ctx) (bool, error) {
+	include := c.Query("include")
+	if include == "" {
+		return false, nil
+	}
+
+	found := false
+	for _, name := range strings.Split(include, ",") {
+		switch strings.TrimSpace(name) {
+		case "reactions":
+			found = true
+		default:
+			return false, fiber.NewError(fiber.StatusBadRequest, "Include must be 'reactions'")
+		}
+	}
+	return found, nil
+}
+
+// addPostReactions sets the reaction summaries of posts if the request
+// includes them
+func addPostReactions(c *fiber.Ctx, db adapters.DatabaseAdapter, posts []*models.Post) error {
+	include, err := includesReactions(c)
+	if err != nil || !include || len(posts) == 0 {
+		return err
+	}
+
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+	summaries, err := getReactionSummaries(c, db, "post", ids)
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		post.Reactions = summaries[post.ID]
+	}
+	return nil
+}
+
+// addCommentReactions sets the reaction summaries of comments if the request
+// includes them
+func addCommentReactions(c *fiber.Ctx, db adapters.DatabaseAdapter, comments []*models.Comment) error {
+	include, err := includesReactions(c)
+	if err != nil || !include || len(comments) == 0 {
+		return err
+	}
+
+	ids := make([]string, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+	summaries, err := getReactionSummaries(c, db, "comment", ids)
+	if err != nil {
+		return err
+	}
+
+	for _, comment := range comments {
+		comment.Reactions = summaries[comment.ID]
+	}
+	return nil
+}
+
+func summarizeReactions(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		targetType := c.Params("targetType")
+		targetID := c.Params("targetId")
+		if targetType != "post" && targetType != "comment" {
+			return fiber.NewError(fiber.StatusBadRequest, "Target type must be 'post' or 'comment'")
+		}
+
+		summaries, err := getReactionSummaries(c, db, targetType, []string{targetID})
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(summaries[targetID])
+	}
+}
+
 func deleteReaction(db adapters.DatabaseAdapter) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id := c.Params("id")
@@ -668,11 +1143,34 @@ func deleteReaction(db adapters.DatabaseAdapter) fiber.Handler {
 			return fiber.ErrUnauthorized
 		}
 
-		if err := db.DeleteReaction(id); err != nil {
+		reaction, err := db.GetReactionByID(c.UserContext(), id)
+		if err != nil {
+			return err
+		}
+
+		// Moderators may remove other users' reactions, giving a reason
+		var moderation *models.ModerationAction
+		if !isAuthor(c, reaction.UserID) {
+			moderation, err = newModeration(c, models.ModerationDelete, "reaction", reaction.ID, reaction.UserID)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = db.Transaction(c.UserContext(), func(tx adapters.DatabaseAdapter) error {
+			if err := tx.DeleteReaction(c.UserContext(), reaction.ID); err != nil {
+				return err
+			}
+
+			if moderation != nil {
+				return recordModeration(c, tx, moderation)
+			}
+			return hooks.TriggerReactionRemoved(c.UserContext(), tx, getTenantID(c), userID, reaction)
+		})
+		if err != nil {
 			return err
 		}
 
-		hooks.TriggerReactionRemoved(userID, id)
 		return c.SendStatus(http.StatusNoContent)
 	}
 }
@@ -680,117 +1178,157 @@ func deleteReaction(db adapters.DatabaseAdapter) fiber.Handler {
 // Search for posts based on content
 func searchPosts(db adapters.DatabaseAdapter) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		query := c.Query("q")
-		city := c.Query("city")
-		latStr := c.Query("lat")
-		lngStr := c.Query("lng")
-		radiusStr := c.Query("radius")
+		p, err := getPagination(c)
+		if err != nil {
+			return err
+		}
 
-		// At least one search criteria must be provided
-		if query == "" && city == "" && (latStr == "" || lngStr == "") {
-			return fiber.NewError(fiber.StatusBadRequest, "At least one search criteria (query, city, or location) is required")
+		q, err := getSearchQuery(c, p)
+		if err != nil {
+			return err
 		}
 
-		limit, offset := getPaginationParams(c)
-		page, _ := strconv.Atoi(c.Query("page", "1"))
+		// All criteria are applied by the database, so pages are always full
+		posts, err := db.SearchPosts(c.UserContext(), q, withLookahead(p))
+		if err != nil {
+			return err
+		}
+		posts, hasMore := trimPage(posts, p.Limit)
+		if err := addPostReactions(c, db, posts); err != nil {
+			return err
+		}
 
-		// If location parameters are provided, use geospatial search
-		if latStr != "" && lngStr != "" {
-			lat, err := strconv.ParseFloat(latStr, 64)
-			if err != nil {
-				return fiber.NewError(fiber.StatusBadRequest, "Invalid latitude format")
-			}
+		// Cursors follow the newest-first order only
+		last := lastPostCursor(posts)
+		if q.Sort == adapters.SortRelevance {
+			last = nil
+		}
 
-			lng, err := strconv.ParseFloat(lngStr, 64)
-			if err != nil {
-				return fiber.NewError(fiber.StatusBadRequest, "Invalid longitude format")
-			}
+		meta := paginationMeta(c, p, len(posts), hasMore, last)
+		meta["query"] = q.Text
+		meta["sort"] = q.Sort
+		if q.City != "" {
+			meta["city"] = q.City
+		}
+		if q.Near != nil {
+			meta["lat"] = q.Near.Lat
+			meta["lng"] = q.Near.Lng
+			meta["radius"] = q.Near.RadiusKm
+		}
 
-			radius := 10.0 // Default radius in km
-			if radiusStr != "" {
-				radius, err = strconv.ParseFloat(radiusStr, 64)
-				if err != nil {
-					return fiber.NewError(fiber.StatusBadRequest, "Invalid radius format")
-				}
-			}
+		err = addTotal(c, meta, func() (int64, error) {
+			return db.CountSearchPosts(c.UserContext(), q)
+		})
+		if err != nil {
+			return err
+		}
 
-			posts, err := db.FindNearbyPosts(lat, lng, radius, limit, offset)
-			if err != nil {
-				return err
-			}
+		return c.JSON(fiber.Map{
+			"data": posts,
+			"meta": meta,
+		})
+	}
+}
 
-			// Filter by content query if provided
-			if query != "" {
-				filteredPosts := []*models.Post{}
-				for _, post := range posts {
-					if strings.Contains(strings.ToLower(post.Content), strings.ToLower(query)) {
-						filteredPosts = append(filteredPosts, post)
-					}
-				}
-				posts = filteredPosts
-			}
+// getSearchQuery reads the criteria of a post search from the query parameters
+func getSearchQuery(c *fiber.Ctx, p adapters.Pagination) (adapters.SearchQuery, error) {
+	q := adapters.SearchQuery{
+		Text:         c.Query("q"),
+		City:         c.Query("city"),
+		UserID:       c.Query("user_id"),
+		ReactionType: c.Query("reaction"),
+	}
 
-			return c.JSON(fiber.Map{
-				"data": posts,
-				"meta": fiber.Map{
-					"query":  query,
-					"lat":    lat,
-					"lng":    lng,
-					"radius": radius,
-					"page":   page,
-					"limit":  limit,
-					"offset": offset,
-					"count":  len(posts),
-				},
-			})
-		} else if city != "" {
-			// Search by city
-			posts, err := db.ListPostsByCity(city, limit, offset)
-			if err != nil {
-				return err
-			}
+	latStr, lngStr := c.Query("lat"), c.Query("lng")
+	if latStr != "" || lngStr != "" {
+		lat, err := strconv.ParseFloat(latStr, 64)
+		if err != nil || lat < -90 || lat > 90 {
+			return q, fiber.NewError(fiber.StatusBadRequest, "Latitude must be a number between -90 and 90")
+		}
 
-			// Filter by content query if provided
-			if query != "" {
-				filteredPosts := []*models.Post{}
-				for _, post := range posts {
-					if strings.Contains(strings.ToLower(post.Content), strings.ToLower(query)) {
-						filteredPosts = append(filteredPosts, post)
-					}
-				}
-				posts = filteredPosts
-			}
+		lng, err := strconv.ParseFloat(lngStr, 64)
+		if err != nil || lng < -180 || lng > 180 {
+			return q, fiber.NewError(fiber.StatusBadRequest, "Longitude must be a number between -180 and 180")
+		}
 
-			return c.JSON(fiber.Map{
-				"data": posts,
-				"meta": fiber.Map{
-					"query":  query,
-					"city":   city,
-					"page":   page,
-					"limit":  limit,
-					"offset": offset,
-					"count":  len(posts),
-				},
-			})
-		} else {
-			// Regular text search
-			posts, err := db.SearchPosts(query, limit, offset)
+		radius, err := strconv.ParseFloat(c.Query("radius", "10"), 64)
+		if err != nil || radius <= 0 {
+			return q, fiber.NewError(fiber.StatusBadRequest, "Radius must be a positive number")
+		}
+
+		q.Near = &adapters.GeoRadius{Lat: lat, Lng: lng, RadiusKm: radius}
+	}
+
+	if bbox := c.Query("bbox"); bbox != "" {
+		box, err := parseBoundingBox(bbox)
+		if err != nil {
+			return q, err
+		}
+		q.Within = box
+	}
+
+	for param, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		if value := c.Query(param); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
 			if err != nil {
-				return err
+				return q, fiber.NewError(fiber.StatusBadRequest, "Invalid "+param+", expected an RFC 3339 timestamp")
 			}
+			*t = parsed
+		}
+	}
+
+	if value := c.Query("has_attachments"); value != "" {
+		hasAttachments, err := strconv.ParseBool(value)
+		if err != nil {
+			return q, fiber.NewError(fiber.StatusBadRequest, "Invalid has_attachments, expected true or false")
+		}
+		q.HasAttachments = &hasAttachments
+	}
+
+	// At least one criterion must be provided
+	if q == (adapters.SearchQuery{}) {
+		return q, fiber.NewError(fiber.StatusBadRequest,
+			"At least one search criterion (q, city, lat/lng, bbox, user_id, since, until, has_attachments or reaction) is required")
+	}
+
+	order, err := getSearchSort(c, p)
+	if err != nil {
+		return q, err
+	}
+	if order == adapters.SortRelevance && strings.TrimSpace(q.Text) == "" {
+		return q, fiber.NewError(fiber.StatusBadRequest, "Relevance-sorted search requires q")
+	}
+	q.Sort = order
+
+	return q, nil
+}
+
+// parseBoundingBox parses a bbox query parameter: the minimum longitude,
+// minimum latitude, maximum longitude and maximum latitude, separated by
+// commas, as in GeoJSON
+func parseBoundingBox(bbox string) (*adapters.BoundingBox, error) {
+	invalid := fiber.NewError(fiber.StatusBadRequest, "Invalid bbox, expected min_lng,min_lat,max_lng,max_lat")
+
+	parts := strings.Split(bbox, ",")
+	if len(parts) != 4 {
+		return nil, invalid
+	}
 
-			return c.JSON(fiber.Map{
-				"data": posts,
-				"meta": fiber.Map{
-					"query":  query,
-					"page":   page,
-					"limit":  limit,
-					"offset": offset,
-					"count":  len(posts),
-				},
-			})
+	values := make([]float64, len(parts))
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, invalid
 		}
+		values[i] = value
+	}
+
+	box := &adapters.BoundingBox{MinLng: values[0], MinLat: values[1], MaxLng: values[2], MaxLat: values[3]}
+	if box.MinLat < -90 || box.MaxLat > 90 || box.MinLat > box.MaxLat ||
+		box.MinLng < -180 || box.MinLng > 180 || box.MaxLng < -180 || box.MaxLng > 180 {
+		return nil, invalid
 	}
+	return box, nil
 }
 
 // List posts by city
@@ -809,23 +1347,32 @@ func listPostsByCity(db adapters.DatabaseAdapter) fiber.Handler {
 			return fiber.NewError(fiber.StatusBadRequest, "Invalid city name format")
 		}
 
-		limit, offset := getPaginationParams(c)
-		page, _ := strconv.Atoi(c.Query("page", "1"))
+		p, err := getPagination(c)
+		if err != nil {
+			return err
+		}
+
+		posts, err := db.ListPostsByCity(c.UserContext(), cityName, withLookahead(p))
+		if err != nil {
+			return err
+		}
+		posts, hasMore := trimPage(posts, p.Limit)
+		if err := addPostReactions(c, db, posts); err != nil {
+			return err
+		}
 
-		posts, err := db.ListPostsByCity(cityName, limit, offset)
+		meta := paginationMeta(c, p, len(posts), hasMore, lastPostCursor(posts))
+		meta["city"] = cityName
+		err = addTotal(c, meta, func() (int64, error) {
+			return db.CountPostsByCity(c.UserContext(), cityName)
+		})
 		if err != nil {
 			return err
 		}
 
 		return c.JSON(fiber.Map{
 			"data": posts,
-			"meta": fiber.Map{
-				"city":   cityName,
-				"page":   page,
-				"limit":  limit,
-				"offset": offset,
-				"count":  len(posts),
-			},
+			"meta": meta,
 		})
 	}
 }
@@ -856,25 +1403,39 @@ func findNearbyPosts(db adapters.DatabaseAdapter) fiber.Handler {
 			return fiber.NewError(fiber.StatusBadRequest, "Invalid radius format")
 		}
 
-		limit, offset := getPaginationParams(c)
-		page, _ := strconv.Atoi(c.Query("page", "1"))
+		p, err := getPagination(c)
+		if err != nil {
+			return err
+		}
+
+		// Nearby posts are ordered by distance, which cursors cannot express
+		if p.After != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Cursor pagination is not supported for location queries")
+		}
+
+		posts, err := db.FindNearbyPosts(c.UserContext(), lat, lng, radius, p.Limit+1, p.Offset)
+		if err != nil {
+			return err
+		}
+		posts, hasMore := trimPage(posts, p.Limit)
+		if err := addPostReactions(c, db, posts); err != nil {
+			return err
+		}
 
-		posts, err := db.FindNearbyPosts(lat, lng, radius, limit, offset)
+		meta := paginationMeta(c, p, len(posts), hasMore, nil)
+		meta["lat"] = lat
+		meta["lng"] = lng
+		meta["radius"] = radius
+		err = addTotal(c, meta, func() (int64, error) {
+			return db.CountNearbyPosts(c.UserContext(), lat, lng, radius)
+		})
 		if err != nil {
 			return err
 		}
 
 		return c.JSON(fiber.Map{
 			"data": posts,
-			"meta": fiber.Map{
-				"lat":    lat,
-				"lng":    lng,
-				"radius": radius,
-				"page":   page,
-				"limit":  limit,
-				"offset": offset,
-				"count":  len(posts),
-			},
+			"meta": meta,
 		})
 	}
 }
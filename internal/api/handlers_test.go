@@ -1,19 +1,30 @@
 package api_test
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 
+	"sonet/internal/adapters"
 	"sonet/internal/api"
+	"sonet/internal/auth"
+	"sonet/internal/hooks"
 	"sonet/internal/models"
 )
 
@@ -22,82 +33,157 @@ type MockDatabaseAdapter struct {
 	mock.Mock
 }
 
-func (m *MockDatabaseAdapter) CreatePost(post *models.Post) error {
-	args := m.Called(post)
+func (m *MockDatabaseAdapter) CreatePost(ctx context.Context, post *models.Post) error {
+	args := m.Called(ctx, post)
 	return args.Error(0)
 }
 
-func (m *MockDatabaseAdapter) GetPostByID(id string) (*models.Post, error) {
-	args := m.Called(id)
+func (m *MockDatabaseAdapter) GetPostByID(ctx context.Context, id string) (*models.Post, error) {
+	args := m.Called(ctx, id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.Post), args.Error(1)
 }
 
-func (m *MockDatabaseAdapter) ListPosts(userID string, limit, offset int) ([]*models.Post, error) {
-	args := m.Called(userID, limit, offset)
+func (m *MockDatabaseAdapter) ListPosts(ctx context.Context, userID string, p adapters.Pagination) ([]*models.Post, error) {
+	args := m.Called(ctx, userID, p)
 	return args.Get(0).([]*models.Post), args.Error(1)
 }
 
-func (m *MockDatabaseAdapter) UpdatePost(post *models.Post) error {
-	args := m.Called(post)
+func (m *MockDatabaseAdapter) CountPosts(ctx context.Context, userID string) (int64, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) UpdatePost(ctx context.Context, post *models.Post) error {
+	args := m.Called(ctx, post)
 	return args.Error(0)
 }
 
-func (m *MockDatabaseAdapter) DeletePost(id string) error {
-	args := m.Called(id)
+func (m *MockDatabaseAdapter) DeletePost(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
-func (m *MockDatabaseAdapter) CreateComment(comment *models.Comment) error {
-	args := m.Called(comment)
+func (m *MockDatabaseAdapter) CreateComment(ctx context.Context, comment *models.Comment) error {
+	args := m.Called(ctx, comment)
 	return args.Error(0)
 }
 
-func (m *MockDatabaseAdapter) GetCommentByID(id string) (*models.Comment, error) {
-	args := m.Called(id)
+func (m *MockDatabaseAdapter) GetCommentByID(ctx context.Context, id string) (*models.Comment, error) {
+	args := m.Called(ctx, id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.Comment), args.Error(1)
 }
 
-func (m *MockDatabaseAdapter) ListComments(postID string, limit, offset int) ([]*models.Comment, error) {
-	args := m.Called(postID, limit, offset)
+func (m *MockDatabaseAdapter) ListComments(ctx context.Context, postID string, p adapters.Pagination) ([]*models.Comment, error) {
+	args := m.Called(ctx, postID, p)
 	return args.Get(0).([]*models.Comment), args.Error(1)
 }
 
-func (m *MockDatabaseAdapter) UpdateComment(comment *models.Comment) error {
-	args := m.Called(comment)
+func (m *MockDatabaseAdapter) CountComments(ctx context.Context, postID string) (int64, error) {
+	args := m.Called(ctx, postID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) UpdateComment(ctx context.Context, comment *models.Comment) error {
+	args := m.Called(ctx, comment)
+	return args.Error(0)
+}
+
+func (m *MockDatabaseAdapter) DeleteComment(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
 	return args.Error(0)
 }
 
-func (m *MockDatabaseAdapter) DeleteComment(id string) error {
-	args := m.Called(id)
+func (m *MockDatabaseAdapter) CreateReaction(ctx context.Context, reaction *models.Reaction) error {
+	args := m.Called(ctx, reaction)
 	return args.Error(0)
 }
 
-func (m *MockDatabaseAdapter) CreateReaction(reaction *models.Reaction) error {
-	args := m.Called(reaction)
+func (m *MockDatabaseAdapter) AddReaction(ctx context.Context, reaction *models.Reaction) (bool, error) {
+	args := m.Called(ctx, reaction)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) ReplaceReaction(ctx context.Context, reaction *models.Reaction) (bool, []*models.Reaction, error) {
+	args := m.Called(ctx, reaction)
+	if args.Get(1) == nil {
+		return args.Bool(0), nil, args.Error(2)
+	}
+	return args.Bool(0), args.Get(1).([]*models.Reaction), args.Error(2)
+}
+
+func (m *MockDatabaseAdapter) CreateReactionType(ctx context.Context, reactionType *models.ReactionType) error {
+	args := m.Called(ctx, reactionType)
 	return args.Error(0)
 }
 
-func (m *MockDatabaseAdapter) GetReaction(userID, targetID, targetType, reactionType string) (*models.Reaction, error) {
-	args := m.Called(userID, targetID, targetType, reactionType)
+func (m *MockDatabaseAdapter) GetReactionType(ctx context.Context, name string) (*models.ReactionType, error) {
+	args := m.Called(ctx, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.ReactionType), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) ListReactionTypes(ctx context.Context) ([]*models.ReactionType, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]*models.ReactionType), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) DeleteReactionType(ctx context.Context, name string) error {
+	args := m.Called(ctx, name)
+	return args.Error(0)
+}
+
+func (m *MockDatabaseAdapter) RemoveReaction(ctx context.Context, userID, targetID, targetType, reactionType string) (*models.Reaction, error) {
+	args := m.Called(ctx, userID, targetID, targetType, reactionType)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Reaction), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) GetReaction(ctx context.Context, userID, targetID, targetType, reactionType string) (*models.Reaction, error) {
+	args := m.Called(ctx, userID, targetID, targetType, reactionType)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Reaction), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) GetReactionByID(ctx context.Context, id string) (*models.Reaction, error) {
+	args := m.Called(ctx, id)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.Reaction), args.Error(1)
 }
 
-func (m *MockDatabaseAdapter) ListReactions(targetID, targetType string) ([]*models.Reaction, error) {
-	args := m.Called(targetID, targetType)
+func (m *MockDatabaseAdapter) ListReactions(ctx context.Context, targetID, targetType string) ([]*models.Reaction, error) {
+	args := m.Called(ctx, targetID, targetType)
 	return args.Get(0).([]*models.Reaction), args.Error(1)
 }
 
-func (m *MockDatabaseAdapter) DeleteReaction(id string) error {
-	args := m.Called(id)
+func (m *MockDatabaseAdapter) DeleteReaction(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockDatabaseAdapter) SummarizeReactions(ctx context.Context, targetType string, targetIDs []string, userID string, recent int) (map[string]*models.ReactionSummary, error) {
+	args := m.Called(ctx, targetType, targetIDs, userID, recent)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(map[string]*models.ReactionSummary), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) RepairCounters(ctx context.Context) error {
+	args := m.Called(ctx)
 	return args.Error(0)
 }
 
@@ -106,65 +192,227 @@ func (m *MockDatabaseAdapter) Close() error {
 	return args.Error(0)
 }
 
-func (m *MockDatabaseAdapter) SearchPosts(query string, limit, offset int) ([]*models.Post, error) {
-	args := m.Called(query, limit, offset)
+func (m *MockDatabaseAdapter) SearchPosts(ctx context.Context, q adapters.SearchQuery, p adapters.Pagination) ([]*models.Post, error) {
+	args := m.Called(ctx, q, p)
 	return args.Get(0).([]*models.Post), args.Error(1)
 }
 
-func (m *MockDatabaseAdapter) ListPostsByCity(city string, limit, offset int) ([]*models.Post, error) {
-	args := m.Called(city, limit, offset)
+func (m *MockDatabaseAdapter) CountSearchPosts(ctx context.Context, q adapters.SearchQuery) (int64, error) {
+	args := m.Called(ctx, q)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) ListPostsByCity(ctx context.Context, city string, p adapters.Pagination) ([]*models.Post, error) {
+	args := m.Called(ctx, city, p)
 	return args.Get(0).([]*models.Post), args.Error(1)
 }
 
-func (m *MockDatabaseAdapter) FindNearbyPosts(lat, lng float64, radiusKm float64, limit, offset int) ([]*models.Post, error) {
-	args := m.Called(lat, lng, radiusKm, limit, offset)
+func (m *MockDatabaseAdapter) CountPostsByCity(ctx context.Context, city string) (int64, error) {
+	args := m.Called(ctx, city)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) FindNearbyPosts(ctx context.Context, lat, lng float64, radiusKm float64, limit, offset int) ([]*models.Post, error) {
+	args := m.Called(ctx, lat, lng, radiusKm, limit, offset)
 	return args.Get(0).([]*models.Post), args.Error(1)
 }
 
-func (m *MockDatabaseAdapter) CreateAttachment(attachment *models.Attachment) error {
-	args := m.Called(attachment)
+func (m *MockDatabaseAdapter) CountNearbyPosts(ctx context.Context, lat, lng float64, radiusKm float64) (int64, error) {
+	args := m.Called(ctx, lat, lng, radiusKm)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) CreateAttachment(ctx context.Context, attachment *models.Attachment) error {
+	args := m.Called(ctx, attachment)
 	return args.Error(0)
 }
 
-func (m *MockDatabaseAdapter) GetAttachmentsForPost(postID string) ([]*models.Attachment, error) {
-	args := m.Called(postID)
+func (m *MockDatabaseAdapter) GetAttachmentsForPost(ctx context.Context, postID string) ([]*models.Attachment, error) {
+	args := m.Called(ctx, postID)
 	return args.Get(0).([]*models.Attachment), args.Error(1)
 }
 
-func (m *MockDatabaseAdapter) GetAttachmentForComment(commentID string) (*models.Attachment, error) {
-	args := m.Called(commentID)
+func (m *MockDatabaseAdapter) GetAttachmentForComment(ctx context.Context, commentID string) (*models.Attachment, error) {
+	args := m.Called(ctx, commentID)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.Attachment), args.Error(1)
 }
 
-func (m *MockDatabaseAdapter) DeleteAttachment(id string) error {
-	args := m.Called(id)
+func (m *MockDatabaseAdapter) DeleteAttachment(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockDatabaseAdapter) CreateModerationAction(ctx context.Context, action *models.ModerationAction) error {
+	args := m.Called(ctx, action)
+	return args.Error(0)
+}
+
+func (m *MockDatabaseAdapter) ListModerationActions(ctx context.Context, p adapters.Pagination) ([]*models.ModerationAction, error) {
+	args := m.Called(ctx, p)
+	return args.Get(0).([]*models.ModerationAction), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *MockDatabaseAdapter) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	args := m.Called(ctx, prefix)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.APIKey), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) ListAPIKeys(ctx context.Context) ([]*models.APIKey, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]*models.APIKey), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) RevokeAPIKey(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockDatabaseAdapter) EnqueueEvent(ctx context.Context, event *models.OutboxEvent) error {
+	args := m.Called(ctx, event)
 	return args.Error(0)
 }
 
+func (m *MockDatabaseAdapter) ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error) {
+	args := m.Called(ctx, limit, lease)
+	return args.Get(0).([]*models.OutboxEvent), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) CompleteEvent(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockDatabaseAdapter) ReleaseEvent(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockDatabaseAdapter) FailEvent(ctx context.Context, id, lastError string, retryAt time.Time) error {
+	args := m.Called(ctx, id, lastError, retryAt)
+	return args.Error(0)
+}
+
+func (m *MockDatabaseAdapter) DeadLetterEvent(ctx context.Context, id, lastError string) error {
+	args := m.Called(ctx, id, lastError)
+	return args.Error(0)
+}
+
+func (m *MockDatabaseAdapter) GetEvent(ctx context.Context, id string) (*models.OutboxEvent, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(*models.OutboxEvent), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) ListDeadLetteredEvents(ctx context.Context, p adapters.Pagination) ([]*models.OutboxEvent, error) {
+	args := m.Called(ctx, p)
+	return args.Get(0).([]*models.OutboxEvent), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) ListEvents(ctx context.Context, since, until time.Time, limit int) ([]*models.OutboxEvent, error) {
+	args := m.Called(ctx, since, until, limit)
+	return args.Get(0).([]*models.OutboxEvent), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) ReplayEvent(ctx context.Context, id string) (*models.OutboxEvent, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(*models.OutboxEvent), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) DeleteDeliveredEvents(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) DeleteDeadLetteredEvents(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) CreateWebhookSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	args := m.Called(ctx, subscription)
+	return args.Error(0)
+}
+
+func (m *MockDatabaseAdapter) GetWebhookSubscription(ctx context.Context, id string) (*models.WebhookSubscription, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(*models.WebhookSubscription), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) ListWebhookSubscriptions(ctx context.Context) ([]*models.WebhookSubscription, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]*models.WebhookSubscription), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) UpdateWebhookSubscription(ctx context.Context, subscription *models.WebhookSubscription) error {
+	args := m.Called(ctx, subscription)
+	return args.Error(0)
+}
+
+func (m *MockDatabaseAdapter) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockDatabaseAdapter) RecordWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	args := m.Called(ctx, delivery)
+	return args.Error(0)
+}
+
+func (m *MockDatabaseAdapter) ListWebhookDeliveries(ctx context.Context, q adapters.DeliveryQuery, p adapters.Pagination) ([]*models.WebhookDelivery, error) {
+	args := m.Called(ctx, q, p)
+	return args.Get(0).([]*models.WebhookDelivery), args.Error(1)
+}
+
+func (m *MockDatabaseAdapter) DeleteWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// Transaction runs fn with the mock itself
+func (m *MockDatabaseAdapter) Transaction(ctx context.Context, fn func(tx adapters.DatabaseAdapter) error) error {
+	return fn(m)
+}
+
 // Helper function to create a test app
-func setupTestApp(db *MockDatabaseAdapter) *fiber.App {
+func setupTestApp(t *testing.T, db *MockDatabaseAdapter) *fiber.App {
 	app := fiber.New(fiber.Config{
 		ErrorHandler: api.ErrorHandler,
 	})
-	api.SetupRoutes(app, db)
+	app.Use(auth.Middleware(auth.TrustedHeader{}))
+	app.Use(api.TenantMiddleware())
+	api.SetupRoutes(app, db, reactionRules(t))
 	return app
 }
 
+// reactionRules loads the reaction rules of the current configuration
+func reactionRules(t *testing.T) *api.ReactionRules {
+	rules, err := api.LoadReactionRules()
+	assert.Nil(t, err)
+	return rules
+}
+
 // Test creating a post
 func TestCreatePost(t *testing.T) {
 	// Setup
 	mockDB := new(MockDatabaseAdapter)
-	app := setupTestApp(mockDB)
+	app := setupTestApp(t, mockDB)
 
 	// Test data
 	userID := "test-user-123"
 	postID := uuid.New().String()
 
 	// Mock behavior
-	mockDB.On("CreatePost", mock.MatchedBy(func(post *models.Post) bool {
+	mockDB.On("CreatePost", mock.Anything, mock.MatchedBy(func(post *models.Post) bool {
 		// Set ID for the returned post
 		post.ID = postID
 		return post.UserID == userID && post.Content == "Test post"
@@ -195,3 +443,1050 @@ func TestCreatePost(t *testing.T) {
 	// Verify mocks
 	mockDB.AssertExpectations(t)
 }
+
+// Helper function to create a test app backed by the in-memory adapter
+func setupMemoryApp(t *testing.T) *fiber.App {
+	app, _ := setupMemoryAppWithDB(t)
+	return app
+}
+
+// setupMemoryAppWithDB creates an app backed by a memory adapter, and returns
+// the adapter along with it. Requests authenticate with API keys, or as the
+// user of X-User-ID with the roles of X-Roles.
+func setupMemoryAppWithDB(t *testing.T) (*fiber.App, adapters.DatabaseAdapter) {
+	viper.Set("DB_ADAPTER", "memory")
+	db, err := adapters.NewDatabaseAdapter()
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler: api.ErrorHandler,
+	})
+	app.Use(auth.Middleware(auth.Chain{auth.APIKeys{Store: db}, rolesHeader{}}))
+	app.Use(api.TenantMiddleware())
+	api.SetupRoutes(app, db, reactionRules(t))
+	return app, db
+}
+
+// rolesHeader authenticates like auth.TrustedHeader, taking the user's roles
+// from X-Roles
+type rolesHeader struct{}
+
+func (rolesHeader) Authenticate(c *fiber.Ctx) (*auth.Identity, error) {
+	identity, err := auth.TrustedHeader{}.Authenticate(c)
+	if err != nil {
+		return nil, err
+	}
+	identity.Roles = strings.Fields(c.Get("X-Roles"))
+	return identity, nil
+}
+
+// doRequest performs a request against the app with headers, and returns the
+// response body
+func doRequest(t *testing.T, app *fiber.App, method, path string, headers map[string]string, body string) (int, []byte) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := app.Test(req)
+	assert.Nil(t, err)
+	respBody, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, respBody
+}
+
+// userHeaders returns the headers of a user with roles, separated by spaces
+func userHeaders(userID, roles string) map[string]string {
+	headers := map[string]string{}
+	if userID != "" {
+		headers["X-User-ID"] = userID
+	}
+	if roles != "" {
+		headers["X-Roles"] = roles
+	}
+	return headers
+}
+
+// doJSON performs a request against the app and decodes the JSON response
+func doJSON(t *testing.T, app *fiber.App, method, path, userID, body string) (int, map[string]interface{}) {
+	return doJSONAs(t, app, method, path, userID, "", body)
+}
+
+// doJSONAs performs a request as a user with roles, see doJSON
+func doJSONAs(t *testing.T, app *fiber.App, method, path, userID, roles, body string) (int, map[string]interface{}) {
+	status, respBody := doRequest(t, app, method, path, userHeaders(userID, roles), body)
+
+	var result map[string]interface{}
+	if len(respBody) > 0 && respBody[0] == '{' {
+		assert.Nil(t, json.Unmarshal(respBody, &result))
+	}
+	return status, result
+}
+
+// Test the post lifecycle end to end against the in-memory adapter
+func TestPostLifecycleWithMemoryAdapter(t *testing.T) {
+	app := setupMemoryApp(t)
+	userID := "test-user-123"
+
+	// Create a post with an attachment
+	status, post := doJSON(t, app, http.MethodPost, "/api/posts", userID,
+		`{"content":"Hello Oakland","city":"Oakland","attachments":[{"url":"https://example.com/a.jpg","type":"image"}]}`)
+	assert.Equal(t, http.StatusCreated, status)
+	postID := post["id"].(string)
+
+	// Comment and react on it
+	status, comment := doJSON(t, app, http.MethodPost, "/api/comments", "other-user",
+		`{"post_id":"`+postID+`","content":"Nice!"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	commentID := comment["id"].(string)
+
+	status, _ = doJSON(t, app, http.MethodPost, "/api/reactions", "other-user",
+		`{"target_id":"`+commentID+`","target_type":"comment","type":"like"}`)
+	assert.Equal(t, http.StatusCreated, status)
+
+	// The post shows up in city search with its attachment
+	status, result := doJSON(t, app, http.MethodGet, "/api/posts/search?q=oakland&city=Oakland", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	data := result["data"].([]interface{})
+	assert.Len(t, data, 1)
+	assert.Len(t, data[0].(map[string]interface{})["attachments"], 1)
+
+	// Only the author may delete the post
+	status, _ = doJSON(t, app, http.MethodDelete, "/api/posts/"+postID, "other-user", "")
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status, _ = doJSON(t, app, http.MethodDelete, "/api/posts/"+postID, userID, "")
+	assert.Equal(t, http.StatusNoContent, status)
+
+	// Deleting the post cascades to its comments
+	status, _ = doJSON(t, app, http.MethodGet, "/api/posts/"+postID, "", "")
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = doJSON(t, app, http.MethodGet, "/api/comments/"+commentID, "", "")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+// Test that slow queries are cancelled by the query timeout
+func TestQueryTimeout(t *testing.T) {
+	viper.Set("DB_QUERY_TIMEOUT", 1)
+	defer viper.Set("DB_QUERY_TIMEOUT", 0)
+
+	mockDB := new(MockDatabaseAdapter)
+	app := fiber.New(fiber.Config{
+		ErrorHandler: api.ErrorHandler,
+	})
+	app.Use(api.QueryTimeoutMiddleware())
+	api.SetupRoutes(app, mockDB, reactionRules(t))
+
+	// Block until the request deadline expires, like a slow query would
+	mockDB.On("GetPostByID", mock.Anything, "slow-post").Run(func(args mock.Arguments) {
+		ctx := args.Get(0).(context.Context)
+		<-ctx.Done()
+	}).Return(nil, context.DeadlineExceeded)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/posts/slow-post", nil)
+	resp, err := app.Test(req, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+
+	mockDB.AssertExpectations(t)
+}
+
+// Test walking the post list with cursors
+func TestListPostsCursorPagination(t *testing.T) {
+	app := setupMemoryApp(t)
+	userID := "test-user-123"
+
+	for i := 0; i < 5; i++ {
+		status, _ := doJSON(t, app, http.MethodPost, "/api/posts", userID, `{"content":"post"}`)
+		assert.Equal(t, http.StatusCreated, status)
+	}
+
+	seen := map[string]bool{}
+	path := "/api/posts?limit=2"
+	for pages := 0; pages < 5; pages++ {
+		status, result := doJSON(t, app, http.MethodGet, path, "", "")
+		assert.Equal(t, http.StatusOK, status)
+		for _, item := range result["data"].([]interface{}) {
+			seen[item.(map[string]interface{})["id"].(string)] = true
+		}
+
+		next, ok := result["meta"].(map[string]interface{})["next_cursor"].(string)
+		if !ok {
+			break
+		}
+		path = "/api/posts?limit=2&cursor=" + next
+	}
+	assert.Len(t, seen, 5)
+
+	// Malformed cursors are rejected
+	status, _ := doJSON(t, app, http.MethodGet, "/api/posts?cursor=not-a-cursor", "", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+// Test has_more and the opt-in total in list metadata
+func TestPaginationMetadata(t *testing.T) {
+	app := setupMemoryApp(t)
+	userID := "test-user-123"
+
+	for i := 0; i < 3; i++ {
+		status, _ := doJSON(t, app, http.MethodPost, "/api/posts", userID, `{"content":"post"}`)
+		assert.Equal(t, http.StatusCreated, status)
+	}
+
+	status, result := doJSON(t, app, http.MethodGet, "/api/posts?limit=2", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	meta := result["meta"].(map[string]interface{})
+	assert.Equal(t, true, meta["has_more"])
+	assert.NotContains(t, meta, "total")
+
+	status, result = doJSON(t, app, http.MethodGet, "/api/posts?limit=2&page=2&with_total=true", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	meta = result["meta"].(map[string]interface{})
+	assert.Equal(t, false, meta["has_more"])
+	assert.Nil(t, meta["next_cursor"])
+	assert.Equal(t, float64(3), meta["total"])
+	assert.Equal(t, float64(1), meta["count"])
+
+	// A page that is exactly full has no more results after it
+	status, result = doJSON(t, app, http.MethodGet, "/api/posts?limit=3", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, false, result["meta"].(map[string]interface{})["has_more"])
+}
+
+// Test search query syntax and sort orders
+func TestSearchPostsSort(t *testing.T) {
+	app := setupMemoryApp(t)
+	userID := "test-user-123"
+
+	for _, content := range []string{"golang golang golang", "golang and rust", "just rust"} {
+		status, _ := doJSON(t, app, http.MethodPost, "/api/posts", userID, `{"content":"`+content+`"}`)
+		assert.Equal(t, http.StatusCreated, status)
+	}
+
+	status, result := doJSON(t, app, http.MethodGet, "/api/search/posts?q=golang&sort=relevance", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	data := result["data"].([]interface{})
+	assert.Len(t, data, 2)
+	assert.Equal(t, "golang golang golang", data[0].(map[string]interface{})["content"])
+	assert.Equal(t, "<mark>golang</mark> and rust", data[1].(map[string]interface{})["snippet"])
+
+	status, result = doJSON(t, app, http.MethodGet, "/api/search/posts?q=rust+-golang", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, result["data"], 1)
+
+	status, _ = doJSON(t, app, http.MethodGet, "/api/search/posts?q=golang&sort=oldest", "", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	cursor := adapters.Cursor{CreatedAt: time.Now(), ID: "post"}
+	status, _ = doJSON(t, app, http.MethodGet, "/api/search/posts?q=golang&sort=relevance&cursor="+cursor.Encode(), "", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestPostLanguage(t *testing.T) {
+	app := setupMemoryApp(t)
+	userID := "test-user-123"
+
+	status, post := doJSON(t, app, http.MethodPost, "/api/posts", userID, `{"content":"olá mundo","language":"pt-BR"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "pt-BR", post["language"])
+
+	status, _ = doJSON(t, app, http.MethodPost, "/api/posts", userID, `{"content":"hello","language":"not a language"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, updated := doJSON(t, app, http.MethodPut, "/api/posts/"+post["id"].(string), userID, `{"content":"hello world","language":"en"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "en", updated["language"])
+
+	status, _ = doJSON(t, app, http.MethodPut, "/api/posts/"+post["id"].(string), userID, `{"content":"hello","language":"en_US"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestSearchPostsCombinedFilters(t *testing.T) {
+	app := setupMemoryApp(t)
+	userID := "test-user-123"
+
+	// Older matches behind newer posts that only match the city
+	for _, content := range []string{"coffee one", "coffee two", "coffee three", "tea", "tea", "tea"} {
+		status, _ := doJSON(t, app, http.MethodPost, "/api/posts", userID,
+			`{"content":"`+content+`","city":"Oakland","latitude":37.8044,"longitude":-122.2712}`)
+		assert.Equal(t, http.StatusCreated, status)
+	}
+
+	for _, path := range []string{
+		"/api/search/posts?q=coffee&city=Oakland&limit=2&with_total=true",
+		"/api/search/posts?q=coffee&lat=37.8&lng=-122.27&radius=5&limit=2&with_total=true",
+		"/api/search/posts?q=coffee&bbox=-123,37,-122,38&user_id=" + userID + "&limit=2&with_total=true",
+	} {
+		status, result := doJSON(t, app, http.MethodGet, path, "", "")
+		assert.Equal(t, http.StatusOK, status, path)
+		assert.Len(t, result["data"], 2, path)
+		meta := result["meta"].(map[string]interface{})
+		assert.Equal(t, true, meta["has_more"], path)
+		assert.Equal(t, float64(3), meta["total"], path)
+	}
+
+	for _, path := range []string{
+		"/api/search/posts",
+		"/api/search/posts?lat=37.8",
+		"/api/search/posts?bbox=1,2,3",
+		"/api/search/posts?city=Oakland&sort=relevance",
+		"/api/search/posts?since=yesterday",
+		"/api/search/posts?has_attachments=maybe",
+	} {
+		status, _ := doJSON(t, app, http.MethodGet, path, "", "")
+		assert.Equal(t, http.StatusBadRequest, status, path)
+	}
+}
+
+// hs256Token returns a JWT with claims signed with secret
+func hs256Token(t *testing.T, secret []byte, claims map[string]interface{}) string {
+	payload, err := json.Marshal(claims)
+	assert.Nil(t, err)
+	input := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Test that users with roles act within the tenant of their token, or the
+// default tenant if it names none, never one picked by X-Tenant-ID
+func TestRolesAreBoundToTenant(t *testing.T) {
+	viper.Set("DB_ADAPTER", "memory")
+	db, err := adapters.NewDatabaseAdapter()
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	secret := []byte("test-secret")
+	authenticator, err := auth.NewJWT(auth.JWTConfig{Secret: secret})
+	assert.Nil(t, err)
+	app := fiber.New(fiber.Config{
+		ErrorHandler: api.ErrorHandler,
+	})
+	app.Use(auth.Middleware(authenticator))
+	app.Use(api.TenantMiddleware())
+	api.SetupRoutes(app, db, reactionRules(t))
+
+	expires := time.Now().Add(time.Hour).Unix()
+	admin := map[string]string{"Authorization": "Bearer " + hs256Token(t, secret, map[string]interface{}{"sub": "admin-1", "roles": []string{"admin"}, "exp": expires})}
+	status, _ := doRequest(t, app, http.MethodGet, "/api/admin/api-keys", admin, "")
+	assert.Equal(t, http.StatusOK, status)
+
+	admin["X-Tenant-ID"] = "other"
+	for _, path := range []string{"/api/admin/api-keys", "/api/admin/webhooks", "/api/moderation/actions"} {
+		status, _ = doRequest(t, app, http.MethodGet, path, admin, "")
+		assert.Equal(t, http.StatusForbidden, status, path)
+	}
+	status, _ = doRequest(t, app, http.MethodPost, "/api/admin/api-keys", admin, `{"name":"stolen","scopes":["admin"]}`)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// Users without roles still pick their tenant
+	user := map[string]string{
+		"Authorization": "Bearer " + hs256Token(t, secret, map[string]interface{}{"sub": "user-1", "exp": expires}),
+		"X-Tenant-ID":   "other",
+	}
+	status, _ = doRequest(t, app, http.MethodPost, "/api/posts", user, `{"content":"Hello"}`)
+	assert.Equal(t, http.StatusCreated, status)
+}
+
+// Test that tenants named by X-Tenant-ID only see their own posts
+func TestTenantIsolation(t *testing.T) {
+	app := setupMemoryApp(t)
+
+	request := func(method, path, tenantID, body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-ID", "user-1")
+		if tenantID != "" {
+			req.Header.Set("X-Tenant-ID", tenantID)
+		}
+
+		resp, err := app.Test(req)
+		assert.Nil(t, err)
+
+		var result map[string]interface{}
+		respBody, _ := io.ReadAll(resp.Body)
+		if len(respBody) > 0 && respBody[0] == '{' {
+			assert.Nil(t, json.Unmarshal(respBody, &result))
+		}
+		return resp.StatusCode, result
+	}
+
+	status, post := request(http.MethodPost, "/api/posts", "app-a", `{"content":"Hello from A"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	postID := post["id"].(string)
+
+	status, _ = request(http.MethodGet, "/api/posts/"+postID, "app-a", "")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = request(http.MethodGet, "/api/posts/"+postID, "app-b", "")
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = request(http.MethodDelete, "/api/posts/"+postID, "app-b", "")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	for _, tenantID := range []string{"app-b", ""} {
+		status, result := request(http.MethodGet, "/api/posts", tenantID, "")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Empty(t, result["data"], tenantID)
+	}
+
+	status, _ = request(http.MethodGet, "/api/posts", "app a", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestAPIKeys(t *testing.T) {
+	app, db := setupMemoryAppWithDB(t)
+
+	// The first admin key is created out of band, as with `sonet apikey create`
+	adminKey, admin, err := auth.NewAPIKey("admin", []string{auth.ScopeAdmin}, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, db.CreateAPIKey(adapters.WithTenant(context.Background(), "app-a"), admin))
+
+	asAdmin := map[string]string{"X-API-Key": adminKey}
+	asUser := map[string]string{"X-User-ID": "user-1", "X-Tenant-ID": "app-a"}
+
+	// Create a moderation key
+	status, body := doRequest(t, app, http.MethodPost, "/api/admin/api-keys", asAdmin, `{"name":"moderator","scopes":["moderation"]}`)
+	assert.Equal(t, http.StatusCreated, status)
+	var created map[string]interface{}
+	assert.Nil(t, json.Unmarshal(body, &created))
+	assert.NotContains(t, created, "hash")
+	moderatorKey := created["key"].(string)
+	asModerator := map[string]string{"X-API-Key": moderatorKey}
+
+	status, _ = doRequest(t, app, http.MethodPost, "/api/admin/api-keys", asAdmin, `{"name":"bad","scopes":["everything"]}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Only admin keys manage keys; users are never admins
+	status, _ = doRequest(t, app, http.MethodGet, "/api/admin/api-keys", nil, "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = doRequest(t, app, http.MethodGet, "/api/admin/api-keys", asUser, "")
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = doRequest(t, app, http.MethodGet, "/api/admin/api-keys", asModerator, "")
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status, body = doRequest(t, app, http.MethodGet, "/api/admin/api-keys", asAdmin, "")
+	assert.Equal(t, http.StatusOK, status)
+	var keys []map[string]interface{}
+	assert.Nil(t, json.Unmarshal(body, &keys))
+	assert.Len(t, keys, 2)
+
+	// The moderation key removes a user's post in its tenant, but cannot post
+	status, body = doRequest(t, app, http.MethodPost, "/api/posts", asUser, `{"content":"spam"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	var post map[string]interface{}
+	assert.Nil(t, json.Unmarshal(body, &post))
+	postID := post["id"].(string)
+
+	status, _ = doRequest(t, app, http.MethodPost, "/api/posts", asModerator, `{"content":"hello"}`)
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = doRequest(t, app, http.MethodDelete, "/api/posts/"+postID, map[string]string{"X-API-Key": moderatorKey, "X-Tenant-ID": "app-b"}, "")
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = doRequest(t, app, http.MethodDelete, "/api/posts/"+postID, map[string]string{"X-User-ID": "user-2", "X-Tenant-ID": "app-a"}, "")
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = doRequest(t, app, http.MethodDelete, "/api/posts/"+postID+"?reason=spam", asModerator, "")
+	assert.Equal(t, http.StatusNoContent, status)
+
+	// Revoked and made-up keys are rejected
+	status, _ = doRequest(t, app, http.MethodDelete, "/api/admin/api-keys/"+created["id"].(string), asAdmin, "")
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = doRequest(t, app, http.MethodGet, "/api/posts", asModerator, "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = doRequest(t, app, http.MethodGet, "/api/posts", map[string]string{"X-API-Key": adminKey + "x"}, "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestAPIKeyRateLimit(t *testing.T) {
+	viper.Set("RATE_LIMIT_ENABLED", true)
+	viper.Set("RATE_LIMIT_REQUESTS", 3)
+	defer viper.Set("RATE_LIMIT_ENABLED", false)
+	defer viper.Set("RATE_LIMIT_REQUESTS", 100)
+
+	viper.Set("DB_ADAPTER", "memory")
+	db, err := adapters.NewDatabaseAdapter()
+	assert.Nil(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	app := fiber.New(fiber.Config{
+		ErrorHandler: api.ErrorHandler,
+	})
+	app.Use(auth.Middleware(auth.Chain{auth.APIKeys{Store: db}, auth.TrustedHeader{}}))
+	app.Use(api.TenantMiddleware())
+	app.Use(api.RateLimiterMiddleware())
+	api.SetupRoutes(app, db, reactionRules(t))
+
+	limitedKey, limited, err := auth.NewAPIKey("limited", nil, 1)
+	assert.Nil(t, err)
+	assert.Nil(t, db.CreateAPIKey(context.Background(), limited))
+	defaultKey, unlimited, err := auth.NewAPIKey("default", nil, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, db.CreateAPIKey(context.Background(), unlimited))
+
+	statuses := func(header, value string, n int) []int {
+		var statuses []int
+		for i := 0; i < n; i++ {
+			req := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
+			req.Header.Set(header, value)
+			resp, err := app.Test(req)
+			assert.Nil(t, err)
+			statuses = append(statuses, resp.StatusCode)
+		}
+		return statuses
+	}
+
+	// Keys with a rate limit use it, others RATE_LIMIT_REQUESTS like users
+	assert.Equal(t, []int{200, 429}, statuses("X-API-Key", limitedKey, 2))
+	assert.Equal(t, []int{200, 200, 200, 429}, statuses("X-API-Key", defaultKey, 4))
+	assert.Equal(t, []int{200, 200, 200, 429}, statuses("X-User-ID", "user-1", 4))
+}
+
+// Test that only the owner of a reaction may delete it
+func TestDeleteReaction(t *testing.T) {
+	app := setupMemoryApp(t)
+
+	status, post := doJSON(t, app, http.MethodPost, "/api/posts", "user-1", `{"content":"Hello"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	status, reaction := doJSON(t, app, http.MethodPost, "/api/reactions", "user-2",
+		`{"target_id":"`+post["id"].(string)+`","target_type":"post","type":"like"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	path := "/api/reactions/" + reaction["id"].(string)
+
+	status, _ = doJSON(t, app, http.MethodDelete, path, "", "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = doJSON(t, app, http.MethodDelete, path, "user-1", "")
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = doJSON(t, app, http.MethodDelete, "/api/reactions/missing", "user-2", "")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, _ = doJSON(t, app, http.MethodDelete, path, "user-2", "")
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = doJSON(t, app, http.MethodDelete, path, "user-2", "")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+// Test toggling and removing reactions by target, and the hooks they trigger
+func TestToggleReaction(t *testing.T) {
+	viper.Set("HOOKS_ENABLED", true)
+	defer viper.Set("HOOKS_ENABLED", false)
+	manager := hooks.DefaultHookManager
+	hooks.DefaultHookManager = hooks.NewHookManager()
+	defer func() { hooks.DefaultHookManager = manager }()
+
+	events := make(chan hooks.EventType, 10)
+	record := func(event hooks.Event) error {
+		events <- event.Type
+		return nil
+	}
+	hooks.DefaultHookManager.Register(hooks.EventReactionAdded, record)
+	hooks.DefaultHookManager.Register(hooks.EventReactionRemoved, record)
+	expectEvent := func(expected hooks.EventType) {
+		select {
+		case event := <-events:
+			assert.Equal(t, expected, event)
+		case <-time.After(time.Second):
+			t.Fatalf("expected a %s event", expected)
+		}
+	}
+
+	app, db := setupMemoryAppWithDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go (&hooks.Dispatcher{Outbox: db, Interval: 10 * time.Millisecond, BatchSize: 10, Lease: time.Minute}).Run(ctx)
+	status, post := doJSON(t, app, http.MethodPost, "/api/posts", "user-1", `{"content":"Hello"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	target := "/api/reactions/post/" + post["id"].(string) + "/like"
+
+	countReactions := func() int {
+		var reactions []interface{}
+		req := httptest.NewRequest(http.MethodGet, "/api/reactions/post/"+post["id"].(string), nil)
+		resp, err := app.Test(req)
+		assert.Nil(t, err)
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(&reactions))
+		return len(reactions)
+	}
+
+	status, reaction := doJSON(t, app, http.MethodPut, target+"/toggle", "user-2", "")
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, "like", reaction["type"])
+	expectEvent(hooks.EventReactionAdded)
+	assert.Equal(t, 1, countReactions())
+
+	status, _ = doJSON(t, app, http.MethodPut, target+"/toggle", "user-2", "")
+	assert.Equal(t, http.StatusNoContent, status)
+	expectEvent(hooks.EventReactionRemoved)
+	assert.Equal(t, 0, countReactions())
+
+	// Reacting twice returns the existing reaction
+	status, first := doJSON(t, app, http.MethodPost, "/api/reactions", "user-2",
+		`{"target_id":"`+post["id"].(string)+`","target_type":"post","type":"like"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	expectEvent(hooks.EventReactionAdded)
+	status, second := doJSON(t, app, http.MethodPost, "/api/reactions", "user-2",
+		`{"target_id":"`+post["id"].(string)+`","target_type":"post","type":"like"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, first["id"], second["id"])
+
+	// Removing by target only removes the caller's reaction, and is idempotent
+	status, _ = doJSON(t, app, http.MethodDelete, target, "user-3", "")
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.Equal(t, 1, countReactions())
+	status, _ = doJSON(t, app, http.MethodDelete, target, "user-2", "")
+	assert.Equal(t, http.StatusNoContent, status)
+	expectEvent(hooks.EventReactionRemoved)
+	status, _ = doJSON(t, app, http.MethodDelete, target, "user-2", "")
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.Equal(t, 0, countReactions())
+
+	status, _ = doJSON(t, app, http.MethodPut, "/api/reactions/post/missing/like/toggle", "user-2", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = doJSON(t, app, http.MethodPut, target+"/toggle", "", "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected %s event", event)
+	default:
+	}
+}
+
+// Test reaction summaries, on their own and included with posts and comments
+func TestReactionSummaries(t *testing.T) {
+	app := setupMemoryApp(t)
+
+	status, post := doJSON(t, app, http.MethodPost, "/api/posts", "user-1", `{"content":"Hello"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	postID := post["id"].(string)
+	status, comment := doJSON(t, app, http.MethodPost, "/api/comments", "user-2", `{"post_id":"`+postID+`","content":"Hi"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	commentID := comment["id"].(string)
+
+	for _, userID := range []string{"user-2", "user-3", "user-4"} {
+		status, _ = doJSON(t, app, http.MethodPut, "/api/reactions/post/"+postID+"/like/toggle", userID, "")
+		assert.Equal(t, http.StatusCreated, status)
+	}
+	status, _ = doJSON(t, app, http.MethodPut, "/api/reactions/post/"+postID+"/love/toggle", "user-2", "")
+	assert.Equal(t, http.StatusCreated, status)
+	status, _ = doJSON(t, app, http.MethodPut, "/api/reactions/comment/"+commentID+"/haha/toggle", "user-1", "")
+	assert.Equal(t, http.StatusCreated, status)
+
+	status, summary := doJSON(t, app, http.MethodGet, "/api/reactions/post/"+postID+"/summary?reactors=2", "user-2", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(4), summary["total"])
+	types := summary["types"].([]interface{})
+	assert.Len(t, types, 2)
+	like := types[0].(map[string]interface{})
+	assert.Equal(t, "like", like["type"])
+	assert.Equal(t, float64(3), like["count"])
+	assert.Len(t, like["recent_users"], 2)
+	assert.ElementsMatch(t, []interface{}{"like", "love"}, summary["mine"])
+
+	status, _ = doJSON(t, app, http.MethodGet, "/api/reactions/post/"+postID+"/summary?reactors=100", "", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = doJSON(t, app, http.MethodGet, "/api/reactions/user/"+postID+"/summary", "", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Posts and comments only carry summaries when asked to
+	status, result := doJSON(t, app, http.MethodGet, "/api/posts/"+postID, "", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotContains(t, result, "reactions")
+
+	status, result = doJSON(t, app, http.MethodGet, "/api/posts/"+postID+"?include=reactions", "user-3", "")
+	assert.Equal(t, http.StatusOK, status)
+	reactions := result["reactions"].(map[string]interface{})
+	assert.Equal(t, float64(4), reactions["total"])
+	assert.Equal(t, []interface{}{"like"}, reactions["mine"])
+
+	status, result = doJSON(t, app, http.MethodGet, "/api/posts?include=reactions", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	data := result["data"].([]interface{})
+	assert.Len(t, data, 1)
+	reactions = data[0].(map[string]interface{})["reactions"].(map[string]interface{})
+	assert.Equal(t, float64(4), reactions["total"])
+	assert.Empty(t, reactions["mine"])
+
+	status, result = doJSON(t, app, http.MethodGet, "/api/comments/post/"+postID+"?include=reactions", "user-1", "")
+	assert.Equal(t, http.StatusOK, status)
+	data = result["data"].([]interface{})
+	reactions = data[0].(map[string]interface{})["reactions"].(map[string]interface{})
+	assert.Equal(t, float64(1), reactions["total"])
+	assert.Equal(t, []interface{}{"haha"}, reactions["mine"])
+
+	status, _ = doJSON(t, app, http.MethodGet, "/api/posts?include=everything", "", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+// Test the reaction type registry and exclusive reactions
+func TestReactionTypes(t *testing.T) {
+	viper.Set("REACTION_MODES", "post:exclusive")
+	defer viper.Set("REACTION_MODES", "")
+	app := setupMemoryApp(t)
+
+	status, post := doJSONAs(t, app, http.MethodPost, "/api/posts", "user-1", "", `{"content":"Hello"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	postID := post["id"].(string)
+	status, comment := doJSONAs(t, app, http.MethodPost, "/api/comments", "user-1", "", `{"post_id":"`+postID+`","content":"Hi"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	commentID := comment["id"].(string)
+
+	// Only registered types are accepted
+	status, _ = doJSONAs(t, app, http.MethodPost, "/api/reactions", "user-2", "", `{"target_id":"`+postID+`","target_type":"post","type":"junk"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = doJSONAs(t, app, http.MethodPut, "/api/reactions/post/"+postID+"/parrot/toggle", "user-2", "", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Admins add custom types to their tenant
+	parrot := `{"name":"parrot","image_url":"https://example.com/parrot.gif"}`
+	status, _ = doJSONAs(t, app, http.MethodPost, "/api/admin/reaction-types", "user-2", "", parrot)
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = doJSONAs(t, app, http.MethodPost, "/api/admin/reaction-types", "admin-1", "admin", `{"name":"like","image_url":"https://example.com/like.gif"}`)
+	assert.Equal(t, http.StatusConflict, status)
+	status, _ = doJSONAs(t, app, http.MethodPost, "/api/admin/reaction-types", "admin-1", "admin", `{"name":"Party Parrot","image_url":"https://example.com/parrot.gif"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = doJSONAs(t, app, http.MethodPost, "/api/admin/reaction-types", "admin-1", "admin", `{"name":"parrot","image_url":"javascript:alert(1)"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = doJSONAs(t, app, http.MethodPost, "/api/admin/reaction-types", "admin-1", "admin", parrot)
+	assert.Equal(t, http.StatusCreated, status)
+	status, _ = doJSONAs(t, app, http.MethodPost, "/api/admin/reaction-types", "admin-1", "admin", parrot)
+	assert.Equal(t, http.StatusConflict, status)
+
+	status, result := doJSONAs(t, app, http.MethodGet, "/api/reactions/types", "user-2", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	types := result["types"].([]interface{})
+	assert.Len(t, types, len(api.DefaultReactionTypes)+1)
+	custom := types[len(types)-1].(map[string]interface{})
+	assert.Equal(t, "parrot", custom["name"])
+	assert.Equal(t, "https://example.com/parrot.gif", custom["image_url"])
+	assert.Equal(t, map[string]interface{}{"post": "exclusive", "comment": "multi"}, result["modes"])
+
+	// Reactions to posts replace each other, reactions to comments add up
+	for _, reactionType := range []string{"like", "parrot"} {
+		status, _ = doJSONAs(t, app, http.MethodPut, "/api/reactions/post/"+postID+"/"+reactionType+"/toggle", "user-2", "", "")
+		assert.Equal(t, http.StatusCreated, status)
+		status, _ = doJSONAs(t, app, http.MethodPut, "/api/reactions/comment/"+commentID+"/"+reactionType+"/toggle", "user-2", "", "")
+		assert.Equal(t, http.StatusCreated, status)
+	}
+	status, summary := doJSONAs(t, app, http.MethodGet, "/api/reactions/post/"+postID+"/summary", "user-2", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(1), summary["total"])
+	assert.Equal(t, []interface{}{"parrot"}, summary["mine"])
+	status, summary = doJSONAs(t, app, http.MethodGet, "/api/reactions/comment/"+commentID+"/summary", "user-2", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(2), summary["total"])
+
+	// Deleted custom types can no longer be used
+	status, _ = doJSONAs(t, app, http.MethodDelete, "/api/admin/reaction-types/parrot", "admin-1", "admin", "")
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = doJSONAs(t, app, http.MethodDelete, "/api/admin/reaction-types/parrot", "admin-1", "admin", "")
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = doJSONAs(t, app, http.MethodPost, "/api/reactions", "user-3", "", `{"target_id":"`+postID+`","target_type":"post","type":"parrot"}`)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+// Test reading the reaction configuration
+func TestLoadReactionRules(t *testing.T) {
+	defer viper.Set("REACTION_TYPES", "")
+	defer viper.Set("REACTION_MODES", "")
+
+	rules, err := api.LoadReactionRules()
+	assert.Nil(t, err)
+	assert.Equal(t, api.DefaultReactionTypes, rules.Types)
+	assert.Equal(t, api.ReactionModeMulti, rules.Modes["post"])
+
+	viper.Set("REACTION_TYPES", "up, down")
+	viper.Set("REACTION_MODES", "comment:exclusive")
+	rules, err = api.LoadReactionRules()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"up", "down"}, rules.Types)
+	assert.Equal(t, api.ReactionModeExclusive, rules.Modes["comment"])
+
+	for _, modes := range []string{"comment", "comment:single", "user:exclusive"} {
+		viper.Set("REACTION_MODES", modes)
+		_, err = api.LoadReactionRules()
+		assert.Error(t, err, modes)
+	}
+	viper.Set("REACTION_MODES", "")
+	viper.Set("REACTION_TYPES", "like,Thumbs Up")
+	_, err = api.LoadReactionRules()
+	assert.Error(t, err)
+}
+
+func TestModeration(t *testing.T) {
+	app := setupMemoryApp(t)
+
+	status, post := doJSONAs(t, app, http.MethodPost, "/api/posts", "user-1", "", `{"content":"abuse"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	postID := post["id"].(string)
+	status, comment := doJSONAs(t, app, http.MethodPost, "/api/comments", "user-1", "", `{"post_id":"`+postID+`","content":"more abuse"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	commentID := comment["id"].(string)
+
+	// Only moderators hide content, and they must say why
+	status, _ = doJSONAs(t, app, http.MethodPost, "/api/posts/"+postID+"/hide", "user-2", "", `{"reason":"abuse"}`)
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = doJSONAs(t, app, http.MethodPost, "/api/posts/"+postID+"/hide", "mod-1", "moderator", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, post = doJSONAs(t, app, http.MethodPost, "/api/posts/"+postID+"/hide", "mod-1", "moderator", `{"reason":"abuse"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotNil(t, post["hidden_at"])
+
+	// Hidden posts are only shown to their author and moderators
+	status, result := doJSONAs(t, app, http.MethodGet, "/api/posts", "user-2", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, result["data"])
+	status, _ = doJSONAs(t, app, http.MethodGet, "/api/posts/"+postID, "user-2", "", "")
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = doJSONAs(t, app, http.MethodGet, "/api/posts/"+postID, "user-1", "", "")
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = doJSONAs(t, app, http.MethodGet, "/api/posts/"+postID, "mod-1", "moderator", "")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, post = doJSONAs(t, app, http.MethodPost, "/api/posts/"+postID+"/unhide", "mod-1", "moderator", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Nil(t, post["hidden_at"])
+	status, _ = doJSONAs(t, app, http.MethodGet, "/api/posts/"+postID, "user-2", "", "")
+	assert.Equal(t, http.StatusOK, status)
+
+	// Other users cannot delete the comment; moderators can, with a reason
+	status, _ = doJSONAs(t, app, http.MethodDelete, "/api/comments/"+commentID+"?reason=abuse", "user-2", "", "")
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = doJSONAs(t, app, http.MethodDelete, "/api/comments/"+commentID, "mod-1", "moderator", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = doJSONAs(t, app, http.MethodDelete, "/api/comments/"+commentID, "mod-1", "moderator", `{"reason":"harassment"}`)
+	assert.Equal(t, http.StatusNoContent, status)
+	status, reaction := doJSONAs(t, app, http.MethodPost, "/api/reactions", "user-1", "", `{"target_id":"`+postID+`","target_type":"post","type":"like"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	status, _ = doJSONAs(t, app, http.MethodDelete, "/api/reactions/"+reaction["id"].(string)+"?reason=brigading", "mod-1", "moderator", "")
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = doJSONAs(t, app, http.MethodDelete, "/api/posts/"+postID+"?reason=abuse", "admin-1", "admin", "")
+	assert.Equal(t, http.StatusNoContent, status)
+
+	// Every action is logged, with who did it and why
+	status, _ = doJSONAs(t, app, http.MethodGet, "/api/moderation/actions", "user-2", "", "")
+	assert.Equal(t, http.StatusForbidden, status)
+	status, result = doJSONAs(t, app, http.MethodGet, "/api/moderation/actions", "mod-1", "moderator", "")
+	assert.Equal(t, http.StatusOK, status)
+	actions := result["data"].([]interface{})
+	assert.Len(t, actions, 5)
+	latest := actions[0].(map[string]interface{})
+	assert.Equal(t, "delete", latest["action"])
+	assert.Equal(t, "post", latest["target_type"])
+	assert.Equal(t, postID, latest["target_id"])
+	assert.Equal(t, "user-1", latest["author_id"])
+	assert.Equal(t, "admin-1", latest["moderator_id"])
+	assert.Equal(t, "abuse", latest["reason"])
+}
+
+// Test that admins inspect and replay the dead-lettered hook events of their tenant
+func TestDeadLetteredEvents(t *testing.T) {
+	viper.Set("HOOKS_ENABLED", true)
+	defer viper.Set("HOOKS_ENABLED", false)
+	manager := hooks.DefaultHookManager
+	hooks.DefaultHookManager = hooks.NewHookManager()
+	defer func() { hooks.DefaultHookManager = manager }()
+
+	var failing atomic.Bool
+	failing.Store(true)
+	hooks.DefaultHookManager.Register(hooks.EventPostCreated, func(event hooks.Event) error {
+		if failing.Load() {
+			return errors.New("receiver unavailable")
+		}
+		return nil
+	})
+
+	app, db := setupMemoryAppWithDB(t)
+	dispatcher := &hooks.Dispatcher{Outbox: db, BatchSize: 10, Lease: time.Minute, MaxAttempts: 1}
+
+	status, _ := doJSON(t, app, http.MethodPost, "/api/posts", "user-1", `{"content":"Hello"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	delivered, err := dispatcher.DispatchPending(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 0, delivered)
+
+	status, _ = doJSON(t, app, http.MethodGet, "/api/admin/hook-events/dead-lettered", "user-1", "")
+	assert.Equal(t, http.StatusForbidden, status)
+	status, result := doJSONAs(t, app, http.MethodGet, "/api/admin/hook-events/dead-lettered", "user-1", "admin", "")
+	assert.Equal(t, http.StatusOK, status)
+	events := result["data"].([]interface{})
+	assert.Len(t, events, 1)
+	event := events[0].(map[string]interface{})
+	assert.Equal(t, "receiver unavailable", event["last_error"])
+	assert.Equal(t, "post_created", event["payload"].(map[string]interface{})["type"])
+	eventID := event["id"].(string)
+
+	status, found := doJSONAs(t, app, http.MethodGet, "/api/admin/hook-events/"+eventID, "user-1", "admin", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.NotNil(t, found["dead_lettered_at"])
+
+	// Replayed events are delivered again, and can't be replayed twice
+	failing.Store(false)
+	status, replayed := doJSONAs(t, app, http.MethodPost, "/api/admin/hook-events/"+eventID+"/replay", "user-1", "admin", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Nil(t, replayed["dead_lettered_at"])
+	status, _ = doJSONAs(t, app, http.MethodPost, "/api/admin/hook-events/"+eventID+"/replay", "user-1", "admin", "")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	delivered, err = dispatcher.DispatchPending(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, delivered)
+	status, result = doJSONAs(t, app, http.MethodGet, "/api/admin/hook-events/dead-lettered", "user-1", "admin", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, result["data"])
+}
+
+// Test that admins manage the webhook subscriptions of their tenant, whose
+// secrets are only returned when created or rotated
+func TestWebhookSubscriptions(t *testing.T) {
+	app, db := setupMemoryAppWithDB(t)
+	asAdmin := userHeaders("user-1", "admin")
+
+	status, _ := doRequest(t, app, http.MethodPost, "/api/admin/webhooks", userHeaders("user-1", ""), `{"url":"https://example.com/hooks"}`)
+	assert.Equal(t, http.StatusForbidden, status)
+	for _, body := range []string{
+		`{"url":"ftp://example.com/hooks"}`,
+		`{"url":"https://example.com/hooks","event_types":["post_liked"]}`,
+		`{"url":"https://example.com/hooks","post_ids":["post-1,post-2"]}`,
+		`{"url":"https://example.com/hooks","user_ids":[""]}`,
+	} {
+		status, _ = doRequest(t, app, http.MethodPost, "/api/admin/webhooks", asAdmin, body)
+		assert.Equal(t, http.StatusBadRequest, status, body)
+	}
+
+	status, body := doRequest(t, app, http.MethodPost, "/api/admin/webhooks", asAdmin, `{"url":"https://example.com/hooks","event_types":["comment_created"],"post_ids":["post-1"]}`)
+	assert.Equal(t, http.StatusCreated, status)
+	var created map[string]interface{}
+	assert.Nil(t, json.Unmarshal(body, &created))
+	id := created["id"].(string)
+	secret := created["secret"].(string)
+	assert.True(t, strings.HasPrefix(secret, "whsec_"))
+	assert.Equal(t, true, created["enabled"])
+	assert.Equal(t, []interface{}{}, created["user_ids"])
+
+	status, body = doRequest(t, app, http.MethodGet, "/api/admin/webhooks", asAdmin, "")
+	assert.Equal(t, http.StatusOK, status)
+	var subscriptions []map[string]interface{}
+	assert.Nil(t, json.Unmarshal(body, &subscriptions))
+	assert.Len(t, subscriptions, 1)
+	assert.Equal(t, id, subscriptions[0]["id"])
+	assert.NotContains(t, subscriptions[0], "secret")
+	assert.Equal(t, float64(0), subscriptions[0]["stats"].(map[string]interface{})["delivered_count"])
+
+	// Updates replace the filters, keeping the secret
+	status, body = doRequest(t, app, http.MethodPut, "/api/admin/webhooks/"+id, asAdmin, `{"url":"https://example.com/other","enabled":false}`)
+	assert.Equal(t, http.StatusOK, status)
+	var updated map[string]interface{}
+	assert.Nil(t, json.Unmarshal(body, &updated))
+	assert.Equal(t, "https://example.com/other", updated["url"])
+	assert.Equal(t, false, updated["enabled"])
+	assert.Equal(t, []interface{}{}, updated["event_types"])
+	found, err := db.GetWebhookSubscription(context.Background(), id)
+	assert.Nil(t, err)
+	assert.Equal(t, secret, found.Secret)
+
+	// Rotating keeps the previous secret until it is removed
+	status, body = doRequest(t, app, http.MethodPost, "/api/admin/webhooks/"+id+"/rotate-secret", asAdmin, "")
+	assert.Equal(t, http.StatusOK, status)
+	var rotated map[string]interface{}
+	assert.Nil(t, json.Unmarshal(body, &rotated))
+	assert.NotEqual(t, secret, rotated["secret"])
+	found, err = db.GetWebhookSubscription(context.Background(), id)
+	assert.Nil(t, err)
+	assert.Equal(t, rotated["secret"], found.Secret)
+	assert.Equal(t, secret, found.PreviousSecret)
+	status, _ = doRequest(t, app, http.MethodDelete, "/api/admin/webhooks/"+id+"/previous-secret", asAdmin, "")
+	assert.Equal(t, http.StatusNoContent, status)
+	found, err = db.GetWebhookSubscription(context.Background(), id)
+	assert.Nil(t, err)
+	assert.Empty(t, found.PreviousSecret)
+
+	status, _ = doRequest(t, app, http.MethodDelete, "/api/admin/webhooks/"+id, asAdmin, "")
+	assert.Equal(t, http.StatusNoContent, status)
+	status, _ = doRequest(t, app, http.MethodGet, "/api/admin/webhooks/"+id, asAdmin, "")
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = doRequest(t, app, http.MethodPut, "/api/admin/webhooks/"+id, asAdmin, `{"url":"https://example.com/hooks"}`)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+// Test that events are sent to a webhook subscription again, and that the
+// attempts are listed
+func TestResendWebhookEvents(t *testing.T) {
+	viper.Set("HOOKS_ENABLED", true)
+	defer viper.Set("HOOKS_ENABLED", false)
+	// The test server listens on loopback
+	viper.Set("WEBHOOK_ALLOW_PRIVATE", true)
+	defer viper.Set("WEBHOOK_ALLOW_PRIVATE", false)
+	manager := hooks.DefaultHookManager
+	hooks.DefaultHookManager = hooks.NewHookManager()
+	defer func() { hooks.DefaultHookManager = manager }()
+
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer server.Close()
+
+	app, db := setupMemoryAppWithDB(t)
+	dispatcher := &hooks.Dispatcher{Outbox: db, BatchSize: 10, Lease: time.Minute}
+
+	// The subscription only receives comments, so it misses the post
+	status, subscription := doJSONAs(t, app, http.MethodPost, "/api/admin/webhooks", "user-1", "admin", `{"url":"`+server.URL+`","event_types":["comment_created"]}`)
+	assert.Equal(t, http.StatusCreated, status)
+	id := subscription["id"].(string)
+	since := time.Now().Add(-time.Minute).Format(time.RFC3339Nano)
+	status, _ = doJSONAs(t, app, http.MethodPost, "/api/posts", "user-1", "admin", `{"content":"Hello"}`)
+	assert.Equal(t, http.StatusCreated, status)
+	until := time.Now().Add(time.Minute).Format(time.RFC3339Nano)
+	delivered, err := dispatcher.DispatchPending(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Equal(t, int32(0), received.Load())
+
+	events, err := db.ListEvents(context.Background(), time.Time{}, time.Now(), 10)
+	assert.Nil(t, err)
+	assert.Len(t, events, 1)
+	eventID := events[0].ID
+
+	for _, body := range []string{
+		`{}`,
+		`{"event_id":"` + eventID + `","since":"` + since + `","until":"` + until + `"}`,
+		`{"since":"` + until + `","until":"` + since + `"}`,
+	} {
+		status, _ = doJSONAs(t, app, http.MethodPost, "/api/admin/webhooks/"+id+"/resend", "user-1", "admin", body)
+		assert.Equal(t, http.StatusBadRequest, status, body)
+	}
+	status, _ = doJSONAs(t, app, http.MethodPost, "/api/admin/webhooks/"+id+"/resend", "user-1", "admin", `{"event_id":"missing"}`)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// Time windows only resend the events matching the filters, while an
+	// event is resent as asked
+	status, result := doJSONAs(t, app, http.MethodPost, "/api/admin/webhooks/"+id+"/resend", "user-1", "admin", `{"since":"`+since+`","until":"`+until+`"}`)
+	assert.Equal(t, http.StatusAccepted, status)
+	assert.Equal(t, float64(0), result["resent"])
+	status, result = doJSONAs(t, app, http.MethodPost, "/api/admin/webhooks/"+id+"/resend", "user-1", "admin", `{"event_id":"`+eventID+`"}`)
+	assert.Equal(t, http.StatusAccepted, status)
+	assert.Equal(t, float64(1), result["resent"])
+
+	delivered, err = dispatcher.DispatchPending(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Equal(t, int32(1), received.Load())
+
+	status, result = doJSONAs(t, app, http.MethodGet, "/api/admin/webhook-deliveries?subscription_id="+id, "user-1", "admin", "")
+	assert.Equal(t, http.StatusOK, status)
+	deliveries := result["data"].([]interface{})
+	assert.Len(t, deliveries, 1)
+	delivery := deliveries[0].(map[string]interface{})
+	assert.Equal(t, eventID, delivery["event_id"])
+	assert.Equal(t, float64(http.StatusOK), delivery["status_code"])
+	assert.Equal(t, float64(1), delivery["attempt"])
+	status, result = doJSONAs(t, app, http.MethodGet, "/api/admin/webhook-deliveries?failed=true", "user-1", "admin", "")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, result["data"])
+	status, _ = doJSONAs(t, app, http.MethodGet, "/api/admin/webhook-deliveries?failed=maybe", "user-1", "admin", "")
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Disabled subscriptions receive nothing
+	status, _ = doJSONAs(t, app, http.MethodPut, "/api/admin/webhooks/"+id, "user-1", "admin", `{"url":"`+server.URL+`","enabled":false}`)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = doJSONAs(t, app, http.MethodPost, "/api/admin/webhooks/"+id+"/resend", "user-1", "admin", `{"event_id":"`+eventID+`"}`)
+	assert.Equal(t, http.StatusConflict, status)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+
+	"sonet/internal/adapters"
+	"sonet/internal/models"
+)
+
+// HookEvent is a hook event of the outbox, with its payload as JSON rather
+// than a string
+type HookEvent struct {
+	*models.OutboxEvent
+	Payload json.RawMessage `json:"payload"`
+}
+
+// newHookEvent returns the response of an outbox event
+func newHookEvent(event *models.OutboxEvent) HookEvent {
+	return HookEvent{OutboxEvent: event, Payload: json.RawMessage(event.Payload)}
+}
+
+// Hook event handlers. Admins see the events of their tenant.
+func listDeadLetteredEvents(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		p, err := getPagination(c)
+		if err != nil {
+			return err
+		}
+
+		events, err := db.ListDeadLetteredEvents(c.UserContext(), withLookahead(p))
+		if err != nil {
+			return err
+		}
+		events, hasMore := trimPage(events, p.Limit)
+
+		data := make([]HookEvent, len(events))
+		for i, event := range events {
+			data[i] = newHookEvent(event)
+		}
+
+		var last *adapters.Cursor
+		if len(events) > 0 {
+			event := events[len(events)-1]
+			last = &adapters.Cursor{CreatedAt: event.CreatedAt, ID: event.ID}
+		}
+
+		return c.JSON(fiber.Map{
+			"data": data,
+			"meta": paginationMeta(c, p, len(events), hasMore, last),
+		})
+	}
+}
+
+func getHookEvent(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		if id == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid event ID")
+		}
+
+		event, err := db.GetEvent(c.UserContext(), id)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(newHookEvent(event))
+	}
+}
+
+// replayHookEvent makes a dead-lettered event due for delivery again, with a
+// fresh set of attempts
+func replayHookEvent(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		if id == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid event ID")
+		}
+
+		event, err := db.ReplayEvent(c.UserContext(), id)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(newHookEvent(event))
+	}
+}
@@ -1,14 +1,22 @@
 package api
 
 import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/spf13/viper"
+
+	"sonet/internal/adapters"
+	"sonet/internal/auth"
 )
 
-// RateLimiterMiddleware creates a rate limiter middleware
+// RateLimiterMiddleware creates a rate limiter middleware. API keys with a
+// rate limit of their own are limited by it instead of RATE_LIMIT_REQUESTS.
 func RateLimiterMiddleware() fiber.Handler {
 	if !viper.GetBool("RATE_LIMIT_ENABLED") {
 		// Return a no-op middleware if rate limiting is disabled
@@ -28,23 +36,98 @@ func RateLimiterMiddleware() fiber.Handler {
 		duration = 60
 	}
 
-	// Create the rate limiter
-	return limiter.New(limiter.Config{
-		Max:        max,
-		Expiration: time.Duration(duration) * time.Second,
-		KeyGenerator: func(c *fiber.Ctx) string {
-			// Use X-User-ID as the rate limiting key if available
-			// Otherwise use the remote IP
-			userID := c.Get("X-User-ID")
-			if userID != "" {
-				return "user:" + userID
+	// Create a rate limiter for a number of requests per duration
+	newLimiter := func(max int) fiber.Handler {
+		return limiter.New(limiter.Config{
+			Max:        max,
+			Expiration: time.Duration(duration) * time.Second,
+			KeyGenerator: func(c *fiber.Ctx) string {
+				// Use the authenticated user as the rate limiting key if available
+				// Otherwise use the remote IP
+				userID := auth.UserID(c)
+				if userID != "" {
+					return "user:" + getTenantID(c) + ":" + userID
+				}
+				return c.IP()
+			},
+			LimitReached: func(c *fiber.Ctx) error {
+				return c.Status(fiber.StatusTooManyRequests).JSON(ErrorResponse{
+					Error: "Rate limit exceeded",
+				})
+			},
+		})
+	}
+
+	defaultLimiter := newLimiter(max)
+	var mu sync.Mutex
+	keyLimiters := make(map[int]fiber.Handler) // Limiters of API keys, by rate limit
+
+	return func(c *fiber.Ctx) error {
+		identity := auth.FromContext(c)
+		if identity == nil || identity.APIKey == nil || identity.APIKey.RateLimit <= 0 {
+			return defaultLimiter(c)
+		}
+
+		limit := identity.APIKey.RateLimit
+		mu.Lock()
+		keyLimiter, ok := keyLimiters[limit]
+		if !ok {
+			keyLimiter = newLimiter(limit)
+			keyLimiters[limit] = keyLimiter
+		}
+		mu.Unlock()
+		return keyLimiter(c)
+	}
+}
+
+// QueryTimeoutMiddleware bounds the time database queries may take for a request.
+// Handlers pass c.UserContext() to the database adapter, so the deadline set here
+// cancels any query still running when it expires.
+func QueryTimeoutMiddleware() fiber.Handler {
+	timeout := viper.GetInt("DB_QUERY_TIMEOUT")
+	if timeout <= 0 {
+		// Return a no-op middleware if the query timeout is disabled
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(c.UserContext(), time.Duration(timeout)*time.Second)
+		defer cancel()
+
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
+
+// tenantIDPattern matches valid tenant IDs
+var tenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// TenantMiddleware resolves the tenant a request is made for, so that the
+// database adapter only sees that tenant's records. The tenant named by the
+// request's credentials wins, as does the tenant of an API key, even the
+// default tenant; so does the default tenant for users with roles whose
+// credentials name none, since roles grant scopes within one tenant only.
+// Anonymous requests, and other credentials that name no tenant, use the
+// X-Tenant-ID header. Requests naming neither use the default tenant. Must
+// run after the authentication middleware.
+func TenantMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Header values are only valid until the request completes, so keep a copy
+		tenantID := strings.Clone(c.Get(auth.HeaderTenantID))
+		if identity := auth.FromContext(c); identity != nil && (identity.TenantID != "" || identity.APIKey != nil || len(identity.Roles) > 0) {
+			if tenantID != "" && tenantID != identity.TenantID {
+				return fiber.NewError(fiber.StatusForbidden, "Credentials are not valid for tenant "+tenantID)
 			}
-			return c.IP()
-		},
-		LimitReached: func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusTooManyRequests).JSON(ErrorResponse{
-				Error: "Rate limit exceeded",
-			})
-		},
-	})
+			tenantID = identity.TenantID
+		}
+
+		if tenantID != "" && !tenantIDPattern.MatchString(tenantID) {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid tenant ID")
+		}
+
+		c.SetUserContext(adapters.WithTenant(c.UserContext(), tenantID))
+		return c.Next()
+	}
 }
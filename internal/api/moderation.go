@@ -0,0 +1,191 @@
+package api
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"sonet/internal/adapters"
+	"sonet/internal/auth"
+	"sonet/internal/hooks"
+	"sonet/internal/models"
+)
+
+// ModerationInput is the request body of moderation actions
+type ModerationInput struct {
+	Reason string `json:"reason"`
+}
+
+// maxReasonLength bounds the reasons given for moderation actions
+const maxReasonLength = 1000
+
+// newModeration starts the moderation action of a request on another user's
+// post or comment. It rejects requests without the moderation scope, and
+// requires a reason, in the JSON body or the reason query parameter, for
+// anything but unhiding.
+func newModeration(c *fiber.Ctx, action, targetType, targetID, authorID string) (*models.ModerationAction, error) {
+	moderatorID, err := requireScope(c, auth.ScopeModeration)
+	if err != nil {
+		return nil, err
+	}
+
+	// Query values are only valid until the request completes, so keep a copy
+	input := ModerationInput{Reason: strings.Clone(c.Query("reason"))}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&input); err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+	if input.Reason == "" && action != models.ModerationUnhide {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "A reason is required to moderate content")
+	}
+	if len(input.Reason) > maxReasonLength {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Reason is too long")
+	}
+
+	return &models.ModerationAction{
+		Action:      action,
+		TargetType:  targetType,
+		TargetID:    targetID,
+		AuthorID:    authorID,
+		ModeratorID: moderatorID,
+		Reason:      input.Reason,
+	}, nil
+}
+
+// recordModeration logs a moderation action that was carried out and triggers
+// its hook, within the transaction of tx
+func recordModeration(c *fiber.Ctx, tx adapters.DatabaseAdapter, action *models.ModerationAction) error {
+	if err := tx.CreateModerationAction(c.UserContext(), action); err != nil {
+		return err
+	}
+
+	return hooks.TriggerContentModerated(c.UserContext(), tx, getTenantID(c), action.ModeratorID, action)
+}
+
+// hiddenAt returns the time content hidden now is hidden at, or nil to unhide it
+func hiddenAt(hide bool) *time.Time {
+	if !hide {
+		return nil
+	}
+	now := time.Now()
+	return &now
+}
+
+// Moderation handlers
+func setPostHidden(db adapters.DatabaseAdapter, hide bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		if id == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid post ID")
+		}
+
+		action := models.ModerationHide
+		if !hide {
+			action = models.ModerationUnhide
+		}
+		if _, err := requireScope(c, auth.ScopeModeration); err != nil {
+			return err
+		}
+
+		post, err := db.GetPostByID(c.UserContext(), id)
+		if err != nil {
+			return err
+		}
+
+		moderation, err := newModeration(c, action, "post", post.ID, post.UserID)
+		if err != nil {
+			return err
+		}
+
+		// Hiding hidden posts, or unhiding visible ones, changes nothing
+		if (post.HiddenAt != nil) == hide {
+			return c.JSON(post)
+		}
+
+		post.HiddenAt = hiddenAt(hide)
+		err = db.Transaction(c.UserContext(), func(tx adapters.DatabaseAdapter) error {
+			if err := tx.UpdatePost(c.UserContext(), post); err != nil {
+				return err
+			}
+			return recordModeration(c, tx, moderation)
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(post)
+	}
+}
+
+func setCommentHidden(db adapters.DatabaseAdapter, hide bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		if id == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid comment ID")
+		}
+
+		action := models.ModerationHide
+		if !hide {
+			action = models.ModerationUnhide
+		}
+		if _, err := requireScope(c, auth.ScopeModeration); err != nil {
+			return err
+		}
+
+		comment, err := db.GetCommentByID(c.UserContext(), id)
+		if err != nil {
+			return err
+		}
+
+		moderation, err := newModeration(c, action, "comment", comment.ID, comment.UserID)
+		if err != nil {
+			return err
+		}
+
+		// Hiding hidden comments, or unhiding visible ones, changes nothing
+		if (comment.HiddenAt != nil) == hide {
+			return c.JSON(comment)
+		}
+
+		comment.HiddenAt = hiddenAt(hide)
+		err = db.Transaction(c.UserContext(), func(tx adapters.DatabaseAdapter) error {
+			if err := tx.UpdateComment(c.UserContext(), comment); err != nil {
+				return err
+			}
+			return recordModeration(c, tx, moderation)
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(comment)
+	}
+}
+
+func listModerationActions(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		p, err := getPagination(c)
+		if err != nil {
+			return err
+		}
+
+		actions, err := db.ListModerationActions(c.UserContext(), withLookahead(p))
+		if err != nil {
+			return err
+		}
+		actions, hasMore := trimPage(actions, p.Limit)
+
+		var last *adapters.Cursor
+		if len(actions) > 0 {
+			action := actions[len(actions)-1]
+			last = &adapters.Cursor{CreatedAt: action.CreatedAt, ID: action.ID}
+		}
+
+		return c.JSON(fiber.Map{
+			"data": actions,
+			"meta": paginationMeta(c, p, len(actions), hasMore, last),
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+
+	"sonet/internal/adapters"
+	"sonet/internal/hooks"
+	"sonet/internal/models"
+)
+
+// Reaction modes of target types, see REACTION_MODES
+const (
+	ReactionModeMulti     = "multi"     // Users react with any number of types, like Slack
+	ReactionModeExclusive = "exclusive" // Users hold one reaction at a time, like Facebook
+)
+
+// DefaultReactionTypes are the reaction types of every tenant when
+// REACTION_TYPES is not set
+var DefaultReactionTypes = []string{"like", "love", "haha", "wow", "sad", "angry"}
+
+// reactionTypeName matches the names of reaction types
+var reactionTypeName = regexp.MustCompile(`^[a-z0-9_+-]{1,32}$`)
+
+// ReactionRules are the reaction types of every tenant, which tenants may add
+// custom types to, and the reaction mode of each target type
+type ReactionRules struct {
+	Types []string
+	Modes map[string]string // By target type, "post" or "comment"
+}
+
+// LoadReactionRules reads the reaction rules from REACTION_TYPES, a
+// comma-separated list of types, and REACTION_MODES, a list of
+// targetType:mode pairs. Target types without a mode are multi-reaction.
+func LoadReactionRules() (*ReactionRules, error) {
+	rules := &ReactionRules{
+		Types: DefaultReactionTypes,
+		Modes: map[string]string{"post": ReactionModeMulti, "comment": ReactionModeMulti},
+	}
+
+	if types := viper.GetString("REACTION_TYPES"); strings.TrimSpace(types) != "" {
+		rules.Types = nil
+		for _, name := range strings.Split(types, ",") {
+			name = strings.TrimSpace(name)
+			if !reactionTypeName.MatchString(name) {
+				return nil, fmt.Errorf("invalid REACTION_TYPES entry %q, expected up to 32 lowercase letters, digits, _, + or -", name)
+			}
+			rules.Types = append(rules.Types, name)
+		}
+	}
+
+	for _, pair := range strings.Split(viper.GetString("REACTION_MODES"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		targetType, mode, ok := strings.Cut(pair, ":")
+		targetType, mode = strings.TrimSpace(targetType), strings.TrimSpace(mode)
+		if _, known := rules.Modes[targetType]; !ok || !known || (mode != ReactionModeMulti && mode != ReactionModeExclusive) {
+			return nil, fmt.Errorf("invalid REACTION_MODES entry %q, expected post or comment:multi or exclusive", pair)
+		}
+		rules.Modes[targetType] = mode
+	}
+
+	return rules, nil
+}
+
+// builtIn reports whether a reaction type is one of every tenant
+func (r *ReactionRules) builtIn(name string) bool {
+	for _, t := range r.Types {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// exclusive reports whether users hold one reaction at a time to targets of a type
+func (r *ReactionRules) exclusive(targetType string) bool {
+	return r.Modes[targetType] == ReactionModeExclusive
+}
+
+// checkType verifies that a reaction type exists in the tenant of the request
+func (r *ReactionRules) checkType(c *fiber.Ctx, db adapters.DatabaseAdapter, name string) error {
+	if r.builtIn(name) {
+		return nil
+	}
+
+	_, err := db.GetReactionType(c.UserContext(), name)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fiber.NewError(fiber.StatusBadRequest, "Unknown reaction type")
+	}
+	return err
+}
+
+// addReaction adds a reaction according to the mode of its target type,
+// triggering hooks for the reactions it adds and replaces within the
+// transaction of tx
+func (r *ReactionRules) addReaction(c *fiber.Ctx, tx adapters.DatabaseAdapter, reaction *models.Reaction) (bool, error) {
+	if !r.exclusive(reaction.TargetType) {
+		created, err := tx.AddReaction(c.UserContext(), reaction)
+		if err != nil || !created {
+			return false, err
+		}
+		return true, hooks.TriggerReactionAdded(c.UserContext(), tx, getTenantID(c), reaction.UserID, reaction)
+	}
+
+	created, removed, err := tx.ReplaceReaction(c.UserContext(), reaction)
+	if err != nil {
+		return false, err
+	}
+	for _, previous := range removed {
+		if err := hooks.TriggerReactionRemoved(c.UserContext(), tx, getTenantID(c), reaction.UserID, previous); err != nil {
+			return false, err
+		}
+	}
+	if created {
+		return true, hooks.TriggerReactionAdded(c.UserContext(), tx, getTenantID(c), reaction.UserID, reaction)
+	}
+	return false, nil
+}
+
+// ReactionTypeInfo describes a reaction type of a tenant
+type ReactionTypeInfo struct {
+	Name     string `json:"name"`
+	ImageURL string `json:"image_url,omitempty"` // Set for custom types
+	Custom   bool   `json:"custom"`
+}
+
+// ReactionTypeInput is the request body for creating a custom reaction type
+type ReactionTypeInput struct {
+	Name     string `json:"name"`
+	ImageURL string `json:"image_url"`
+}
+
+// Reaction type handlers
+func listReactionTypes(db adapters.DatabaseAdapter, rules *ReactionRules) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		custom, err := db.ListReactionTypes(c.UserContext())
+		if err != nil {
+			return err
+		}
+
+		types := make([]ReactionTypeInfo, 0, len(rules.Types)+len(custom))
+		for _, name := range rules.Types {
+			types = append(types, ReactionTypeInfo{Name: name})
+		}
+		for _, reactionType := range custom {
+			types = append(types, ReactionTypeInfo{Name: reactionType.Name, ImageURL: reactionType.ImageURL, Custom: true})
+		}
+
+		return c.JSON(fiber.Map{
+			"types": types,
+			"modes": rules.Modes,
+		})
+	}
+}
+
+func createReactionType(db adapters.DatabaseAdapter, rules *ReactionRules) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		input := new(ReactionTypeInput)
+		if err := c.BodyParser(input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+
+		if !reactionTypeName.MatchString(input.Name) {
+			return fiber.NewError(fiber.StatusBadRequest, "Name must be up to 32 lowercase letters, digits, _, + or -")
+		}
+		if rules.builtIn(input.Name) {
+			return fiber.NewError(fiber.StatusConflict, "Reaction type already exists")
+		}
+		imageURL, err := url.Parse(input.ImageURL)
+		if err != nil || (imageURL.Scheme != "http" && imageURL.Scheme != "https") || imageURL.Host == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Image URL must be an http or https URL")
+		}
+
+		reactionType := &models.ReactionType{Name: input.Name, ImageURL: input.ImageURL}
+		if err := db.CreateReactionType(c.UserContext(), reactionType); err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusCreated).JSON(reactionType)
+	}
+}
+
+func deleteReactionType(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		name := c.Params("name")
+		if name == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid reaction type")
+		}
+
+		if err := db.DeleteReactionType(c.UserContext(), name); err != nil {
+			return err
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
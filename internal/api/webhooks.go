@@ -0,0 +1,341 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"sonet/internal/adapters"
+	"sonet/internal/hooks"
+	"sonet/internal/models"
+)
+
+// maxWebhookFilter bounds the values of each filter of a webhook subscription
+const maxWebhookFilter = 100
+
+// WebhookSubscriptionInput is the request body for creating and updating a
+// webhook subscription. Empty filters match every event.
+type WebhookSubscriptionInput struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	PostIDs    []string `json:"post_ids"`
+	UserIDs    []string `json:"user_ids"`
+	Enabled    *bool    `json:"enabled"` // Enabled when created, and unchanged when updated, if omitted
+}
+
+// SecretWebhookSubscription is a webhook subscription along with its secret,
+// which is only returned when it is created or rotated
+type SecretWebhookSubscription struct {
+	*models.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// apply validates the input and sets the fields of a subscription to it
+func (input *WebhookSubscriptionInput) apply(subscription *models.WebhookSubscription) error {
+	target, err := url.Parse(input.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "URL must be an http or https URL")
+	}
+	for _, eventType := range input.EventTypes {
+		if !slices.Contains(hooks.EventTypes, hooks.EventType(eventType)) {
+			return fiber.NewError(fiber.StatusBadRequest, "Unknown event type "+eventType)
+		}
+	}
+	for _, filter := range [][]string{input.EventTypes, input.PostIDs, input.UserIDs} {
+		if len(filter) > maxWebhookFilter {
+			return fiber.NewError(fiber.StatusBadRequest, "Filters are limited to 100 values")
+		}
+		for _, value := range filter {
+			// Filters are stored as comma-separated text
+			if value == "" || strings.Contains(value, ",") {
+				return fiber.NewError(fiber.StatusBadRequest, "Filter values must be non-empty and without commas")
+			}
+		}
+	}
+
+	subscription.URL = input.URL
+	subscription.EventTypes = append(models.StringList{}, input.EventTypes...)
+	subscription.PostIDs = append(models.StringList{}, input.PostIDs...)
+	subscription.UserIDs = append(models.StringList{}, input.UserIDs...)
+	if input.Enabled != nil {
+		subscription.Enabled = *input.Enabled
+	}
+	return nil
+}
+
+// Webhook subscription handlers. Subscriptions are managed within the tenant
+// of the admin key, and receive its events.
+func createWebhookSubscription(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		input := new(WebhookSubscriptionInput)
+		if err := c.BodyParser(input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+
+		subscription := &models.WebhookSubscription{Enabled: true}
+		if err := input.apply(subscription); err != nil {
+			return err
+		}
+		secret, err := hooks.NewSecret()
+		if err != nil {
+			return err
+		}
+		subscription.Secret = secret
+
+		if err := db.CreateWebhookSubscription(c.UserContext(), subscription); err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusCreated).JSON(SecretWebhookSubscription{WebhookSubscription: subscription, Secret: secret})
+	}
+}
+
+func listWebhookSubscriptions(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		subscriptions, err := db.ListWebhookSubscriptions(c.UserContext())
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(subscriptions)
+	}
+}
+
+func getWebhookSubscription(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		if id == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid webhook subscription ID")
+		}
+
+		subscription, err := db.GetWebhookSubscription(c.UserContext(), id)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(subscription)
+	}
+}
+
+// updateWebhookSubscription replaces the URL and filters of a subscription,
+// and enables or disables it
+func updateWebhookSubscription(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		if id == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid webhook subscription ID")
+		}
+
+		input := new(WebhookSubscriptionInput)
+		if err := c.BodyParser(input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+
+		subscription, err := db.GetWebhookSubscription(c.UserContext(), id)
+		if err != nil {
+			return err
+		}
+		if err := input.apply(subscription); err != nil {
+			return err
+		}
+		if err := db.UpdateWebhookSubscription(c.UserContext(), subscription); err != nil {
+			return err
+		}
+
+		return c.JSON(subscription)
+	}
+}
+
+func deleteWebhookSubscription(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		if id == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid webhook subscription ID")
+		}
+
+		if err := db.DeleteWebhookSubscription(c.UserContext(), id); err != nil {
+			return err
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// rotateWebhookSecret gives a subscription a new secret. Events are signed
+// with both the new and the previous secret until the previous secret is
+// removed, so that receivers can move to the new one.
+func rotateWebhookSecret(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		if id == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid webhook subscription ID")
+		}
+
+		subscription, err := db.GetWebhookSubscription(c.UserContext(), id)
+		if err != nil {
+			return err
+		}
+		secret, err := hooks.NewSecret()
+		if err != nil {
+			return err
+		}
+		subscription.PreviousSecret = subscription.Secret
+		subscription.Secret = secret
+		if err := db.UpdateWebhookSubscription(c.UserContext(), subscription); err != nil {
+			return err
+		}
+
+		return c.JSON(SecretWebhookSubscription{WebhookSubscription: subscription, Secret: secret})
+	}
+}
+
+// removePreviousWebhookSecret stops signing a subscription's events with its
+// previous secret, once receivers have moved to the new one
+func removePreviousWebhookSecret(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		if id == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid webhook subscription ID")
+		}
+
+		subscription, err := db.GetWebhookSubscription(c.UserContext(), id)
+		if err != nil {
+			return err
+		}
+		subscription.PreviousSecret = ""
+		if err := db.UpdateWebhookSubscription(c.UserContext(), subscription); err != nil {
+			return err
+		}
+
+		return c.SendStatus(http.StatusNoContent)
+	}
+}
+
+// ResendInput is the request body for sending events to a webhook
+// subscription again: an event, or the events created in a time window
+type ResendInput struct {
+	EventID string    `json:"event_id"`
+	Since   time.Time `json:"since"`
+	Until   time.Time `json:"until"`
+}
+
+// maxResendEvents bounds the events of a time window sent again at once
+const maxResendEvents = 1000
+
+// resendWebhookEvents queues events for delivery to a subscription again,
+// with their original IDs. An event is sent whether or not it matches the
+// subscription's filters; of a time window, only those that match are.
+func resendWebhookEvents(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+		if id == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid webhook subscription ID")
+		}
+
+		input := new(ResendInput)
+		if err := c.BodyParser(input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+		}
+		window := !input.Since.IsZero() || !input.Until.IsZero()
+		if (input.EventID == "") == !window {
+			return fiber.NewError(fiber.StatusBadRequest, "Either event_id or since and until are required")
+		}
+		if window && !input.Since.Before(input.Until) {
+			return fiber.NewError(fiber.StatusBadRequest, "since must be before until")
+		}
+
+		subscription, err := db.GetWebhookSubscription(c.UserContext(), id)
+		if err != nil {
+			return err
+		}
+		if !subscription.Enabled {
+			return fiber.NewError(fiber.StatusConflict, "Webhook subscription is disabled")
+		}
+
+		var events []*models.OutboxEvent
+		if window {
+			events, err = db.ListEvents(c.UserContext(), input.Since, input.Until, maxResendEvents+1)
+			if err != nil {
+				return err
+			}
+			if len(events) > maxResendEvents {
+				return fiber.NewError(fiber.StatusBadRequest, "The time window has more than 1000 events, narrow it")
+			}
+			events = slices.DeleteFunc(events, func(event *models.OutboxEvent) bool {
+				var payload hooks.Event
+				return json.Unmarshal([]byte(event.Payload), &payload) != nil || !hooks.Matches(subscription, payload)
+			})
+		} else {
+			event, err := db.GetEvent(c.UserContext(), input.EventID)
+			if err != nil {
+				return err
+			}
+			events = append(events, event)
+		}
+
+		err = db.Transaction(c.UserContext(), func(tx adapters.DatabaseAdapter) error {
+			for _, event := range events {
+				err := tx.EnqueueEvent(c.UserContext(), &models.OutboxEvent{
+					Type:           event.Type,
+					Payload:        event.Payload,
+					SubscriptionID: subscription.ID,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusAccepted).JSON(fiber.Map{"resent": len(events)})
+	}
+}
+
+// listWebhookDeliveries lists the attempts to send the tenant's events to
+// webhooks, newest first, by subscription, event and outcome
+func listWebhookDeliveries(db adapters.DatabaseAdapter) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		p, err := getPagination(c)
+		if err != nil {
+			return err
+		}
+
+		q := adapters.DeliveryQuery{
+			SubscriptionID: c.Query("subscription_id"),
+			EventID:        c.Query("event_id"),
+		}
+		if value := c.Query("failed"); value != "" {
+			failed, err := strconv.ParseBool(value)
+			if err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, "Invalid failed, expected true or false")
+			}
+			q.Failed = &failed
+		}
+
+		deliveries, err := db.ListWebhookDeliveries(c.UserContext(), q, withLookahead(p))
+		if err != nil {
+			return err
+		}
+		deliveries, hasMore := trimPage(deliveries, p.Limit)
+
+		var last *adapters.Cursor
+		if len(deliveries) > 0 {
+			delivery := deliveries[len(deliveries)-1]
+			last = &adapters.Cursor{CreatedAt: delivery.CreatedAt, ID: delivery.ID}
+		}
+
+		return c.JSON(fiber.Map{
+			"data": deliveries,
+			"meta": paginationMeta(c, p, len(deliveries), hasMore, last),
+		})
+	}
+}
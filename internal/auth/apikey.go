@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"sonet/internal/models"
+)
+
+// HeaderAPIKey carries the API key of a backend service
+const HeaderAPIKey = "X-API-Key"
+
+// Scopes of API keys and users. API keys are granted scopes; users have
+// ScopePostsWrite and the scopes of their roles.
+const (
+	ScopePostsWrite = "posts:write" // Create and edit posts, comments and reactions
+	ScopeModeration = "moderation"  // Remove any post, comment or reaction
+	ScopeAdmin      = "admin"       // Everything, including managing API keys
+)
+
+// User roles, from the claim named by AUTH_JWT_ROLES_CLAIM
+const (
+	RoleModerator = "moderator" // Has ScopeModeration
+	RoleAdmin     = "admin"     // Has ScopeAdmin
+)
+
+// Scopes lists the valid API key scopes
+var Scopes = []string{ScopePostsWrite, ScopeModeration, ScopeAdmin}
+
+// apiKeyPrefix starts every API key, so that leaked keys are easy to spot
+const apiKeyPrefix = "sonet_"
+
+// APIKeyStore looks up API keys, see adapters.DatabaseAdapter
+type APIKeyStore interface {
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+}
+
+// APIKeys authenticates backend services by the API key in X-API-Key. The
+// key's tenant is the tenant of the request, and its ID, prefixed by
+// "apikey:", is the user ID, so the content it creates is attributed to it.
+type APIKeys struct {
+	Store APIKeyStore
+}
+
+// Authenticate looks up the key in X-API-Key and checks its hash
+func (k APIKeys) Authenticate(c *fiber.Ctx) (*Identity, error) {
+	key := strings.TrimSpace(c.Get(HeaderAPIKey))
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+
+	prefix, ok := apiKeyPrefixOf(key)
+	if !ok {
+		return nil, errors.New("malformed API key")
+	}
+	stored, err := k.Store.GetAPIKeyByPrefix(c.UserContext(), prefix)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("unknown API key")
+	}
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusServiceUnavailable, "Failed to look up API key")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(HashAPIKey(key)), []byte(stored.Hash)) != 1 {
+		return nil, errors.New("unknown API key")
+	}
+	if stored.Revoked() {
+		return nil, errors.New("API key has been revoked")
+	}
+
+	return &Identity{UserID: "apikey:" + stored.ID, TenantID: stored.TenantID, APIKey: stored}, nil
+}
+
+// NewAPIKey generates an API key, and returns it along with the record to
+// store. The key cannot be recovered from the record.
+func NewAPIKey(name string, scopes []string, rateLimit int) (string, *models.APIKey, error) {
+	for _, scope := range scopes {
+		if !ValidScope(scope) {
+			return "", nil, fmt.Errorf("unknown scope %q, expected one of %s", scope, strings.Join(Scopes, ", "))
+		}
+	}
+	if rateLimit < 0 {
+		return "", nil, errors.New("rate limit cannot be negative")
+	}
+
+	public := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(public); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+
+	prefix := apiKeyPrefix + hex.EncodeToString(public)
+	key := prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, &models.APIKey{
+		Name:      name,
+		Prefix:    prefix,
+		Hash:      HashAPIKey(key),
+		Scopes:    append(models.StringList{}, scopes...),
+		RateLimit: rateLimit,
+	}, nil
+}
+
+// HashAPIKey returns the hash of an API key that is stored in its place.
+// Keys are random, so an unsalted hash is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyPrefixOf returns the public prefix of an API key, sonet_ and the
+// hex-encoded key ID before the secret
+func apiKeyPrefixOf(key string) (string, bool) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", false
+	}
+	end := strings.IndexByte(key[len(apiKeyPrefix):], '_')
+	if end <= 0 {
+		return "", false
+	}
+	return key[:len(apiKeyPrefix)+end], true
+}
+
+// ValidScope reports whether a scope exists
+func ValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the request may act with a scope. API keys have
+// their own scopes, users ScopePostsWrite and the scopes of their roles, and
+// anonymous requests none. ScopeAdmin grants every scope.
+func HasScope(c *fiber.Ctx, scope string) bool {
+	identity := FromContext(c)
+	if identity == nil {
+		return false
+	}
+
+	var scopes []string
+	if identity.APIKey != nil {
+		scopes = identity.APIKey.Scopes
+	} else {
+		scopes = []string{ScopePostsWrite}
+		for _, role := range identity.Roles {
+			switch role {
+			case RoleModerator:
+				scopes = append(scopes, ScopeModeration)
+			case RoleAdmin:
+				scopes = append(scopes, ScopeAdmin)
+			}
+		}
+	}
+
+	for _, s := range scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
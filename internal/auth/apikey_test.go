@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"sonet/internal/models"
+)
+
+// keyStore is an APIKeyStore holding keys by prefix
+type keyStore map[string]*models.APIKey
+
+func (s keyStore) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	if key, ok := s[prefix]; ok {
+		return key, nil
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// failingStore is an APIKeyStore whose database is down
+type failingStore struct{}
+
+func (failingStore) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestNewAPIKey(t *testing.T) {
+	key, stored, err := NewAPIKey("importer", []string{ScopePostsWrite}, 10)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, stored.Prefix+"_"))
+	assert.NotContains(t, stored.Hash, key)
+	assert.Equal(t, HashAPIKey(key), stored.Hash)
+	assert.Equal(t, models.StringList{ScopePostsWrite}, stored.Scopes)
+	assert.Equal(t, 10, stored.RateLimit)
+
+	prefix, ok := apiKeyPrefixOf(key)
+	assert.True(t, ok)
+	assert.Equal(t, stored.Prefix, prefix)
+
+	other, _, err := NewAPIKey("importer", nil, 0)
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+
+	_, _, err = NewAPIKey("importer", []string{"posts:read"}, 0)
+	assert.Error(t, err)
+	_, _, err = NewAPIKey("importer", nil, -1)
+	assert.Error(t, err)
+}
+
+func TestAPIKeys(t *testing.T) {
+	key, stored, err := NewAPIKey("moderator", []string{ScopeModeration}, 0)
+	require.NoError(t, err)
+	stored.ID = "key-1"
+	stored.TenantID = "app-1"
+	revokedKey, revoked, err := NewAPIKey("old", nil, 0)
+	require.NoError(t, err)
+	revokedAt := time.Now()
+	revoked.RevokedAt = &revokedAt
+
+	a := APIKeys{Store: keyStore{stored.Prefix: stored, revoked.Prefix: revoked}}
+	tests := []struct {
+		name   string
+		key    string
+		status int
+		userID string
+	}{
+		{"valid", key, http.StatusOK, "apikey:key-1"},
+		{"no key", "", http.StatusOK, ""},
+		{"wrong secret", stored.Prefix + "_guess", http.StatusUnauthorized, ""},
+		{"unknown prefix", "sonet_000000000000_guess", http.StatusUnauthorized, ""},
+		{"malformed", "guess", http.StatusUnauthorized, ""},
+		{"revoked", revokedKey, http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tt.key != "" {
+				headers[HeaderAPIKey] = tt.key
+			}
+			status, userID := signedRequest(t, a, "/", headers)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.userID, userID)
+		})
+	}
+
+	// A database failure is not the caller's fault
+	status, _ := signedRequest(t, APIKeys{Store: failingStore{}}, "/", map[string]string{HeaderAPIKey: key})
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+}
+
+func TestHasScope(t *testing.T) {
+	hasScope := func(identity *Identity, scope string) bool {
+		var has bool
+		app := fiber.New()
+		app.Get("/", func(c *fiber.Ctx) error {
+			if identity != nil {
+				c.Locals(identityKey{}, identity)
+			}
+			has = HasScope(c, scope)
+			return nil
+		})
+		_, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+		require.NoError(t, err)
+		return has
+	}
+
+	user := &Identity{UserID: "user-1"}
+	assert.True(t, hasScope(user, ScopePostsWrite))
+	assert.False(t, hasScope(user, ScopeModeration))
+	assert.False(t, hasScope(user, ScopeAdmin))
+	assert.False(t, hasScope(nil, ScopePostsWrite))
+
+	moderator := &Identity{UserID: "apikey:1", APIKey: &models.APIKey{Scopes: models.StringList{ScopeModeration}}}
+	assert.True(t, hasScope(moderator, ScopeModeration))
+	assert.False(t, hasScope(moderator, ScopePostsWrite))
+
+	admin := &Identity{UserID: "apikey:2", APIKey: &models.APIKey{Scopes: models.StringList{ScopeAdmin}}}
+	assert.True(t, hasScope(admin, ScopePostsWrite))
+	assert.True(t, hasScope(admin, ScopeModeration))
+
+	// Users get the scopes of their roles
+	moderatorUser := &Identity{UserID: "user-2", Roles: []string{"editor", RoleModerator}}
+	assert.True(t, hasScope(moderatorUser, ScopePostsWrite))
+	assert.True(t, hasScope(moderatorUser, ScopeModeration))
+	assert.False(t, hasScope(moderatorUser, ScopeAdmin))
+	adminUser := &Identity{UserID: "user-3", Roles: []string{RoleAdmin}}
+	assert.True(t, hasScope(adminUser, ScopeModeration))
+	assert.True(t, hasScope(adminUser, ScopeAdmin))
+}
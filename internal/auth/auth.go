@@ -0,0 +1,181 @@
+// Package auth identifies the user making an API request.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spf13/viper"
+
+	"sonet/internal/models"
+)
+
+// Authentication modes selected with AUTH_MODE
+const (
+	ModeJWT           = "jwt"
+	ModeSignedHeader  = "signed-header"
+	ModeTrustedHeader = "trusted-header"
+)
+
+// ErrNoCredentials is returned by an Authenticator when a request carries no
+// credentials it understands. Such requests continue anonymously.
+var ErrNoCredentials = errors.New("no credentials")
+
+// HeaderTenantID names the tenant, the application a request is made for
+const HeaderTenantID = "X-Tenant-ID"
+
+// Identity is the verified identity of the user making a request
+type Identity struct {
+	UserID   string
+	TenantID string                 // Tenant the credentials are for, if they name one
+	Roles    []string               // Roles of the user, see RoleModerator and RoleAdmin
+	Claims   map[string]interface{} // Token claims, if authenticated by a token
+	APIKey   *models.APIKey         // API key, if authenticated by one
+}
+
+// Authenticator verifies the credentials of a request
+type Authenticator interface {
+	// Authenticate returns the identity the request's credentials prove,
+	// ErrNoCredentials if it has none, or another error if they are invalid
+	Authenticate(c *fiber.Ctx) (*Identity, error)
+}
+
+// identityKey is the fiber.Ctx Locals key of the request's identity
+type identityKey struct{}
+
+// New creates the Authenticator configured with AUTH_MODE, a mode or a
+// comma-separated list of modes tried in order
+func New() (Authenticator, error) {
+	var chain Chain
+	for _, mode := range strings.Split(viper.GetString("AUTH_MODE"), ",") {
+		authenticator, err := newMode(strings.TrimSpace(mode))
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, authenticator)
+	}
+
+	if len(chain) == 1 {
+		return chain[0], nil
+	}
+	// Unsigned headers would let any caller bypass the other modes
+	for _, a := range chain {
+		if _, ok := a.(TrustedHeader); ok {
+			return nil, fmt.Errorf("AUTH_MODE %s cannot be combined with other modes", ModeTrustedHeader)
+		}
+	}
+	return chain, nil
+}
+
+// newMode creates the Authenticator of a single mode
+func newMode(mode string) (Authenticator, error) {
+	switch mode {
+	case ModeJWT, "":
+		return NewJWT(JWTConfig{
+			Secret:      []byte(viper.GetString("AUTH_JWT_SECRET")),
+			JWKSFile:    viper.GetString("AUTH_JWKS_FILE"),
+			JWKSURL:     viper.GetString("AUTH_JWKS_URL"),
+			JWKSRefresh: time.Duration(viper.GetInt("AUTH_JWKS_REFRESH")) * time.Second,
+			UserClaim:   viper.GetString("AUTH_JWT_USER_CLAIM"),
+			TenantClaim: viper.GetString("AUTH_JWT_TENANT_CLAIM"),
+			RolesClaim:  viper.GetString("AUTH_JWT_ROLES_CLAIM"),
+			Issuer:      viper.GetString("AUTH_JWT_ISSUER"),
+			Audience:    viper.GetString("AUTH_JWT_AUDIENCE"),
+			Leeway:      time.Duration(viper.GetInt("AUTH_JWT_LEEWAY")) * time.Second,
+		})
+	case ModeSignedHeader:
+		return NewSignedHeader(SignedHeaderConfig{
+			Secret:     []byte(viper.GetString("AUTH_SIGNATURE_SECRET")),
+			UserHeader: viper.GetString("AUTH_TRUSTED_HEADER"),
+			MaxSkew:    time.Duration(viper.GetInt("AUTH_SIGNATURE_MAX_SKEW")) * time.Second,
+		})
+	case ModeTrustedHeader:
+		return TrustedHeader{Header: viper.GetString("AUTH_TRUSTED_HEADER")}, nil
+	default:
+		return nil, fmt.Errorf("unknown AUTH_MODE %q, expected %s, %s or %s", mode, ModeJWT, ModeSignedHeader, ModeTrustedHeader)
+	}
+}
+
+// Middleware authenticates requests with an Authenticator. Requests with
+// valid credentials continue with their identity, see UserID; requests
+// without credentials continue anonymously, and handlers that need a user
+// reject them. Requests with invalid credentials are rejected, with the
+// *fiber.Error the Authenticator returns if it could not check them.
+func Middleware(authenticator Authenticator) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		identity, err := authenticator.Authenticate(c)
+		if errors.Is(err, ErrNoCredentials) {
+			return c.Next()
+		}
+		var fiberErr *fiber.Error
+		if errors.As(err, &fiberErr) {
+			return err // The credentials could not be checked
+		}
+		if err != nil {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+			return fiber.NewError(fiber.StatusUnauthorized, "Invalid credentials: "+err.Error())
+		}
+
+		c.Locals(identityKey{}, identity)
+		return c.Next()
+	}
+}
+
+// FromContext returns the identity of the request, or nil if it is anonymous
+func FromContext(c *fiber.Ctx) *Identity {
+	identity, _ := c.Locals(identityKey{}).(*Identity)
+	return identity
+}
+
+// UserID returns the ID of the user making the request, or "" if it is anonymous
+func UserID(c *fiber.Ctx) string {
+	if identity := FromContext(c); identity != nil {
+		return identity.UserID
+	}
+	return ""
+}
+
+// Chain authenticates requests with the first Authenticator that finds
+// credentials it understands
+type Chain []Authenticator
+
+// Authenticate returns the result of the first Authenticator of the chain that
+// does not return ErrNoCredentials
+func (chain Chain) Authenticate(c *fiber.Ctx) (*Identity, error) {
+	for _, a := range chain {
+		identity, err := a.Authenticate(c)
+		if !errors.Is(err, ErrNoCredentials) {
+			return identity, err
+		}
+	}
+	return nil, ErrNoCredentials
+}
+
+// TrustedHeader takes the user ID, and the tenant ID from X-Tenant-ID, from
+// request headers as is. They prove nothing about the caller, so it is only
+// safe behind a gateway that authenticates requests and sets the headers itself.
+type TrustedHeader struct {
+	Header string // Defaults to X-User-ID
+}
+
+// Authenticate returns the user ID in the header
+func (h TrustedHeader) Authenticate(c *fiber.Ctx) (*Identity, error) {
+	header := h.Header
+	if header == "" {
+		header = "X-User-ID"
+	}
+
+	userID := strings.TrimSpace(c.Get(header))
+	if userID == "" {
+		return nil, ErrNoCredentials
+	}
+
+	// Header values are only valid until the request completes, so keep copies
+	return &Identity{
+		UserID:   strings.Clone(userID),
+		TenantID: strings.Clone(strings.TrimSpace(c.Get(HeaderTenantID))),
+	}, nil
+}
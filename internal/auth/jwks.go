@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// minRSABits is the smallest RSA key accepted
+const minRSABits = 2048
+
+// keySource finds the public key that verifies a token
+type keySource interface {
+	// key returns the key with an ID, or the only key for the algorithm if
+	// the token names none
+	key(ctx context.Context, kid, alg string) (crypto.PublicKey, error)
+}
+
+// jwk is a JSON Web Key. Only the members of RSA and EC public keys are read.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// signingKey is a public key of a key set with the algorithm it verifies
+type signingKey struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+// keySet is a parsed JWKS document
+type keySet []signingKey
+
+// parseKeySet parses a JWKS document. Keys that are not RS256 or ES256
+// signing keys are skipped.
+func parseKeySet(data []byte) (keySet, error) {
+	var document struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("invalid JWKS document: %v", err)
+	}
+
+	var keys keySet
+	for _, k := range document.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var parsed signingKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			parsed, err = parseRSAKey(k)
+		case "EC":
+			parsed, err = parseECKey(k)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key %q: %v", k.Kid, err)
+		}
+		if k.Alg != "" && k.Alg != parsed.alg {
+			continue
+		}
+		keys = append(keys, parsed)
+	}
+
+	return keys, nil
+}
+
+// parseRSAKey parses an RS256 key
+func parseRSAKey(k jwk) (signingKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil || len(n) == 0 {
+		return signingKey{}, errors.New("invalid modulus")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return signingKey{}, errors.New("invalid exponent")
+	}
+
+	key := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}
+	if key.N.BitLen() < minRSABits {
+		return signingKey{}, fmt.Errorf("RSA keys must have at least %d bits", minRSABits)
+	}
+	return signingKey{kid: k.Kid, alg: "RS256", key: key}, nil
+}
+
+// parseECKey parses an ES256 key, which is on the P-256 curve
+func parseECKey(k jwk) (signingKey, error) {
+	if k.Crv != "P-256" {
+		return signingKey{}, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil || len(x) != 32 {
+		return signingKey{}, errors.New("invalid x coordinate")
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil || len(y) != 32 {
+		return signingKey{}, errors.New("invalid y coordinate")
+	}
+
+	// Reject points that are not on the curve
+	uncompressed := append(append([]byte{4}, x...), y...)
+	if _, err := ecdh.P256().NewPublicKey(uncompressed); err != nil {
+		return signingKey{}, errors.New("point is not on the curve")
+	}
+
+	key := &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}
+	return signingKey{kid: k.Kid, alg: "ES256", key: key}, nil
+}
+
+// key returns the key with an ID for an algorithm, or the only key for the
+// algorithm if kid is empty
+func (s keySet) key(_ context.Context, kid, alg string) (crypto.PublicKey, error) {
+	var found []signingKey
+	for _, k := range s {
+		if k.alg == alg && (kid == "" || k.kid == kid) {
+			found = append(found, k)
+		}
+	}
+
+	switch {
+	case len(found) == 0 && kid != "":
+		return nil, fmt.Errorf("unknown %s key %q", alg, kid)
+	case len(found) == 0:
+		return nil, fmt.Errorf("no %s key", alg)
+	case len(found) > 1:
+		return nil, errors.New("token has no key ID and more than one key could verify it")
+	}
+	return found[0].key, nil
+}
+
+// loadKeySetFile reads a JWKS document from a file
+func loadKeySetFile(path string) (keySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %v", err)
+	}
+	return parseKeySet(data)
+}
+
+// remoteKeySet is a JWKS document fetched from a URL. It is fetched on first
+// use and refreshed periodically, and early when a token names a key it does
+// not have, so that keys can be rotated. Fetch failures keep the keys already
+// fetched.
+type remoteKeySet struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	mu        sync.Mutex
+	keys      keySet
+	fetchedAt time.Time // Time of the last fetch attempt
+}
+
+// minRefetchInterval limits how often unknown key IDs cause a fetch
+const minRefetchInterval = time.Minute
+
+// newRemoteKeySet creates a key set fetched from a URL
+func newRemoteKeySet(url string, refresh time.Duration) *remoteKeySet {
+	return &remoteKeySet{
+		url:     url,
+		refresh: refresh,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// key returns a key, fetching the document if it is stale or lacks the key
+func (r *remoteKeySet) key(ctx context.Context, kid, alg string) (crypto.PublicKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.fetchedAt.IsZero() || time.Since(r.fetchedAt) > r.refresh {
+		r.fetch(ctx)
+	}
+
+	key, err := r.keys.key(ctx, kid, alg)
+	if err != nil && time.Since(r.fetchedAt) > minRefetchInterval {
+		r.fetch(ctx)
+		key, err = r.keys.key(ctx, kid, alg)
+	}
+	return key, err
+}
+
+// fetch replaces the keys with the current document, if it can be fetched.
+// The caller must hold the lock.
+func (r *remoteKeySet) fetch(ctx context.Context) {
+	r.fetchedAt = time.Now()
+
+	keys, err := r.download(ctx)
+	if err != nil {
+		log.Printf("Failed to fetch JWKS from %s: %v", r.url, err)
+		return
+	}
+	r.keys = keys
+}
+
+// download fetches and parses the document
+func (r *remoteKeySet) download(ctx context.Context) (keySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return parseKeySet(data)
+}
@@ -0,0 +1,289 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// JWTConfig configures JWT authentication
+type JWTConfig struct {
+	Secret      []byte        // HS256 shared secret
+	JWKSFile    string        // Path of a JWKS document with RS256 and ES256 keys
+	JWKSURL     string        // URL of a JWKS document with RS256 and ES256 keys
+	JWKSRefresh time.Duration // How often keys from JWKSURL are refreshed, default one hour
+	UserClaim   string        // Claim holding the user ID, default "sub"
+	TenantClaim string        // Claim holding the tenant ID, required in tokens if set
+	RolesClaim  string        // Claim holding the user's roles, default "roles"
+	Issuer      string        // Required "iss" claim, if set
+	Audience    string        // Required "aud" claim, if set
+	Leeway      time.Duration // Allowed clock skew when checking "exp" and "nbf"
+}
+
+// JWT authenticates requests with a bearer JSON Web Token, signed with HS256
+// by a shared secret or with RS256 or ES256 by a key in a JWKS document.
+// Tokens must expire.
+type JWT struct {
+	config JWTConfig
+	keys   keySource // nil without a JWKS document
+	now    func() time.Time
+}
+
+// NewJWT creates a JWT authenticator. At least one of Secret, JWKSFile and
+// JWKSURL must be set.
+func NewJWT(config JWTConfig) (*JWT, error) {
+	if config.UserClaim == "" {
+		config.UserClaim = "sub"
+	}
+	if config.RolesClaim == "" {
+		config.RolesClaim = "roles"
+	}
+	if config.JWKSRefresh <= 0 {
+		config.JWKSRefresh = time.Hour
+	}
+
+	a := &JWT{config: config, now: time.Now}
+	switch {
+	case config.JWKSFile != "" && config.JWKSURL != "":
+		return nil, errors.New("set either AUTH_JWKS_FILE or AUTH_JWKS_URL, not both")
+	case config.JWKSFile != "":
+		keys, err := loadKeySetFile(config.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.keys = keys
+	case config.JWKSURL != "":
+		a.keys = newRemoteKeySet(config.JWKSURL, config.JWKSRefresh)
+	case len(config.Secret) == 0:
+		return nil, errors.New("JWT authentication needs AUTH_JWT_SECRET, AUTH_JWKS_FILE or AUTH_JWKS_URL; " +
+			"set AUTH_MODE=trusted-header only behind a gateway that authenticates requests")
+	}
+
+	return a, nil
+}
+
+// Authenticate verifies the bearer token of the request
+func (a *JWT) Authenticate(c *fiber.Ctx) (*Identity, error) {
+	header := c.Get(fiber.HeaderAuthorization)
+	if header == "" {
+		return nil, ErrNoCredentials
+	}
+
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := a.verify(c.UserContext(), strings.TrimSpace(token))
+	if err != nil {
+		return nil, err
+	}
+
+	userID, _ := claims[a.config.UserClaim].(string)
+	if userID == "" {
+		return nil, fmt.Errorf("token has no %s claim", a.config.UserClaim)
+	}
+
+	var tenantID string
+	if a.config.TenantClaim != "" {
+		tenantID, _ = claims[a.config.TenantClaim].(string)
+		if tenantID == "" {
+			return nil, fmt.Errorf("token has no %s claim", a.config.TenantClaim)
+		}
+	}
+
+	return &Identity{UserID: userID, TenantID: tenantID, Roles: rolesClaim(claims[a.config.RolesClaim]), Claims: claims}, nil
+}
+
+// rolesClaim returns the roles in a claim, either an array of strings or a
+// space-separated string like the OAuth "scope" claim
+func rolesClaim(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var roles []string
+		for _, role := range v {
+			if role, ok := role.(string); ok && role != "" {
+				roles = append(roles, role)
+			}
+		}
+		return roles
+	}
+	return nil
+}
+
+// jwtHeader is the JOSE header of a token
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// verify checks the signature and registered claims of a token and returns its claims
+func (a *JWT) verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errors.New("malformed token header")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+
+	if err := a.verifySignature(ctx, header, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.New("malformed token claims")
+	}
+	if err := a.verifyClaims(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// verifySignature checks the signature of a token's signing input. The
+// algorithm named in the header must match the type of the key, so a public
+// key can never be used as an HMAC secret.
+func (a *JWT) verifySignature(ctx context.Context, header jwtHeader, signingInput string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch header.Alg {
+	case "HS256":
+		if len(a.config.Secret) == 0 {
+			return errors.New("HS256 tokens are not accepted")
+		}
+		mac := hmac.New(sha256.New, a.config.Secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+
+	case "RS256", "ES256":
+		if a.keys == nil {
+			return fmt.Errorf("%s tokens are not accepted", header.Alg)
+		}
+		key, err := a.keys.key(ctx, header.Kid, header.Alg)
+		if err != nil {
+			return err
+		}
+
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+				return errors.New("invalid signature")
+			}
+		case *ecdsa.PublicKey:
+			// The signature is r and s as 32-byte big-endian integers
+			if len(signature) != 64 {
+				return errors.New("invalid signature")
+			}
+			r := new(big.Int).SetBytes(signature[:32])
+			s := new(big.Int).SetBytes(signature[32:])
+			if !ecdsa.Verify(key, digest[:], r, s) {
+				return errors.New("invalid signature")
+			}
+		default:
+			return fmt.Errorf("unsupported key type %T", key)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q", header.Alg)
+	}
+}
+
+// verifyClaims checks the expiry, not-before time, issuer and audience of a token
+func (a *JWT) verifyClaims(claims map[string]interface{}) error {
+	now := a.now()
+
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	if !now.Before(exp.Add(a.config.Leeway)) {
+		return errors.New("token has expired")
+	}
+
+	if _, present := claims["nbf"]; present {
+		nbf, ok := numericDate(claims["nbf"])
+		if !ok || now.Add(a.config.Leeway).Before(nbf) {
+			return errors.New("token is not valid yet")
+		}
+	}
+
+	if a.config.Issuer != "" && claims["iss"] != a.config.Issuer {
+		return errors.New("token has the wrong issuer")
+	}
+
+	if a.config.Audience != "" && !hasAudience(claims["aud"], a.config.Audience) {
+		return errors.New("token has the wrong audience")
+	}
+
+	return nil
+}
+
+// numericDate converts a JWT NumericDate claim, seconds since the epoch, to a time
+func numericDate(value interface{}) (time.Time, bool) {
+	number, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), true
+}
+
+// hasAudience reports whether an "aud" claim, a string or an array of
+// strings, contains an audience
+func hasAudience(value interface{}, audience string) bool {
+	switch aud := value.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, item := range aud {
+			if item == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeSegment decodes a base64url-encoded JSON token segment. Numbers are
+// decoded as json.Number so that large values keep their precision.
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,358 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var b64 = base64.RawURLEncoding
+
+// signToken signs claims with HS256 using a []byte secret, or with RS256 or
+// ES256 using a private key
+func signToken(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	input := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+
+	var signature []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(input))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return input + "." + b64.EncodeToString(signature)
+}
+
+// keySetJSON renders public keys as a JWKS document
+func keySetJSON(t *testing.T, keys map[string]crypto.PublicKey) []byte {
+	var jwks []map[string]string
+	for kid, key := range keys {
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+				"n": b64.EncodeToString(key.N.Bytes()),
+				"e": b64.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "EC", "kid": kid, "crv": "P-256",
+				"x": b64.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+				"y": b64.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+			})
+		}
+	}
+	data, err := json.Marshal(map[string]interface{}{"keys": jwks})
+	require.NoError(t, err)
+	return data
+}
+
+// authenticate runs a request with an Authorization header through the middleware
+// and returns the status and the user ID the handler saw
+func authenticate(t *testing.T, a Authenticator, header string) (int, string) {
+	app := fiber.New()
+	app.Use(Middleware(a))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(UserID(c))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if header != "" {
+		req.Header.Set(fiber.HeaderAuthorization, header)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, ""
+	}
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	secret := []byte("test-secret")
+
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(jwksFile, keySetJSON(t, map[string]crypto.PublicKey{
+		"rsa-1": &rsaKey.PublicKey,
+		"ec-1":  &ecKey.PublicKey,
+	}), 0o600))
+
+	a, err := NewJWT(JWTConfig{
+		Secret:   secret,
+		JWKSFile: jwksFile,
+		Issuer:   "https://auth.example.com",
+		Audience: "sonet",
+	})
+	require.NoError(t, err)
+
+	now := time.Now()
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "user-1",
+			"iss": "https://auth.example.com",
+			"aud": []string{"other", "sonet"},
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+			} else {
+				c[k] = v
+			}
+		}
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		status int
+		userID string
+	}{
+		{"HS256", "Bearer " + signToken(t, "HS256", "", secret, claims(nil)), http.StatusOK, "user-1"},
+		{"RS256", "Bearer " + signToken(t, "RS256", "rsa-1", rsaKey, claims(nil)), http.StatusOK, "user-1"},
+		{"ES256", "Bearer " + signToken(t, "ES256", "ec-1", ecKey, claims(nil)), http.StatusOK, "user-1"},
+		{"ES256 without key ID", "Bearer " + signToken(t, "ES256", "", ecKey, claims(nil)), http.StatusOK, "user-1"},
+		{"no credentials", "", http.StatusOK, ""},
+		{"other scheme", "Basic dXNlcjpwYXNz", http.StatusOK, ""},
+		{"wrong secret", "Bearer " + signToken(t, "HS256", "", []byte("guess"), claims(nil)), http.StatusUnauthorized, ""},
+		{"wrong key", "Bearer " + signToken(t, "ES256", "ec-1", otherKey, claims(nil)), http.StatusUnauthorized, ""},
+		{"unknown key ID", "Bearer " + signToken(t, "ES256", "ec-2", ecKey, claims(nil)), http.StatusUnauthorized, ""},
+		{"alg none", "Bearer " + signToken(t, "none", "", nil, claims(nil)), http.StatusUnauthorized, ""},
+		{"expired", "Bearer " + signToken(t, "HS256", "", secret, claims(map[string]interface{}{
+			"exp": now.Add(-time.Hour).Unix(),
+		})), http.StatusUnauthorized, ""},
+		{"no expiry", "Bearer " + signToken(t, "HS256", "", secret, claims(map[string]interface{}{
+			"exp": nil,
+		})), http.StatusUnauthorized, ""},
+		{"not valid yet", "Bearer " + signToken(t, "HS256", "", secret, claims(map[string]interface{}{
+			"nbf": now.Add(time.Hour).Unix(),
+		})), http.StatusUnauthorized, ""},
+		{"wrong issuer", "Bearer " + signToken(t, "HS256", "", secret, claims(map[string]interface{}{
+			"iss": "https://evil.example.com",
+		})), http.StatusUnauthorized, ""},
+		{"wrong audience", "Bearer " + signToken(t, "HS256", "", secret, claims(map[string]interface{}{
+			"aud": "other",
+		})), http.StatusUnauthorized, ""},
+		{"no user claim", "Bearer " + signToken(t, "HS256", "", secret, claims(map[string]interface{}{
+			"sub": nil,
+		})), http.StatusUnauthorized, ""},
+		{"malformed", "Bearer not-a-token", http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, userID := authenticate(t, a, tt.header)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.userID, userID)
+		})
+	}
+}
+
+// Test that an RSA public key cannot be used as an HS256 secret
+func TestJWTRejectsAlgorithmConfusion(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwks := keySetJSON(t, map[string]crypto.PublicKey{"rsa-1": &rsaKey.PublicKey})
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(jwksFile, jwks, 0o600))
+
+	a, err := NewJWT(JWTConfig{JWKSFile: jwksFile})
+	require.NoError(t, err)
+
+	token := signToken(t, "HS256", "rsa-1", jwks, map[string]interface{}{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	status, _ := authenticate(t, a, "Bearer "+token)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestJWTUserClaimAndLeeway(t *testing.T) {
+	secret := []byte("test-secret")
+	a, err := NewJWT(JWTConfig{Secret: secret, UserClaim: "uid", Leeway: time.Minute})
+	require.NoError(t, err)
+
+	token := signToken(t, "HS256", "", secret, map[string]interface{}{
+		"sub": "subject",
+		"uid": "user-7",
+		"exp": time.Now().Add(-30 * time.Second).Unix(),
+	})
+	status, userID := authenticate(t, a, "Bearer "+token)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "user-7", userID)
+}
+
+func TestJWTTenantClaim(t *testing.T) {
+	secret := []byte("test-secret")
+	a, err := NewJWT(JWTConfig{Secret: secret, TenantClaim: "tenant"})
+	require.NoError(t, err)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	for _, tt := range []struct {
+		claims map[string]interface{}
+		tenant string
+	}{
+		{map[string]interface{}{"sub": "user-1", "tenant": "app-1", "exp": exp}, "app-1"},
+		{map[string]interface{}{"sub": "user-1", "exp": exp}, ""},
+	} {
+		app := fiber.New()
+		app.Use(Middleware(a))
+		app.Get("/", func(c *fiber.Ctx) error {
+			return c.SendString(FromContext(c).TenantID)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+signToken(t, "HS256", "", secret, tt.claims))
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+
+		// Tokens without the tenant claim are rejected
+		if tt.tenant == "" {
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+			continue
+		}
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, tt.tenant, string(body))
+	}
+}
+
+func TestJWTRoles(t *testing.T) {
+	secret := []byte("test-secret")
+	exp := time.Now().Add(time.Hour).Unix()
+
+	for _, tt := range []struct {
+		config JWTConfig
+		claims map[string]interface{}
+		roles  []string
+	}{
+		{JWTConfig{Secret: secret}, map[string]interface{}{"roles": []interface{}{"moderator", 1, "admin"}}, []string{"moderator", "admin"}},
+		{JWTConfig{Secret: secret, RolesClaim: "scope"}, map[string]interface{}{"scope": "openid moderator"}, []string{"openid", "moderator"}},
+		{JWTConfig{Secret: secret}, map[string]interface{}{"scope": "moderator"}, nil},
+	} {
+		a, err := NewJWT(tt.config)
+		require.NoError(t, err)
+
+		tt.claims["sub"] = "user-1"
+		tt.claims["exp"] = exp
+		var roles []string
+		app := fiber.New()
+		app.Use(Middleware(a))
+		app.Get("/", func(c *fiber.Ctx) error {
+			roles = FromContext(c).Roles
+			return nil
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Bearer "+signToken(t, "HS256", "", secret, tt.claims))
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, tt.roles, roles)
+	}
+}
+
+// Test that keys are fetched from a JWKS URL and refetched when rotated
+func TestJWTKeySetURL(t *testing.T) {
+	first, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	second, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	document := keySetJSON(t, map[string]crypto.PublicKey{"key-1": &first.PublicKey})
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		w.Write(document)
+	}))
+	defer server.Close()
+
+	a, err := NewJWT(JWTConfig{JWKSURL: server.URL})
+	require.NoError(t, err)
+
+	claims := map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}
+	status, userID := authenticate(t, a, "Bearer "+signToken(t, "ES256", "key-1", first, claims))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "user-1", userID)
+	authenticate(t, a, "Bearer "+signToken(t, "ES256", "key-1", first, claims))
+	assert.Equal(t, 1, fetches)
+
+	// Rotate keys; the unknown key ID triggers a fetch once the minimum interval has passed
+	document = keySetJSON(t, map[string]crypto.PublicKey{"key-2": &second.PublicKey})
+	a.keys.(*remoteKeySet).fetchedAt = time.Now().Add(-2 * minRefetchInterval)
+	status, _ = authenticate(t, a, "Bearer "+signToken(t, "ES256", "key-2", second, claims))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 2, fetches)
+
+	// Unknown key IDs do not cause a fetch per request
+	status, _ = authenticate(t, a, "Bearer "+signToken(t, "ES256", "key-3", second, claims))
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, 2, fetches)
+}
+
+func TestNewJWTNeedsKeys(t *testing.T) {
+	_, err := NewJWT(JWTConfig{})
+	assert.Error(t, err)
+
+	_, err = NewJWT(JWTConfig{JWKSFile: "jwks.json", JWKSURL: "https://example.com/jwks.json"})
+	assert.Error(t, err)
+}
+
+func TestTrustedHeader(t *testing.T) {
+	app := fiber.New()
+	app.Use(Middleware(TrustedHeader{Header: "X-Forwarded-User"}))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(UserID(c))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-User", "user-1")
+	req.Header.Set("X-User-ID", "user-2")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "user-1", string(body))
+}
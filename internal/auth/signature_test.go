@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gatewaySignature signs a user ID, timestamp and path the way a gateway does
+func gatewaySignature(secret, userID, timestamp, path string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(userID + "\n" + timestamp + "\n" + path))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedRequest runs a request with headers through the middleware and
+// returns the status and the user ID the handler saw
+func signedRequest(t *testing.T, a Authenticator, path string, headers map[string]string) (int, string) {
+	app := fiber.New()
+	app.Use(Middleware(a))
+	app.Get("/*", func(c *fiber.Ctx) error {
+		return c.SendString(UserID(c))
+	})
+
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, ""
+	}
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestSignedHeader(t *testing.T) {
+	const secret = "gateway-secret"
+	now := time.Now()
+	ts := strconv.FormatInt(now.Unix(), 10)
+	old := strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		status  int
+		userID  string
+	}{
+		{"valid", "/api/posts", map[string]string{
+			"X-User-ID": "user-1", HeaderTimestamp: ts, HeaderSignature: gatewaySignature(secret, "user-1", ts, "/api/posts"),
+		}, http.StatusOK, "user-1"},
+		{"valid with tenant", "/api/posts", map[string]string{
+			"X-User-ID": "user-1", HeaderTenantID: "app-1", HeaderTimestamp: ts,
+			HeaderSignature: gatewaySignature(secret, "user-1", ts, "/api/posts\napp-1"),
+		}, http.StatusOK, "user-1"},
+		{"unsigned tenant", "/api/posts", map[string]string{
+			"X-User-ID": "user-1", HeaderTenantID: "app-2", HeaderTimestamp: ts, HeaderSignature: gatewaySignature(secret, "user-1", ts, "/api/posts"),
+		}, http.StatusUnauthorized, ""},
+		{"no credentials", "/api/posts", nil, http.StatusOK, ""},
+		{"unsigned user ID", "/api/posts", map[string]string{
+			"X-User-ID": "user-1",
+		}, http.StatusUnauthorized, ""},
+		{"other user ID", "/api/posts", map[string]string{
+			"X-User-ID": "user-2", HeaderTimestamp: ts, HeaderSignature: gatewaySignature(secret, "user-1", ts, "/api/posts"),
+		}, http.StatusUnauthorized, ""},
+		{"other path", "/api/posts/1", map[string]string{
+			"X-User-ID": "user-1", HeaderTimestamp: ts, HeaderSignature: gatewaySignature(secret, "user-1", ts, "/api/posts"),
+		}, http.StatusUnauthorized, ""},
+		{"wrong secret", "/api/posts", map[string]string{
+			"X-User-ID": "user-1", HeaderTimestamp: ts, HeaderSignature: gatewaySignature("guess", "user-1", ts, "/api/posts"),
+		}, http.StatusUnauthorized, ""},
+		{"expired", "/api/posts", map[string]string{
+			"X-User-ID": "user-1", HeaderTimestamp: old, HeaderSignature: gatewaySignature(secret, "user-1", old, "/api/posts"),
+		}, http.StatusUnauthorized, ""},
+		{"malformed timestamp", "/api/posts", map[string]string{
+			"X-User-ID": "user-1", HeaderTimestamp: "soon", HeaderSignature: gatewaySignature(secret, "user-1", "soon", "/api/posts"),
+		}, http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewSignedHeader(SignedHeaderConfig{Secret: []byte(secret)})
+			require.NoError(t, err)
+
+			status, userID := signedRequest(t, a, tt.path, tt.headers)
+			assert.Equal(t, tt.status, status)
+			assert.Equal(t, tt.userID, userID)
+		})
+	}
+}
+
+func TestSignedHeaderRejectsReplay(t *testing.T) {
+	const secret = "gateway-secret"
+	a, err := NewSignedHeader(SignedHeaderConfig{Secret: []byte(secret), MaxSkew: time.Minute})
+	require.NoError(t, err)
+
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := gatewaySignature(secret, "user-1", ts, "/api/posts")
+	headers := map[string]string{"X-User-ID": "user-1", HeaderTimestamp: ts, HeaderSignature: signature}
+
+	status, _ := signedRequest(t, a, "/api/posts", headers)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = signedRequest(t, a, "/api/posts", headers)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// The same signature in upper case is the same signature
+	headers[HeaderSignature] = strings.ToUpper(signature)
+	status, _ = signedRequest(t, a, "/api/posts", headers)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// Used signatures are forgotten once they expire
+	a.now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	a.use("other", time.Now().Add(3*time.Minute), a.now())
+	assert.NotContains(t, a.seen, strings.ToLower(signature))
+}
+
+func TestNewModes(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("AUTH_JWT_SECRET", "jwt-secret")
+	viper.Set("AUTH_SIGNATURE_SECRET", "gateway-secret")
+
+	viper.Set("AUTH_MODE", "jwt, signed-header")
+	a, err := New()
+	require.NoError(t, err)
+	require.IsType(t, Chain{}, a)
+
+	// Both gateway-signed and token-authenticated requests are accepted
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	status, userID := signedRequest(t, a, "/", map[string]string{
+		"X-User-ID": "user-1", HeaderTimestamp: ts, HeaderSignature: gatewaySignature("gateway-secret", "user-1", ts, "/"),
+	})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "user-1", userID)
+
+	token := signToken(t, "HS256", "", []byte("jwt-secret"), map[string]interface{}{
+		"sub": "user-2",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	status, userID = signedRequest(t, a, "/", map[string]string{fiber.HeaderAuthorization: "Bearer " + token})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "user-2", userID)
+
+	viper.Set("AUTH_MODE", "jwt,trusted-header")
+	_, err = New()
+	assert.Error(t, err)
+
+	viper.Set("AUTH_MODE", "header")
+	_, err = New()
+	assert.Error(t, err)
+}
@@ -17,10 +17,31 @@ func LoadConfig() error {
 	viper.SetDefault("ENV", "development")
 	viper.SetDefault("DB_ADAPTER", "sqlite")
 	viper.SetDefault("DB_CONNECTION_STRING", "sonet.db")
+	viper.SetDefault("DB_MIGRATE_MODE", "up")
+	viper.SetDefault("DB_QUERY_TIMEOUT", 10)
+	viper.SetDefault("SEARCH_LANGUAGES", "en:english")
+	viper.SetDefault("SEARCH_DEFAULT_CONFIG", "english")
+	viper.SetDefault("AUTH_MODE", "jwt")
+	viper.SetDefault("AUTH_JWT_USER_CLAIM", "sub")
+	viper.SetDefault("AUTH_JWT_ROLES_CLAIM", "roles")
+	viper.SetDefault("AUTH_JWT_LEEWAY", 60)
+	viper.SetDefault("AUTH_JWKS_REFRESH", 3600)
+	viper.SetDefault("AUTH_TRUSTED_HEADER", "X-User-ID")
+	viper.SetDefault("AUTH_SIGNATURE_MAX_SKEW", 300)
 	viper.SetDefault("RATE_LIMIT_ENABLED", false)
 	viper.SetDefault("RATE_LIMIT_REQUESTS", 100)
 	viper.SetDefault("RATE_LIMIT_DURATION", 60)
 	viper.SetDefault("HOOKS_ENABLED", true)
+	viper.SetDefault("HOOKS_POLL_INTERVAL", 1)
+	viper.SetDefault("HOOKS_BATCH_SIZE", 100)
+	viper.SetDefault("HOOKS_LEASE", 60)
+	viper.SetDefault("HOOKS_RETENTION_HOURS", 168)
+	viper.SetDefault("HOOKS_MAX_ATTEMPTS", 10)
+	viper.SetDefault("HOOKS_BACKOFF_BASE", 10)
+	viper.SetDefault("HOOKS_BACKOFF_MAX", 3600)
+	viper.SetDefault("HOOKS_DEAD_LETTER_RETENTION_HOURS", 720)
+	viper.SetDefault("WEBHOOK_TIMEOUT", 10)
+	viper.SetDefault("WEBHOOK_ALLOW_PRIVATE", false)
 
 	// Read the .env file
 	err := viper.ReadInConfig()
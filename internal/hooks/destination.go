@@ -0,0 +1,99 @@
+package hooks
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ErrPrivateAddress is returned for webhook requests to addresses that are
+// not on the public internet
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+// reservedPrefixes are ranges that are neither private, loopback nor
+// link-local, yet are not on the public internet either
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // Shared address space of carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),   // NAT64, which may map to private IPv4 addresses
+	netip.MustParsePrefix("64:ff9b:1::/48"), // Local-use NAT64
+	netip.MustParsePrefix("fec0::/10"),      // Deprecated site-local
+}
+
+// PublicAddress reports whether an address is on the public internet, so
+// that tenants' webhooks cannot reach the host or its network
+func PublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPublic refuses connections to addresses that are not public. It runs
+// once host names are resolved, for every address dialed, so that names
+// resolving to private addresses are refused too.
+func checkPublic(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, address)
+	}
+	if !PublicAddress(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, addrPort.Addr())
+	}
+	return nil
+}
+
+// publicTransport sends webhook requests to public addresses only, without
+// proxies, which would dial on its behalf
+var publicTransport = &http.Transport{
+	DialContext: (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   checkPublic,
+	}).DialContext,
+	ForceAttemptHTTP2:     true,
+	MaxIdleConns:          100,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   10 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+// transport returns the transport of requests to a webhook. Subscriptions'
+// webhooks are only sent to public addresses, unless WEBHOOK_ALLOW_PRIVATE
+// is set, read when they are sent, see enabled.
+func transport(webhook Webhook) http.RoundTripper {
+	if webhook.PublicOnly && !viper.GetBool("WEBHOOK_ALLOW_PRIVATE") {
+		return publicTransport
+	}
+	return http.DefaultTransport
+}
+
+// refuseRedirect stops clients at redirects, which could lead webhooks to
+// private addresses, and would send them again as GET requests
+func refuseRedirect(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+// keepResponse reports whether the body of a webhook response may be kept
+// with its delivery. Deliveries are shown to tenants, who would otherwise
+// read the services of private networks through them; so bodies are only
+// kept from public addresses, and never from redirects.
+func keepResponse(status int, remote netip.Addr) bool {
+	redirect := status >= 300 && status < 400
+	return !redirect && PublicAddress(remote)
+}
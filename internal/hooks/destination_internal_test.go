@@ -0,0 +1,32 @@
+package hooks
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeepResponse(t *testing.T) {
+	public := netip.MustParseAddr("93.184.216.34")
+	tests := []struct {
+		name   string
+		status int
+		remote netip.Addr
+		keep   bool
+	}{
+		{"public", http.StatusOK, public, true},
+		{"public error", http.StatusServiceUnavailable, public, true},
+		{"redirect", http.StatusFound, public, false},
+		{"loopback", http.StatusOK, netip.MustParseAddr("127.0.0.1"), false},
+		{"metadata", http.StatusOK, netip.MustParseAddr("169.254.169.254"), false},
+		{"unknown address", http.StatusOK, netip.Addr{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.keep, keepResponse(tt.status, tt.remote))
+		})
+	}
+}
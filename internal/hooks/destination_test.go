@@ -0,0 +1,114 @@
+package hooks_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sonet/internal/adapters"
+	"sonet/internal/hooks"
+	"sonet/internal/models"
+)
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"64:ff9b::a00:1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			assert.Equal(t, tt.public, hooks.PublicAddress(netip.MustParseAddr(tt.addr)))
+		})
+	}
+}
+
+// Test that subscriptions are not sent to private addresses, unless
+// WEBHOOK_ALLOW_PRIVATE is set, while WEBHOOK_URL is
+func TestWebhookPrivateAddresses(t *testing.T) {
+	var received atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer server.Close()
+
+	db, manager := newOutbox(t)
+	viper.Set("WEBHOOK_ALLOW_PRIVATE", false)
+	viper.Set("WEBHOOK_URL", server.URL+"/operator")
+	t.Cleanup(func() { viper.Set("WEBHOOK_URL", "") })
+
+	ctx := context.Background()
+	require.NoError(t, db.CreateWebhookSubscription(ctx, &models.WebhookSubscription{URL: server.URL + "/tenant", Enabled: true}))
+	require.NoError(t, manager.Trigger(ctx, db, hooks.EventPostDeleted, "", "user-1", "post-1", nil))
+
+	dispatcher := &hooks.Dispatcher{Outbox: db, Manager: manager, BatchSize: 10}
+	delivered, err := dispatcher.DispatchPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Equal(t, int32(1), received.Load())
+
+	failed := true
+	deliveries, err := db.ListWebhookDeliveries(ctx, adapters.DeliveryQuery{Failed: &failed}, adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, server.URL+"/tenant", deliveries[0].URL)
+	assert.Contains(t, deliveries[0].Error, hooks.ErrPrivateAddress.Error())
+}
+
+// Test that redirects are not followed, and fail deliveries
+func TestWebhookRedirects(t *testing.T) {
+	var redirected atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			redirected.Add(1)
+			return
+		}
+		w.Header().Set("Location", "/moved")
+		w.WriteHeader(http.StatusFound)
+		_, _ = w.Write([]byte("internal"))
+	}))
+	defer server.Close()
+
+	db, manager := newOutbox(t)
+	ctx := context.Background()
+	require.NoError(t, db.CreateWebhookSubscription(ctx, &models.WebhookSubscription{URL: server.URL, Enabled: true}))
+	require.NoError(t, manager.Trigger(ctx, db, hooks.EventPostDeleted, "", "user-1", "post-1", nil))
+
+	dispatcher := &hooks.Dispatcher{Outbox: db, Manager: manager, BatchSize: 10}
+	delivered, err := dispatcher.DispatchPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered) // Only to the handlers
+	assert.Zero(t, redirected.Load())
+
+	deliveries, err := db.ListWebhookDeliveries(ctx, adapters.DeliveryQuery{}, adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, http.StatusFound, deliveries[0].StatusCode)
+	assert.Equal(t, "webhook returned status: 302", deliveries[0].Error)
+	assert.Empty(t, deliveries[0].Response)
+}
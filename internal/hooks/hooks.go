@@ -2,10 +2,19 @@ package hooks
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httptrace"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"sonet/internal/models"
 
@@ -25,22 +34,52 @@ const (
 	EventCommentDeleted  EventType = "comment_deleted"
 	EventReactionAdded   EventType = "reaction_added"
 	EventReactionRemoved EventType = "reaction_removed"
+
+	// EventContentModerated is triggered when a moderator deletes, hides or
+	// unhides another user's post, comment or reaction, instead of the
+	// deletion event
+	EventContentModerated EventType = "content_moderated"
 )
 
-// Event represents a hook event
+// EventTypes lists every event type
+var EventTypes = []EventType{
+	EventPostCreated, EventPostUpdated, EventPostDeleted,
+	EventCommentCreated, EventCommentUpdated, EventCommentDeleted,
+	EventReactionAdded, EventReactionRemoved,
+	EventContentModerated,
+}
+
+// Event represents a hook event. Events are delivered at least once, so
+// handlers and webhooks may see an ID more than once.
 type Event struct {
-	Type      EventType   `json:"type"`
-	UserID    string      `json:"user_id"`
-	Data      interface{} `json:"data"`
-	Timestamp int64       `json:"timestamp"`
+	ID        string          `json:"id"`
+	Type      EventType       `json:"type"`
+	TenantID  string          `json:"tenant_id"`
+	UserID    string          `json:"user_id"`
+	PostID    string          `json:"post_id,omitempty"` // The post the event is about, if any
+	Data      json.RawMessage `json:"data"`              // The JSON encoded post, comment, reaction or moderation action
+	Timestamp int64           `json:"timestamp"`
+}
+
+// EventWriter writes events to the outbox for the webhook subscriptions of
+// the tenant of the context, see adapters.DatabaseAdapter
+type EventWriter interface {
+	EnqueueEvent(ctx context.Context, event *models.OutboxEvent) error
+	ListWebhookSubscriptions(ctx context.Context) ([]*models.WebhookSubscription, error)
 }
 
 // HookManager manages event hooks
 type HookManager struct {
-	handlers   map[EventType][]EventHandler
-	webhookURL string
-	enabled    bool
-	mu         sync.RWMutex
+	handlers map[EventType][]EventHandler
+	mu       sync.RWMutex
+}
+
+// Webhook is an endpoint that receives events, see Sign
+type Webhook struct {
+	URL            string
+	Secret         string // Signs every event, if set
+	PreviousSecret string // Also signs events while receivers move to Secret
+	PublicOnly     bool   // Only sent to public addresses, for URLs given by tenants
 }
 
 // EventHandler is a function that handles an event
@@ -49,12 +88,46 @@ type EventHandler func(event Event) error
 // NewHookManager creates a new hook manager
 func NewHookManager() *HookManager {
 	return &HookManager{
-		handlers:   make(map[EventType][]EventHandler),
-		webhookURL: viper.GetString("WEBHOOK_URL"),
-		enabled:    viper.GetBool("HOOKS_ENABLED"),
+		handlers: make(map[EventType][]EventHandler),
 	}
 }
 
+// enabled reports whether HOOKS_ENABLED is set. It is read when events are
+// triggered, since DefaultHookManager is created before the configuration is
+// loaded.
+func (h *HookManager) enabled() bool {
+	return viper.GetBool("HOOKS_ENABLED")
+}
+
+// webhook returns the webhook of WEBHOOK_URL, signed with WEBHOOK_SECRET and
+// WEBHOOK_PREVIOUS_SECRET, read when events are delivered, see enabled
+func (h *HookManager) webhook() Webhook {
+	return Webhook{
+		URL:            viper.GetString("WEBHOOK_URL"),
+		Secret:         viper.GetString("WEBHOOK_SECRET"),
+		PreviousSecret: viper.GetString("WEBHOOK_PREVIOUS_SECRET"),
+	}
+}
+
+// defaultWebhookTimeout bounds webhook requests when WEBHOOK_TIMEOUT is not set
+const defaultWebhookTimeout = 10 * time.Second
+
+// webhookTimeout returns how long a webhook request may take: WEBHOOK_TIMEOUT,
+// read when requests are sent, see enabled
+func webhookTimeout() time.Duration {
+	timeout := time.Duration(viper.GetInt("WEBHOOK_TIMEOUT")) * time.Second
+	if timeout <= 0 {
+		return defaultWebhookTimeout
+	}
+	return timeout
+}
+
+// client returns the client of requests to a webhook, see webhookTimeout.
+// Redirects are not followed.
+func (h *HookManager) client(webhook Webhook) *http.Client {
+	return &http.Client{Timeout: webhookTimeout(), Transport: transport(webhook), CheckRedirect: refuseRedirect}
+}
+
 // Register registers a handler for an event type
 func (h *HookManager) Register(eventType EventType, handler EventHandler) {
 	h.mu.Lock()
@@ -67,49 +140,169 @@ func (h *HookManager) Register(eventType EventType, handler EventHandler) {
 	}
 }
 
-// Trigger triggers an event
-func (h *HookManager) Trigger(eventType EventType, userID string, data interface{}) {
-	if !h.enabled {
-		return
+// Trigger writes an event to the outbox with w, so that it is stored in the
+// same transaction as the change it describes: once for the handlers and the
+// webhook URL, and once for every enabled webhook subscription it matches, so
+// that each is retried on its own. The Dispatcher delivers it.
+func (h *HookManager) Trigger(ctx context.Context, w EventWriter, eventType EventType, tenantID, userID, postID string, data interface{}) error {
+	if !h.enabled() {
+		return nil
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event data: %v", err)
 	}
 
 	event := Event{
-		Type:   eventType,
-		UserID: userID,
-		Data:   data,
+		ID:        models.NewID(),
+		Type:      eventType,
+		TenantID:  tenantID,
+		UserID:    userID,
+		PostID:    postID,
+		Data:      encoded,
+		Timestamp: time.Now().Unix(),
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %v", err)
+	}
+
+	err = w.EnqueueEvent(ctx, &models.OutboxEvent{
+		ID:      event.ID,
+		Type:    string(eventType),
+		Payload: string(payload),
+	})
+	if err != nil {
+		return err
+	}
+
+	subscriptions, err := w.ListWebhookSubscriptions(ctx)
+	if err != nil {
+		return err
+	}
+	for _, subscription := range subscriptions {
+		if !Matches(subscription, event) {
+			continue
+		}
+		err := w.EnqueueEvent(ctx, &models.OutboxEvent{
+			Type:           string(eventType),
+			Payload:        string(payload),
+			SubscriptionID: subscription.ID,
+		})
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+// Matches reports whether a webhook subscription is enabled and its filters
+// match an event
+func Matches(subscription *models.WebhookSubscription, event Event) bool {
+	return subscription.Enabled &&
+		matchesFilter(subscription.EventTypes, string(event.Type)) &&
+		matchesFilter(subscription.PostIDs, event.PostID) &&
+		matchesFilter(subscription.UserIDs, event.UserID)
+}
+
+// matchesFilter reports whether a value is in a filter, or the filter is empty
+func matchesFilter(filter models.StringList, value string) bool {
+	return len(filter) == 0 || slices.Contains(filter, value)
+}
 
-	// Run local handlers
+// Deliver runs the handlers of an event and sends it to the webhook URL, if
+// configured, returning their errors
+func (h *HookManager) Deliver(event Event) error {
+	_, err := h.deliver(event)
+	return err
+}
+
+// deliver runs the handlers of an event and sends it to the webhook URL,
+// returning the attempt to send it, if any
+func (h *HookManager) deliver(event Event) (*models.WebhookDelivery, error) {
 	h.mu.RLock()
-	handlers := h.handlers[eventType]
+	handlers := h.handlers[event.Type]
 	h.mu.RUnlock()
 
+	var errs []error
 	for _, handler := range handlers {
-		go func(handler EventHandler) {
-			_ = handler(event)
-		}(handler)
+		if err := handler(event); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	// Send to webhook if configured
-	if h.webhookURL != "" {
-		go h.sendWebhook(event)
+	var delivery *models.WebhookDelivery
+	if webhook := h.webhook(); webhook.URL != "" {
+		var err error
+		if delivery, err = h.sendWebhook(webhook, event); err != nil {
+			errs = append(errs, err)
+		}
 	}
+
+	return delivery, errors.Join(errs...)
 }
 
-// sendWebhook sends the event to the configured webhook URL
-func (h *HookManager) sendWebhook(event Event) error {
+// maxResponseSnippet bounds the start of the response body kept with a
+// webhook delivery
+const maxResponseSnippet = 1024
+
+// sendWebhook sends an event to a webhook, with its ID and the time it is
+// sent in headers, signed with the webhook's secrets. It returns the attempt,
+// with the error if it failed.
+func (h *HookManager) sendWebhook(webhook Webhook, event Event) (*models.WebhookDelivery, error) {
+	delivery := &models.WebhookDelivery{EventID: event.ID, EventType: string(event.Type), URL: webhook.URL}
+	err := h.post(webhook, event, delivery)
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+	return delivery, err
+}
+
+// post makes the request of sendWebhook, recording the response in delivery
+func (h *HookManager) post(webhook Webhook, event Event, delivery *models.WebhookDelivery) error {
 	jsonData, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal event: %v", err)
 	}
 
-	resp, err := http.Post(h.webhookURL, "application/json", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(jsonData))
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %v", err)
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, event.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	if signature := Sign(jsonData, timestamp, webhook.Secret, webhook.PreviousSecret); signature != "" {
+		req.Header.Set(HeaderSignature, signature)
+	}
+
+	// Note the address the request is sent to, see keepResponse
+	var remote netip.AddrPort
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			remote, _ = netip.ParseAddrPort(info.Conn.RemoteAddr().String())
+		},
+	}))
+
+	start := time.Now()
+	resp, err := h.client(webhook).Do(req)
+	delivery.LatencyMS = time.Since(start).Milliseconds()
 	if err != nil {
 		return fmt.Errorf("webhook request failed: %v", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode >= 400 {
+	delivery.StatusCode = resp.StatusCode
+	if keepResponse(resp.StatusCode, remote.Addr()) {
+		// Keep text the database accepts, whatever the receiver sent
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSnippet))
+		delivery.Response = strings.ReplaceAll(strings.ToValidUTF8(string(snippet), ""), "\x00", "")
+	}
+
+	// Redirects are not followed, so the event was not received
+	if resp.StatusCode >= 300 {
 		return fmt.Errorf("webhook returned status: %d", resp.StatusCode)
 	}
 
@@ -120,34 +313,47 @@ func (h *HookManager) sendWebhook(event Event) error {
 var DefaultHookManager = NewHookManager()
 
 // Convenience functions for triggering events
-func TriggerPostCreated(userID string, post *models.Post) {
-	DefaultHookManager.Trigger(EventPostCreated, userID, post)
+func TriggerPostCreated(ctx context.Context, w EventWriter, tenantID, userID string, post *models.Post) error {
+	return DefaultHookManager.Trigger(ctx, w, EventPostCreated, tenantID, userID, post.ID, post)
+}
+
+func TriggerPostUpdated(ctx context.Context, w EventWriter, tenantID, userID string, post *models.Post) error {
+	return DefaultHookManager.Trigger(ctx, w, EventPostUpdated, tenantID, userID, post.ID, post)
 }
 
-func TriggerPostUpdated(userID string, post *models.Post) {
-	DefaultHookManager.Trigger(EventPostUpdated, userID, post)
+func TriggerPostDeleted(ctx context.Context, w EventWriter, tenantID, userID string, postID string) error {
+	return DefaultHookManager.Trigger(ctx, w, EventPostDeleted, tenantID, userID, postID, map[string]string{"id": postID})
 }
 
-func TriggerPostDeleted(userID string, postID string) {
-	DefaultHookManager.Trigger(EventPostDeleted, userID, map[string]string{"id": postID})
+func TriggerCommentCreated(ctx context.Context, w EventWriter, tenantID, userID string, comment *models.Comment) error {
+	return DefaultHookManager.Trigger(ctx, w, EventCommentCreated, tenantID, userID, comment.PostID, comment)
 }
 
-func TriggerCommentCreated(userID string, comment *models.Comment) {
-	DefaultHookManager.Trigger(EventCommentCreated, userID, comment)
+func TriggerCommentUpdated(ctx context.Context, w EventWriter, tenantID, userID string, comment *models.Comment) error {
+	return DefaultHookManager.Trigger(ctx, w, EventCommentUpdated, tenantID, userID, comment.PostID, comment)
 }
 
-func TriggerCommentUpdated(userID string, comment *models.Comment) {
-	DefaultHookManager.Trigger(EventCommentUpdated, userID, comment)
+func TriggerCommentDeleted(ctx context.Context, w EventWriter, tenantID, userID string, comment *models.Comment) error {
+	return DefaultHookManager.Trigger(ctx, w, EventCommentDeleted, tenantID, userID, comment.PostID, map[string]string{"id": comment.ID})
 }
 
-func TriggerCommentDeleted(userID string, commentID string) {
-	DefaultHookManager.Trigger(EventCommentDeleted, userID, map[string]string{"id": commentID})
+func TriggerReactionAdded(ctx context.Context, w EventWriter, tenantID, userID string, reaction *models.Reaction) error {
+	return DefaultHookManager.Trigger(ctx, w, EventReactionAdded, tenantID, userID, targetPostID(reaction.TargetType, reaction.TargetID), reaction)
 }
 
-func TriggerReactionAdded(userID string, reaction *models.Reaction) {
-	DefaultHookManager.Trigger(EventReactionAdded, userID, reaction)
+func TriggerReactionRemoved(ctx context.Context, w EventWriter, tenantID, userID string, reaction *models.Reaction) error {
+	return DefaultHookManager.Trigger(ctx, w, EventReactionRemoved, tenantID, userID, targetPostID(reaction.TargetType, reaction.TargetID), map[string]string{"id": reaction.ID})
 }
 
-func TriggerReactionRemoved(userID string, reactionID string) {
-	DefaultHookManager.Trigger(EventReactionRemoved, userID, map[string]string{"id": reactionID})
+func TriggerContentModerated(ctx context.Context, w EventWriter, tenantID, userID string, action *models.ModerationAction) error {
+	return DefaultHookManager.Trigger(ctx, w, EventContentModerated, tenantID, userID, targetPostID(action.TargetType, action.TargetID), action)
+}
+
+// targetPostID returns the post ID of events about a reaction or moderation
+// action. Those targeting comments carry no post ID.
+func targetPostID(targetType, targetID string) string {
+	if targetType == "post" {
+		return targetID
+	}
+	return ""
 }
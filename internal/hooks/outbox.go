@@ -0,0 +1,238 @@
+package hooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+
+	"sonet/internal/adapters"
+	"sonet/internal/models"
+)
+
+// Outbox stores events until they are delivered, see adapters.DatabaseAdapter
+type Outbox interface {
+	EventWriter
+	ClaimEvents(ctx context.Context, limit int, lease time.Duration) ([]*models.OutboxEvent, error)
+	CompleteEvent(ctx context.Context, id string) error
+	ReleaseEvent(ctx context.Context, id string) error
+	FailEvent(ctx context.Context, id, lastError string, retryAt time.Time) error
+	DeadLetterEvent(ctx context.Context, id, lastError string) error
+	DeleteDeliveredEvents(ctx context.Context, before time.Time) (int64, error)
+	DeleteDeadLetteredEvents(ctx context.Context, before time.Time) (int64, error)
+	GetWebhookSubscription(ctx context.Context, id string) (*models.WebhookSubscription, error)
+	RecordWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	DeleteWebhookDeliveries(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Dispatcher delivers the events of the outbox at least once. Events that
+// fail are retried with exponential backoff until they run out of attempts,
+// and are then dead-lettered. Events whose dispatcher stops before marking
+// them delivered are delivered again when their lease expires, so several
+// dispatchers may share an outbox.
+type Dispatcher struct {
+	Outbox              Outbox
+	Manager             *HookManager  // Delivers the events, DefaultHookManager if nil
+	Interval            time.Duration // Between polls of the outbox
+	BatchSize           int           // Events claimed per poll
+	Lease               time.Duration // Before claimed events are due again
+	Retention           time.Duration // Before delivered events and webhook deliveries are deleted
+	MaxAttempts         int           // Before failed events are dead-lettered, unlimited if 0
+	BackoffBase         time.Duration // Before the first retry, doubling with every attempt
+	BackoffMax          time.Duration // Longest time between retries, a day if 0
+	DeadLetterRetention time.Duration // Before dead-lettered events are deleted, never if 0
+}
+
+// NewDispatcher creates a dispatcher of an outbox configured by
+// HOOKS_POLL_INTERVAL, HOOKS_BATCH_SIZE, HOOKS_LEASE, HOOKS_RETENTION_HOURS,
+// HOOKS_MAX_ATTEMPTS, HOOKS_BACKOFF_BASE, HOOKS_BACKOFF_MAX and
+// HOOKS_DEAD_LETTER_RETENTION_HOURS
+func NewDispatcher(outbox Outbox) *Dispatcher {
+	return &Dispatcher{
+		Outbox:              outbox,
+		Interval:            time.Duration(viper.GetInt("HOOKS_POLL_INTERVAL")) * time.Second,
+		BatchSize:           viper.GetInt("HOOKS_BATCH_SIZE"),
+		Lease:               time.Duration(viper.GetInt("HOOKS_LEASE")) * time.Second,
+		Retention:           time.Duration(viper.GetInt("HOOKS_RETENTION_HOURS")) * time.Hour,
+		MaxAttempts:         viper.GetInt("HOOKS_MAX_ATTEMPTS"),
+		BackoffBase:         time.Duration(viper.GetInt("HOOKS_BACKOFF_BASE")) * time.Second,
+		BackoffMax:          time.Duration(viper.GetInt("HOOKS_BACKOFF_MAX")) * time.Second,
+		DeadLetterRetention: time.Duration(viper.GetInt("HOOKS_DEAD_LETTER_RETENTION_HOURS")) * time.Hour,
+	}
+}
+
+// Run delivers events until ctx is done, and deletes delivered events,
+// webhook deliveries and dead-lettered events past their retention about
+// once an hour
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	var pruned time.Time
+	for {
+		if _, err := d.DispatchPending(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to dispatch hook events: %v", err)
+		}
+		if time.Since(pruned) >= time.Hour {
+			d.prune(ctx)
+			pruned = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// prune deletes delivered events and webhook deliveries past the retention,
+// and dead-lettered events past theirs
+func (d *Dispatcher) prune(ctx context.Context) {
+	if _, err := d.Outbox.DeleteDeliveredEvents(ctx, time.Now().Add(-d.Retention)); err != nil && ctx.Err() == nil {
+		log.Printf("Failed to delete delivered hook events: %v", err)
+	}
+	if _, err := d.Outbox.DeleteWebhookDeliveries(ctx, time.Now().Add(-d.Retention)); err != nil && ctx.Err() == nil {
+		log.Printf("Failed to delete webhook deliveries: %v", err)
+	}
+	if d.DeadLetterRetention <= 0 {
+		return
+	}
+	if _, err := d.Outbox.DeleteDeadLetteredEvents(ctx, time.Now().Add(-d.DeadLetterRetention)); err != nil && ctx.Err() == nil {
+		log.Printf("Failed to delete dead-lettered hook events: %v", err)
+	}
+}
+
+// DispatchPending claims a batch of due events and delivers them one by one,
+// returning how many were delivered. Events are delivered while a webhook
+// request still fits in their lease; the rest are released for the next
+// poll, so that no other dispatcher claims an event still being delivered.
+func (d *Dispatcher) DispatchPending(ctx context.Context) (int, error) {
+	manager := d.Manager
+	if manager == nil {
+		manager = DefaultHookManager
+	}
+
+	deadline := time.Now().Add(d.Lease - webhookTimeout())
+	events, err := d.Outbox.ClaimEvents(ctx, d.BatchSize, d.Lease)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for i, stored := range events {
+		// The first event is delivered even if its lease is too short for
+		// any request, so that the outbox still drains
+		if i > 0 && d.Lease > 0 && time.Now().After(deadline) {
+			return delivered, d.release(ctx, events[i:])
+		}
+		if err := d.deliver(ctx, manager, stored); err != nil {
+			if err := d.fail(ctx, stored, err); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+		if err := d.Outbox.CompleteEvent(ctx, stored.ID); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+// deliver delivers an event of the outbox to the handlers and the webhook
+// URL, or to its webhook subscription, recording the attempt to send it
+func (d *Dispatcher) deliver(ctx context.Context, manager *HookManager, stored *models.OutboxEvent) error {
+	var event Event
+	if err := json.Unmarshal([]byte(stored.Payload), &event); err != nil {
+		return fmt.Errorf("failed to unmarshal event: %v", err)
+	}
+	ctx = adapters.WithTenant(ctx, stored.TenantID)
+	if stored.SubscriptionID == "" {
+		delivery, err := manager.deliver(event)
+		if delivery != nil {
+			d.record(ctx, stored, delivery)
+		}
+		return err
+	}
+
+	// Subscriptions deleted or disabled since the event was triggered no
+	// longer receive it
+	subscription, err := d.Outbox.GetWebhookSubscription(ctx, stored.SubscriptionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !subscription.Enabled {
+		return nil
+	}
+
+	webhook := Webhook{
+		URL:            subscription.URL,
+		Secret:         subscription.Secret,
+		PreviousSecret: subscription.PreviousSecret,
+		PublicOnly:     true,
+	}
+	delivery, err := manager.sendWebhook(webhook, event)
+	d.record(ctx, stored, delivery)
+	return err
+}
+
+// release makes claimed events that were not delivered due again at once
+func (d *Dispatcher) release(ctx context.Context, events []*models.OutboxEvent) error {
+	for _, event := range events {
+		if err := d.Outbox.ReleaseEvent(ctx, event.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record stores an attempt to send an event of the outbox to a webhook.
+// Failing to store it is no reason to send the event again.
+func (d *Dispatcher) record(ctx context.Context, stored *models.OutboxEvent, delivery *models.WebhookDelivery) {
+	delivery.SubscriptionID = stored.SubscriptionID
+	delivery.Attempt = stored.Attempts
+	if err := d.Outbox.RecordWebhookDelivery(ctx, delivery); err != nil {
+		log.Printf("Failed to record delivery of hook event %s: %v", delivery.EventID, err)
+	}
+}
+
+// fail retries an event that failed after a backoff, or dead-letters it once
+// it has no attempts left
+func (d *Dispatcher) fail(ctx context.Context, event *models.OutboxEvent, err error) error {
+	if d.MaxAttempts > 0 && event.Attempts >= d.MaxAttempts {
+		log.Printf("Dead-lettered hook event %s after %d attempts: %v", event.ID, event.Attempts, err)
+		return d.Outbox.DeadLetterEvent(ctx, event.ID, err.Error())
+	}
+	return d.Outbox.FailEvent(ctx, event.ID, err.Error(), time.Now().Add(d.backoff(event.Attempts)))
+}
+
+// backoff returns how long to wait before retrying an event after an attempt:
+// BackoffBase doubled for every earlier attempt, up to BackoffMax, of which a
+// random half is left out so that events failing together spread their
+// retries
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	longest := d.BackoffMax
+	if longest <= 0 {
+		longest = 24 * time.Hour
+	}
+
+	delay := d.BackoffBase
+	for i := 1; i < attempt && delay < longest; i++ {
+		delay *= 2
+	}
+	delay = min(delay, longest)
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
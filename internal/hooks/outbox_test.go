@@ -0,0 +1,426 @@
+package hooks_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sonet/internal/adapters"
+	"sonet/internal/config"
+	"sonet/internal/hooks"
+	"sonet/internal/models"
+)
+
+// newOutbox returns a memory adapter and a hook manager writing events to it
+func newOutbox(t *testing.T) (adapters.DatabaseAdapter, *hooks.HookManager) {
+	viper.Set("DB_ADAPTER", "memory")
+	viper.Set("HOOKS_ENABLED", true)
+	viper.Set("WEBHOOK_URL", "")
+	// Test servers listen on loopback
+	viper.Set("WEBHOOK_ALLOW_PRIVATE", true)
+	t.Cleanup(func() {
+		viper.Set("HOOKS_ENABLED", false)
+		viper.Set("WEBHOOK_ALLOW_PRIVATE", false)
+	})
+
+	db, err := adapters.NewDatabaseAdapter()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return db, hooks.NewHookManager()
+}
+
+// Test that events are delivered once they succeed, and retried until then
+func TestDispatcherRetriesFailedEvents(t *testing.T) {
+	db, manager := newOutbox(t)
+	ctx := context.Background()
+
+	var delivered []hooks.Event
+	fail := true
+	manager.Register(hooks.EventPostDeleted, func(event hooks.Event) error {
+		delivered = append(delivered, event)
+		if fail {
+			return errors.New("handler failed")
+		}
+		return nil
+	})
+	require.NoError(t, manager.Trigger(ctx, db, hooks.EventPostDeleted, "", "user-1", "post-1", map[string]string{"id": "post-1"}))
+
+	// Failed events are due again when their lease expires
+	dispatcher := &hooks.Dispatcher{Outbox: db, Manager: manager, BatchSize: 10}
+	n, err := dispatcher.DispatchPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	fail = false
+	n, err = dispatcher.DispatchPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = dispatcher.DispatchPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+
+	// Both attempts carry the same event
+	require.Len(t, delivered, 2)
+	assert.Equal(t, delivered[0].ID, delivered[1].ID)
+	assert.Equal(t, "user-1", delivered[1].UserID)
+	assert.NotZero(t, delivered[1].Timestamp)
+	var data map[string]string
+	require.NoError(t, json.Unmarshal(delivered[1].Data, &data))
+	assert.Equal(t, "post-1", data["id"])
+}
+
+// Test that events claimed by a dispatcher that stopped before delivering
+// them are delivered by another once the lease expires
+func TestDispatcherRecoversClaimedEvents(t *testing.T) {
+	db, manager := newOutbox(t)
+	ctx := context.Background()
+
+	events := make(chan hooks.Event, 1)
+	manager.Register(hooks.EventPostCreated, func(event hooks.Event) error {
+		events <- event
+		return nil
+	})
+	require.NoError(t, manager.Trigger(ctx, db, hooks.EventPostCreated, "", "user-1", "", &models.Post{Content: "Hello"}))
+
+	claimed, err := db.ClaimEvents(ctx, 10, 50*time.Millisecond)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go (&hooks.Dispatcher{Outbox: db, Manager: manager, Interval: 10 * time.Millisecond, BatchSize: 10, Lease: time.Minute}).Run(runCtx)
+
+	select {
+	case event := <-events:
+		assert.Equal(t, claimed[0].ID, event.ID)
+	case <-time.After(time.Second):
+		t.Fatal("expected the claimed event to be delivered")
+	}
+}
+
+// Test that a dispatcher releases the claimed events it has no time to
+// deliver before their lease expires, rather than delivering them late
+func TestDispatcherReleasesEventsPastLease(t *testing.T) {
+	db, manager := newOutbox(t)
+	viper.Set("WEBHOOK_TIMEOUT", 1)
+	t.Cleanup(func() { viper.Set("WEBHOOK_TIMEOUT", 0) })
+	ctx := context.Background()
+
+	var delivered atomic.Int32
+	manager.Register(hooks.EventPostCreated, func(event hooks.Event) error {
+		delivered.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	})
+	for range 3 {
+		require.NoError(t, manager.Trigger(ctx, db, hooks.EventPostCreated, "", "user-1", "", &models.Post{}))
+	}
+
+	// A webhook request no longer fits in the lease once the first event is delivered
+	dispatcher := &hooks.Dispatcher{Outbox: db, Manager: manager, BatchSize: 10, Lease: time.Second + 50*time.Millisecond}
+	n, err := dispatcher.DispatchPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, int32(1), delivered.Load())
+
+	// The others are due at once, without an attempt spent
+	claimed, err := db.ClaimEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	assert.Equal(t, 1, claimed[0].Attempts)
+	assert.Equal(t, 1, claimed[1].Attempts)
+}
+
+// Test that disabled hooks write nothing to the outbox
+func TestTriggerDisabled(t *testing.T) {
+	db, _ := newOutbox(t)
+	viper.Set("HOOKS_ENABLED", false)
+	manager := hooks.NewHookManager()
+
+	require.NoError(t, manager.Trigger(context.Background(), db, hooks.EventPostCreated, "", "user-1", "", &models.Post{}))
+	claimed, err := db.ClaimEvents(context.Background(), 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+}
+
+// Test that failed events are retried after a backoff, and dead-lettered once
+// they run out of attempts
+func TestDispatcherDeadLettersEvents(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	db, _ := newOutbox(t)
+	viper.Set("WEBHOOK_URL", server.URL)
+	viper.Set("WEBHOOK_TIMEOUT", 5)
+	defer viper.Set("WEBHOOK_URL", "")
+	manager := hooks.NewHookManager()
+
+	ctx := context.Background()
+	require.NoError(t, manager.Trigger(ctx, db, hooks.EventPostCreated, "", "user-1", "", &models.Post{}))
+	dispatcher := &hooks.Dispatcher{Outbox: db, Manager: manager, BatchSize: 10, Lease: time.Minute,
+		MaxAttempts: 2, BackoffBase: 20 * time.Millisecond, BackoffMax: time.Minute}
+
+	// The retry waits for the backoff, at least half of BackoffBase
+	_, err := dispatcher.DispatchPending(ctx)
+	require.NoError(t, err)
+	_, err = dispatcher.DispatchPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), requests.Load())
+
+	time.Sleep(50 * time.Millisecond)
+	_, err = dispatcher.DispatchPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+
+	events, err := db.ListDeadLetteredEvents(ctx, adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, 2, events[0].Attempts)
+	assert.Equal(t, "webhook returned status: 500", events[0].LastError)
+
+	time.Sleep(50 * time.Millisecond)
+	_, err = dispatcher.DispatchPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+}
+
+// Test that dead-lettered events are deleted past their retention
+func TestDispatcherDeletesDeadLetteredEvents(t *testing.T) {
+	db, manager := newOutbox(t)
+	ctx := context.Background()
+
+	require.NoError(t, manager.Trigger(ctx, db, hooks.EventPostCreated, "", "user-1", "", &models.Post{}))
+	claimed, err := db.ClaimEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.NoError(t, db.DeadLetterEvent(ctx, claimed[0].ID, "handler failed"))
+	time.Sleep(10 * time.Millisecond)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go (&hooks.Dispatcher{Outbox: db, Manager: manager, Interval: 10 * time.Millisecond, BatchSize: 10, Lease: time.Minute,
+		Retention: time.Hour, DeadLetterRetention: 5 * time.Millisecond}).Run(runCtx)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		events, err := db.ListDeadLetteredEvents(ctx, adapters.Pagination{Limit: 10})
+		require.NoError(t, err)
+		if len(events) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the dead-lettered event to be deleted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Test that events are sent to the enabled webhook subscriptions of their
+// tenant whose filters they match, counting the deliveries
+func TestWebhookSubscriptions(t *testing.T) {
+	var mu sync.Mutex
+	received := map[string][]hooks.Event{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event hooks.Event
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		received[r.URL.Path] = append(received[r.URL.Path], event)
+		mu.Unlock()
+		if r.URL.Path == "/failing" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	db, manager := newOutbox(t)
+	ctx := adapters.WithTenant(context.Background(), "acme")
+	subscribe := func(ctx context.Context, path string, enabled bool, eventTypes, postIDs models.StringList) *models.WebhookSubscription {
+		subscription := &models.WebhookSubscription{URL: server.URL + path, Enabled: enabled, EventTypes: eventTypes, PostIDs: postIDs}
+		require.NoError(t, db.CreateWebhookSubscription(ctx, subscription))
+		return subscription
+	}
+	all := subscribe(ctx, "/all", true, nil, nil)
+	comments := subscribe(ctx, "/comments", true, models.StringList{"comment_created"}, nil)
+	subscribe(ctx, "/post", true, nil, models.StringList{"post-1"})
+	subscribe(ctx, "/disabled", false, nil, nil)
+	failing := subscribe(ctx, "/failing", true, models.StringList{"post_created"}, nil)
+	subscribe(context.Background(), "/elsewhere", true, nil, nil)
+
+	require.NoError(t, manager.Trigger(ctx, db, hooks.EventPostCreated, "acme", "user-1", "post-1", &models.Post{}))
+	require.NoError(t, manager.Trigger(ctx, db, hooks.EventCommentCreated, "acme", "user-1", "post-2", &models.Comment{}))
+
+	dispatcher := &hooks.Dispatcher{Outbox: db, Manager: manager, BatchSize: 10}
+	delivered, err := dispatcher.DispatchPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 6, delivered) // Two for the handlers, four to subscriptions
+
+	types := func(path string) []hooks.EventType {
+		var types []hooks.EventType
+		for _, event := range received[path] {
+			types = append(types, event.Type)
+		}
+		return types
+	}
+	assert.Equal(t, []hooks.EventType{hooks.EventPostCreated, hooks.EventCommentCreated}, types("/all"))
+	assert.Equal(t, []hooks.EventType{hooks.EventCommentCreated}, types("/comments"))
+	assert.Equal(t, []hooks.EventType{hooks.EventPostCreated}, types("/post"))
+	assert.Equal(t, []hooks.EventType{hooks.EventPostCreated}, types("/failing"))
+	assert.Empty(t, received["/disabled"])
+	assert.Empty(t, received["/elsewhere"])
+	assert.Equal(t, "post-2", received["/comments"][0].PostID)
+
+	found, err := db.GetWebhookSubscription(ctx, all.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), found.Stats.DeliveredCount)
+	assert.Zero(t, found.Stats.FailedCount)
+	found, err = db.GetWebhookSubscription(ctx, comments.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), found.Stats.DeliveredCount)
+	found, err = db.GetWebhookSubscription(ctx, failing.ID)
+	require.NoError(t, err)
+	assert.Zero(t, found.Stats.DeliveredCount)
+	assert.Equal(t, int64(1), found.Stats.FailedCount)
+	assert.Equal(t, "webhook returned status: 500", found.Stats.LastError)
+
+	// Deleted subscriptions no longer receive their pending events
+	require.NoError(t, db.DeleteWebhookSubscription(ctx, failing.ID))
+	delivered, err = dispatcher.DispatchPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Len(t, received["/failing"], 1)
+}
+
+// Test that every attempt to send an event to a webhook is recorded with its
+// outcome
+func TestDispatcherRecordsDeliveries(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+		_, _ = w.Write([]byte(strings.Repeat("x", 2000)))
+	}))
+	defer server.Close()
+
+	db, _ := newOutbox(t)
+	viper.Set("WEBHOOK_URL", server.URL+"/global")
+	defer viper.Set("WEBHOOK_URL", "")
+	manager := hooks.NewHookManager()
+
+	ctx := adapters.WithTenant(context.Background(), "acme")
+	subscription := &models.WebhookSubscription{URL: server.URL + "/hooks", Enabled: true}
+	require.NoError(t, db.CreateWebhookSubscription(ctx, subscription))
+	require.NoError(t, manager.Trigger(ctx, db, hooks.EventPostCreated, "acme", "user-1", "post-1", &models.Post{}))
+
+	dispatcher := &hooks.Dispatcher{Outbox: db, Manager: manager, BatchSize: 10}
+	delivered, err := dispatcher.DispatchPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, delivered)
+	status.Store(http.StatusOK)
+	delivered, err = dispatcher.DispatchPending(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, delivered)
+
+	deliveries, err := db.ListWebhookDeliveries(ctx, adapters.DeliveryQuery{SubscriptionID: subscription.ID}, adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, 2, deliveries[0].Attempt)
+	assert.Equal(t, http.StatusOK, deliveries[0].StatusCode)
+	assert.Empty(t, deliveries[0].Error)
+	assert.Equal(t, 1, deliveries[1].Attempt)
+	assert.Equal(t, http.StatusServiceUnavailable, deliveries[1].StatusCode)
+	assert.Equal(t, "webhook returned status: 503", deliveries[1].Error)
+	assert.Equal(t, server.URL+"/hooks", deliveries[1].URL)
+	assert.Empty(t, deliveries[1].Response) // Not kept from loopback, see TestKeepResponse
+	assert.Equal(t, "post_created", deliveries[1].EventType)
+
+	// Deliveries to the webhook URL are recorded in the event's tenant
+	deliveries, err = db.ListWebhookDeliveries(ctx, adapters.DeliveryQuery{EventID: deliveries[0].EventID}, adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 4)
+	var global int
+	for _, delivery := range deliveries {
+		if delivery.URL == server.URL+"/global" {
+			assert.Empty(t, delivery.SubscriptionID)
+			global++
+		}
+	}
+	assert.Equal(t, 2, global)
+}
+
+// Test that the default hook manager follows the configuration loaded at
+// startup, although it is created before
+func TestDefaultHookManagerLoadsConfig(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	t.Setenv("DB_ADAPTER", "memory")
+	require.NoError(t, config.LoadConfig())
+
+	db, err := adapters.NewDatabaseAdapter()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	// Hooks are enabled by default
+	ctx := context.Background()
+	require.NoError(t, hooks.TriggerPostDeleted(ctx, db, "", "user-1", "post-1"))
+	claimed, err := db.ClaimEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Len(t, claimed, 1)
+
+	t.Setenv("HOOKS_ENABLED", "false")
+	require.NoError(t, hooks.TriggerPostDeleted(ctx, db, "", "user-1", "post-2"))
+	claimed, err = db.ClaimEvents(ctx, 10, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, claimed)
+}
+
+// Test that webhook requests time out after the WEBHOOK_TIMEOUT loaded at
+// startup
+func TestWebhookTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	t.Setenv("DB_ADAPTER", "memory")
+	t.Setenv("WEBHOOK_TIMEOUT", "1")
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE", "true")
+	require.NoError(t, config.LoadConfig())
+
+	db, err := adapters.NewDatabaseAdapter()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	ctx := context.Background()
+	require.NoError(t, db.CreateWebhookSubscription(ctx, &models.WebhookSubscription{URL: server.URL, Enabled: true}))
+	require.NoError(t, hooks.TriggerPostDeleted(ctx, db, "", "user-1", "post-1"))
+
+	start := time.Now()
+	delivered, err := hooks.NewDispatcher(db).DispatchPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered) // Only to the handlers
+	assert.Less(t, time.Since(start), 3*time.Second)
+
+	deliveries, err := db.ListWebhookDeliveries(ctx, adapters.DeliveryQuery{}, adapters.Pagination{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Contains(t, deliveries[0].Error, "Client.Timeout exceeded")
+}
@@ -0,0 +1,106 @@
+package hooks
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of webhook requests
+const (
+	HeaderEventID   = "X-Sonet-Event-ID"
+	HeaderTimestamp = "X-Sonet-Timestamp"
+	HeaderSignature = "X-Sonet-Signature"
+)
+
+// DefaultTolerance is how far the timestamp of a webhook request may be from
+// the receiver's clock, see VerifySignature
+const DefaultTolerance = 5 * time.Minute
+
+// Errors of VerifySignature
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrSignatureExpired = errors.New("webhook signature has expired")
+)
+
+// signaturePrefix starts each signature of X-Sonet-Signature, naming its scheme
+const signaturePrefix = "sha256="
+
+// NewSecret generates a random secret for signing the events of a webhook
+// subscription
+func NewSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// Sign returns the X-Sonet-Signature of a webhook body sent at a Unix time:
+// for each secret, "sha256=" and the hex-encoded HMAC-SHA256 of the timestamp
+// and body joined by a dot, separated by commas. Empty secrets are skipped,
+// and without secrets the signature is empty.
+func Sign(body []byte, timestamp int64, secrets ...string) string {
+	signatures := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		if secret != "" {
+			signatures = append(signatures, signaturePrefix+hex.EncodeToString(sign(body, timestamp, secret)))
+		}
+	}
+	return strings.Join(signatures, ",")
+}
+
+// sign returns the HMAC of a timestamp and body
+func sign(body []byte, timestamp int64, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// VerifySignature checks that a webhook request comes from Sonet. It takes
+// the raw body and headers of the request, and the secrets the receiver
+// accepts, any of which may match any signature, so both sides can rotate
+// secrets independently. Requests sent more than tolerance from now,
+// DefaultTolerance if 0, fail with ErrSignatureExpired.
+//
+// Events may be delivered more than once; receivers should skip the event
+// IDs of X-Sonet-Event-ID they have already processed.
+func VerifySignature(body []byte, header http.Header, tolerance time.Duration, secrets ...string) error {
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	sentAt := time.Unix(timestamp, 0)
+	if now := time.Now(); sentAt.Before(now.Add(-tolerance)) || sentAt.After(now.Add(tolerance)) {
+		return ErrSignatureExpired
+	}
+
+	for _, signature := range strings.Split(header.Get(HeaderSignature), ",") {
+		encoded, ok := strings.CutPrefix(strings.TrimSpace(signature), signaturePrefix)
+		if !ok {
+			continue
+		}
+		mac, err := hex.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		for _, secret := range secrets {
+			if secret != "" && hmac.Equal(mac, sign(body, timestamp, secret)) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidSignature
+}
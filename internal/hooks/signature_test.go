@@ -0,0 +1,127 @@
+package hooks_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"sonet/internal/adapters"
+	"sonet/internal/config"
+	"sonet/internal/hooks"
+	"sonet/internal/models"
+)
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"id":"event-1","type":"post_created"}`)
+	now := time.Now().Unix()
+	headers := func(timestamp int64, signature string) http.Header {
+		header := http.Header{}
+		header.Set(hooks.HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+		header.Set(hooks.HeaderSignature, signature)
+		return header
+	}
+
+	tests := []struct {
+		name    string
+		body    []byte
+		header  http.Header
+		secrets []string
+		err     error
+	}{
+		{"valid", body, headers(now, hooks.Sign(body, now, "current")), []string{"current"}, nil},
+		{"signed during rotation", body, headers(now, hooks.Sign(body, now, "current", "previous")), []string{"previous"}, nil},
+		{"receiver rotating", body, headers(now, hooks.Sign(body, now, "current")), []string{"next", "current"}, nil},
+		{"wrong secret", body, headers(now, hooks.Sign(body, now, "current")), []string{"other"}, hooks.ErrInvalidSignature},
+		{"tampered body", []byte(`{"id":"event-2"}`), headers(now, hooks.Sign(body, now, "current")), []string{"current"}, hooks.ErrInvalidSignature},
+		{"tampered timestamp", body, headers(now+1, hooks.Sign(body, now, "current")), []string{"current"}, hooks.ErrInvalidSignature},
+		{"expired", body, headers(now-600, hooks.Sign(body, now-600, "current")), []string{"current"}, hooks.ErrSignatureExpired},
+		{"unsigned", body, headers(now, ""), []string{"current"}, hooks.ErrInvalidSignature},
+		{"no timestamp", body, http.Header{hooks.HeaderSignature: {hooks.Sign(body, now, "current")}}, []string{"current"}, hooks.ErrInvalidSignature},
+		{"no secrets", body, headers(now, hooks.Sign(body, now, "current")), nil, hooks.ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.err, hooks.VerifySignature(tt.body, tt.header, 0, tt.secrets...))
+		})
+	}
+}
+
+// Test that webhooks receive the event ID, timestamp and signature headers
+func TestWebhookSignature(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{header: r.Header, body: body}
+	}))
+	defer server.Close()
+
+	db, _ := newOutbox(t)
+	viper.Set("WEBHOOK_URL", server.URL)
+	viper.Set("WEBHOOK_SECRET", "current")
+	viper.Set("WEBHOOK_PREVIOUS_SECRET", "previous")
+	defer func() {
+		viper.Set("WEBHOOK_URL", "")
+		viper.Set("WEBHOOK_SECRET", "")
+		viper.Set("WEBHOOK_PREVIOUS_SECRET", "")
+	}()
+	manager := hooks.NewHookManager()
+
+	ctx := context.Background()
+	require.NoError(t, manager.Trigger(ctx, db, hooks.EventPostCreated, "", "user-1", "", &models.Post{}))
+	delivered, err := (&hooks.Dispatcher{Outbox: db, Manager: manager, BatchSize: 10}).DispatchPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+
+	request := <-requests
+	assert.NotEmpty(t, request.header.Get(hooks.HeaderEventID))
+	assert.Contains(t, string(request.body), `"id":"`+request.header.Get(hooks.HeaderEventID)+`"`)
+	assert.NoError(t, hooks.VerifySignature(request.body, request.header, 0, "current"))
+	assert.NoError(t, hooks.VerifySignature(request.body, request.header, 0, "previous"))
+	assert.Equal(t, hooks.ErrInvalidSignature, hooks.VerifySignature(request.body, request.header, 0, "other"))
+}
+
+// Test that the default hook manager sends events to the WEBHOOK_URL loaded
+// at startup, signed with WEBHOOK_SECRET
+func TestDefaultWebhookLoadsConfig(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	t.Setenv("DB_ADAPTER", "memory")
+	t.Setenv("WEBHOOK_URL", server.URL)
+	t.Setenv("WEBHOOK_SECRET", "current")
+	require.NoError(t, config.LoadConfig())
+
+	db, err := adapters.NewDatabaseAdapter()
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	ctx := context.Background()
+	require.NoError(t, hooks.TriggerPostDeleted(ctx, db, "", "user-1", "post-1"))
+	delivered, err := hooks.NewDispatcher(db).DispatchPending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+
+	request := <-requests
+	assert.NoError(t, hooks.VerifySignature(<-bodies, request.Header, 0, "current"))
+}
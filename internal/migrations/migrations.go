@@ -0,0 +1,333 @@
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Dialects with migrations
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// advisoryLockID identifies the Postgres advisory lock held while migrating,
+// so that replicas starting at the same time apply migrations one at a time
+const advisoryLockID int64 = 7_301_455_219
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+// fileName matches migration files such as 0001_initial_schema.up.sql
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// requiresDirective marks an up migration that needs an optional database
+// feature, e.g. "-- sonet:requires fts5". Such migrations are left pending
+// until the database supports the feature.
+var requiresDirective = regexp.MustCompile(`(?m)^-- sonet:requires (\w+)\s*$`)
+
+// rebuildsDirective marks an up migration that derives its data from the
+// tables as they are when it runs, e.g. a search index, with
+// "-- sonet:rebuilds". Only such migrations are applied after later ones,
+// as happens once the database gains the feature a migration requires.
+var rebuildsDirective = regexp.MustCompile(`(?m)^-- sonet:rebuilds\s*$`)
+
+// schemaMigrationsDDL creates the table recording applied migrations
+var schemaMigrationsDDL = map[string]string{
+	Postgres: `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamptz NOT NULL
+	)`,
+	SQLite: `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version integer PRIMARY KEY,
+		name text NOT NULL,
+		applied_at datetime NOT NULL
+	)`,
+}
+
+// Migration is a versioned schema change with the SQL to apply and revert it
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Requires string // Optional database feature the migration needs
+	Rebuilds bool   // The migration may be applied after later ones
+}
+
+// Status reports whether a migration has been applied
+type Status struct {
+	Migration
+	AppliedAt   *time.Time
+	Unsupported bool // The database lacks the feature the migration requires
+}
+
+// schemaMigration is a row of the schema_migrations table
+type schemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// TableName overrides the table name used by GORM
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrator applies and reverts the migrations of a dialect on a database
+type Migrator struct {
+	db         *gorm.DB
+	dialect    string
+	migrations []Migration
+}
+
+// New creates a migrator for the embedded migrations of a dialect
+func New(db *gorm.DB, dialect string) (*Migrator, error) {
+	migrations, err := Load(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// Load returns the embedded migrations of a dialect ordered by version
+func Load(dialect string) ([]Migration, error) {
+	if _, ok := schemaMigrationsDDL[dialect]; !ok {
+		return nil, fmt.Errorf("no migrations for dialect %q", dialect)
+	}
+
+	entries, err := fs.ReadDir(files, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, migration.Name, match[2])
+		}
+
+		sql, err := fs.ReadFile(files, path.Join(dialect, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			migration.Up = string(sql)
+			if requires := requiresDirective.FindStringSubmatch(migration.Up); requires != nil {
+				migration.Requires = requires[1]
+			}
+			migration.Rebuilds = rebuildsDirective.MatchString(migration.Up)
+		} else {
+			migration.Down = string(sql)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Up applies all pending migrations in order and returns the ones applied.
+// Migrations requiring a feature the database lacks are skipped. Pending
+// migrations older than applied ones fail, unless they rebuild their data.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(db *gorm.DB) error {
+		done, err := m.appliedVersions(db)
+		if err != nil {
+			return err
+		}
+		latest := 0
+		for version := range done {
+			latest = max(latest, version)
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := done[migration.Version]; ok {
+				continue
+			}
+
+			supported, err := m.supports(db, migration.Requires)
+			if err != nil {
+				return err
+			}
+			if !supported {
+				continue
+			}
+			if migration.Version < latest && !migration.Rebuilds {
+				return fmt.Errorf("migration %04d_%s is pending but later migrations are applied, and it cannot be applied out of order", migration.Version, migration.Name)
+			}
+
+			err = db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Up).Error; err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{
+					Version:   migration.Version,
+					Name:      migration.Name,
+					AppliedAt: time.Now().UTC(),
+				}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+			latest = max(latest, migration.Version)
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns
+// the ones reverted
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	byVersion := make(map[int]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	var reverted []Migration
+	err := m.withLock(ctx, func(db *gorm.DB) error {
+		var rows []schemaMigration
+		if err := db.Order("version DESC").Limit(steps).Find(&rows).Error; err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			migration, ok := byVersion[row.Version]
+			if !ok {
+				return fmt.Errorf("migration %d_%s is applied but unknown to this build", row.Version, row.Name)
+			}
+
+			err := db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Exec(migration.Down).Error; err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{}, "version = ?", migration.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+
+	return reverted, err
+}
+
+// Status returns every known migration with the time it was applied, if it was
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	db := m.db.WithContext(ctx)
+	if err := db.Exec(schemaMigrationsDDL[m.dialect]).Error; err != nil {
+		return nil, err
+	}
+
+	done, err := m.appliedVersions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = Status{Migration: migration}
+		if appliedAt, ok := done[migration.Version]; ok {
+			statuses[i].AppliedAt = &appliedAt
+			continue
+		}
+
+		supported, err := m.supports(db, migration.Requires)
+		if err != nil {
+			return nil, err
+		}
+		statuses[i].Unsupported = !supported
+	}
+	return statuses, nil
+}
+
+// supports reports whether the database has an optional feature
+func (m *Migrator) supports(db *gorm.DB, feature string) (bool, error) {
+	switch {
+	case feature == "":
+		return true, nil
+	case feature == "fts5" && m.dialect == SQLite:
+		// FTS5 is only compiled into go-sqlite3 with the sqlite_fts5 build tag
+		var used int
+		err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used).Error
+		return used == 1, err
+	default:
+		return false, fmt.Errorf("unknown migration requirement %q", feature)
+	}
+}
+
+// appliedVersions returns the applied migration versions with the time they were applied
+func (m *Migrator) appliedVersions(db *gorm.DB) (map[int]time.Time, error) {
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	done := make(map[int]time.Time, len(rows))
+	for _, row := range rows {
+		done[row.Version] = row.AppliedAt
+	}
+	return done, nil
+}
+
+// withLock runs fn with the schema_migrations table in place. On Postgres, fn
+// runs on a single connection holding an advisory lock, so only one process
+// migrates at a time. SQLite serializes writers on the database file itself.
+func (m *Migrator) withLock(ctx context.Context, fn func(db *gorm.DB) error) error {
+	db := m.db.WithContext(ctx)
+	if m.dialect != Postgres {
+		if err := db.Exec(schemaMigrationsDDL[m.dialect]).Error; err != nil {
+			return err
+		}
+		return fn(db)
+	}
+
+	return db.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", advisoryLockID).Error; err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		// Release the lock even if ctx is done, since the connection goes back to the pool
+		defer conn.WithContext(context.Background()).Exec("SELECT pg_advisory_unlock(?)", advisoryLockID)
+
+		if err := conn.Exec(schemaMigrationsDDL[m.dialect]).Error; err != nil {
+			return err
+		}
+		return fn(conn)
+	})
+}
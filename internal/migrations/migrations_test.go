@@ -0,0 +1,210 @@
+package migrations_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"sonet/internal/migrations"
+	"sonet/internal/models"
+)
+
+func openSQLite(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "sonet.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		_ = sqlDB.Close()
+	})
+	return db
+}
+
+func TestLoad(t *testing.T) {
+	for _, dialect := range []string{migrations.Postgres, migrations.SQLite} {
+		loaded, err := migrations.Load(dialect)
+		require.NoError(t, err, dialect)
+		require.NotEmpty(t, loaded, dialect)
+
+		// Versions start at 1 and have no gaps
+		for i, migration := range loaded {
+			assert.Equal(t, i+1, migration.Version, dialect)
+			assert.NotEmpty(t, migration.Up, dialect)
+			assert.NotEmpty(t, migration.Down, dialect)
+		}
+	}
+
+	_, err := migrations.Load("mysql")
+	assert.Error(t, err)
+}
+
+func TestUpDownStatus(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	migrator, err := migrations.New(db, migrations.SQLite)
+	require.NoError(t, err)
+
+	all, _ := migrations.Load(migrations.SQLite)
+
+	// Migrations requiring features this build lacks are never applied
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, len(all))
+	var supported []migrations.Migration
+	for _, status := range statuses {
+		assert.Nil(t, status.AppliedAt)
+		if !status.Unsupported {
+			supported = append(supported, status.Migration)
+		} else {
+			assert.NotEmpty(t, status.Requires)
+		}
+	}
+
+	applied, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, supported, applied)
+	assert.True(t, db.Migrator().HasTable(&models.Post{}))
+
+	// A second run has nothing to do
+	applied, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	statuses, err = migrator.Status(ctx)
+	require.NoError(t, err)
+	for _, status := range statuses {
+		assert.Equal(t, !status.Unsupported, status.AppliedAt != nil)
+	}
+
+	// The schema works with the models
+	post := &models.Post{UserID: "user-1", Content: "hello", Metadata: models.JSON{"a": "b"}}
+	require.NoError(t, db.Create(post).Error)
+	require.NoError(t, db.Create(&models.Reaction{UserID: "user-1", TargetID: post.ID, TargetType: "post", Type: "like"}).Error)
+
+	// Reverting everything drops the tables
+	reverted, err := migrator.Down(ctx, len(all))
+	require.NoError(t, err)
+	assert.Len(t, reverted, len(supported))
+	assert.Equal(t, supported[len(supported)-1].Version, reverted[0].Version)
+	assert.False(t, db.Migrator().HasTable(&models.Post{}))
+
+	reverted, err = migrator.Down(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, reverted)
+}
+
+// legacyPost is a post as it was when AutoMigrate created the schema
+type legacyPost struct {
+	ID        string `gorm:"primaryKey"`
+	UserID    string `gorm:"index"`
+	Content   string
+	City      string      `gorm:"index"`
+	Latitude  float64     `gorm:"index"`
+	Longitude float64     `gorm:"index"`
+	Metadata  models.JSON `gorm:"type:jsonb"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (legacyPost) TableName() string { return "posts" }
+
+// legacyComment is a comment as it was when AutoMigrate created the schema
+type legacyComment struct {
+	ID        string `gorm:"primaryKey"`
+	PostID    string `gorm:"index"`
+	UserID    string `gorm:"index"`
+	Content   string
+	ParentID  *string     `gorm:"index"`
+	Metadata  models.JSON `gorm:"type:jsonb"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (legacyComment) TableName() string { return "comments" }
+
+// legacyReaction is a reaction as it was when AutoMigrate created the schema
+type legacyReaction struct {
+	ID         string `gorm:"primaryKey"`
+	UserID     string `gorm:"uniqueIndex:idx_reactions_unique"`
+	TargetID   string `gorm:"uniqueIndex:idx_reactions_unique"`
+	TargetType string `gorm:"uniqueIndex:idx_reactions_unique"`
+	Type       string `gorm:"uniqueIndex:idx_reactions_unique"`
+	CreatedAt  time.Time
+}
+
+func (legacyReaction) TableName() string { return "reactions" }
+
+// legacyAttachment is an attachment as it was when AutoMigrate created the schema
+type legacyAttachment struct {
+	ID        string `gorm:"primaryKey"`
+	URL       string
+	Type      string
+	PostID    *string     `gorm:"index"`
+	CommentID *string     `gorm:"index"`
+	Metadata  models.JSON `gorm:"type:jsonb"`
+	CreatedAt time.Time
+}
+
+func (legacyAttachment) TableName() string { return "attachments" }
+
+// A database created by AutoMigrate before versioned migrations adopts them as is
+func TestUpAdoptsAutoMigratedSchema(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	require.NoError(t, db.AutoMigrate(&legacyPost{}, &legacyComment{}, &legacyReaction{}, &legacyAttachment{}))
+	require.NoError(t, db.Create(&legacyPost{ID: "post-1", UserID: "user-1", Content: "kept"}).Error)
+
+	migrator, err := migrations.New(db, migrations.SQLite)
+	require.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+
+	var post models.Post
+	require.NoError(t, db.First(&post, "id = ?", "post-1").Error)
+	assert.Equal(t, "kept", post.Content)
+	assert.Equal(t, "", post.TenantID)
+}
+
+// Pending migrations older than applied ones are only applied if they rebuild
+// their data, as the full-text index does once FTS5 is available
+func TestUpOutOfOrder(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+	migrator, err := migrations.New(db, migrations.SQLite)
+	require.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	require.NoError(t, db.Create(&models.Post{UserID: "user-1", Content: "indexed later"}).Error)
+
+	all, _ := migrations.Load(migrations.SQLite)
+	fts, language := all[1], all[2]
+	assert.Equal(t, "fts5", fts.Requires)
+	assert.True(t, fts.Rebuilds)
+	assert.False(t, language.Rebuilds)
+
+	// As if the index had been skipped, and the language added by hand
+	require.NoError(t, db.Exec(fts.Down).Error)
+	require.NoError(t, db.Exec("DELETE FROM schema_migrations WHERE version IN (?, ?)", fts.Version, language.Version).Error)
+
+	_, err = migrator.Up(ctx)
+	assert.ErrorContains(t, err, "0003_post_language is pending but later migrations are applied")
+
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, !statuses[1].Unsupported, statuses[1].AppliedAt != nil)
+	assert.Nil(t, statuses[2].AppliedAt)
+	if !statuses[1].Unsupported {
+		var count int
+		require.NoError(t, db.Raw("SELECT count(*) FROM posts_fts WHERE posts_fts MATCH 'indexed'").Scan(&count).Error)
+		assert.Equal(t, 1, count)
+	}
+}
@@ -0,0 +1,5 @@
+-- The PostGIS extension is left in place, other schemas may depend on it
+DROP TABLE IF EXISTS attachments;
+DROP TABLE IF EXISTS reactions;
+DROP TABLE IF EXISTS comments;
+DROP TABLE IF EXISTS posts;
@@ -0,0 +1,62 @@
+-- Initial schema, matching what AutoMigrate created before versioned
+-- migrations, so existing databases adopt it without changes.
+
+-- PostGIS provides the geospatial functions used by location queries
+CREATE EXTENSION IF NOT EXISTS postgis;
+
+CREATE TABLE IF NOT EXISTS posts (
+    id text PRIMARY KEY,
+    user_id text,
+    content text,
+    city text,
+    latitude decimal,
+    longitude decimal,
+    metadata jsonb,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_posts_user_id ON posts (user_id);
+CREATE INDEX IF NOT EXISTS idx_posts_city ON posts (city);
+CREATE INDEX IF NOT EXISTS idx_posts_latitude ON posts (latitude);
+CREATE INDEX IF NOT EXISTS idx_posts_longitude ON posts (longitude);
+
+-- Spatial index for geolocation queries
+CREATE INDEX IF NOT EXISTS idx_posts_location ON posts USING GIST (
+    ST_SetSRID(ST_MakePoint(longitude, latitude), 4326)
+);
+
+CREATE TABLE IF NOT EXISTS comments (
+    id text PRIMARY KEY,
+    post_id text,
+    user_id text,
+    content text,
+    parent_id text,
+    metadata jsonb,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments (post_id);
+CREATE INDEX IF NOT EXISTS idx_comments_user_id ON comments (user_id);
+CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments (parent_id);
+
+CREATE TABLE IF NOT EXISTS reactions (
+    id text PRIMARY KEY,
+    user_id text,
+    target_id text,
+    target_type text,
+    type text,
+    created_at timestamptz
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reactions_unique ON reactions (user_id, target_id, target_type, type);
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id text PRIMARY KEY,
+    url text,
+    type text,
+    post_id text,
+    comment_id text,
+    metadata jsonb,
+    created_at timestamptz
+);
+CREATE INDEX IF NOT EXISTS idx_attachments_post_id ON attachments (post_id);
+CREATE INDEX IF NOT EXISTS idx_attachments_comment_id ON attachments (comment_id);
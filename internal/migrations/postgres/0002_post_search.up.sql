@@ -0,0 +1,10 @@
+-- Full-text search on a stored tsvector column, indexed with GIN. Each post
+-- is indexed with the text search configuration of its language, which the
+-- application sets in search_config from SEARCH_LANGUAGES.
+
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS language text;
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS search_config regconfig NOT NULL DEFAULT 'english';
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (to_tsvector(search_config, coalesce(content, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING GIN (search_vector);
@@ -0,0 +1,16 @@
+-- API keys of backend services. Only a SHA-256 hash of each key is stored;
+-- keys are looked up by their prefix, which is not secret.
+
+CREATE TABLE api_keys (
+    id text PRIMARY KEY,
+    tenant_id text NOT NULL DEFAULT '',
+    name text,
+    prefix text,
+    hash text,
+    scopes text,
+    rate_limit integer,
+    created_at timestamptz,
+    revoked_at timestamptz
+);
+CREATE INDEX idx_api_keys_tenant_id ON api_keys (tenant_id);
+CREATE UNIQUE INDEX idx_api_keys_prefix ON api_keys (prefix);
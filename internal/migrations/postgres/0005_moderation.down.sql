@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS moderation_actions;
+
+ALTER TABLE comments DROP COLUMN hidden_at;
+ALTER TABLE posts DROP COLUMN hidden_at;
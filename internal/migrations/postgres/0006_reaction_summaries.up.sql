@@ -0,0 +1,3 @@
+-- Reactions by target, for aggregating the reactions to posts and comments.
+
+CREATE INDEX idx_reactions_tenant_target ON reactions (tenant_id, target_id, target_type, type, created_at);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS reaction_counts;
+
+ALTER TABLE comments DROP COLUMN reply_count;
+ALTER TABLE posts DROP COLUMN comment_count;
@@ -0,0 +1,24 @@
+-- Comment, reply and reaction counts of posts and comments, maintained along
+-- with the comments and reactions, counted from the existing ones.
+
+ALTER TABLE posts ADD COLUMN comment_count bigint NOT NULL DEFAULT 0;
+ALTER TABLE comments ADD COLUMN reply_count bigint NOT NULL DEFAULT 0;
+
+CREATE TABLE reaction_counts (
+    tenant_id text NOT NULL DEFAULT '',
+    target_id text,
+    target_type text,
+    type text,
+    count bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, target_id, target_type, type)
+);
+
+UPDATE posts SET comment_count = (
+    SELECT COUNT(*) FROM comments WHERE comments.tenant_id = posts.tenant_id AND comments.post_id = posts.id
+);
+UPDATE comments SET reply_count = (
+    SELECT COUNT(*) FROM comments AS replies WHERE replies.tenant_id = comments.tenant_id AND replies.parent_id = comments.id
+);
+INSERT INTO reaction_counts (tenant_id, target_id, target_type, type, count)
+SELECT tenant_id, target_id, target_type, type, COUNT(*) FROM reactions
+GROUP BY tenant_id, target_id, target_type, type;
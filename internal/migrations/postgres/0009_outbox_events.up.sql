@@ -0,0 +1,16 @@
+-- Outbox of hook events, written in the same transaction as the changes they
+-- describe and delivered from there.
+
+CREATE TABLE outbox_events (
+    id text PRIMARY KEY,
+    tenant_id text NOT NULL DEFAULT '',
+    type text,
+    payload text,
+    attempts integer NOT NULL DEFAULT 0,
+    last_error text,
+    available_at timestamptz,
+    delivered_at timestamptz,
+    created_at timestamptz
+);
+CREATE INDEX idx_outbox_events_pending ON outbox_events (available_at) WHERE delivered_at IS NULL;
+CREATE INDEX idx_outbox_events_delivered ON outbox_events (delivered_at);
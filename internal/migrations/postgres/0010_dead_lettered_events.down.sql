@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_outbox_events_dead_lettered;
+DROP INDEX IF EXISTS idx_outbox_events_pending;
+
+ALTER TABLE outbox_events DROP COLUMN dead_lettered_at;
+
+CREATE INDEX idx_outbox_events_pending ON outbox_events (available_at) WHERE delivered_at IS NULL;
@@ -0,0 +1,24 @@
+-- Every attempt to send a hook event to a webhook, kept for
+-- HOOKS_RETENTION_HOURS, and an index to find the events of a tenant by time
+-- to send them again.
+
+CREATE TABLE webhook_deliveries (
+    id text PRIMARY KEY,
+    tenant_id text NOT NULL DEFAULT '',
+    event_id text NOT NULL,
+    event_type text,
+    subscription_id text NOT NULL DEFAULT '',
+    url text,
+    attempt integer,
+    status_code integer,
+    latency_ms bigint,
+    response text,
+    error text,
+    created_at timestamptz
+);
+CREATE INDEX idx_webhook_deliveries_created_at ON webhook_deliveries (created_at);
+CREATE INDEX idx_webhook_deliveries_event_id ON webhook_deliveries (event_id);
+CREATE INDEX idx_webhook_deliveries_tenant ON webhook_deliveries (tenant_id, created_at);
+CREATE INDEX idx_webhook_deliveries_subscription ON webhook_deliveries (subscription_id, created_at);
+
+CREATE INDEX idx_outbox_events_tenant ON outbox_events (tenant_id, created_at) WHERE subscription_id = '';
@@ -0,0 +1,34 @@
+-- sonet:requires fts5
+-- sonet:rebuilds
+--
+-- Full-text index of post content, kept in sync with posts by triggers.
+-- Without FTS5 this migration stays pending and search falls back to LIKE.
+-- It indexes the posts that exist when it runs, so it is applied after
+-- later migrations once FTS5 is available.
+--
+-- The index refers to posts by rowid. VACUUM may renumber the rowids of
+-- posts, so rebuild the index after vacuuming:
+--   INSERT INTO posts_fts(posts_fts) VALUES ('rebuild');
+
+CREATE VIRTUAL TABLE IF NOT EXISTS posts_fts USING fts5(
+    content,
+    content = 'posts',
+    content_rowid = 'rowid',
+    tokenize = 'porter unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_insert AFTER INSERT ON posts BEGIN
+    INSERT INTO posts_fts (rowid, content) VALUES (new.rowid, new.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_delete AFTER DELETE ON posts BEGIN
+    INSERT INTO posts_fts (posts_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+END;
+
+CREATE TRIGGER IF NOT EXISTS posts_fts_update AFTER UPDATE OF content ON posts BEGIN
+    INSERT INTO posts_fts (posts_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+    INSERT INTO posts_fts (rowid, content) VALUES (new.rowid, new.content);
+END;
+
+-- Index the posts that already exist
+INSERT INTO posts_fts (posts_fts) VALUES ('rebuild');
@@ -0,0 +1,2 @@
+-- Language of the post content. SQLite search indexes every language alike.
+ALTER TABLE posts ADD COLUMN language text;
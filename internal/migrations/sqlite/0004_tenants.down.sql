@@ -0,0 +1,16 @@
+DROP INDEX IF EXISTS idx_reactions_unique;
+CREATE UNIQUE INDEX idx_reactions_unique ON reactions (user_id, target_id, target_type, type);
+
+DROP INDEX IF EXISTS idx_comments_tenant_post;
+CREATE INDEX idx_comments_post_id ON comments (post_id);
+
+DROP INDEX IF EXISTS idx_posts_tenant_created;
+DROP INDEX IF EXISTS idx_posts_tenant_city;
+DROP INDEX IF EXISTS idx_posts_tenant_user;
+CREATE INDEX idx_posts_city ON posts (city);
+CREATE INDEX idx_posts_user_id ON posts (user_id);
+
+ALTER TABLE attachments DROP COLUMN tenant_id;
+ALTER TABLE reactions DROP COLUMN tenant_id;
+ALTER TABLE comments DROP COLUMN tenant_id;
+ALTER TABLE posts DROP COLUMN tenant_id;
@@ -0,0 +1,19 @@
+-- Tenant of every record, so one deployment can serve several applications.
+-- Existing records belong to the default tenant, ''.
+
+ALTER TABLE posts ADD COLUMN tenant_id text NOT NULL DEFAULT '';
+ALTER TABLE comments ADD COLUMN tenant_id text NOT NULL DEFAULT '';
+ALTER TABLE reactions ADD COLUMN tenant_id text NOT NULL DEFAULT '';
+ALTER TABLE attachments ADD COLUMN tenant_id text NOT NULL DEFAULT '';
+
+DROP INDEX IF EXISTS idx_posts_user_id;
+DROP INDEX IF EXISTS idx_posts_city;
+CREATE INDEX idx_posts_tenant_user ON posts (tenant_id, user_id);
+CREATE INDEX idx_posts_tenant_city ON posts (tenant_id, city);
+CREATE INDEX idx_posts_tenant_created ON posts (tenant_id, created_at);
+
+DROP INDEX IF EXISTS idx_comments_post_id;
+CREATE INDEX idx_comments_tenant_post ON comments (tenant_id, post_id);
+
+DROP INDEX IF EXISTS idx_reactions_unique;
+CREATE UNIQUE INDEX idx_reactions_unique ON reactions (tenant_id, user_id, target_id, target_type, type);
@@ -0,0 +1,17 @@
+-- Posts and comments hidden by moderators, and the log of moderation actions.
+
+ALTER TABLE posts ADD COLUMN hidden_at datetime;
+ALTER TABLE comments ADD COLUMN hidden_at datetime;
+
+CREATE TABLE moderation_actions (
+    id text PRIMARY KEY,
+    tenant_id text NOT NULL DEFAULT '',
+    action text,
+    target_type text,
+    target_id text,
+    author_id text,
+    moderator_id text,
+    reason text,
+    created_at datetime
+);
+CREATE INDEX idx_moderation_actions_tenant_created ON moderation_actions (tenant_id, created_at);
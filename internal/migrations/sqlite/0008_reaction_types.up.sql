@@ -0,0 +1,10 @@
+-- Custom reaction types of tenants, such as custom emoji.
+
+CREATE TABLE reaction_types (
+    id text PRIMARY KEY,
+    tenant_id text NOT NULL DEFAULT '',
+    name text,
+    image_url text,
+    created_at datetime
+);
+CREATE UNIQUE INDEX idx_reaction_types_tenant_name ON reaction_types (tenant_id, name);
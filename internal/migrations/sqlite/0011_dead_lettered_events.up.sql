@@ -0,0 +1,8 @@
+-- Hook events that failed every delivery attempt are dead-lettered, and no
+-- longer claimed until an admin replays them.
+
+ALTER TABLE outbox_events ADD COLUMN dead_lettered_at datetime;
+
+DROP INDEX IF EXISTS idx_outbox_events_pending;
+CREATE INDEX idx_outbox_events_pending ON outbox_events (available_at) WHERE delivered_at IS NULL AND dead_lettered_at IS NULL;
+CREATE INDEX idx_outbox_events_dead_lettered ON outbox_events (tenant_id, created_at) WHERE dead_lettered_at IS NOT NULL;
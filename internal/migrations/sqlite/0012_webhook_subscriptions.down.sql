@@ -0,0 +1,3 @@
+ALTER TABLE outbox_events DROP COLUMN subscription_id;
+
+DROP TABLE IF EXISTS webhook_subscriptions;
@@ -0,0 +1,25 @@
+-- Webhook endpoints of each tenant, with the event filters and delivery
+-- stats of each. Hook events are stored once more in the outbox for each
+-- subscription they match.
+
+CREATE TABLE webhook_subscriptions (
+    id text PRIMARY KEY,
+    tenant_id text NOT NULL DEFAULT '',
+    url text NOT NULL,
+    event_types text,
+    post_ids text,
+    user_ids text,
+    enabled boolean NOT NULL,
+    secret text,
+    previous_secret text,
+    delivered_count integer NOT NULL DEFAULT 0,
+    failed_count integer NOT NULL DEFAULT 0,
+    last_delivered_at datetime,
+    last_failed_at datetime,
+    last_error text,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE INDEX idx_webhook_subscriptions_tenant_id ON webhook_subscriptions (tenant_id);
+
+ALTER TABLE outbox_events ADD COLUMN subscription_id text NOT NULL DEFAULT '';
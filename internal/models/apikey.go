@@ -0,0 +1,69 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// APIKey is a key that a backend service authenticates with. Only a hash of
+// the key is stored; the key itself is shown once, when it is created.
+type APIKey struct {
+	ID        string     `json:"id" gorm:"primaryKey"`
+	TenantID  string     `json:"-" gorm:"not null;default:'';index"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix" gorm:"uniqueIndex"` // Public part of the key, used to look it up
+	Hash      string     `json:"-"`                         // Hex-encoded SHA-256 of the whole key
+	Scopes    StringList `json:"scopes" gorm:"type:text"`
+	RateLimit int        `json:"rate_limit"` // Requests per RATE_LIMIT_DURATION, 0 for RATE_LIMIT_REQUESTS
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// BeforeCreate hook for API keys to generate IDs
+func (k *APIKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == "" {
+		k.ID = NewID()
+	}
+	if k.CreatedAt.IsZero() {
+		k.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// Revoked reports whether the key has been revoked
+func (k *APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
+
+// StringList is a list of strings stored as comma-separated text
+type StringList []string
+
+// Value implements the driver.Valuer interface for database/sql
+func (l StringList) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+// Scan implements the sql.Scanner interface for database/sql
+func (l *StringList) Scan(value interface{}) error {
+	var text string
+	switch v := value.(type) {
+	case nil:
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		return fmt.Errorf("failed to scan string list: unsupported type %T", value)
+	}
+
+	if text == "" {
+		*l = StringList{}
+		return nil
+	}
+	*l = strings.Split(text, ",")
+	return nil
+}
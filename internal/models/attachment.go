@@ -20,6 +20,7 @@ const (
 // Attachment represents a file or media attachment to a post or comment
 type Attachment struct {
 	ID        string         `json:"id" gorm:"primaryKey"`
+	TenantID  string         `json:"-" gorm:"not null;default:''"`
 	URL       string         `json:"url"`
 	Type      AttachmentType `json:"type"`
 	PostID    *string        `json:"post_id,omitempty" gorm:"index"`
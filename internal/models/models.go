@@ -9,39 +9,86 @@ import (
 
 // Post represents a user post
 type Post struct {
-	ID          string       `json:"id" gorm:"primaryKey"`
-	UserID      string       `json:"user_id" gorm:"index"`
-	Content     string       `json:"content"`
-	City        string       `json:"city,omitempty" gorm:"index"`
-	Latitude    float64      `json:"latitude,omitempty" gorm:"index"`
-	Longitude   float64      `json:"longitude,omitempty" gorm:"index"`
-	Metadata    JSON         `json:"metadata,omitempty" gorm:"type:jsonb"`
-	Attachments []Attachment `json:"attachments,omitempty" gorm:"-"` // Loaded separately
-	CreatedAt   time.Time    `json:"created_at"`
-	UpdatedAt   time.Time    `json:"updated_at"`
+	ID             string           `json:"id" gorm:"primaryKey"`
+	TenantID       string           `json:"-" gorm:"not null;default:'';index:idx_posts_tenant_user;index:idx_posts_tenant_city;index:idx_posts_tenant_created"`
+	UserID         string           `json:"user_id" gorm:"index:idx_posts_tenant_user"`
+	Content        string           `json:"content"`
+	Language       string           `json:"language,omitempty"` // BCP 47 language tag, e.g. "en" or "pt-BR"
+	City           string           `json:"city,omitempty" gorm:"index:idx_posts_tenant_city"`
+	Latitude       float64          `json:"latitude,omitempty" gorm:"index"`
+	Longitude      float64          `json:"longitude,omitempty" gorm:"index"`
+	Metadata       JSON             `json:"metadata,omitempty" gorm:"type:jsonb"`
+	Attachments    []Attachment     `json:"attachments,omitempty" gorm:"-"`             // Loaded separately
+	Snippet        string           `json:"snippet,omitempty" gorm:"->;-:migration"`    // Highlighted excerpt, selected by text search
+	HiddenAt       *time.Time       `json:"hidden_at,omitempty"`                        // Set when a moderator hides the post
+	CommentCount   int64            `json:"comment_count" gorm:"->;not null;default:0"` // Maintained by the adapter, hidden comments included
+	ReactionCounts map[string]int64 `json:"reaction_counts" gorm:"-"`                   // By type, loaded separately
+	Reactions      *ReactionSummary `json:"reactions,omitempty" gorm:"-"`               // Loaded on request
+	CreatedAt      time.Time        `json:"created_at" gorm:"index:idx_posts_tenant_created"`
+	UpdatedAt      time.Time        `json:"updated_at"`
 }
 
 // Comment represents a comment on a post
 type Comment struct {
-	ID         string      `json:"id" gorm:"primaryKey"`
-	PostID     string      `json:"post_id" gorm:"index"`
-	UserID     string      `json:"user_id" gorm:"index"`
-	Content    string      `json:"content"`
-	ParentID   *string     `json:"parent_id,omitempty" gorm:"index"`
-	Metadata   JSON        `json:"metadata,omitempty" gorm:"type:jsonb"`
-	Attachment *Attachment `json:"attachment,omitempty" gorm:"-"` // Loaded separately
-	CreatedAt  time.Time   `json:"created_at"`
-	UpdatedAt  time.Time   `json:"updated_at"`
+	ID             string           `json:"id" gorm:"primaryKey"`
+	TenantID       string           `json:"-" gorm:"not null;default:'';index:idx_comments_tenant_post"`
+	PostID         string           `json:"post_id" gorm:"index:idx_comments_tenant_post"`
+	UserID         string           `json:"user_id" gorm:"index"`
+	Content        string           `json:"content"`
+	ParentID       *string          `json:"parent_id,omitempty" gorm:"index"`
+	Metadata       JSON             `json:"metadata,omitempty" gorm:"type:jsonb"`
+	Attachment     *Attachment      `json:"attachment,omitempty" gorm:"-"`            // Loaded separately
+	HiddenAt       *time.Time       `json:"hidden_at,omitempty"`                      // Set when a moderator hides the comment
+	ReplyCount     int64            `json:"reply_count" gorm:"->;not null;default:0"` // Maintained by the adapter, hidden replies included
+	ReactionCounts map[string]int64 `json:"reaction_counts" gorm:"-"`                 // By type, loaded separately
+	Reactions      *ReactionSummary `json:"reactions,omitempty" gorm:"-"`             // Loaded on request
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
 }
 
 // Reaction represents a user reaction to a post or comment
 type Reaction struct {
 	ID         string    `json:"id" gorm:"primaryKey"`
+	TenantID   string    `json:"-" gorm:"not null;default:'';uniqueIndex:idx_reactions_unique;index:idx_reactions_tenant_target"`
 	UserID     string    `json:"user_id" gorm:"uniqueIndex:idx_reactions_unique"`
-	TargetID   string    `json:"target_id" gorm:"uniqueIndex:idx_reactions_unique"`
-	TargetType string    `json:"target_type" gorm:"uniqueIndex:idx_reactions_unique"` // "post" or "comment"
-	Type       string    `json:"type" gorm:"uniqueIndex:idx_reactions_unique"`        // e.g., "like", "love", "haha"
-	CreatedAt  time.Time `json:"created_at"`
+	TargetID   string    `json:"target_id" gorm:"uniqueIndex:idx_reactions_unique;index:idx_reactions_tenant_target"`
+	TargetType string    `json:"target_type" gorm:"uniqueIndex:idx_reactions_unique;index:idx_reactions_tenant_target"` // "post" or "comment"
+	Type       string    `json:"type" gorm:"uniqueIndex:idx_reactions_unique;index:idx_reactions_tenant_target"`        // e.g., "like", "love", "haha"
+	CreatedAt  time.Time `json:"created_at" gorm:"index:idx_reactions_tenant_target"`
+}
+
+// ReactionType is a custom reaction type of a tenant, such as a custom emoji,
+// allowed in addition to the types of REACTION_TYPES
+type ReactionType struct {
+	ID        string    `json:"id" gorm:"primaryKey"`
+	TenantID  string    `json:"-" gorm:"not null;default:'';uniqueIndex:idx_reaction_types_tenant_name"`
+	Name      string    `json:"name" gorm:"uniqueIndex:idx_reaction_types_tenant_name"`
+	ImageURL  string    `json:"image_url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReactionCount is the number of reactions of a type to a post or comment,
+// maintained along with the reactions
+type ReactionCount struct {
+	TenantID   string `gorm:"primaryKey;default:''"`
+	TargetID   string `gorm:"primaryKey"`
+	TargetType string `gorm:"primaryKey"`
+	Type       string `gorm:"primaryKey"`
+	Count      int64  `gorm:"not null;default:0"`
+}
+
+// ReactionSummary aggregates the reactions to a post or comment
+type ReactionSummary struct {
+	Total int64                 `json:"total"`
+	Types []ReactionTypeSummary `json:"types"` // Most used first
+	Mine  []string              `json:"mine"`  // Types the requesting user reacted with
+}
+
+// ReactionTypeSummary aggregates the reactions of a type to a post or comment
+type ReactionTypeSummary struct {
+	Type        string   `json:"type"`
+	Count       int64    `json:"count"`
+	RecentUsers []string `json:"recent_users"` // Users who reacted most recently, newest first
 }
 
 // NewID generates a new UUID string
@@ -83,3 +130,14 @@ func (r *Reaction) BeforeCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+// BeforeCreate hook for reaction types to generate IDs
+func (t *ReactionType) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == "" {
+		t.ID = NewID()
+	}
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Moderation actions
+const (
+	ModerationDelete = "delete"
+	ModerationHide   = "hide"
+	ModerationUnhide = "unhide"
+)
+
+// ModerationAction records a moderator acting on another user's post,
+// comment or reaction: who did it, to what and why
+type ModerationAction struct {
+	ID          string    `json:"id" gorm:"primaryKey"`
+	TenantID    string    `json:"-" gorm:"not null;default:'';index:idx_moderation_actions_tenant_created"`
+	Action      string    `json:"action"`      // ModerationDelete, ModerationHide or ModerationUnhide
+	TargetType  string    `json:"target_type"` // "post", "comment" or "reaction"
+	TargetID    string    `json:"target_id"`
+	AuthorID    string    `json:"author_id"`    // User who created the content
+	ModeratorID string    `json:"moderator_id"` // User or API key that acted
+	Reason      string    `json:"reason,omitempty"`
+	CreatedAt   time.Time `json:"created_at" gorm:"index:idx_moderation_actions_tenant_created"`
+}
+
+// BeforeCreate hook for moderation actions to generate IDs
+func (m *ModerationAction) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == "" {
+		m.ID = NewID()
+	}
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now()
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// OutboxEvent is a hook event, stored in the same transaction as the change
+// it describes until it has been delivered. Each event is stored once for the
+// local handlers and WEBHOOK_URL, with the event's ID, and once for each
+// webhook subscription it matches. Events that fail every attempt are
+// dead-lettered, and kept until an admin replays them.
+type OutboxEvent struct {
+	ID             string     `json:"id" gorm:"primaryKey"`
+	TenantID       string     `json:"tenant_id" gorm:"not null;default:'';index:idx_outbox_events_dead_lettered,priority:1,where:dead_lettered_at IS NOT NULL;index:idx_outbox_events_tenant,priority:1,where:subscription_id = ''"`
+	SubscriptionID string     `json:"subscription_id,omitempty" gorm:"not null;default:''"` // Empty for the local handlers and WEBHOOK_URL
+	Type           string     `json:"type"`
+	Payload        string     `json:"payload" gorm:"type:text"` // The JSON encoded hooks.Event
+	Attempts       int        `json:"attempts" gorm:"not null;default:0"`
+	LastError      string     `json:"last_error,omitempty"`
+	AvailableAt    time.Time  `json:"available_at" gorm:"index:idx_outbox_events_pending,where:delivered_at IS NULL AND dead_lettered_at IS NULL"` // When it may next be claimed for delivery
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty" gorm:"index:idx_outbox_events_delivered"`
+	DeadLetteredAt *time.Time `json:"dead_lettered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"index:idx_outbox_events_dead_lettered,priority:2;index:idx_outbox_events_tenant,priority:2"`
+}
+
+// BeforeCreate hook for outbox events to generate IDs
+func (e *OutboxEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == "" {
+		e.ID = NewID()
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	if e.AvailableAt.IsZero() {
+		e.AvailableAt = e.CreatedAt
+	}
+	return nil
+}
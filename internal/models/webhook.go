@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// WebhookSubscription is an endpoint of a tenant that receives the hook
+// events matching its filters, signed with its secrets
+type WebhookSubscription struct {
+	ID             string       `json:"id" gorm:"primaryKey"`
+	TenantID       string       `json:"-" gorm:"not null;default:'';index"`
+	URL            string       `json:"url" gorm:"not null"`
+	EventTypes     StringList   `json:"event_types" gorm:"type:text"` // Every event type if empty
+	PostIDs        StringList   `json:"post_ids" gorm:"type:text"`    // Events about any post if empty
+	UserIDs        StringList   `json:"user_ids" gorm:"type:text"`    // Events of any user if empty
+	Enabled        bool         `json:"enabled" gorm:"not null"`
+	Secret         string       `json:"-"`
+	PreviousSecret string       `json:"-"` // Also signs events while a secret is rotated
+	Stats          WebhookStats `json:"stats" gorm:"embedded"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// WebhookStats counts the deliveries to a webhook subscription. They are
+// only written by recording deliveries.
+type WebhookStats struct {
+	DeliveredCount  int64      `json:"delivered_count" gorm:"->;not null;default:0"`
+	FailedCount     int64      `json:"failed_count" gorm:"->;not null;default:0"` // Failed attempts, including retried ones
+	LastDeliveredAt *time.Time `json:"last_delivered_at,omitempty" gorm:"->"`
+	LastFailedAt    *time.Time `json:"last_failed_at,omitempty" gorm:"->"`
+	LastError       string     `json:"last_error,omitempty" gorm:"->"`
+}
+
+// BeforeCreate hook for webhook subscriptions to generate IDs
+func (s *WebhookSubscription) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == "" {
+		s.ID = NewID()
+	}
+	now := time.Now()
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = now
+	}
+	if s.UpdatedAt.IsZero() {
+		s.UpdatedAt = now
+	}
+	return nil
+}
+
+// WebhookDelivery is an attempt to send a hook event to a webhook. Attempts
+// are kept for HOOKS_RETENTION_HOURS.
+type WebhookDelivery struct {
+	ID             string    `json:"id" gorm:"primaryKey"`
+	TenantID       string    `json:"-" gorm:"not null;default:'';index:idx_webhook_deliveries_tenant,priority:1"`
+	EventID        string    `json:"event_id" gorm:"not null;index"`
+	EventType      string    `json:"event_type"`
+	SubscriptionID string    `json:"subscription_id,omitempty" gorm:"not null;default:'';index:idx_webhook_deliveries_subscription,priority:1"` // Empty for WEBHOOK_URL
+	URL            string    `json:"url"`
+	Attempt        int       `json:"attempt"`                             // Of the event's delivery to the webhook, counting from 1
+	StatusCode     int       `json:"status_code,omitempty"`               // Of the response, if any
+	LatencyMS      int64     `json:"latency_ms"`                          // From sending the request to receiving the response
+	Response       string    `json:"response,omitempty" gorm:"type:text"` // The start of the response body
+	Error          string    `json:"error,omitempty"`                     // Why the attempt failed, empty if it succeeded
+	CreatedAt      time.Time `json:"created_at" gorm:"index;index:idx_webhook_deliveries_tenant,priority:2;index:idx_webhook_deliveries_subscription,priority:2"`
+}
+
+// BeforeCreate hook for webhook deliveries to generate IDs
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == "" {
+		d.ID = NewID()
+	}
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = time.Now()
+	}
+	return nil
+}